@@ -0,0 +1,194 @@
+package xtrieve
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"time"
+)
+
+// Stats holds aggregates of one field over a set of records. Sum is only
+// accumulated for numeric fields; Min and Max work for numbers, strings,
+// dates and times. As in SQL, null values of a Nullable field are left
+// out of every aggregate.
+type Stats struct {
+	// Count is the number of values that are not null
+	Count int64
+	Sum   float64
+	// Exact is the exact sum of a scaled field decoding to FixedPoint,
+	// such as MONEY; Sum is then its nearest float64
+	Exact FixedPoint
+	Min   any
+	Max   any
+}
+
+// Aggregate scans records and computes Count, Sum, Min and Max of a field.
+// Pass a Range iterator to aggregate over a key range, or a filtered
+// iterator to reduce the records considered.
+func Aggregate(it RecordIterator, schema *Schema, field string) (*Stats, error) {
+	stats := &Stats{}
+	for it.Next() {
+		v, err := schema.Get(it.Record(), field)
+		if err != nil {
+			return nil, err
+		}
+		if err := stats.add(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GroupBy scans records and computes the aggregates of field for every
+// distinct value of groupField
+func GroupBy(it RecordIterator, schema *Schema, groupField, field string) (map[any]*Stats, error) {
+	groups := make(map[any]*Stats)
+	for it.Next() {
+		g, err := schema.Get(it.Record(), groupField)
+		if err != nil {
+			return nil, err
+		}
+		if raw, ok := g.([]byte); ok {
+			g = string(raw) // byte slices are not valid map keys
+		}
+		v, err := schema.Get(it.Record(), field)
+		if err != nil {
+			return nil, err
+		}
+
+		stats := groups[g]
+		if stats == nil {
+			stats = &Stats{}
+			groups[g] = stats
+		}
+		if err := stats.add(v); err != nil {
+			return nil, err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Count counts the records of an iterator
+func Count(it RecordIterator) (int64, error) {
+	var n int64
+	for it.Next() {
+		n++
+	}
+	return n, it.Err()
+}
+
+// Sum adds up a numeric field over all records
+func Sum(it RecordIterator, schema *Schema, field string) (float64, error) {
+	stats, err := Aggregate(it, schema, field)
+	if err != nil {
+		return 0, err
+	}
+	return stats.Sum, nil
+}
+
+// Min returns the smallest value of a field, or nil if there are no records
+func Min(it RecordIterator, schema *Schema, field string) (any, error) {
+	stats, err := Aggregate(it, schema, field)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Min, nil
+}
+
+// Max returns the largest value of a field, or nil if there are no records
+func Max(it RecordIterator, schema *Schema, field string) (any, error) {
+	stats, err := Aggregate(it, schema, field)
+	if err != nil {
+		return nil, err
+	}
+	return stats.Max, nil
+}
+
+// add folds a decoded field value into the aggregates, skipping nulls
+func (s *Stats) add(v any) error {
+	if v == nil {
+		return nil
+	}
+	s.Count++
+	if x, ok := v.(FixedPoint); ok {
+		sum, err := s.Exact.Add(x)
+		if err != nil {
+			return fmt.Errorf("sum: %w", err)
+		}
+		s.Exact, s.Sum = sum, sum.Float64()
+	} else if x, ok := toFloat64(v); ok {
+		s.Sum += x
+	}
+	if s.Min == nil {
+		s.Min, s.Max = v, v
+		return nil
+	}
+
+	c, err := compareValues(v, s.Min)
+	if err != nil {
+		return err
+	}
+	if c < 0 {
+		s.Min = v
+	}
+	if c, _ = compareValues(v, s.Max); c > 0 {
+		s.Max = v
+	}
+	return nil
+}
+
+// compareValues orders two decoded field values of the same type
+func compareValues(a, b any) (int, error) {
+	switch x := a.(type) {
+	case int64:
+		if y, ok := b.(int64); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case uint64:
+		if y, ok := b.(uint64); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case float64:
+		if y, ok := b.(float64); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case FixedPoint:
+		if y, ok := b.(FixedPoint); ok {
+			return x.Cmp(y), nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	case time.Duration:
+		if y, ok := b.(time.Duration); ok {
+			return cmp.Compare(x, y), nil
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return cmp.Compare(boolInt(x), boolInt(y)), nil
+		}
+	case []byte:
+		if y, ok := b.([]byte); ok {
+			return bytes.Compare(x, y), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T with %T", a, b)
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package xtrieve
+
+import (
+	"errors"
+	"testing"
+)
+
+// recordSlice iterates over records held in memory
+type recordSlice struct {
+	records [][]byte
+	i       int
+}
+
+func (r *recordSlice) Next() bool {
+	r.i++
+	return r.i <= len(r.records)
+}
+
+func (r *recordSlice) Record() []byte { return r.records[r.i-1] }
+func (r *recordSlice) Key() []byte    { return nil }
+func (r *recordSlice) Err() error     { return nil }
+
+func encodeAll(t *testing.T, s *Schema, values ...map[string]any) *recordSlice {
+	t.Helper()
+	it := &recordSlice{}
+	for _, v := range values {
+		record, err := s.Encode(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		it.records = append(it.records, record)
+	}
+	return it
+}
+
+func TestAggregateMoney(t *testing.T) {
+	s, err := NewSchema(
+		Field{Name: "region", Length: 4, Type: KeyTypeString},
+		Field{Name: "balance", Offset: 4, Length: 8, Type: KeyTypeMoney},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []map[string]any{
+		{"region": "EU", "balance": NewFixedPoint(1010, 2)},
+		{"region": "US", "balance": NewFixedPoint(-250, 2)},
+		{"region": "EU", "balance": NewFixedPoint(20, 2)},
+	}
+
+	stats, err := Aggregate(encodeAll(t, s, values...), s, "balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 3 || stats.Exact != NewFixedPoint(780, 2) || stats.Sum != 7.8 {
+		t.Errorf("count %d, exact %v, sum %v; want 3, 7.80, 7.8", stats.Count, stats.Exact, stats.Sum)
+	}
+	if stats.Min != NewFixedPoint(-250, 2) || stats.Max != NewFixedPoint(1010, 2) {
+		t.Errorf("min %v, max %v; want -2.50, 10.10", stats.Min, stats.Max)
+	}
+
+	groups, err := GroupBy(encodeAll(t, s, values...), s, "region", "balance")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eu := groups["EU"]; eu == nil || eu.Exact != NewFixedPoint(1030, 2) {
+		t.Errorf("EU = %+v, want a sum of 10.30", eu)
+	}
+
+	most, err := Max(encodeAll(t, s, values...), s, "balance")
+	if err != nil || most != NewFixedPoint(1010, 2) {
+		t.Errorf("Max = %v, %v, want 10.10", most, err)
+	}
+}
+
+func TestAggregateOverflow(t *testing.T) {
+	s, err := NewSchema(Field{Name: "amount", Length: 10, Type: KeyTypeDecimal, Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	huge := NewFixedPoint(9_000_000_000_000_000_000, 2)
+	_, err = Aggregate(encodeAll(t, s, map[string]any{"amount": huge}, map[string]any{"amount": huge}), s, "amount")
+	if !errors.Is(err, ErrFixedPointOverflow) {
+		t.Errorf("Aggregate = %v, want ErrFixedPointOverflow", err)
+	}
+}
+
+func TestAggregateNulls(t *testing.T) {
+	s, err := NewSchema(Field{Name: "score", Offset: 1, Length: 4, Type: KeyTypeInteger, Nullable: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := []map[string]any{
+		{"score": nil},
+		{"score": int64(7)},
+		{"score": nil},
+		{"score": int64(-2)},
+	}
+	stats, err := Aggregate(encodeAll(t, s, values...), s, "score")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Count != 2 || stats.Sum != 5 || stats.Min != int64(-2) || stats.Max != int64(7) {
+		t.Errorf("stats = %+v, want count 2, sum 5, min -2, max 7", stats)
+	}
+
+	stats, err = Aggregate(encodeAll(t, s, values[0]), s, "score")
+	if err != nil || stats.Count != 0 || stats.Min != nil {
+		t.Errorf("stats of nulls only = %+v, %v, want none", stats, err)
+	}
+}
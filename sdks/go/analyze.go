@@ -0,0 +1,250 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// KeyAnalysis is the result of AnalyzeKeys
+type KeyAnalysis struct {
+	Records uint64
+	Keys    []KeyDistribution
+	// Sampled is set when the keys were sampled with percentage
+	// positioning; otherwise every key was read and the figures are exact
+	Sampled bool
+	Taken   time.Time
+}
+
+// KeyDistribution describes the values of one key
+type KeyDistribution struct {
+	KeyNumber int16
+	// Distinct is the number of distinct key values
+	Distinct uint64
+	// Min and Max are the first and last key values in key order
+	Min, Max []byte
+	// Top is the most common key value among the records read and
+	// TopShare the fraction of the file estimated to hold it
+	Top      []byte
+	TopShare float64
+	// Skew is TopShare over the share every value would have if the
+	// records were spread evenly: about 1 for an even key, far more for a
+	// key with a hot spot
+	Skew float64
+}
+
+// AnalyzeKeys estimates the distribution of every key of f, e.g. to decide
+// which keys a file needs or to feed the query planner through
+// Statistics. For each key it positions at probes evenly spaced
+// percentages of the index with GetByPercentage and reads depth records
+// from each: distinct values are estimated from how often neighbouring
+// keys differ, skew from how often the probed records share a value.
+// Files with no more than probes*depth records, and servers without
+// percentage positioning, are read in full instead. AnalyzeKeys moves the
+// file's position.
+func AnalyzeKeys(ctx context.Context, f *File, probes, depth int) (*KeyAnalysis, error) {
+	probes, depth = max(probes, 1), max(depth, 2)
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	a := &KeyAnalysis{Records: stat.NumRecords, Sampled: stat.NumRecords > uint64(probes*depth), Taken: time.Now()}
+	for n := int16(0); f.KeySegments(n) != nil; n++ {
+		var d *KeyDistribution
+		if a.Sampled {
+			d, err = sampleKey(ctx, f, n, stat.NumRecords, probes, depth)
+			if IsStatus(err, StatusInvalidOperation) {
+				a.Sampled = false
+			}
+		}
+		if !a.Sampled {
+			d, err = scanKey(ctx, f, n)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", n, err)
+		}
+		a.Keys = append(a.Keys, *d)
+	}
+	return a, nil
+}
+
+// keyCounter tallies the key values read from a key
+type keyCounter struct {
+	f         *File
+	keyNumber int16
+	counts    map[string]int
+	total     int
+	// pairs and changes count neighbouring records read and how many of
+	// them differ in key
+	pairs, changes int
+}
+
+// sampleKey samples one key at probes positions
+func sampleKey(ctx context.Context, f *File, keyNumber int16, records uint64, probes, depth int) (*KeyDistribution, error) {
+	d, err := keyBounds(f, keyNumber)
+	if err != nil || d.Min == nil {
+		return d, err
+	}
+	c := &keyCounter{f: f, keyNumber: keyNumber, counts: make(map[string]int)}
+	for i := 0; i < probes; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Probe the middle of each of probes equal slices
+		pct := (2*i + 1) * MaxPercentage / (2 * probes)
+		resp, err := f.getByPercentage(pct, keyNumber)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(OpGetByPercentage, resp); err != nil {
+			return nil, err
+		}
+		// Only the probed record counts towards the shares: probes are
+		// spread evenly over the records, the runs after them are not
+		c.counts[string(resp.KeyBuffer)]++
+		c.total++
+		prev := bytes.Clone(resp.KeyBuffer)
+		for j := 1; j < depth; j++ {
+			resp, err := f.GetNext(keyNumber)
+			if err != nil {
+				return nil, err
+			}
+			if resp.StatusCode == StatusEndOfFile {
+				break
+			}
+			if err := checkStatus(OpGetNext, resp); err != nil {
+				return nil, err
+			}
+			c.pair(prev, resp.KeyBuffer)
+			prev = append(prev[:0], resp.KeyBuffer...)
+		}
+	}
+
+	// Each change between neighbours starts a new value
+	d.Distinct = uint64(len(c.counts))
+	if c.pairs > 0 {
+		d.Distinct = max(1, uint64(float64(c.changes)/float64(c.pairs)*float64(records-1))+1)
+	}
+	c.top(d)
+	return d, nil
+}
+
+// scanKey reads every key value of one key
+func scanKey(ctx context.Context, f *File, keyNumber int16) (*KeyDistribution, error) {
+	d := &KeyDistribution{KeyNumber: keyNumber}
+	c := &keyCounter{f: f, keyNumber: keyNumber, counts: make(map[string]int)}
+	var prev []byte
+	it := f.Scan(keyNumber)
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := it.Key()
+		c.counts[string(key)]++
+		c.total++
+		if prev == nil {
+			d.Min = bytes.Clone(key)
+		} else {
+			c.pair(prev, key)
+		}
+		prev = append(prev[:0], key...)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		d.Max = bytes.Clone(prev)
+	}
+	d.Distinct = uint64(c.changes)
+	if c.total > 0 {
+		d.Distinct++
+	}
+	c.top(d)
+	return d, nil
+}
+
+// keyBounds reads the first and last key values of a key
+func keyBounds(f *File, keyNumber int16) (*KeyDistribution, error) {
+	d := &KeyDistribution{KeyNumber: keyNumber}
+	for _, op := range []uint16{OpGetFirst, OpGetLast} {
+		resp, err := f.Get(op, nil, keyNumber)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == StatusEndOfFile {
+			return d, nil
+		}
+		if err := checkStatus(op, resp); err != nil {
+			return nil, err
+		}
+		if op == OpGetFirst {
+			d.Min = bytes.Clone(resp.KeyBuffer)
+		} else {
+			d.Max = bytes.Clone(resp.KeyBuffer)
+		}
+	}
+	return d, nil
+}
+
+// pair counts two neighbouring keys
+func (c *keyCounter) pair(a, b []byte) {
+	c.pairs++
+	if c.f.CompareKeys(c.keyNumber, a, b) != 0 {
+		c.changes++
+	}
+}
+
+// top fills in the most common value and the skew
+func (c *keyCounter) top(d *KeyDistribution) {
+	n := 0
+	for key, count := range c.counts {
+		if count > n || count == n && key < string(d.Top) {
+			d.Top, n = []byte(key), count
+		}
+	}
+	if c.total == 0 || d.Distinct == 0 {
+		return
+	}
+	d.TopShare = float64(n) / float64(c.total)
+	d.Skew = d.TopShare * float64(d.Distinct)
+}
+
+// Statistics returns the analysis as statistics for File.SetStatistics
+func (a *KeyAnalysis) Statistics() *FileStatistics {
+	s := &FileStatistics{Records: a.Records, Source: "analysis", Taken: a.Taken}
+	for _, d := range a.Keys {
+		s.Keys = append(s.Keys, KeyStatistics{Distinct: d.Distinct})
+	}
+	return s
+}
+
+// WriteReport writes the analysis as a table, one line per key
+func (a *KeyAnalysis) WriteReport(w io.Writer) error {
+	how := "read in full"
+	if a.Sampled {
+		how = "sampled"
+	}
+	if _, err := fmt.Fprintf(w, "%d records, %s\n%-4s %12s %9s %7s  %-20s %-20s %s\n",
+		a.Records, how, "key", "distinct", "top", "skew", "min", "max", "top value"); err != nil {
+		return err
+	}
+	for _, d := range a.Keys {
+		if _, err := fmt.Fprintf(w, "%-4d %12d %8.2f%% %7.1f  %-20s %-20s %s\n",
+			d.KeyNumber, d.Distinct, 100*d.TopShare, d.Skew, reportKey(d.Min), reportKey(d.Max), reportKey(d.Top)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportKey formats a key value for a report, quoted without its padding
+func reportKey(key []byte) string {
+	s := fmt.Sprintf("%q", bytes.TrimRight(key, " \x00"))
+	if len(s) > 20 {
+		s = s[:17] + "..."
+	}
+	return s
+}
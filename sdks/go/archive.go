@@ -0,0 +1,177 @@
+package xtrieve
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+)
+
+// archiveManifest is the name of the manifest entry of an archive
+const archiveManifest = "manifest.json"
+
+// ArchiveFile describes one file of an archive
+type ArchiveFile struct {
+	// Path is the path the file was archived from
+	Path string `json:"path"`
+	// Entry is the archive entry holding the records
+	Entry string   `json:"entry"`
+	Spec  FileSpec `json:"spec"`
+	// Records and Checksum are the number of records and their
+	// RecordChecksum, which Restore verifies
+	Records  uint64 `json:"records"`
+	Checksum string `json:"checksum"`
+}
+
+// RecordChecksum is a checksum of a set of records that does not depend
+// on their order: the lane-wise sum of their SHA-256 hashes. Physical
+// order changes when a file is rebuilt, so a restored file is compared
+// with its archive by count and checksum rather than record by record.
+type RecordChecksum [4]uint64
+
+// Add adds a record to the checksum
+func (c *RecordChecksum) Add(record []byte) {
+	sum := sha256.Sum256(record)
+	for i := range c {
+		c[i] += binary.LittleEndian.Uint64(sum[8*i:])
+	}
+}
+
+// String returns the checksum in hex
+func (c RecordChecksum) String() string {
+	var b [32]byte
+	for i, lane := range c {
+		binary.LittleEndian.PutUint64(b[8*i:], lane)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// WriteArchive writes a logical backup of files to w: a zip archive with
+// each file's records, read in physical order, and a manifest holding the
+// files' specs, record counts and checksums. Unlike BackupFile it works
+// over the network and the files may stay open, but records written
+// during the archive may or may not be included. It returns the manifest.
+func WriteArchive(ctx context.Context, w io.Writer, files []*File, progress Progress) ([]ArchiveFile, error) {
+	zw := zip.NewWriter(w)
+	tracker := newProgressTracker(progress, 0)
+	manifest := make([]ArchiveFile, 0, len(files))
+	for i, f := range files {
+		stat, err := f.Stat()
+		if err != nil {
+			return manifest, fmt.Errorf("archive %s: %w", f.Path(), err)
+		}
+		af := ArchiveFile{
+			Path:  f.Path(),
+			Entry: fmt.Sprintf("%03d-%s.rec", i+1, filepath.Base(f.Path())),
+			Spec:  *stat.Spec(),
+		}
+		if err := archiveRecords(ctx, zw, f, &af, tracker); err != nil {
+			return manifest, fmt.Errorf("archive %s: %w", f.Path(), err)
+		}
+		manifest = append(manifest, af)
+	}
+
+	mw, err := zw.Create(archiveManifest)
+	if err != nil {
+		return manifest, err
+	}
+	enc := json.NewEncoder(mw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return manifest, err
+	}
+	if err := zw.Close(); err != nil {
+		return manifest, err
+	}
+	tracker.done()
+	return manifest, nil
+}
+
+// archiveRecords writes the records of f to the entry of af, each
+// preceded by its 4-byte length, and fills in the count and checksum
+func archiveRecords(ctx context.Context, zw *zip.Writer, f *File, af *ArchiveFile, tracker *progressTracker) error {
+	ew, err := zw.Create(af.Entry)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(ew)
+	var sum RecordChecksum
+	it := f.ScanPhysical()
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rec := it.Record()
+		if err := binary.Write(bw, binary.LittleEndian, uint32(len(rec))); err != nil {
+			return err
+		}
+		if _, err := bw.Write(rec); err != nil {
+			return err
+		}
+		sum.Add(rec)
+		af.Records++
+		tracker.add(1, len(rec))
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	af.Checksum = sum.String()
+	return bw.Flush()
+}
+
+// ReadArchiveManifest returns the manifest of an archive written by
+// WriteArchive
+func ReadArchiveManifest(r io.ReaderAt, size int64) ([]ArchiveFile, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+	return readManifest(zr)
+}
+
+func readManifest(zr *zip.Reader) ([]ArchiveFile, error) {
+	mr, err := zr.Open(archiveManifest)
+	if err != nil {
+		return nil, fmt.Errorf("archive: %w", err)
+	}
+	defer mr.Close()
+	var manifest []ArchiveFile
+	if err := json.NewDecoder(mr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("archive manifest: %w", err)
+	}
+	return manifest, nil
+}
+
+// archiveReader reads the records of an archive entry
+type archiveReader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// next returns the next record, valid until the following call, or
+// io.EOF after the last one
+func (ar *archiveReader) next() ([]byte, error) {
+	var n uint32
+	if err := binary.Read(ar.r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	if cap(ar.buf) < int(n) {
+		ar.buf = make([]byte, n)
+	}
+	ar.buf = ar.buf[:n]
+	if _, err := io.ReadFull(ar.r, ar.buf); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return ar.buf, nil
+}
@@ -0,0 +1,223 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// AuditImage holds the before and after images of one Update or Delete
+type AuditImage struct {
+	Time time.Time `json:"time"`
+	File string    `json:"file"`
+	// Op is OpUpdate or OpDelete
+	Op uint16 `json:"op"`
+	// Key is the record's value of AuditConfig.KeyNumber before the write
+	KeyNumber int16  `json:"key_number"`
+	Key       []byte `json:"key,omitempty"`
+	// Before is the stored record and After the record written, nil for a
+	// delete
+	Before []byte `json:"before"`
+	After  []byte `json:"after,omitempty"`
+	// Changes lists what an update changed, see DiffRecords
+	Changes []FieldChange `json:"changes,omitempty"`
+	// Context is the file's context during the write, see
+	// File.SetContext, e.g. for the sink to record the user
+	Context context.Context `json:"-"`
+}
+
+// FieldChange is one difference between two records. With a schema it
+// names a field and holds its decoded values; encrypted fields hold their
+// stored bytes, never decrypted. Without a schema it holds a run of
+// differing bytes at Offset.
+type FieldChange struct {
+	Field  string `json:"field,omitempty"`
+	Offset int    `json:"offset"`
+	Before any    `json:"before"`
+	After  any    `json:"after"`
+}
+
+// AuditConfig controls File.Audit
+type AuditConfig struct {
+	// KeyNumber is the key the stored record is re-read under and whose
+	// value identifies it in AuditImage.Key
+	KeyNumber int16
+	// Schema, if set, diffs updates field by field; otherwise by byte runs
+	Schema *Schema
+	// OnImage receives the images once the server has confirmed the
+	// write, e.g. AuditHistory.Write. An error is returned by the write,
+	// which in a transaction can then be aborted so that no change goes
+	// unaudited.
+	OnImage func(AuditImage) error
+}
+
+// Audit captures the before and after images of every Update and Delete
+// of f from now on, for tables whose changes must be kept with their
+// prior content. Before each write the stored record is re-read, which
+// costs two operations per write. The re-read takes no lock, since the
+// server only releases record locks when a transaction ends: run the
+// writes in a transaction, where the server keeps other clients off the
+// records changed, for the images to be exactly those the writes replaced.
+// Unlike a ChangeLog, Audit sees only updates and deletes.
+func (f *File) Audit(cfg AuditConfig) {
+	var before []byte
+	f.Before(func(f *File, op uint16, record []byte) error {
+		before = nil
+		if op == OpInsert {
+			return nil
+		}
+		var err error
+		before, err = storedRecord(f, cfg.KeyNumber)
+		return err
+	})
+	f.After(func(f *File, op uint16, record []byte) error {
+		if op == OpInsert || before == nil {
+			return nil
+		}
+		img := AuditImage{
+			Time:      time.Now(),
+			File:      f.Path(),
+			Op:        op,
+			KeyNumber: cfg.KeyNumber,
+			Key:       ExtractKey(f.KeySegments(cfg.KeyNumber), before),
+			Before:    before,
+			Context:   f.Context(),
+		}
+		before = nil
+		if op == OpUpdate {
+			img.After = bytes.Clone(record)
+			changes, err := DiffRecords(cfg.Schema, img.Before, img.After)
+			if err != nil {
+				return err
+			}
+			img.Changes = changes
+		}
+		if cfg.OnImage == nil {
+			return nil
+		}
+		return cfg.OnImage(img)
+	})
+}
+
+// storedRecord re-reads the record at the file's current position,
+// leaving the position as it was
+func storedRecord(f *File, keyNumber int16) ([]byte, error) {
+	snapshot := f.SnapshotPosition()
+	defer f.RestorePosition(snapshot)
+	pos, err := f.GetPosition()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, max(8, f.recordLength))
+	binary.LittleEndian.PutUint64(data, pos)
+	resp, err := f.exec(&Request{
+		Operation:  OpGetDirect,
+		DataBuffer: data,
+		KeyNumber:  keyNumber,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(OpGetDirect, resp); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(resp.DataBuffer), nil
+}
+
+// DiffRecords lists the differences between two images of a record: the
+// fields of schema whose values differ, or without a schema the runs of
+// differing bytes, a length change counting as a run at the end of the
+// shorter record
+func DiffRecords(schema *Schema, before, after []byte) ([]FieldChange, error) {
+	if schema == nil {
+		return diffBytes(before, after), nil
+	}
+	var changes []FieldChange
+	for _, f := range schema.Fields {
+		if f.Encrypted {
+			b, errB := f.bytes(before)
+			a, errA := f.bytes(after)
+			if errB != nil || errA != nil {
+				return nil, fmt.Errorf("xtrieve: diff: field %s beyond the record", f.Name)
+			}
+			if !bytes.Equal(b, a) {
+				changes = append(changes, FieldChange{Field: f.Name, Offset: f.Offset, Before: bytes.Clone(b), After: bytes.Clone(a)})
+			}
+			continue
+		}
+		b, err := f.Decode(before)
+		if err != nil {
+			return nil, fmt.Errorf("xtrieve: diff before image: %w", err)
+		}
+		a, err := f.Decode(after)
+		if err != nil {
+			return nil, fmt.Errorf("xtrieve: diff after image: %w", err)
+		}
+		if !reflect.DeepEqual(b, a) {
+			changes = append(changes, FieldChange{Field: f.Name, Offset: f.Offset, Before: b, After: a})
+		}
+	}
+	return changes, nil
+}
+
+// diffBytes returns the runs of differing bytes of two records
+func diffBytes(before, after []byte) []FieldChange {
+	var changes []FieldChange
+	n := min(len(before), len(after))
+	for i := 0; i < n; {
+		if before[i] == after[i] {
+			i++
+			continue
+		}
+		start := i
+		for i < n && before[i] != after[i] {
+			i++
+		}
+		changes = append(changes, FieldChange{Offset: start, Before: bytes.Clone(before[start:i]), After: bytes.Clone(after[start:i])})
+	}
+	if len(before) != len(after) {
+		changes = append(changes, FieldChange{Offset: n, Before: bytes.Clone(before[n:]), After: bytes.Clone(after[n:])})
+	}
+	return changes
+}
+
+// AuditHistory appends audit images to a history file as JSON lines. It
+// is safe for concurrent use, so files on several connections can share
+// one.
+//
+//	f, err := os.OpenFile("payroll.audit", os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+//	history := xtrieve.NewAuditHistory(f)
+//	payroll.Audit(xtrieve.AuditConfig{Schema: schema, OnImage: history.Write})
+type AuditHistory struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewAuditHistory returns a history writing to w
+func NewAuditHistory(w io.Writer) *AuditHistory {
+	return &AuditHistory{w: w}
+}
+
+// Write appends one image, syncing w if it has a Sync method, such as an
+// *os.File
+func (h *AuditHistory) Write(img AuditImage) error {
+	line, err := json.Marshal(img)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, err := h.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("audit history: %w", err)
+	}
+	if s, ok := h.w.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
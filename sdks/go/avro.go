@@ -0,0 +1,614 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"time"
+)
+
+// AvroSchema is an Avro record schema whose fields map by name to the
+// fields of a Schema. Only flat records are supported: fields are
+// primitives, fixed, enums, logical types or a union of null and one of
+// these.
+type AvroSchema struct {
+	Name      string
+	Namespace string
+	Fields    []AvroField
+}
+
+// AvroField is a field of an AvroSchema
+type AvroField struct {
+	Name string
+	Type AvroType
+}
+
+// AvroType is the type of an AvroField. Type is string, bytes, int, long,
+// float, double, boolean, fixed or enum; LogicalType is empty or date,
+// time-millis, time-micros, timestamp-millis, timestamp-micros or decimal.
+type AvroType struct {
+	Type        string
+	LogicalType string
+	// Precision and Scale describe a decimal
+	Precision int
+	Scale     int
+	// Name and Size describe a fixed, Name and Symbols an enum
+	Name    string
+	Size    int
+	Symbols []string
+	// Nullable types are a union with null, which comes first unless
+	// NullLast is set
+	Nullable bool
+	NullLast bool
+}
+
+// avroTypeJSON is the object form of an Avro type
+type avroTypeJSON struct {
+	Type        string   `json:"type"`
+	LogicalType string   `json:"logicalType,omitempty"`
+	Precision   int      `json:"precision,omitempty"`
+	Scale       int      `json:"scale,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Size        int      `json:"size,omitempty"`
+	Symbols     []string `json:"symbols,omitempty"`
+}
+
+type avroSchemaJSON struct {
+	Type      string      `json:"type"`
+	Name      string      `json:"name"`
+	Namespace string      `json:"namespace,omitempty"`
+	Fields    []avroField `json:"fields"`
+}
+
+type avroField struct {
+	Name string   `json:"name"`
+	Type AvroType `json:"type"`
+}
+
+// ParseAvroSchema parses an Avro record schema (.avsc)
+func ParseAvroSchema(data []byte) (*AvroSchema, error) {
+	var raw avroSchemaJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("avro schema: %w", err)
+	}
+	if raw.Type != "record" {
+		return nil, fmt.Errorf("avro schema: type %q is not a record", raw.Type)
+	}
+	a := &AvroSchema{Name: raw.Name, Namespace: raw.Namespace}
+	for _, f := range raw.Fields {
+		a.Fields = append(a.Fields, AvroField(f))
+	}
+	return a, nil
+}
+
+// MarshalJSON writes the schema in Avro's JSON form
+func (a *AvroSchema) MarshalJSON() ([]byte, error) {
+	raw := avroSchemaJSON{Type: "record", Name: a.Name, Namespace: a.Namespace, Fields: []avroField{}}
+	for _, f := range a.Fields {
+		raw.Fields = append(raw.Fields, avroField(f))
+	}
+	return json.Marshal(raw)
+}
+
+// UnmarshalJSON parses a type name, a type object or a union with null
+func (t *AvroType) UnmarshalJSON(data []byte) error {
+	var name string
+	if json.Unmarshal(data, &name) == nil {
+		*t = AvroType{Type: name}
+		return t.check()
+	}
+
+	var union []json.RawMessage
+	if json.Unmarshal(data, &union) == nil {
+		null := slices.IndexFunc(union, func(u json.RawMessage) bool {
+			return string(bytes.TrimSpace(u)) == `"null"`
+		})
+		if len(union) != 2 || null < 0 {
+			return errors.New("avro schema: only unions of null and one type are supported")
+		}
+		if err := t.UnmarshalJSON(union[1-null]); err != nil {
+			return err
+		}
+		if t.Nullable {
+			return errors.New("avro schema: nested unions are not supported")
+		}
+		t.Nullable, t.NullLast = true, null == 1
+		return nil
+	}
+
+	var obj avroTypeJSON
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return fmt.Errorf("avro schema: %w", err)
+	}
+	*t = AvroType{
+		Type: obj.Type, LogicalType: obj.LogicalType, Precision: obj.Precision,
+		Scale: obj.Scale, Name: obj.Name, Size: obj.Size, Symbols: obj.Symbols,
+	}
+	return t.check()
+}
+
+// MarshalJSON writes the type in Avro's JSON form
+func (t AvroType) MarshalJSON() ([]byte, error) {
+	var base any = t.Type
+	if t.LogicalType != "" || t.Type == "fixed" || t.Type == "enum" {
+		base = avroTypeJSON{
+			Type: t.Type, LogicalType: t.LogicalType, Precision: t.Precision,
+			Scale: t.Scale, Name: t.Name, Size: t.Size, Symbols: t.Symbols,
+		}
+	}
+	switch {
+	case !t.Nullable:
+		return json.Marshal(base)
+	case t.NullLast:
+		return json.Marshal([]any{base, "null"})
+	}
+	return json.Marshal([]any{"null", base})
+}
+
+func (t *AvroType) check() error {
+	switch t.Type {
+	case "string", "bytes", "int", "long", "float", "double", "boolean", "fixed", "enum":
+		return nil
+	}
+	return fmt.Errorf("avro schema: unsupported type %q", t.Type)
+}
+
+// AvroSchema derives an Avro record schema from the schema. Dates map to
+// nullable dates, so that empty dates become null, times to time-millis,
+// DECIMAL and MONEY fields to decimals (MONEY with scale 2), untyped
+// fields to bytes and Nullable fields to unions with null.
+func (s *Schema) AvroSchema(name string) *AvroSchema {
+	a := &AvroSchema{Name: name}
+	for _, f := range s.Fields {
+		if f.Encrypted {
+			f = f.plain()
+		}
+		var t AvroType
+		switch f.Type {
+		case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+			t.Type = "string"
+		case KeyTypeInteger, KeyTypeAutoincrement, KeyTypeUnsignedBinary:
+			t.Type = "long"
+			if f.Length < 4 || f.Length == 4 && f.Type != KeyTypeUnsignedBinary {
+				t.Type = "int"
+			}
+		case KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS:
+			t.Type = "long"
+			if f.Scale > 0 {
+				t = AvroType{Type: "bytes", LogicalType: "decimal", Precision: f.digits(), Scale: f.Scale}
+			}
+		case KeyTypeFloat, KeyTypeBfloat:
+			t.Type = "double"
+			if f.Length == 4 {
+				t.Type = "float"
+			}
+		case KeyTypeLogical:
+			t.Type = "boolean"
+		case KeyTypeDate:
+			t = AvroType{Type: "int", LogicalType: "date", Nullable: true}
+		case KeyTypeTime:
+			t = AvroType{Type: "int", LogicalType: "time-millis"}
+		case KeyTypeDecimal, KeyTypeMoney:
+			t = AvroType{Type: "bytes", LogicalType: "decimal", Precision: f.digits(), Scale: f.scale()}
+		default:
+			t.Type = "bytes"
+		}
+		if f.Nullable {
+			t.Nullable = true
+		}
+		a.Fields = append(a.Fields, AvroField{Name: f.Name, Type: t})
+	}
+	return a
+}
+
+// ToAvro encodes a record as an Avro binary datum of a. Avro fields
+// missing from the schema must be nullable and are written as null.
+// Kafka wire-format headers (magic byte and schema ID) are not included.
+func (s *Schema) ToAvro(a *AvroSchema, record []byte) ([]byte, error) {
+	var out []byte
+	for _, af := range a.Fields {
+		var v any
+		if f, ok := s.Field(af.Name); ok {
+			var err error
+			if v, err = s.avroValue(f, af.Type, record); err != nil {
+				return nil, err
+			}
+		} else if !af.Type.Nullable {
+			return nil, fmt.Errorf("avro field %s: not in the schema", af.Name)
+		}
+		var err error
+		if out, err = af.Type.append(out, v); err != nil {
+			return nil, fmt.Errorf("avro field %s: %w", af.Name, err)
+		}
+	}
+	return out, nil
+}
+
+// FromAvro decodes an Avro binary datum of a into a new record. Avro
+// fields missing from the schema are skipped; nulls leave the field zero,
+// or set the null indicator of a Nullable field.
+func (s *Schema) FromAvro(a *AvroSchema, data []byte) ([]byte, error) {
+	record := make([]byte, s.RecordLength())
+	r := &avroReader{b: data}
+	for _, af := range a.Fields {
+		v, err := af.Type.read(r)
+		if err != nil {
+			return nil, fmt.Errorf("avro field %s: %w", af.Name, err)
+		}
+		f, ok := s.Field(af.Name)
+		if !ok || v == nil && !f.Nullable {
+			continue
+		}
+		if v, err = fieldValue(f, af.Type, v); err != nil {
+			return nil, err
+		}
+		if err := s.Set(record, f.Name, v); err != nil {
+			return nil, err
+		}
+	}
+	if len(r.b) > 0 {
+		return nil, fmt.Errorf("avro: %d bytes left after the last field", len(r.b))
+	}
+	return record, nil
+}
+
+// avroValue reads a field as a value of Avro type t
+func (s *Schema) avroValue(f Field, t AvroType, record []byte) (any, error) {
+	v, err := s.decode(f, record)
+	if err != nil {
+		return nil, err
+	}
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() && t.Nullable {
+			return nil, nil
+		}
+	case FixedPoint:
+		if t.LogicalType == "decimal" {
+			x, err := v.Round(t.Scale)
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			return big.NewInt(x.Units()), nil
+		}
+		return v.Float64(), nil
+	case float64:
+		if t.LogicalType == "decimal" {
+			unscaled := math.Round(v * math.Pow10(t.Scale))
+			n, _ := big.NewFloat(unscaled).Int(nil)
+			return n, nil
+		}
+	}
+	if t.LogicalType == "decimal" {
+		if n, ok := toInt64(v); ok {
+			return big.NewInt(n), nil
+		}
+		if u, ok := v.(uint64); ok {
+			return new(big.Int).SetUint64(u), nil
+		}
+	}
+	return v, nil
+}
+
+// rescaleUnits converts an unscaled decimal from one scale to another. A
+// smaller scale must not drop non-zero digits.
+func rescaleUnits(v *big.Int, from, to int) (*big.Int, error) {
+	if from == to {
+		return v, nil
+	}
+	if to > from {
+		return new(big.Int).Mul(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(to-from)), nil)), nil
+	}
+	q, r := new(big.Int).QuoRem(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(from-to)), nil), new(big.Int))
+	if r.Sign() != 0 {
+		return nil, fmt.Errorf("decimal with scale %d does not fit scale %d", from, to)
+	}
+	return q, nil
+}
+
+// fieldValue converts a value read from Avro for Schema.Set
+func fieldValue(f Field, t AvroType, v any) (any, error) {
+	switch v := v.(type) {
+	case *big.Int:
+		switch f.Type {
+		case KeyTypeDecimal, KeyTypeMoney:
+			length := f.Length
+			if f.Encrypted {
+				length = f.plain().Length
+			}
+			units, err := rescaleUnits(v, t.Scale, f.scale())
+			if err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			b := make([]byte, length)
+			if err := packDecimal(b, units); err != nil {
+				return nil, fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			return b, nil
+		case KeyTypeFloat, KeyTypeBfloat:
+			x, _ := new(big.Rat).SetFrac(v, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(t.Scale)), nil)).Float64()
+			return x, nil
+		}
+		if !v.IsInt64() {
+			return nil, fmt.Errorf("field %s: %s out of range", f.Name, v)
+		}
+		if f.Scale > 0 && t.Scale <= MaxFixedPointScale {
+			return NewFixedPoint(v.Int64(), t.Scale), nil
+		}
+		return v.Int64(), nil
+	case time.Time:
+		if f.Type != KeyTypeDate {
+			return avroInt(t, v)
+		}
+	case time.Duration:
+		if f.Type != KeyTypeTime {
+			return avroInt(t, v)
+		}
+	case []byte:
+		switch f.Type {
+		case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+			return string(v), nil
+		}
+	}
+	return v, nil
+}
+
+// avroInt returns the int or long Avro stores for a logical value
+func avroInt(t AvroType, v any) (int64, error) {
+	switch v := v.(type) {
+	case time.Time:
+		switch t.LogicalType {
+		case "date":
+			return int64(math.Floor(float64(v.Unix()) / 86400)), nil
+		case "timestamp-millis":
+			return v.UnixMilli(), nil
+		case "timestamp-micros":
+			return v.UnixMicro(), nil
+		}
+	case time.Duration:
+		switch t.LogicalType {
+		case "time-millis":
+			return v.Milliseconds(), nil
+		case "time-micros":
+			return v.Microseconds(), nil
+		}
+	default:
+		if n, ok := toInt64(v); ok {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("cannot write %T as %s %s", v, t.Type, t.LogicalType)
+}
+
+// append encodes v, nil meaning null
+func (t AvroType) append(b []byte, v any) ([]byte, error) {
+	if t.Nullable {
+		null, value := int64(0), int64(1)
+		if t.NullLast {
+			null, value = 1, 0
+		}
+		if v == nil {
+			return binary.AppendVarint(b, null), nil
+		}
+		b = binary.AppendVarint(b, value)
+	} else if v == nil {
+		return nil, errors.New("null for a type that is not nullable")
+	}
+
+	switch t.Type {
+	case "string":
+		if s, ok := v.(string); ok {
+			return appendAvroBytes(b, []byte(s)), nil
+		}
+	case "enum":
+		if s, ok := v.(string); ok {
+			i := slices.Index(t.Symbols, s)
+			if i < 0 {
+				return nil, fmt.Errorf("%q is not a symbol of enum %s", s, t.Name)
+			}
+			return binary.AppendVarint(b, int64(i)), nil
+		}
+	case "bytes", "fixed":
+		raw, ok := v.([]byte)
+		if n, isInt := v.(*big.Int); isInt && t.LogicalType == "decimal" {
+			size := 0
+			if t.Type == "fixed" {
+				size = t.Size
+			}
+			var err error
+			if raw, err = twosComplement(n, size); err != nil {
+				return nil, err
+			}
+			ok = true
+		} else if s, isString := v.(string); isString {
+			raw, ok = []byte(s), true
+		}
+		if !ok {
+			break
+		}
+		if t.Type == "bytes" {
+			return appendAvroBytes(b, raw), nil
+		}
+		if len(raw) > t.Size {
+			return nil, fmt.Errorf("%d bytes do not fit fixed %s of %d", len(raw), t.Name, t.Size)
+		}
+		b = append(b, raw...)
+		return append(b, make([]byte, t.Size-len(raw))...), nil
+	case "int", "long":
+		n, err := avroInt(t, v)
+		if err != nil {
+			return nil, err
+		}
+		if t.Type == "int" && (n < math.MinInt32 || n > math.MaxInt32) {
+			return nil, fmt.Errorf("%d out of range for int", n)
+		}
+		return binary.AppendVarint(b, n), nil
+	case "float", "double":
+		x, ok := toFloat64(v)
+		if !ok {
+			break
+		}
+		if t.Type == "float" {
+			return binary.LittleEndian.AppendUint32(b, math.Float32bits(float32(x))), nil
+		}
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(x)), nil
+	case "boolean":
+		if x, ok := v.(bool); ok {
+			if x {
+				return append(b, 1), nil
+			}
+			return append(b, 0), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot write %T as %s", v, t.Type)
+}
+
+// read decodes a value: nil, string, []byte, int64, float64, bool,
+// time.Time for dates and timestamps, time.Duration for times and
+// *big.Int, the unscaled value, for decimals
+func (t AvroType) read(r *avroReader) (any, error) {
+	if t.Nullable {
+		branch, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if (branch == 0) != t.NullLast {
+			return nil, nil
+		}
+	}
+
+	switch t.Type {
+	case "string":
+		b, err := r.bytes()
+		return string(b), err
+	case "enum":
+		i, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= int64(len(t.Symbols)) {
+			return nil, fmt.Errorf("enum index %d out of range", i)
+		}
+		return t.Symbols[i], nil
+	case "bytes", "fixed":
+		var b []byte
+		var err error
+		if t.Type == "bytes" {
+			b, err = r.bytes()
+		} else {
+			b, err = r.next(t.Size)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.LogicalType == "decimal" {
+			n := new(big.Int).SetBytes(b)
+			if len(b) > 0 && b[0]&0x80 != 0 {
+				n.Sub(n, new(big.Int).Lsh(big.NewInt(1), uint(8*len(b))))
+			}
+			return n, nil
+		}
+		return bytes.Clone(b), nil
+	case "int", "long":
+		n, err := r.long()
+		if err != nil {
+			return nil, err
+		}
+		switch t.LogicalType {
+		case "date":
+			return time.Unix(n*86400, 0).UTC(), nil
+		case "time-millis":
+			return time.Duration(n) * time.Millisecond, nil
+		case "time-micros":
+			return time.Duration(n) * time.Microsecond, nil
+		case "timestamp-millis":
+			return time.UnixMilli(n).UTC(), nil
+		case "timestamp-micros":
+			return time.UnixMicro(n).UTC(), nil
+		}
+		return n, nil
+	case "float":
+		b, err := r.next(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case "double":
+		b, err := r.next(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case "boolean":
+		b, err := r.next(1)
+		if err != nil {
+			return nil, err
+		}
+		return b[0] != 0, nil
+	}
+	return nil, fmt.Errorf("unsupported type %q", t.Type)
+}
+
+// twosComplement returns n as a big-endian two's complement number of
+// size bytes, or of the fewest bytes if size is zero
+func twosComplement(n *big.Int, size int) ([]byte, error) {
+	magnitude := n
+	if n.Sign() < 0 {
+		magnitude = new(big.Int).Not(n)
+	}
+	need := magnitude.BitLen()/8 + 1
+	if size == 0 {
+		size = need
+	} else if need > size {
+		return nil, fmt.Errorf("decimal %s does not fit in %d bytes", n, size)
+	}
+	v := n
+	if n.Sign() < 0 {
+		v = new(big.Int).Add(n, new(big.Int).Lsh(big.NewInt(1), uint(8*size)))
+	}
+	return v.FillBytes(make([]byte, size)), nil
+}
+
+func appendAvroBytes(b, data []byte) []byte {
+	b = binary.AppendVarint(b, int64(len(data)))
+	return append(b, data...)
+}
+
+// avroReader consumes an Avro binary datum
+type avroReader struct {
+	b []byte
+}
+
+func (r *avroReader) long() (int64, error) {
+	n, size := binary.Varint(r.b)
+	if size <= 0 {
+		return 0, errors.New("avro: truncated or invalid varint")
+	}
+	r.b = r.b[size:]
+	return n, nil
+}
+
+func (r *avroReader) bytes() ([]byte, error) {
+	n, err := r.long()
+	if err != nil {
+		return nil, err
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("avro: negative length %d", n)
+	}
+	return r.next(int(n))
+}
+
+func (r *avroReader) next(n int) ([]byte, error) {
+	if n > len(r.b) {
+		return nil, fmt.Errorf("avro: truncated datum, need %d bytes, have %d", n, len(r.b))
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
@@ -0,0 +1,159 @@
+package xtrieve
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func avroTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	s, err := NewSchema(
+		Field{Name: "id", Offset: 0, Length: 4, Type: KeyTypeUnsignedBinary},
+		Field{Name: "name", Offset: 4, Length: 10, Type: KeyTypeString},
+		Field{Name: "qty", Offset: 14, Length: 2, Type: KeyTypeInteger},
+		Field{Name: "price", Offset: 16, Length: 5, Type: KeyTypeDecimal, Scale: 3},
+		Field{Name: "total", Offset: 21, Length: 6, Type: KeyTypeMoney},
+		Field{Name: "ratio", Offset: 27, Length: 8, Type: KeyTypeFloat},
+		Field{Name: "active", Offset: 35, Length: 1, Type: KeyTypeLogical},
+		Field{Name: "born", Offset: 36, Length: 4, Type: KeyTypeDate},
+		Field{Name: "at", Offset: 40, Length: 4, Type: KeyTypeTime},
+		Field{Name: "note", Offset: 45, Length: 6, Type: KeyTypeString, Nullable: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestAvroRoundTrip(t *testing.T) {
+	s := avroTestSchema(t)
+	a := s.AvroSchema("Order")
+
+	tests := []map[string]any{
+		{
+			"id": uint64(1), "name": "widget", "qty": int64(-3),
+			"price": NewFixedPoint(12345, 3), "total": NewFixedPoint(-99999, 2),
+			"ratio": 0.25, "active": true,
+			"born": time.Date(1969, 7, 20, 0, 0, 0, 0, time.UTC),
+			"at":   13*time.Hour + 5*time.Minute + 7*time.Second + 120*time.Millisecond,
+			"note": "hi",
+		},
+		{
+			"id": uint64(1 << 31), "name": "", "qty": int64(0),
+			"price": NewFixedPoint(0, 3), "total": NewFixedPoint(0, 2),
+			"ratio": 0.0, "active": false, "born": time.Time{}, "at": time.Duration(0),
+			"note": nil,
+		},
+	}
+	for _, values := range tests {
+		record, err := s.Encode(values)
+		if err != nil {
+			t.Fatalf("Encode(%v): %v", values, err)
+		}
+		datum, err := s.ToAvro(a, record)
+		if err != nil {
+			t.Errorf("ToAvro(%v): %v", values, err)
+			continue
+		}
+		back, err := s.FromAvro(a, datum)
+		if err != nil {
+			t.Errorf("FromAvro(%v): %v", values, err)
+			continue
+		}
+		got, err := s.Decode(back)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("round trip = %v, want %v", got, values)
+		}
+	}
+}
+
+func TestAvroSchemaJSON(t *testing.T) {
+	a := avroTestSchema(t).AvroSchema("Order")
+	data, err := json.Marshal(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParseAvroSchema(data)
+	if err != nil {
+		t.Fatalf("ParseAvroSchema(%s): %v", data, err)
+	}
+	if !reflect.DeepEqual(back, a) {
+		t.Errorf("ParseAvroSchema(%s) = %+v, want %+v", data, back, a)
+	}
+}
+
+func TestAvroEncoding(t *testing.T) {
+	// Encodings from the Avro specification: zig-zag varints, and
+	// decimals as big-endian two's complement bytes
+	tests := []struct {
+		t    AvroType
+		v    any
+		want string
+	}{
+		{AvroType{Type: "long"}, int64(0), "00"},
+		{AvroType{Type: "long"}, int64(-1), "01"},
+		{AvroType{Type: "long"}, int64(64), "8001"},
+		{AvroType{Type: "int"}, int64(-64), "7f"},
+		{AvroType{Type: "string"}, "foo", "06666f6f"},
+		{AvroType{Type: "boolean"}, true, "01"},
+		{AvroType{Type: "string", Nullable: true}, nil, "00"},
+		{AvroType{Type: "string", Nullable: true, NullLast: true}, nil, "02"},
+		{AvroType{Type: "bytes", LogicalType: "decimal", Scale: 2}, big.NewInt(-1), "02ff"},
+		{AvroType{Type: "bytes", LogicalType: "decimal", Scale: 2}, big.NewInt(128), "040080"},
+	}
+	for _, tt := range tests {
+		b, err := tt.t.append(nil, tt.v)
+		if err != nil {
+			t.Errorf("append(%+v, %v): %v", tt.t, tt.v, err)
+			continue
+		}
+		if got := hex.EncodeToString(b); got != tt.want {
+			t.Errorf("append(%+v, %v) = %s, want %s", tt.t, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestAvroDecimalScale(t *testing.T) {
+	s := avroTestSchema(t)
+	tests := []struct {
+		scale int
+		units int64
+		want  FixedPoint // price has scale 3
+		fails bool
+	}{
+		{scale: 3, units: 12345, want: NewFixedPoint(12345, 3)},
+		{scale: 1, units: 123, want: NewFixedPoint(12300, 3)},
+		{scale: 0, units: -7, want: NewFixedPoint(-7000, 3)},
+		{scale: 5, units: 1234500, want: NewFixedPoint(12345, 3)},
+		{scale: 5, units: 1234567, fails: true},
+	}
+	for _, tt := range tests {
+		at := AvroType{Type: "bytes", LogicalType: "decimal", Precision: 12, Scale: tt.scale}
+		a := &AvroSchema{Name: "Price", Fields: []AvroField{{Name: "price", Type: at}}}
+		datum, err := at.append(nil, big.NewInt(tt.units))
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := s.FromAvro(a, datum)
+		if tt.fails {
+			if err == nil {
+				t.Errorf("FromAvro(%d scale %d) succeeded, want an error", tt.units, tt.scale)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("FromAvro(%d scale %d): %v", tt.units, tt.scale, err)
+			continue
+		}
+		if got, _ := s.Get(record, "price"); got != tt.want {
+			t.Errorf("FromAvro(%d scale %d) = %v, want %v", tt.units, tt.scale, got, tt.want)
+		}
+	}
+}
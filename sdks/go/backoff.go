@@ -0,0 +1,112 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"time"
+)
+
+// Backoff controls how dial attempts are retried. Delays start at Initial
+// and grow by Multiplier up to Max; each is randomly spread by up to
+// ±Jitter (a fraction, e.g. 0.2 for ±20%) so that many clients started
+// together do not retry in lockstep. The zero Backoff makes one attempt.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+	// MaxAttempts limits the attempts; 0 retries until the context ends
+	// (or makes one attempt when Initial is zero)
+	MaxAttempts int
+}
+
+// DefaultBackoff retries from 100ms up to 10s with ±20% jitter
+var DefaultBackoff = Backoff{
+	Initial:    100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.2,
+}
+
+// Delay returns the wait before retry number attempt (counting from 1)
+func (b Backoff) Delay(attempt int) time.Duration {
+	mult := b.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	d := float64(b.Initial)
+	for i := 1; i < attempt && (b.Max <= 0 || d < float64(b.Max)); i++ {
+		d *= mult
+	}
+	if b.Max > 0 {
+		d = min(d, float64(b.Max))
+	}
+	if b.Jitter > 0 {
+		d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// reconnectTimeout bounds Reconnect
+const reconnectTimeout = time.Minute
+
+// dialFunc connects to a client's server, giving up when ctx ends
+type dialFunc func(ctx context.Context) (net.Conn, error)
+
+// retry calls dial until it succeeds, the attempts run out or ctx ends
+func (b Backoff) retry(ctx context.Context, dial dialFunc) (net.Conn, error) {
+	for attempt := 1; ; attempt++ {
+		conn, err := dial(ctx)
+		if err == nil {
+			return conn, nil
+		}
+		if b.Initial <= 0 || (b.MaxAttempts > 0 && attempt >= b.MaxAttempts) {
+			return nil, err
+		}
+
+		timer := time.NewTimer(b.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// DialContext is like Dial but retries failed attempts according to
+// backoff until ctx ends. The client keeps backoff for Reconnect.
+//
+//	// Wait for a server that is still starting
+//	client, err := xtrieve.DialContext(ctx, "db1:7419", xtrieve.DefaultBackoff)
+func DialContext(ctx context.Context, address string, backoff Backoff) (*Client, error) {
+	return DialWithOptions(ctx, address, DialOptions{Backoff: backoff})
+}
+
+// ReconnectContext is like Reconnect but retries with the client's
+// backoff until ctx ends. The client is not locked while it waits between
+// attempts: operations meanwhile try to dial once themselves, and fail
+// if the server is still unreachable.
+func (c *Client) ReconnectContext(ctx context.Context) error {
+	c.mu.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.broken = true
+	}
+	c.mu.Unlock()
+
+	conn, err := c.backoff.retry(ctx, c.dial)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		// Replace a connection an operation dialed in the meantime
+		c.conn.Close()
+	}
+	c.install(conn)
+	return nil
+}
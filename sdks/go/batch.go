@@ -0,0 +1,58 @@
+package xtrieve
+
+import "context"
+
+// Batch queues several operations and sends them in one exchange
+//
+//	b := client.Batch()
+//	b.Add(&xtrieve.Request{Operation: xtrieve.OpOpen, FilePath: "a.dat", KeyNumber: -1})
+//	b.Add(&xtrieve.Request{Operation: xtrieve.OpOpen, FilePath: "b.dat", KeyNumber: -1})
+//	resps, err := b.Send()
+//
+// The protocol has no batch envelope, so the queued requests are pipelined:
+// written back to back and answered in order, which costs one round trip.
+// Because all requests are written before any response is read, a request
+// cannot use the position block returned by an earlier one in the same
+// batch.
+type Batch struct {
+	client *Client
+	reqs   []*Request
+}
+
+// Batch starts an empty batch on the client
+func (c *Client) Batch() *Batch {
+	return &Batch{client: c}
+}
+
+// Add queues a request and returns its index in the responses
+func (b *Batch) Add(req *Request) int {
+	b.reqs = append(b.reqs, req)
+	return len(b.reqs) - 1
+}
+
+// Len returns the number of queued requests
+func (b *Batch) Len() int {
+	return len(b.reqs)
+}
+
+// Send executes the queued requests and returns one response per request.
+// Non-success status codes are reported in the responses, not as errors.
+// Each request runs through the client's interceptors, logging and
+// statistics, see pipelineObserved; the first error, such as a request an
+// interceptor refused, fails the Send after the other requests ran.
+// The batch is empty afterwards and can be reused.
+func (b *Batch) Send() ([]*Response, error) {
+	resps := make([]*Response, 0, len(b.reqs))
+	for start := 0; start < len(b.reqs); start += pipelineDepth {
+		end := min(start+pipelineDepth, len(b.reqs))
+		chunk, errs := b.client.pipelineObserved(context.Background(), b.reqs[start:end])
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		resps = append(resps, chunk...)
+	}
+	b.reqs = b.reqs[:0]
+	return resps, nil
+}
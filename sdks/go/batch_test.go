@@ -0,0 +1,44 @@
+package xtrieve
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatchIntercepted(t *testing.T) {
+	c := fakeServer(t, 8, 0)
+	count := &opCount{seen: make(map[uint16]int), refuse: OpDelete}
+	c.Use(count.intercept)
+
+	b := c.Batch()
+	for i := 0; i < pipelineDepth+3; i++ {
+		b.Add(&Request{Operation: OpStepNext})
+	}
+	resps, err := b.Send()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resps) != pipelineDepth+3 || resps[0].StatusCode != StatusSuccess || len(resps[0].DataBuffer) != 8 {
+		t.Fatalf("%d responses, first %+v", len(resps), resps[0])
+	}
+	if n := count.seen[OpStepNext]; n != pipelineDepth+3 {
+		t.Errorf("interceptor saw %d requests, want %d", n, pipelineDepth+3)
+	}
+	if n := c.Stats().Ops[OpName(OpStepNext)].Calls; n != pipelineDepth+3 {
+		t.Errorf("statistics count %d requests, want %d", n, pipelineDepth+3)
+	}
+
+	// A refused request fails the batch; the others are still sent
+	b.Add(&Request{Operation: OpStepNext})
+	b.Add(&Request{Operation: OpDelete})
+	b.Add(&Request{Operation: OpStepNext})
+	if _, err := b.Send(); !errors.Is(err, errRefused) {
+		t.Errorf("Send = %v, want the interceptor's error", err)
+	}
+	if n := c.Stats().Ops[OpName(OpStepNext)].Calls; n != pipelineDepth+5 {
+		t.Errorf("statistics count %d requests, want %d", n, pipelineDepth+5)
+	}
+	if _, ok := c.Stats().Ops[OpName(OpDelete)]; ok {
+		t.Error("the refused request reached the statistics")
+	}
+}
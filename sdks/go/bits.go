@@ -0,0 +1,93 @@
+package xtrieve
+
+import "fmt"
+
+// checkBits validates the bit range of a bit field
+func (f Field) checkBits() error {
+	if f.Bits == 0 {
+		if f.Bit != 0 {
+			return fmt.Errorf("field %s: Bit needs Bits", f.Name)
+		}
+		return nil
+	}
+	switch f.Type {
+	case KeyTypeLogical, KeyTypeUnsignedBinary, KeyTypeInteger:
+	default:
+		return fmt.Errorf("field %s: bit fields must be logical, unsigned or integer", f.Name)
+	}
+	if f.Encrypted {
+		return fmt.Errorf("field %s: bit fields cannot be encrypted", f.Name)
+	}
+	if f.Length > 8 || f.Bit < 0 || f.Bits < 0 || f.Bit+f.Bits > 8*f.Length {
+		return fmt.Errorf("field %s: bits %d-%d do not fit in %d bytes", f.Name, f.Bit, f.Bit+f.Bits-1, f.Length)
+	}
+	return nil
+}
+
+// bitMask returns the mask of the field's bits before shifting
+func (f Field) bitMask() uint64 {
+	return 1<<f.Bits - 1
+}
+
+// word reads b as a little-endian unsigned integer of up to 8 bytes
+func word(b []byte) uint64 {
+	var w uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		w = w<<8 | uint64(b[i])
+	}
+	return w
+}
+
+func putWord(b []byte, w uint64) {
+	for i := range b {
+		b[i] = byte(w)
+		w >>= 8
+	}
+}
+
+// decodeBits decodes a bit field: a bool for LOGICAL, a sign-extended
+// int64 for INTEGER and a uint64 for UNSIGNED BINARY
+func (f Field) decodeBits(b []byte) any {
+	v := word(b) >> f.Bit & f.bitMask()
+	switch f.Type {
+	case KeyTypeLogical:
+		return v != 0
+	case KeyTypeInteger:
+		shift := 64 - f.Bits
+		return int64(v<<shift) >> shift
+	}
+	return v
+}
+
+// encodeBits stores value in the field's bits, leaving the other bits of
+// its bytes as they are
+func (f Field) encodeBits(b []byte, value any) error {
+	var v uint64
+	switch x := value.(type) {
+	case bool:
+		if x {
+			v = 1
+		}
+	case uint64:
+		v = x
+		if v > f.bitMask() {
+			return fmt.Errorf("field %s: %d does not fit in %d bits", f.Name, x, f.Bits)
+		}
+	default:
+		n, ok := toInt64(value)
+		if !ok {
+			return fmt.Errorf("field %s: cannot encode %T in a bit field", f.Name, value)
+		}
+		low, high := int64(0), int64(f.bitMask())
+		if f.Type == KeyTypeInteger {
+			low, high = -1<<(f.Bits-1), 1<<(f.Bits-1)-1
+		}
+		if n < low || n > high {
+			return fmt.Errorf("field %s: %d does not fit in %d bits", f.Name, n, f.Bits)
+		}
+		v = uint64(n) & f.bitMask()
+	}
+	w := word(b)&^(f.bitMask()<<f.Bit) | v<<f.Bit
+	putWord(b, w)
+	return nil
+}
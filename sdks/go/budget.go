@@ -0,0 +1,101 @@
+package xtrieve
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Budget caps what one client may ask of the server, so that a runaway
+// report cannot saturate it for everyone. Zero fields are unlimited.
+type Budget struct {
+	// MaxScanRecords stops an Iterator after it returned this many records
+	MaxScanRecords int
+	// MaxOperationBytes rejects requests whose data buffer is longer, and
+	// fails operations whose response is. Iterators size their extended
+	// batches to stay below it.
+	MaxOperationBytes int
+	// MaxConcurrentScans limits the Iterators of the client in progress
+	// at once. An iterator holds its slot from its first fetch until it
+	// reaches the end, fails or is closed.
+	MaxConcurrentScans int
+}
+
+// BudgetLimit names the limit of a Budget that was exceeded
+type BudgetLimit uint8
+
+const (
+	BudgetScanRecords BudgetLimit = iota
+	BudgetOperationBytes
+	BudgetConcurrentScans
+)
+
+var budgetLimitNames = [...]string{"scan records", "operation bytes", "concurrent scans"}
+
+func (l BudgetLimit) String() string {
+	if int(l) < len(budgetLimitNames) {
+		return budgetLimitNames[l]
+	}
+	return fmt.Sprintf("BudgetLimit(%d)", int(l))
+}
+
+// ErrBudgetExceeded is matched by every *BudgetError
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// BudgetError reports an operation or scan stopped by the client's Budget
+type BudgetError struct {
+	Limit BudgetLimit
+	// Max is the configured limit and Value what was asked for, e.g. the
+	// length of a data buffer
+	Max   int
+	Value int
+	// Operation is the operation refused for BudgetOperationBytes
+	Operation uint16
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit == BudgetOperationBytes {
+		return fmt.Sprintf("xtrieve: %s of %d bytes exceeds the budget of %d bytes", OpName(e.Operation), e.Value, e.Max)
+	}
+	return fmt.Sprintf("xtrieve: %s budget of %d exceeded", e.Limit, e.Max)
+}
+
+func (e *BudgetError) Unwrap() error {
+	return ErrBudgetExceeded
+}
+
+// SetBudget replaces the client's budget. Iterators already in progress
+// keep the record limit they started with.
+func (c *Client) SetBudget(b Budget) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.budget = b
+}
+
+// Budget returns the client's budget
+func (c *Client) Budget() Budget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.budget
+}
+
+// overBudget is the error for a data buffer of n bytes past the
+// operation budget, kept apart so the error does not escape on every
+// operation. The caller holds c.mu.
+func (c *Client) overBudget(op uint16, n int) error {
+	return &BudgetError{Limit: BudgetOperationBytes, Max: c.budget.MaxOperationBytes, Value: n, Operation: op}
+}
+
+// acquireScan takes a scan slot, returning the record limit of the scan
+func (c *Client) acquireScan() (int, error) {
+	b := c.Budget()
+	if n := c.scans.Add(1); b.MaxConcurrentScans > 0 && int(n) > b.MaxConcurrentScans {
+		c.scans.Add(-1)
+		return 0, &BudgetError{Limit: BudgetConcurrentScans, Max: b.MaxConcurrentScans, Value: int(n)}
+	}
+	return b.MaxScanRecords, nil
+}
+
+// releaseScan gives back a slot taken by acquireScan
+func (c *Client) releaseScan() {
+	c.scans.Add(-1)
+}
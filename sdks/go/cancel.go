@@ -0,0 +1,127 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ExecuteContext executes a Btrieve operation and gives up when ctx is
+// cancelled or its deadline passes.
+//
+// The protocol has neither request IDs nor a cancel message, so the
+// server cannot be told to stop: it runs the request to completion, and a
+// write given up on may still be applied. Giving up stops the client
+// waiting for the response. As the connection may then hold a partial
+// response, the client drops it and dials a fresh one before its next
+// operation; xtrieved keeps session state such as locks and transactions
+// with the position block, so it survives the new connection. Only the
+// operation on the wire is interrupted: one still waiting for the
+// connection, used by another goroutine, gives up before it is sent.
+//
+// ctx is passed to the client's interceptors and logger, so its values,
+// such as a trace span or the user, reach them.
+func (c *Client) ExecuteContext(ctx context.Context, req *Request) (*Response, error) {
+	return c.executeWith(ctx, req, nil)
+}
+
+// exchangeContext is exchange giving up when ctx is done, checking the
+// operation timeout like roundTrip. The caller holds c.mu, so the deadline
+// ctx sets on the connection only interrupts this operation.
+func (c *Client) exchangeContext(ctx context.Context, req *Request, resp *Response, timeout time.Duration) error {
+	conn := c.conn
+	fired := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+		close(fired)
+	})
+	err := c.exchange(req, resp)
+	if stop() {
+		return c.checkTimeout(err, timeout)
+	}
+	<-fired
+	if err == nil {
+		// The response arrived whole; the next operation clears the deadline
+		c.deadline = true
+		return nil
+	}
+	// Whatever happened on the wire, the connection may hold a partial
+	// response and cannot be reused
+	conn.Close()
+	c.broken = true
+	return fmt.Errorf("%w: %w", ctx.Err(), err)
+}
+
+// SetContext makes the file's operations run under ctx, as with
+// ExecuteContext: they give up when it is done, and the client's
+// interceptors receive it. Its hooks, and so an Audit sink, read it with
+// Context, e.g. for the user making a change. A File is not safe for
+// concurrent use, so set the context of each request before its
+// operations; nil restores context.Background.
+//
+//	orders.SetContext(r.Context())
+//	defer orders.SetContext(nil)
+func (f *File) SetContext(ctx context.Context) {
+	f.ctx = ctx
+	if f.replica != nil {
+		f.replica.SetContext(ctx)
+	}
+	if f.shadow != nil {
+		f.shadow.file.SetContext(ctx)
+	}
+}
+
+// Context returns the file's context, context.Background unless set with
+// SetContext
+func (f *File) Context() context.Context {
+	if f.ctx == nil {
+		return context.Background()
+	}
+	return f.ctx
+}
+
+// SetContext sets the context of the table's File and History, see
+// File.SetContext. Table hooks read it with t.File.Context().
+func (t *Table) SetContext(ctx context.Context) {
+	t.File.SetContext(ctx)
+	if t.History != nil {
+		t.History.SetContext(ctx)
+	}
+}
+
+// ready checks that the client can send a request, replacing a connection
+// broken by cancellation. After a failed dial it fails fast until the
+// client's backoff delay has passed, so that operations neither wait on
+// nor hammer an unreachable server. The caller holds c.mu.
+func (c *Client) ready(ctx context.Context) error {
+	if c.conn == nil {
+		return errors.New("not connected")
+	}
+	if !c.broken {
+		return nil
+	}
+	if time.Now().Before(c.redialAt) {
+		return fmt.Errorf("failed to connect: %w", c.redialErr)
+	}
+	conn, err := c.dial(ctx)
+	if err != nil {
+		c.redials++
+		if c.backoff.Initial > 0 {
+			c.redialAt = time.Now().Add(c.backoff.Delay(c.redials))
+		}
+		c.redialErr = err
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	c.install(conn)
+	return nil
+}
+
+// install makes conn the client's connection. The caller holds c.mu.
+func (c *Client) install(conn net.Conn) {
+	c.conn, c.broken = conn, false
+	c.connected = time.Now()
+	c.r.Reset(conn)
+	c.redials, c.redialAt, c.redialErr = 0, time.Time{}, nil
+}
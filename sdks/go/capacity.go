@@ -0,0 +1,233 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Page layout figures of Btrieve 6.x files used to estimate page counts
+const (
+	dataPageHeader  = 6
+	indexPageHeader = 12
+	// usageCountSize is the usage count stored with each fixed record and
+	// variableRecordPointer the pointer to its variable-length part
+	usageCountSize        = 2
+	variableRecordPointer = 4
+	// duplicatePointerSize is the pair of pointers each record keeps per
+	// linked-duplicate key
+	duplicatePointerSize = 8
+	// fragmentOverhead is the fragment table entry and pointer of each
+	// variable-length part
+	fragmentOverhead = 6
+	// indexFill is the average fill of B-tree index pages
+	indexFill = 2.0 / 3
+	// fcrPages are the two file control records
+	fcrPages = 2
+)
+
+// CapacityReport describes how a file's records use its pages, as
+// reported by Capacity. Page counts are estimates from the file's layout
+// and record lengths; the protocol does not report them.
+type CapacityReport struct {
+	Records      uint64
+	PageSize     int
+	RecordLength int
+	Variable     bool
+	// Sampled is the number of records whose length was read
+	Sampled int
+	// Lengths of the records sampled
+	MinLength, MaxLength int
+	MeanLength           float64
+	P50, P90, P99        int
+	// Histogram counts the sampled lengths in eight buckets between
+	// MinLength and MaxLength; empty for fixed-length files
+	Histogram []LengthBucket
+	// DataPages hold the fixed parts of records, VariablePages their
+	// variable-length parts and IndexPages the keys; OverheadPages are the
+	// file control records and page allocation tables and UnusedPages the
+	// free pages Stat reports
+	DataPages, VariablePages, IndexPages, OverheadPages, UnusedPages uint64
+	// Pages is the total, and Utilization the share of their bytes taken
+	// by records and key entries
+	Pages       uint64
+	Utilization float64
+	Taken       time.Time
+
+	physical int
+	keys     []int
+	free     float64
+}
+
+// LengthBucket counts the records whose length lies between From and To
+// inclusive
+type LengthBucket struct {
+	From, To int
+	Count    int
+}
+
+// Capacity reports the record lengths and page usage of f from Stat and
+// the lengths of the first sample records in physical order (0 reads
+// them all), for capacity planning: with Project, how the file grows.
+func Capacity(ctx context.Context, f *File, sample int) (*CapacityReport, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r := &CapacityReport{
+		Records:      stat.NumRecords,
+		PageSize:     int(stat.PageSize),
+		RecordLength: int(stat.RecordLength),
+		Variable:     stat.VariableLength(),
+		UnusedPages:  uint64(stat.UnusedPages),
+		Taken:        time.Now(),
+		free:         float64(stat.FreeSpaceThreshold()) / 100,
+	}
+	if r.PageSize == 0 {
+		return nil, fmt.Errorf("xtrieve: file reports page size 0")
+	}
+
+	// The fixed part of each record carries its usage count, the pointers
+	// of its linked-duplicate keys and of its variable part, and system data
+	r.physical = r.RecordLength + usageCountSize
+	if r.Variable {
+		r.physical += variableRecordPointer
+	}
+	if stat.SystemData() {
+		r.physical += 8
+	}
+	specs := make([]KeySpec, len(stat.Keys))
+	for i, k := range stat.Keys {
+		specs[i] = k.KeySpec
+	}
+	for n := int16(0); ; n++ {
+		segments := keySegments(specs, n)
+		if segments == nil {
+			break
+		}
+		length := 0
+		for _, seg := range segments {
+			length += int(seg.Length)
+		}
+		r.keys = append(r.keys, length)
+		if segments[0].Flags&KeyFlagDuplicates != 0 {
+			r.physical += duplicatePointerSize
+		}
+	}
+
+	var lengths []int
+	it := f.ScanPhysical()
+	defer it.Close()
+	for (sample <= 0 || len(lengths) < sample) && it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		lengths = append(lengths, len(it.Record()))
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	r.measure(lengths)
+
+	r.DataPages, r.VariablePages, r.IndexPages, r.OverheadPages = r.pages(r.Records)
+	r.Pages = r.DataPages + r.VariablePages + r.IndexPages + r.OverheadPages + r.UnusedPages
+	if r.Pages > 0 {
+		used := float64(r.Records) * (float64(r.physical) + r.tail())
+		for _, length := range r.keys {
+			used += float64(r.Records) * float64(length+4)
+		}
+		r.Utilization = used / (float64(r.Pages) * float64(r.PageSize))
+	}
+	return r, nil
+}
+
+// measure fills in the length figures from the sampled lengths
+func (r *CapacityReport) measure(lengths []int) {
+	r.Sampled = len(lengths)
+	if len(lengths) == 0 {
+		r.MinLength, r.MaxLength, r.MeanLength = r.RecordLength, r.RecordLength, float64(r.RecordLength)
+		r.P50, r.P90, r.P99 = r.RecordLength, r.RecordLength, r.RecordLength
+		return
+	}
+	sort.Ints(lengths)
+	total := 0
+	for _, n := range lengths {
+		total += n
+	}
+	r.MinLength, r.MaxLength = lengths[0], lengths[len(lengths)-1]
+	r.MeanLength = float64(total) / float64(len(lengths))
+	at := func(p int) int { return lengths[(len(lengths)-1)*p/100] }
+	r.P50, r.P90, r.P99 = at(50), at(90), at(99)
+	if !r.Variable {
+		return
+	}
+
+	width := max(1, (r.MaxLength-r.MinLength+8)/8)
+	for from := r.MinLength; from <= r.MaxLength; from += width {
+		r.Histogram = append(r.Histogram, LengthBucket{From: from, To: from + width - 1})
+	}
+	for _, n := range lengths {
+		r.Histogram[(n-r.MinLength)/width].Count++
+	}
+}
+
+// tail returns the average bytes a record stores on variable pages
+func (r *CapacityReport) tail() float64 {
+	if !r.Variable || r.MeanLength <= float64(r.RecordLength) {
+		return 0
+	}
+	return r.MeanLength - float64(r.RecordLength) + fragmentOverhead
+}
+
+// pages estimates the pages of each kind a file of the given number of
+// records needs
+func (r *CapacityReport) pages(records uint64) (data, variable, index, overhead uint64) {
+	perPage := max(1, (r.PageSize-dataPageHeader)/r.physical)
+	data = ceilDiv(records, uint64(perPage))
+	if tail := r.tail(); tail > 0 {
+		usable := float64(r.PageSize-dataPageHeader) * (1 - r.free)
+		variable = uint64(float64(records)*tail/usable) + 1
+	}
+	for _, length := range r.keys {
+		entries := max(1, int(float64((r.PageSize-indexPageHeader)/(length+4))*indexFill))
+		index += ceilDiv(records, uint64(entries))
+	}
+	// Each page allocation table maps a page's worth of 4-byte entries
+	// and is kept in pairs, like the file control record
+	pat := uint64(max(1, (r.PageSize-8)/4))
+	overhead = fcrPages + 2*ceilDiv(data+variable+index, pat)
+	return data, variable, index, overhead
+}
+
+func ceilDiv(a, b uint64) uint64 {
+	return (a + b - 1) / b
+}
+
+// Project estimates the pages and bytes the file takes once it holds the
+// given number of records. Unused pages are filled before the file grows,
+// and files never shrink.
+func (r *CapacityReport) Project(records uint64) (pages, bytes uint64) {
+	data, variable, index, overhead := r.pages(records)
+	pages = max(r.Pages, data+variable+index+overhead)
+	return pages, pages * uint64(r.PageSize)
+}
+
+// WriteReport writes the report as text
+func (r *CapacityReport) WriteReport(w io.Writer) error {
+	kind := "fixed-length"
+	if r.Variable {
+		kind = "variable-length"
+	}
+	fmt.Fprintf(w, "%d records, %s, record length %d, page size %d\n", r.Records, kind, r.RecordLength, r.PageSize)
+	fmt.Fprintf(w, "lengths of %d records: min %d, mean %.1f, max %d, p50 %d, p90 %d, p99 %d\n",
+		r.Sampled, r.MinLength, r.MeanLength, r.MaxLength, r.P50, r.P90, r.P99)
+	for _, b := range r.Histogram {
+		fmt.Fprintf(w, "  %6d-%-6d %8d\n", b.From, b.To, b.Count)
+	}
+	fmt.Fprintf(w, "pages (estimated): %d data, %d variable, %d index, %d overhead, %d unused, %d total\n",
+		r.DataPages, r.VariablePages, r.IndexPages, r.OverheadPages, r.UnusedPages, r.Pages)
+	_, err := fmt.Fprintf(w, "size %d bytes, %.1f%% used\n", r.Pages*uint64(r.PageSize), 100*r.Utilization)
+	return err
+}
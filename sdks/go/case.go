@@ -0,0 +1,89 @@
+package xtrieve
+
+// FoldKey returns key with the string segments of case-insensitive key
+// segments (KeyFlagNoCase) folded to upper case, the form Btrieve compares
+// them in. key is returned unchanged when no segment needs folding.
+//
+// File folds search keys with the segments Stat reports, so keys are only
+// folded when the server keeps the flag. xtrieved drops it at Create and
+// compares keys bytewise, and folding there would miss stored keys that
+// are not in upper case.
+func FoldKey(segments []KeySpec, key []byte) []byte {
+	if !hasNoCase(segments) {
+		return key
+	}
+	folded := append([]byte(nil), key...)
+	offset := 0
+	for _, seg := range segments {
+		end := offset + int(seg.Length)
+		if seg.Flags&KeyFlagNoCase != 0 && isStringType(seg.Type) {
+			part := sliceRange(folded, offset, end)
+			switch seg.Type {
+			case KeyTypeWString, KeyTypeWZstring:
+				foldUpperUTF16(part)
+			case KeyTypeLstring:
+				if len(part) > 0 {
+					part = part[1:]
+				}
+				fallthrough
+			default:
+				foldUpper(part)
+			}
+		}
+		offset = end
+	}
+	return folded
+}
+
+func hasNoCase(segments []KeySpec) bool {
+	for _, seg := range segments {
+		if seg.Flags&KeyFlagNoCase != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isStringType(keyType uint8) bool {
+	switch keyType {
+	case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+		return true
+	}
+	return false
+}
+
+// foldUpper upper-cases ASCII letters in place
+func foldUpper(b []byte) {
+	for i, c := range b {
+		if 'a' <= c && c <= 'z' {
+			b[i] = c - 'a' + 'A'
+		}
+	}
+}
+
+// foldedCompare compares two strings as if both were folded to upper case
+func foldedCompare(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		ca, cb := upper(a[i]), upper(b[i])
+		if ca != cb {
+			if ca < cb {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+func upper(c byte) byte {
+	if 'a' <= c && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
@@ -0,0 +1,63 @@
+package xtrieve
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFoldKey(t *testing.T) {
+	nameCity := []KeySpec{
+		{Length: 4, Flags: KeyFlagSegmented | KeyFlagNoCase, Type: KeyTypeString},
+		{Length: 4, Type: KeyTypeString},
+	}
+	tests := []struct {
+		name     string
+		segments []KeySpec
+		key      []byte
+		want     []byte
+	}{
+		{"string", []KeySpec{{Length: 6, Flags: KeyFlagNoCase, Type: KeyTypeString}}, []byte("abc-é1"), []byte("ABC-é1")},
+		{"zstring", []KeySpec{{Length: 4, Flags: KeyFlagNoCase, Type: KeyTypeZstring}}, []byte("ab\x00\x00"), []byte("AB\x00\x00")},
+		{"lstring keeps its length", []KeySpec{{Length: 4, Flags: KeyFlagNoCase, Type: KeyTypeLstring}}, []byte("abcd"), []byte("aBCD")},
+		{"wstring", []KeySpec{{Length: 4, Flags: KeyFlagNoCase, Type: KeyTypeWString}}, EncodeUTF16LE("ab"), EncodeUTF16LE("AB")},
+		{"wzstring", []KeySpec{{Length: 4, Flags: KeyFlagNoCase, Type: KeyTypeWZstring}}, EncodeUTF16LE("zé"), EncodeUTF16LE("Zé")},
+		{"case-sensitive", []KeySpec{{Length: 3, Type: KeyTypeString}}, []byte("abc"), []byte("abc")},
+		{"integer", []KeySpec{{Length: 2, Flags: KeyFlagNoCase, Type: KeyTypeInteger}}, []byte("ab"), []byte("ab")},
+		{"first of two segments", nameCity, []byte("annarome"), []byte("ANNArome")},
+		{"descending", []KeySpec{{Length: 2, Flags: KeyFlagNoCase | KeyFlagDescending, Type: KeyTypeString}}, []byte("xy"), []byte("XY")},
+		{"short key", nameCity, []byte("an"), []byte("AN")},
+	}
+	for _, tt := range tests {
+		key := append([]byte(nil), tt.key...)
+		if got := FoldKey(tt.segments, key); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: FoldKey(%q) = %q, want %q", tt.name, tt.key, got, tt.want)
+		}
+		if !bytes.Equal(key, tt.key) {
+			t.Errorf("%s: FoldKey modified its argument to %q", tt.name, key)
+		}
+	}
+}
+
+func TestFoldedCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"abc", "ABC", 0},
+		{"abc", "ABD", -1},
+		{"ab", "ABC", -1},
+		{"abc", "AB", 1},
+		{"_", "a", 1}, // folded to upper case, letters sort before '_'
+		{"_", "A", 1},
+		{"é", "É", 1},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if got := foldedCompare([]byte(tt.a), []byte(tt.b)); got != tt.want {
+			t.Errorf("foldedCompare(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := foldedCompare([]byte(tt.b), []byte(tt.a)); got != -tt.want {
+			t.Errorf("foldedCompare(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package xtrieve
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// ChangeLogPollInterval is how often TailChangeLog looks for new entries
+// once it has read to the end of the log
+var ChangeLogPollInterval = 250 * time.Millisecond
+
+// ChangeEntry is one write recorded in a ChangeLog
+type ChangeEntry struct {
+	// LSN is the entry's byte offset in the log and Next the offset of the
+	// entry after it, to resume reading from
+	LSN  int64 `json:"-"`
+	Next int64 `json:"-"`
+
+	Time time.Time `json:"time"`
+	File string    `json:"file"`
+	// Op is JournalInsert, JournalUpdate or JournalDelete
+	Op string `json:"op"`
+	// Key is the record's value of the key the file was attached with:
+	// before the write for updates and deletes, so it finds the record the
+	// write changed
+	KeyNumber int16  `json:"key_number"`
+	Key       []byte `json:"key,omitempty"`
+	// Before is the record before an update or delete and After the record
+	// after an insert or update
+	Before []byte `json:"before,omitempty"`
+	After  []byte `json:"after,omitempty"`
+}
+
+// ChangeLog records the writes made through Files as a stream of entries
+// with before and after images, for change data capture, replication and
+// point-in-time recovery. The Xtrieve protocol exposes no server-side
+// transaction log, so the log is kept by the client: it holds the writes
+// of the files attached to it, made through this process, and not those
+// of other programs. Entries are appended as the server confirms each
+// write, so a write in a transaction that is later aborted stays logged.
+//
+//	log, err := xtrieve.OpenChangeLog("orders.changes")
+//	log.Attach(orders, 0)
+//	...
+//	next, err := xtrieve.TailChangeLog(ctx, "orders.changes", from, func(e xtrieve.ChangeEntry) error {
+//	    return xtrieve.ApplyChange(replica, e)
+//	})
+type ChangeLog struct {
+	// NoSync skips the fsync after each append
+	NoSync bool
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenChangeLog opens or creates a change log file, appending to it
+func OpenChangeLog(path string) (*ChangeLog, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangeLog{file: f}, nil
+}
+
+// Close closes the change log file
+func (l *ChangeLog) Close() error {
+	return l.file.Close()
+}
+
+// Attach logs the Insert, Update and Delete of f from now on, identifying
+// records by their value of keyNumber. Reading the before image of an
+// update or delete costs two operations.
+func (l *ChangeLog) Attach(f *File, keyNumber int16) {
+	var before []byte
+	f.Before(func(f *File, op uint16, record []byte) error {
+		before = nil
+		if op == OpInsert {
+			return nil
+		}
+		var err error
+		before, err = currentRecord(f, keyNumber)
+		return err
+	})
+	f.After(func(f *File, op uint16, record []byte) error {
+		e := ChangeEntry{Time: time.Now(), File: f.Path(), KeyNumber: keyNumber, Before: before}
+		segments := f.KeySegments(keyNumber)
+		switch op {
+		case OpInsert:
+			e.Op, e.After, e.Key = JournalInsert, record, ExtractKey(segments, record)
+		case OpUpdate:
+			e.Op, e.After, e.Key = JournalUpdate, record, ExtractKey(segments, before)
+		case OpDelete:
+			e.Op, e.Key = JournalDelete, ExtractKey(segments, before)
+		}
+		before = nil
+		return l.append(e)
+	})
+}
+
+// append writes one entry as a JSON line
+func (l *ChangeLog) append(e ChangeEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("change log: %w", err)
+	}
+	if l.NoSync {
+		return nil
+	}
+	return l.file.Sync()
+}
+
+// currentRecord reads the record at the file's current position, leaving
+// the position as it was
+func currentRecord(f *File, keyNumber int16) ([]byte, error) {
+	snapshot := f.SnapshotPosition()
+	defer f.RestorePosition(snapshot)
+	pos, err := f.GetPosition()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.GetDirect(pos, keyNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(OpGetDirect, resp); err != nil {
+		return nil, err
+	}
+	return resp.DataBuffer, nil
+}
+
+// ReadChangeLog calls fn for each entry of the log at path from byte
+// offset from (0 for the start, or the Next of the last entry handled) to
+// its end, and returns the offset to continue from. A torn last entry,
+// still being written or left by a crash, is not read.
+func ReadChangeLog(path string, from int64, fn func(ChangeEntry) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return from, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return from, err
+	}
+
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return from, nil
+		}
+		if err != nil {
+			return from, err
+		}
+		e := ChangeEntry{LSN: from, Next: from + int64(len(line))}
+		if err := json.Unmarshal(line, &e); err != nil {
+			return from, fmt.Errorf("change log entry at %d: %w", from, err)
+		}
+		if err := fn(e); err != nil {
+			return from, err
+		}
+		from = e.Next
+	}
+}
+
+// TailChangeLog reads the log at path from byte offset from like
+// ReadChangeLog, then keeps waiting for new entries until ctx is done or
+// fn fails. It returns the offset to resume from.
+func TailChangeLog(ctx context.Context, path string, from int64, fn func(ChangeEntry) error) (int64, error) {
+	ticker := time.NewTicker(ChangeLogPollInterval)
+	defer ticker.Stop()
+	for {
+		next, err := ReadChangeLog(path, from, fn)
+		from = next
+		if err != nil {
+			return from, err
+		}
+		select {
+		case <-ctx.Done():
+			return from, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyChange applies an entry to f, e.g. a replica or a copy restored
+// from an archive being rolled forward
+func ApplyChange(f *File, e ChangeEntry) error {
+	return apply(f, JournalEntry{Op: e.Op, KeyNumber: e.KeyNumber, Key: e.Key, Data: e.After})
+}
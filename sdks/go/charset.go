@@ -0,0 +1,198 @@
+package xtrieve
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Charset is a single-byte character set that string fields are stored
+// in. Schema fields naming a Charset are converted to UTF-8 when decoded
+// and back when encoded.
+type Charset struct {
+	Name   string
+	decode [256]rune
+	encode map[rune]byte
+}
+
+func newCharset(name, table string) *Charset {
+	c := &Charset{Name: name, encode: make(map[rune]byte, 256)}
+	i := 0
+	for _, r := range table {
+		c.decode[i] = r
+		if _, dup := c.encode[r]; !dup {
+			c.encode[r] = byte(i)
+		}
+		i++
+	}
+	if i != 256 {
+		panic(fmt.Sprintf("xtrieve: charset %s has %d characters", name, i))
+	}
+	return c
+}
+
+// CharsetEBCDIC is EBCDIC code page 037 (US/Canada)
+var CharsetEBCDIC = newCharset("ebcdic", ""+
+	"\x00\x01\x02\x03\u009c\x09\u0086\x7f\u0097\u008d\u008e\x0b\x0c\x0d\x0e\x0f"+
+	"\x10\x11\x12\x13\u009d\u0085\x08\u0087\x18\x19\u0092\u008f\x1c\x1d\x1e\x1f"+
+	"\u0080\u0081\u0082\u0083\u0084\x0a\x17\x1b\u0088\u0089\u008a\u008b\u008c\x05\x06\x07"+
+	"\u0090\u0091\x16\u0093\u0094\u0095\u0096\x04\u0098\u0099\u009a\u009b\x14\x15\u009e\x1a"+
+	" \u00a0âäàáãåçñ¢.<(+|"+
+	"&éêëèíîïìß!$*);¬"+
+	"-/ÂÄÀÁÃÅÇÑ¦,%_>?"+
+	"øÉÊËÈÍÎÏÌ`:#@'=\x22"+
+	"Øabcdefghi«»ðýþ±"+
+	"°jklmnopqrªºæ¸Æ¤"+
+	"µ~stuvwxyz¡¿ÐÝÞ®"+
+	"^£¥·©§¶¼½¾[]¯¨´×"+
+	"{ABCDEFGHI\u00adôöòóõ"+
+	"}JKLMNOPQR¹ûüùúÿ"+
+	"\x5c÷STUVWXYZ²ÔÖÒÓÕ"+
+	"0123456789³ÛÜÙÚ\u009f")
+
+// CharsetCP437 is the original IBM PC code page used by DOS programs
+var CharsetCP437 = newCharset("cp437", ascii+
+	"ÇüéâäàåçêëèïîìÄÅ"+
+	"ÉæÆôöòûùÿÖÜ¢£¥\u20a7\u0192"+
+	"áíóúñÑªº¿\u2310¬½¼¡«»"+
+	"\u2591\u2592\u2593\u2502\u2524\u2561\u2562\u2556\u2555\u2563\u2551\u2557\u255d\u255c\u255b\u2510"+
+	"\u2514\u2534\u252c\u251c\u2500\u253c\u255e\u255f\u255a\u2554\u2569\u2566\u2560\u2550\u256c\u2567"+
+	"\u2568\u2564\u2565\u2559\u2558\u2552\u2553\u256b\u256a\u2518\u250c\u2588\u2584\u258c\u2590\u2580"+
+	"\u03b1ß\u0393\u03c0\u03a3\u03c3µ\u03c4\u03a6\u0398\u03a9\u03b4\u221e\u03c6\u03b5\u2229"+
+	"\u2261±\u2265\u2264\u2320\u2321÷\u2248°\u2219·\u221a\u207f²\u25a0\u00a0")
+
+// CharsetCP850 is the DOS code page for Western European languages
+var CharsetCP850 = newCharset("cp850", ascii+
+	"ÇüéâäàåçêëèïîìÄÅ"+
+	"ÉæÆôöòûùÿÖÜø£Ø×\u0192"+
+	"áíóúñÑªº¿®¬½¼¡«»"+
+	"\u2591\u2592\u2593\u2502\u2524ÁÂÀ©\u2563\u2551\u2557\u255d¢¥\u2510"+
+	"\u2514\u2534\u252c\u251c\u2500\u253cãÃ\u255a\u2554\u2569\u2566\u2560\u2550\u256c¤"+
+	"ðÐÊËÈ\u0131ÍÎÏ\u2518\u250c\u2588\u2584¦Ì\u2580"+
+	"ÓßÔÒõÕµþÞÚÛÙýÝ¯´"+
+	"\u00ad±\u2017¾¶§÷¸°¨·¹³²\u25a0\u00a0")
+
+// CharsetCP1252 is the Windows code page for Western European languages.
+// Its five unassigned bytes map to the C1 controls of the same value.
+var CharsetCP1252 = newCharset("cp1252", ascii+
+	"\u20ac\u0081\u201a\u0192\u201e\u2026\u2020\u2021\u02c6\u2030\u0160\u2039\u0152\u008d\u017d\u008f"+
+	"\u0090\u2018\u2019\u201c\u201d\u2022\u2013\u2014\u02dc\u2122\u0161\u203a\u0153\u009d\u017e\u0178"+
+	"\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯"+
+	"°±²³´µ¶·¸¹º»¼½¾¿"+
+	"ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏ"+
+	"ÐÑÒÓÔÕÖ×ØÙÚÛÜÝÞß"+
+	"àáâãäåæçèéêëìíîï"+
+	"ðñòóôõö÷øùúûüýþÿ")
+
+// ascii is the lower half shared by the DOS and Windows code pages
+var ascii = func() string {
+	b := make([]byte, 128)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return string(b)
+}()
+
+// charsets holds the character sets by name
+var charsets = map[string]*Charset{
+	"ebcdic":       CharsetEBCDIC,
+	"cp037":        CharsetEBCDIC,
+	"cp437":        CharsetCP437,
+	"cp850":        CharsetCP850,
+	"cp1252":       CharsetCP1252,
+	"windows-1252": CharsetCP1252,
+}
+
+// CharsetByName returns a character set by name: "ebcdic" (or "cp037"),
+// "cp437", "cp850" or "cp1252" (or "windows-1252")
+func CharsetByName(name string) (*Charset, bool) {
+	c, ok := charsets[strings.ToLower(name)]
+	return c, ok
+}
+
+// Decode converts bytes in the character set to a UTF-8 string
+func (c *Charset) Decode(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+	for _, x := range b {
+		sb.WriteRune(c.decode[x])
+	}
+	return sb.String()
+}
+
+// Encode converts a UTF-8 string to bytes in the character set. Characters
+// the set lacks are an error.
+func (c *Charset) Encode(s string) ([]byte, error) {
+	b := make([]byte, 0, len(s))
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return nil, fmt.Errorf("invalid UTF-8 at byte %d", i)
+			}
+		}
+		x, ok := c.encode[r]
+		if !ok {
+			return nil, fmt.Errorf("%q has no %s encoding", r, c.Name)
+		}
+		b = append(b, x)
+	}
+	return b, nil
+}
+
+// Space returns the character set's space, used to pad STRING fields
+func (c *Charset) Space() byte {
+	return c.encode[' ']
+}
+
+// withCharset gives a field without a character set the schema's
+func (s *Schema) withCharset(f Field) (Field, error) {
+	if f.Charset != "" || s.Charset == "" {
+		return f, nil
+	}
+	if _, ok := CharsetByName(s.Charset); !ok {
+		return f, fmt.Errorf("xtrieve: unknown schema charset %q", s.Charset)
+	}
+	f.Charset = s.Charset
+	return f, nil
+}
+
+// charset returns the field's character set, nil for plain bytes
+func (f Field) charset() *Charset {
+	if f.Charset == "" {
+		return nil
+	}
+	c, _ := CharsetByName(f.Charset)
+	return c
+}
+
+// string decodes b, taking it as UTF-8 if c is nil
+func (c *Charset) string(b []byte) string {
+	if c == nil {
+		return string(b)
+	}
+	return c.Decode(b)
+}
+
+// bytes encodes s, taking it as UTF-8 if c is nil
+func (c *Charset) bytes(s string) ([]byte, error) {
+	if c == nil {
+		return []byte(s), nil
+	}
+	return c.Encode(s)
+}
+
+// ascii decodes the digits and signs of a zoned decimal. Characters
+// outside ASCII become '?' and fail to parse.
+func (c *Charset) ascii(b []byte) []byte {
+	if c == nil {
+		return b
+	}
+	out := make([]byte, len(b))
+	for i, x := range b {
+		out[i] = '?'
+		if r := c.decode[x]; r < utf8.RuneSelf {
+			out[i] = byte(r)
+		}
+	}
+	return out
+}
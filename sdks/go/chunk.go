@@ -0,0 +1,243 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Mutation is one write applied by a Chunker, typically an Insert, Update
+// or Delete on a file opened on the Chunker's client. It may run more than
+// once when its chunk is retried, so it must not depend on state left by
+// an earlier run.
+type Mutation func() error
+
+// Chunker applies a stream of mutations in transactions of at most MaxOps
+// mutations or MaxDuration each, committing between chunks. A single
+// transaction over millions of writes holds its locks and pre-images on
+// the server until the end, while a transaction per write makes every
+// write wait for its own commit; chunks bound the first and amortize the
+// second.
+//
+// A chunk that fails on a transport error or a locked record or file is
+// rolled back and replayed from its first mutation, after Retry's delay;
+// earlier chunks stay committed. Other failures roll the chunk back and
+// stop the run.
+//
+//	ch := &xtrieve.Chunker{Client: client, MaxOps: 500, MaxDuration: time.Second, Retry: xtrieve.DefaultBackoff}
+//	n, err := ch.Run(ctx, func() (xtrieve.Mutation, error) {
+//	    row, err := src.Next()
+//	    if err != nil {
+//	        return nil, err // io.EOF after the last row
+//	    }
+//	    return func() error { return insert(orders, row) }, nil
+//	})
+//	// On error, the first n mutations are committed; a new run resumes
+//	// after them
+type Chunker struct {
+	// Client is the connection the transactions run on. Transactions
+	// belong to a connection, so the mutations must use files opened on
+	// this client, which nothing else may use during the run.
+	Client *Client
+	// MaxOps is the number of mutations per transaction (default 100)
+	MaxOps int
+	// MaxDuration, if set, commits a chunk once it has been open this
+	// long, even with fewer than MaxOps mutations
+	MaxDuration time.Duration
+	// LockMode is the transaction's lock mode, e.g. LockNone
+	LockMode uint16
+	// Retry controls how failed chunks are retried; the zero Backoff does
+	// not retry. A chunk that fails MaxAttempts times stops the run.
+	Retry Backoff
+	// OnCommit, if set, is called after each chunk commits with the total
+	// number of mutations committed, e.g. to checkpoint the position in
+	// the source. An error stops the run.
+	OnCommit func(committed int) error
+	// Progress, if set, receives progress reports as chunks commit.
+	// Total, if known, is the expected mutation count.
+	Progress Progress
+	Total    int64
+}
+
+// Run applies the mutations returned by next until it returns io.EOF and
+// returns the number of mutations committed. Each mutation runs as it
+// arrives; its chunk commits once it holds MaxOps mutations or has been
+// open MaxDuration, checked as mutations arrive, and after the last one.
+// Mutations are committed in order, so after a failure the first n are in
+// the files and none of the others are.
+//
+// A transport error while committing is not retried: the server may have
+// committed the chunk before the connection broke, and replaying it could
+// apply it twice. Run returns the error with the count of the chunks
+// before it, and the caller decides, e.g. by reading the last record
+// written, where to resume.
+func (ch *Chunker) Run(ctx context.Context, next func() (Mutation, error)) (int, error) {
+	if ch.Client == nil {
+		return 0, errors.New("xtrieve: Chunker needs Client")
+	}
+	maxOps := ch.MaxOps
+	if maxOps <= 0 {
+		maxOps = 100
+	}
+
+	tx := &chunkTx{client: ch.Client, lockMode: ch.LockMode}
+	defer tx.rollback()
+	tracker := newProgressTracker(ch.Progress, ch.Total)
+	defer tracker.done()
+	committed := 0
+	chunk := make([]Mutation, 0, maxOps)
+
+	commit := func() error {
+		err := ch.retry(ctx, func() (bool, error) {
+			if !tx.open {
+				if err := tx.apply(chunk); err != nil {
+					return false, err
+				}
+			}
+			return tx.commit()
+		})
+		if err != nil {
+			return err
+		}
+		committed += len(chunk)
+		tracker.add(len(chunk), 0)
+		chunk = chunk[:0]
+		if ch.OnCommit != nil {
+			return ch.OnCommit(committed)
+		}
+		return nil
+	}
+
+	for {
+		m, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return committed, err
+		}
+		chunk = append(chunk, m)
+		err = ch.retry(ctx, func() (bool, error) {
+			return false, tx.apply(chunk)
+		})
+		if err != nil {
+			return committed, err
+		}
+		if len(chunk) >= maxOps || (ch.MaxDuration > 0 && time.Since(tx.started) >= ch.MaxDuration) {
+			if err := commit(); err != nil {
+				return committed, err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := commit(); err != nil {
+			return committed, err
+		}
+	}
+	return committed, nil
+}
+
+// retry calls fn until it succeeds, fails for good or Retry gives up.
+// fn reports whether its failure is final whatever the error.
+func (ch *Chunker) retry(ctx context.Context, fn func() (final bool, err error)) error {
+	for attempt := 1; ; attempt++ {
+		final, err := fn()
+		if err == nil {
+			return nil
+		}
+		if final || !retryableChunkError(err) ||
+			ch.Retry.Initial <= 0 || (ch.Retry.MaxAttempts > 0 && attempt >= ch.Retry.MaxAttempts) {
+			return err
+		}
+
+		timer := time.NewTimer(ch.Retry.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %w)", ctx.Err(), err)
+		case <-timer.C:
+		}
+		if isTransportError(err) {
+			// Sessions survive reconnects, so this rolls back the
+			// transaction the broken connection left open
+			if err := ch.Client.ReconnectContext(ctx); err != nil {
+				return err
+			}
+			ch.Client.AbortTransaction(nil)
+		}
+	}
+}
+
+// chunkTx is a Chunker's open transaction
+type chunkTx struct {
+	client   *Client
+	lockMode uint16
+	open     bool
+	started  time.Time
+}
+
+// apply runs the last mutation of chunk in the open transaction, or, with
+// none open, begins one and runs the whole chunk, replaying it after a
+// rollback. A failed mutation rolls the transaction back.
+func (tx *chunkTx) apply(chunk []Mutation) error {
+	pending := chunk[len(chunk)-1:]
+	if !tx.open {
+		resp, err := tx.client.BeginTransaction(nil, tx.lockMode)
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(OpBeginTransaction, resp); err != nil {
+			return err
+		}
+		tx.open, tx.started = true, time.Now()
+		pending = chunk
+	}
+	for _, m := range pending {
+		if err := m(); err != nil {
+			tx.rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+// commit ends the transaction. A transport error is final, since the
+// server may have committed before the connection broke.
+func (tx *chunkTx) commit() (final bool, err error) {
+	resp, err := tx.client.EndTransaction(nil)
+	if err != nil {
+		tx.open = false
+		return true, err
+	}
+	if err := checkStatus(OpEndTransaction, resp); err != nil {
+		tx.rollback()
+		return false, err
+	}
+	tx.open = false
+	return false, nil
+}
+
+// rollback aborts the open transaction, if any
+func (tx *chunkTx) rollback() {
+	if tx.open {
+		tx.client.AbortTransaction(nil)
+		tx.open = false
+	}
+}
+
+// retryableChunkError reports whether a chunk that failed with err may
+// succeed when replayed: the connection broke, or another client held a
+// record or file it needed
+func retryableChunkError(err error) bool {
+	return isTransportError(err) || IsStatus(err, StatusRecordLocked) || IsStatus(err, StatusFileLocked)
+}
+
+// isTransportError reports whether err came from the connection rather
+// than the server or the caller
+func isTransportError(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
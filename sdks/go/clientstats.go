@@ -0,0 +1,160 @@
+package xtrieve
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// latencyBuckets is the number of power-of-two latency buckets, from under
+// a microsecond to over half an hour
+const latencyBuckets = 32
+
+// OpStats summarizes operations: how many ran, how many failed with a
+// status or transport error, and how long they took
+type OpStats struct {
+	Calls  uint64        `json:"calls"`
+	Errors uint64        `json:"errors"`
+	Total  time.Duration `json:"total"`
+	Min    time.Duration `json:"min"`
+	Max    time.Duration `json:"max"`
+	// P50, P90 and P99 are latency percentiles, accurate to a factor of two
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+}
+
+// Mean returns the average latency
+func (s OpStats) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Calls)
+}
+
+// ClientStats is a snapshot of a client's operations, returned by
+// Client.Stats
+type ClientStats struct {
+	// Since is when the client connected or its statistics were reset
+	Since time.Time `json:"since"`
+	// Ops holds the statistics of each operation, by OpName
+	Ops map[string]OpStats `json:"ops"`
+	// Files holds the statistics of all operations on each file, by path;
+	// operations on no file, such as transactions, are left out
+	Files map[string]OpStats `json:"files"`
+}
+
+// opCounter accumulates the statistics of one operation or file
+type opCounter struct {
+	calls, errors uint64
+	total         time.Duration
+	min, max      time.Duration
+	buckets       [latencyBuckets]uint64
+}
+
+func (o *opCounter) add(d time.Duration, failed bool) {
+	if o.calls == 0 || d < o.min {
+		o.min = d
+	}
+	o.max = max(o.max, d)
+	o.calls++
+	o.total += d
+	if failed {
+		o.errors++
+	}
+	o.buckets[min(latencyBuckets-1, bits.Len64(uint64(d/time.Microsecond)))]++
+}
+
+func (o *opCounter) snapshot() OpStats {
+	s := OpStats{Calls: o.calls, Errors: o.errors, Total: o.total, Min: o.min, Max: o.max}
+	s.P50, s.P90, s.P99 = o.percentile(50), o.percentile(90), o.percentile(99)
+	return s
+}
+
+// percentile returns the upper bound of the bucket holding the p-th
+// percentile, capped at the largest latency seen
+func (o *opCounter) percentile(p uint64) time.Duration {
+	if o.calls == 0 {
+		return 0
+	}
+	rank := (o.calls*p + 99) / 100
+	var seen uint64
+	for i, n := range o.buckets {
+		if seen += n; seen >= rank {
+			return min(o.max, time.Duration(uint64(1)<<i)*time.Microsecond)
+		}
+	}
+	return o.max
+}
+
+// clientStats accumulates a client's statistics; it has its own lock so
+// Stats does not wait for an operation in flight
+type clientStats struct {
+	mu    sync.Mutex
+	since time.Time
+	ops   map[uint16]*opCounter
+	files map[string]*opCounter
+}
+
+// record counts one operation
+func (s *clientStats) record(req *Request, resp *Response, err error, d time.Duration) {
+	failed := err != nil || resp.StatusCode != StatusSuccess
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ops == nil {
+		s.ops = make(map[uint16]*opCounter)
+		s.files = make(map[string]*opCounter)
+	}
+	op := s.ops[req.Operation]
+	if op == nil {
+		op = &opCounter{}
+		s.ops[req.Operation] = op
+	}
+	op.add(d, failed)
+
+	path := req.FilePath
+	if path == "" {
+		// Looking up the position block's bytes does not allocate
+		file := s.files[string(requestFileBytes(req.PositionBlock))]
+		if file != nil {
+			file.add(d, failed)
+			return
+		}
+		path = requestFile(req)
+	}
+	if path == "" {
+		return
+	}
+	file := s.files[path]
+	if file == nil {
+		file = &opCounter{}
+		s.files[path] = file
+	}
+	file.add(d, failed)
+}
+
+// Stats returns the number, failures and latency of the client's
+// operations since it connected or since ResetStats, by operation and by
+// file. Statistics are always kept, without allocating per operation.
+func (c *Client) Stats() *ClientStats {
+	s := &c.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := &ClientStats{Since: s.since, Ops: make(map[string]OpStats), Files: make(map[string]OpStats)}
+	for op, o := range s.ops {
+		stats.Ops[OpName(op)] = o.snapshot()
+	}
+	for path, o := range s.files {
+		stats.Files[path] = o.snapshot()
+	}
+	return stats
+}
+
+// ResetStats clears the client's statistics
+func (c *Client) ResetStats() {
+	s := &c.stats
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.since = time.Now()
+	s.ops, s.files = nil, nil
+}
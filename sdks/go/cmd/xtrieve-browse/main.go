@@ -0,0 +1,555 @@
+// Command xtrieve-browse is a full-screen terminal browser for Xtrieve files
+//
+//	xtrieve-browse -schema customers.dat=customers.json customers.dat orders.dat
+//
+// Pick a file from the list to see its key definitions and page through its
+// records. Fields are decoded when a schema is given for the file.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+	"golang.org/x/term"
+)
+
+// Keys decoded from terminal input
+const (
+	keyUp = iota + 1000
+	keyDown
+	keyPageUp
+	keyPageDown
+	keyEnter
+	keyEscape
+	keyBackspace
+)
+
+type schemaFlags map[string]string
+
+func (s schemaFlags) String() string { return fmt.Sprint(map[string]string(s)) }
+
+func (s schemaFlags) Set(v string) error {
+	file, schema, ok := strings.Cut(v, "=")
+	if !ok {
+		return errors.New("expected <file>=<schema.json>")
+	}
+	s[file] = schema
+	return nil
+}
+
+type browser struct {
+	client  *xtrieve.Client
+	paths   []string
+	schemas map[string]*xtrieve.Schema
+	in      *bufio.Reader
+	out     *bufio.Writer
+	width   int
+	height  int
+	message string
+}
+
+// view is the state of the record browser for one file
+type view struct {
+	file      *xtrieve.File
+	schema    *xtrieve.Schema
+	stat      *xtrieve.FileStat
+	keyNumber int16
+	tokens    []string // page tokens of the pages before the current one
+	token     string
+	page      *xtrieve.Page
+	selected  int
+}
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	schemaFiles := schemaFlags{}
+	flag.Var(schemaFiles, "schema", "schema for a file, as <file>=<schema.json> (repeatable)")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: xtrieve-browse [-host h] [-port p] [-schema file=schema.json] file...")
+		os.Exit(2)
+	}
+	if err := run(*host, *port, flag.Args(), schemaFiles); err != nil {
+		fmt.Fprintf(os.Stderr, "xtrieve-browse: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(host string, port int, paths []string, schemaFiles schemaFlags) error {
+	schemas := make(map[string]*xtrieve.Schema)
+	for file, path := range schemaFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		schema, err := xtrieve.ParseSchemaJSON(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		schemas[file] = schema
+	}
+
+	client, err := xtrieve.Connect(host, port)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	b := &browser{
+		client:  client,
+		paths:   paths,
+		schemas: schemas,
+		in:      bufio.NewReader(os.Stdin),
+		out:     bufio.NewWriter(os.Stdout),
+	}
+	defer b.out.Flush()
+	defer fmt.Fprint(b.out, "\x1b[H\x1b[2J")
+	return b.fileList()
+}
+
+// fileList lets the user pick a file to browse
+func (b *browser) fileList() error {
+	selected := 0
+	for {
+		b.begin()
+		b.line("\x1b[1mXtrieve files\x1b[0m")
+		b.line("")
+		for i, path := range b.paths {
+			b.row(i == selected, "  "+path)
+		}
+		b.footer("↑/↓ select  Enter browse  q quit")
+
+		switch k := b.readKey(); k {
+		case keyUp:
+			selected = max(selected-1, 0)
+		case keyDown:
+			selected = min(selected+1, len(b.paths)-1)
+		case keyEnter:
+			if err := b.browse(b.paths[selected]); err != nil {
+				b.message = err.Error()
+			}
+		case 'q', keyEscape:
+			return nil
+		}
+	}
+}
+
+// browse pages through the records of one file
+func (b *browser) browse(path string) error {
+	f, err := b.client.OpenFile(path, -1)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	v := &view{file: f, schema: b.schemas[path], stat: stat}
+	if err := b.load(v); err != nil {
+		return err
+	}
+
+	for {
+		b.drawView(v)
+
+		switch k := b.readKey(); k {
+		case keyUp:
+			v.selected = max(v.selected-1, 0)
+		case keyDown:
+			v.selected = min(v.selected+1, len(v.page.Records)-1)
+		case keyPageDown, 'n':
+			if v.page.NextToken != "" {
+				v.tokens = append(v.tokens, v.token)
+				v.token = v.page.NextToken
+				b.reload(v)
+			}
+		case keyPageUp, 'p':
+			if len(v.tokens) > 0 {
+				v.token = v.tokens[len(v.tokens)-1]
+				v.tokens = v.tokens[:len(v.tokens)-1]
+				b.reload(v)
+			}
+		case 'k':
+			v.keyNumber = (v.keyNumber + 1) % int16(max(countKeys(v.stat), 1))
+			v.tokens, v.token = nil, ""
+			b.reload(v)
+		case '/':
+			b.search(v)
+		case keyEnter:
+			b.detail(v)
+		case 'e':
+			b.edit(v)
+		case 'q', keyEscape:
+			return nil
+		}
+	}
+}
+
+func (b *browser) reload(v *view) {
+	if err := b.load(v); err != nil {
+		b.message = err.Error()
+	}
+}
+
+// load fetches the current page
+func (b *browser) load(v *view) error {
+	page, err := v.file.Page(v.keyNumber, v.token, b.pageSize())
+	if err != nil {
+		return err
+	}
+	v.page = page
+	v.selected = min(v.selected, max(len(page.Records)-1, 0))
+	return nil
+}
+
+func (b *browser) drawView(v *view) {
+	b.begin()
+	b.line(fmt.Sprintf("\x1b[1m%s\x1b[0m  %d records, record length %d, key %d",
+		v.file.Path(), v.stat.NumRecords, v.stat.RecordLength, v.keyNumber))
+
+	key := 0
+	for _, k := range v.stat.Keys {
+		marker := " "
+		if int16(key) == v.keyNumber {
+			marker = "*"
+		}
+		b.line(fmt.Sprintf(" %s key %d: pos %d len %d type %d flags 0x%04x",
+			marker, key, k.Position, k.Length, k.Type, k.Flags))
+		if k.Flags&xtrieve.KeyFlagSegmented == 0 {
+			key++
+		}
+	}
+	b.line("")
+
+	if v.schema != nil {
+		names := make([]string, len(v.schema.Fields))
+		for i, field := range v.schema.Fields {
+			names[i] = field.Name
+		}
+		b.line("\x1b[4m  " + strings.Join(names, " │ ") + "\x1b[0m")
+	}
+	for i, rec := range v.page.Records {
+		b.row(i == v.selected, "  "+summarize(v.schema, rec))
+	}
+	if len(v.page.Records) == 0 {
+		b.line("  (no records)")
+	}
+	b.footer("↑/↓ select  n/p page  / search  Enter view  e edit  k next key  q back")
+}
+
+// search positions the view at the first record >= a key value
+func (b *browser) search(v *view) {
+	segments := v.file.KeySegments(v.keyNumber)
+	values := make([]string, len(segments))
+	for i, seg := range segments {
+		text, ok := b.prompt(fmt.Sprintf("key %d segment %d (type %d): ", v.keyNumber, i, seg.Type))
+		if !ok {
+			return
+		}
+		values[i] = text
+	}
+
+	key, err := buildKey(segments, values)
+	if err != nil {
+		b.message = err.Error()
+		return
+	}
+	resp, err := v.file.Get(xtrieve.OpGetGreaterOrEqual, key, v.keyNumber)
+	if err != nil {
+		b.message = err.Error()
+		return
+	}
+	if resp.StatusCode != xtrieve.StatusSuccess {
+		b.message = fmt.Sprintf("not found (status %d)", resp.StatusCode)
+		return
+	}
+
+	// Page from just before the found key by building a token-free view:
+	// read forward from the found record
+	v.tokens = append(v.tokens, v.token)
+	page := &xtrieve.Page{Records: [][]byte{resp.DataBuffer}, Keys: [][]byte{resp.KeyBuffer}}
+	for len(page.Records) < b.pageSize() {
+		next, err := v.file.GetNext(v.keyNumber)
+		if err != nil || next.StatusCode != xtrieve.StatusSuccess {
+			break
+		}
+		page.Records = append(page.Records, next.DataBuffer)
+		page.Keys = append(page.Keys, next.KeyBuffer)
+	}
+	v.page, v.selected, v.token = page, 0, ""
+}
+
+// detail shows every field of the selected record
+func (b *browser) detail(v *view) {
+	if len(v.page.Records) == 0 {
+		return
+	}
+	rec := v.page.Records[v.selected]
+	b.begin()
+	b.line("\x1b[1mRecord\x1b[0m")
+	b.line("")
+	if v.schema != nil {
+		values, err := v.schema.Decode(rec)
+		if err == nil {
+			for _, field := range v.schema.Fields {
+				b.line(fmt.Sprintf("  %-20s %v", field.Name, formatValue(values[field.Name])))
+			}
+		}
+	}
+	for _, l := range strings.Split(strings.TrimRight(hex.Dump(rec), "\n"), "\n") {
+		b.line("  " + l)
+	}
+	b.footer("any key to return")
+	b.readKey()
+}
+
+// edit prompts for new field values and updates the selected record
+func (b *browser) edit(v *view) {
+	if v.schema == nil {
+		b.message = "editing needs a schema (-schema file=schema.json)"
+		return
+	}
+	if len(v.page.Records) == 0 {
+		return
+	}
+	old := v.page.Records[v.selected]
+	rec := append([]byte(nil), old...)
+
+	values, err := v.schema.Decode(rec)
+	if err != nil {
+		b.message = err.Error()
+		return
+	}
+	for _, field := range v.schema.Fields {
+		text, ok := b.prompt(fmt.Sprintf("%s [%v]: ", field.Name, formatValue(values[field.Name])))
+		if !ok {
+			return
+		}
+		if text == "" {
+			continue
+		}
+		value, err := xtrieve.ParseValue(field.Type, text)
+		if err == nil {
+			err = field.Encode(rec, value)
+		}
+		if err != nil {
+			b.message = fmt.Sprintf("%s: %v", field.Name, err)
+			return
+		}
+	}
+
+	if err := positionOn(v.file, v.keyNumber, old); err != nil {
+		b.message = err.Error()
+		return
+	}
+	resp, err := v.file.Update(rec, v.keyNumber)
+	switch {
+	case err != nil:
+		b.message = err.Error()
+	case resp.StatusCode != xtrieve.StatusSuccess:
+		b.message = fmt.Sprintf("update failed with status %d", resp.StatusCode)
+	default:
+		v.page.Records[v.selected] = rec
+		b.message = "record updated"
+	}
+}
+
+// positionOn makes record the current record of f, walking duplicates of
+// its key until the exact record is found
+func positionOn(f *xtrieve.File, keyNumber int16, record []byte) error {
+	key := xtrieve.ExtractKey(f.KeySegments(keyNumber), record)
+	resp, err := f.GetEqual(key, keyNumber)
+	for err == nil && resp.StatusCode == xtrieve.StatusSuccess && bytes.Equal(resp.KeyBuffer, key) {
+		if bytes.Equal(resp.DataBuffer, record) {
+			return nil
+		}
+		resp, err = f.GetNext(keyNumber)
+	}
+	if err != nil {
+		return err
+	}
+	return errors.New("record changed since it was read")
+}
+
+// buildKey encodes one value per key segment into a key buffer
+func buildKey(segments []xtrieve.KeySpec, values []string) ([]byte, error) {
+	var key []byte
+	for i, seg := range segments {
+		field := xtrieve.Field{Name: fmt.Sprintf("segment %d", i), Length: int(seg.Length), Type: seg.Type}
+		buf := make([]byte, seg.Length)
+		v, err := xtrieve.ParseValue(seg.Type, values[i])
+		if err == nil {
+			err = field.Encode(buf, v)
+		}
+		if err != nil {
+			return nil, err
+		}
+		key = append(key, buf...)
+	}
+	return key, nil
+}
+
+func countKeys(stat *xtrieve.FileStat) int {
+	n := 0
+	for _, k := range stat.Keys {
+		if k.Flags&xtrieve.KeyFlagSegmented == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// summarize renders a record on one line
+func summarize(schema *xtrieve.Schema, rec []byte) string {
+	if schema == nil {
+		return hex.EncodeToString(rec)
+	}
+	values, err := schema.Decode(rec)
+	if err != nil {
+		return hex.EncodeToString(rec)
+	}
+	parts := make([]string, len(schema.Fields))
+	for i, field := range schema.Fields {
+		parts[i] = fmt.Sprint(formatValue(values[field.Name]))
+	}
+	return strings.Join(parts, " │ ")
+}
+
+func formatValue(v any) any {
+	if raw, ok := v.([]byte); ok {
+		return hex.EncodeToString(raw)
+	}
+	return v
+}
+
+// ========== Terminal ==========
+
+func (b *browser) pageSize() int {
+	_, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		h = 24
+	}
+	return max(h-12, 5)
+}
+
+func (b *browser) begin() {
+	w, h, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		w, h = 80, 24
+	}
+	b.width, b.height = w, h
+	fmt.Fprint(b.out, "\x1b[H\x1b[2J")
+}
+
+func (b *browser) line(s string) {
+	fmt.Fprint(b.out, clip(s, b.width), "\r\n")
+}
+
+func (b *browser) row(selected bool, s string) {
+	if selected {
+		fmt.Fprint(b.out, "\x1b[7m", clip(s, b.width), "\x1b[0m\r\n")
+		return
+	}
+	b.line(s)
+}
+
+func (b *browser) footer(help string) {
+	fmt.Fprintf(b.out, "\x1b[%d;1H", b.height-1)
+	if b.message != "" {
+		fmt.Fprint(b.out, "\x1b[1m", clip(b.message, b.width), "\x1b[0m")
+		b.message = ""
+	}
+	fmt.Fprintf(b.out, "\x1b[%d;1H\x1b[7m%s\x1b[0m", b.height, clip(help, b.width))
+	b.out.Flush()
+}
+
+// prompt reads a line of text on the bottom line; ok is false on Escape
+func (b *browser) prompt(label string) (string, bool) {
+	var text []rune
+	for {
+		fmt.Fprintf(b.out, "\x1b[%d;1H\x1b[2K%s%s", b.height-1, label, string(text))
+		b.out.Flush()
+
+		switch k := b.readKey(); {
+		case k == keyEnter:
+			return string(text), true
+		case k == keyEscape:
+			return "", false
+		case k == keyBackspace:
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case k >= ' ' && k < keyUp:
+			text = append(text, rune(k))
+		}
+	}
+}
+
+// readKey reads one key press from the raw terminal
+func (b *browser) readKey() int {
+	r, _, err := b.in.ReadRune()
+	if err != nil {
+		return 'q'
+	}
+	switch r {
+	case '\r', '\n':
+		return keyEnter
+	case 127, 8:
+		return keyBackspace
+	case 3: // Ctrl-C
+		return 'q'
+	case 27:
+		if b.in.Buffered() == 0 {
+			return keyEscape
+		}
+		seq := make([]byte, 0, 4)
+		for b.in.Buffered() > 0 && len(seq) < 4 {
+			c, _ := b.in.ReadByte()
+			seq = append(seq, c)
+			if c >= 'A' && c <= 'Z' || c == '~' {
+				break
+			}
+		}
+		switch string(seq) {
+		case "[A", "OA":
+			return keyUp
+		case "[B", "OB":
+			return keyDown
+		case "[5~":
+			return keyPageUp
+		case "[6~":
+			return keyPageDown
+		}
+		return 0
+	}
+	return int(r)
+}
+
+func clip(s string, width int) string {
+	if width <= 0 {
+		return s
+	}
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+// Command xtrieve-capacity reports how Xtrieve files use their pages
+//
+//	xtrieve-capacity -sample 10000 -growth 2500 customers.dat orders.dat
+//
+// For each file it prints the record count and layout from Stat, the
+// length distribution of a sample of records read in physical order
+// (a histogram for variable-length files), estimated page counts by kind
+// and how full they are. With -growth, the expected records added per
+// day, it projects the file's size after each of the -days periods.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	sample := flag.Int("sample", 10000, "records to read lengths from (0: all)")
+	growth := flag.Float64("growth", 0, "records added per day, to project growth")
+	days := flag.String("days", "30,90,365", "days to project growth over, comma-separated")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: xtrieve-capacity [-sample n] [-growth records/day] [-days 30,90,365] file...")
+		os.Exit(2)
+	}
+	periods, err := parseDays(*days)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := xtrieve.Connect(*host, *port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for i, path := range flag.Args() {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := report(ctx, client, path, *sample, *growth, periods); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+// report prints the capacity report of one file
+func report(ctx context.Context, client *xtrieve.Client, path string, sample int, growth float64, days []int) error {
+	f, err := client.OpenFile(path, -1)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r, err := xtrieve.Capacity(ctx, f, sample)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n", path)
+	if err := r.WriteReport(os.Stdout); err != nil {
+		return err
+	}
+	if growth <= 0 {
+		return nil
+	}
+	for _, d := range days {
+		records := r.Records + uint64(growth*float64(d))
+		pages, bytes := r.Project(records)
+		fmt.Printf("in %d days: %d records, %d pages, %d bytes\n", d, records, pages, bytes)
+	}
+	return nil
+}
+
+func parseDays(s string) ([]int, error) {
+	var days []int
+	for _, part := range strings.Split(s, ",") {
+		d, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid -days value %q", part)
+		}
+		days = append(days, d)
+	}
+	return days, nil
+}
@@ -0,0 +1,105 @@
+// Command xtrieve-conformance checks Xtrieve clients and servers against
+// the protocol fixtures of the conformance package
+//
+//	xtrieve-conformance -dir tmp             # run the scenario on a live server
+//	xtrieve-conformance -serve 127.0.0.1:7420 # serve the wire cases to an SDK's tests
+//	xtrieve-conformance -dump > suite.json   # write the fixtures
+//
+// The scenario creates conformance.dat in -dir on the server and prints
+// each step with ok or what the server returned instead. With -serve it
+// answers the requests of the wire cases with their golden responses and
+// prints every request that matches none, naming the first byte and field
+// that differ; on interrupt it lists the cases never requested.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+	"github.com/eduardostern/xtrieve-go/conformance"
+)
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	dir := flag.String("dir", "", "server directory to create the scenario's file in")
+	serve := flag.String("serve", "", "serve the wire cases on this address instead")
+	dump := flag.Bool("dump", false, "write the fixtures as JSON to standard output")
+	flag.Parse()
+
+	if *dump {
+		os.Stdout.Write(conformance.JSON())
+		return
+	}
+	suite, err := conformance.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *serve != "" {
+		if err := serveCases(ctx, suite, *serve); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	client, err := xtrieve.Connect(*host, *port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	results, err := suite.Run(ctx, client, *dir)
+	failed := false
+	for _, r := range results {
+		if r.Err != nil {
+			failed = true
+			fmt.Printf("FAIL %-24s %v\n", r.Step, r.Err)
+			continue
+		}
+		fmt.Printf("ok   %s\n", r.Step)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if failed || len(results) < len(suite.Scenario) {
+		fmt.Printf("%d of %d steps passed\n", len(results)-1, len(suite.Scenario))
+		os.Exit(1)
+	}
+	fmt.Printf("all %d steps passed\n", len(results))
+}
+
+// serveCases serves the wire cases until ctx is done
+func serveCases(ctx context.Context, suite *conformance.Suite, addr string) error {
+	srv, err := conformance.NewServer(suite)
+	if err != nil {
+		return err
+	}
+	srv.OnMismatch = func(m conformance.Mismatch) {
+		log.Printf("mismatch: %v", m)
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving %d wire cases on %s", len(suite.Wire), ln.Addr())
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	if err := srv.Serve(ln); err != nil {
+		return err
+	}
+	if unserved := srv.Unserved(); len(unserved) > 0 {
+		log.Printf("%d cases never requested: %v", len(unserved), unserved)
+	}
+	return nil
+}
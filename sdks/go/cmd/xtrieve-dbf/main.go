@@ -0,0 +1,128 @@
+// Command xtrieve-dbf imports dBASE, Clipper and FoxPro tables
+//
+//	xtrieve-dbf -index CUSTNO.NTX -index CUSTNAME.NTX CUSTOMER.DBF
+//
+// Each table is loaded into a file of the same name with a .dat extension,
+// created with one key per -index file (Clipper .ntx or dBASE .ndx) or per
+// -key expression, and its schema is written next to it as .json for the
+// other tools. Memo fields, read from the table's .dbt or .fpt file, are
+// stored as document values after the fixed fields. With -n the table is
+// read and encoded without connecting or writing anything, to preview the
+// import.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ", ") }
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	out := flag.String("o", "", "file to create (default: the table name with .dat)")
+	charset := flag.String("charset", "", "code page of the table, overriding its header (e.g. cp850)")
+	dryRun := flag.Bool("n", false, "dry run: report what would be imported without writing")
+	var indexes, keys listFlag
+	flag.Var(&indexes, "index", "index file whose key expression becomes a key (repeatable)")
+	flag.Var(&keys, "key", "key expression such as UPPER(NAME)+DTOS(SINCE) (repeatable)")
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: xtrieve-dbf [-n] [-o file.dat] [-index file.ntx]... [-key expr]... [-charset cp850] table.dbf")
+		os.Exit(2)
+	}
+	table := flag.Arg(0)
+	path := *out
+	if path == "" {
+		path = strings.ToLower(strings.TrimSuffix(filepath.Base(table), filepath.Ext(table))) + ".dat"
+	}
+
+	d, err := xtrieve.OpenDBF(table)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer d.Close()
+	if *charset != "" {
+		d.Charset = *charset
+	}
+	schema, err := d.Schema()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, index := range indexes {
+		expr, err := xtrieve.ReadDBFIndex(index)
+		if err != nil {
+			log.Fatal(err)
+		}
+		keys = append(keys, expr)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *dryRun {
+		report := &xtrieve.DryRunReport{}
+		im := &xtrieve.DBFImport{Path: path, DBF: d, Schema: schema, Indexes: keys, DryRun: report}
+		if _, err := im.Run(ctx); err != nil {
+			log.Fatalf("%s: %v", table, err)
+		}
+		fmt.Printf("would import %s into %s (%d fields)\n", report, path, len(schema.Fields))
+		for _, key := range report.Keys {
+			fmt.Printf("  key %q\n", key)
+		}
+		return
+	}
+
+	def, err := schema.JSON()
+	if err != nil {
+		log.Fatal(err)
+	}
+	schemaPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+	if err := os.WriteFile(schemaPath, def, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	client, err := xtrieve.Connect(*host, *port)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer client.Close()
+
+	im := &xtrieve.DBFImport{
+		Client:  client,
+		Path:    path,
+		DBF:     d,
+		Schema:  schema,
+		Indexes: keys,
+		Progress: xtrieve.ProgressFunc(func(p xtrieve.ProgressInfo) {
+			if !p.Done {
+				log.Printf("%s: %d/%d records, %v left", table, p.Records, p.Total, p.ETA.Round(time.Second))
+			}
+		}),
+	}
+	start := time.Now()
+	n, err := im.Run(ctx)
+	if err != nil {
+		log.Fatalf("%s: %v", table, err)
+	}
+	log.Printf("%s: %d records into %s in %v, schema in %s", table, n, path, time.Since(start).Round(time.Millisecond), schemaPath)
+}
@@ -0,0 +1,510 @@
+// Command xtrieve-shell is an interactive shell for an Xtrieve server
+//
+//	xtrieve-shell -host 127.0.0.1 -port 7419
+//	xtrieve> open customers.dat
+//	customers.dat> schema customers.json
+//	customers.dat> get 0 1001
+//	customers.dat> scan 0 20
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+const historyFile = ".xtrieve_history"
+
+type shell struct {
+	client  *xtrieve.Client
+	files   map[string]*xtrieve.File
+	schemas map[string]*xtrieve.Schema
+	current string
+	history []string
+	out     io.Writer
+}
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	flag.Parse()
+
+	client, err := xtrieve.Connect(*host, *port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "xtrieve-shell: %v\n", err)
+		os.Exit(1)
+	}
+	defer client.Close()
+
+	sh := &shell{
+		client:  client,
+		files:   make(map[string]*xtrieve.File),
+		schemas: make(map[string]*xtrieve.Schema),
+		out:     os.Stdout,
+	}
+	sh.loadHistory()
+	defer sh.saveHistory()
+
+	fmt.Fprintf(sh.out, "Connected to %s:%d. Type \"help\" for commands.\n", *host, *port)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(sh.out, sh.prompt())
+		if !scanner.Scan() {
+			fmt.Fprintln(sh.out)
+			return
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line == "quit" || line == "exit" {
+			return
+		}
+		sh.history = append(sh.history, line)
+		if err := sh.run(line); err != nil {
+			fmt.Fprintf(sh.out, "error: %v\n", err)
+		}
+	}
+}
+
+func (sh *shell) prompt() string {
+	if sh.current == "" {
+		return "xtrieve> "
+	}
+	return sh.current + "> "
+}
+
+func (sh *shell) run(line string) error {
+	args := strings.Fields(line)
+	cmd, args := args[0], args[1:]
+
+	switch cmd {
+	case "help":
+		sh.help()
+		return nil
+	case "history":
+		for i, h := range sh.history {
+			fmt.Fprintf(sh.out, "%4d  %s\n", i+1, h)
+		}
+		return nil
+	case "open":
+		return sh.open(args)
+	case "use":
+		if len(args) != 1 || sh.files[args[0]] == nil {
+			return errors.New("usage: use <open file>")
+		}
+		sh.current = args[0]
+		return nil
+	case "files":
+		for _, name := range sortedKeys(sh.files) {
+			fmt.Fprintln(sh.out, name)
+		}
+		return nil
+	}
+
+	f := sh.files[sh.current]
+	if f == nil {
+		return errors.New("no file open; use \"open <path>\"")
+	}
+
+	switch cmd {
+	case "close":
+		if _, err := f.Close(); err != nil {
+			return err
+		}
+		delete(sh.files, sh.current)
+		delete(sh.schemas, sh.current)
+		sh.current = ""
+		return nil
+	case "schema":
+		return sh.loadSchema(args)
+	case "stat":
+		return sh.stat(f)
+	case "analyze":
+		return sh.analyze(f, args)
+	case "first", "last", "next", "prev":
+		return sh.move(f, cmd, args)
+	case "get", "ge", "gt", "le", "lt":
+		return sh.get(f, cmd, args)
+	case "scan":
+		return sh.scan(f, args)
+	case "insert":
+		return sh.insert(f, args)
+	case "delete":
+		if len(args) == 1 && args[0] == "-n" {
+			return sh.previewDelete(f)
+		}
+		resp, err := f.Delete(0)
+		return sh.status(resp, err, false)
+	}
+	return fmt.Errorf("unknown command %q", cmd)
+}
+
+func (sh *shell) help() {
+	fmt.Fprint(sh.out, `Commands:
+  open [-r] <path> [mode]     open a file and make it current (-r: read-only)
+  use <path>                  switch to another open file
+  files                       list open files
+  close                       close the current file
+  schema <file.json>          decode records of the current file with a schema
+  stat                        show file and key attributes
+  analyze [probes]            sample key distributions for the query planner
+  first|last [key]            read the first/last record in key order
+  next|prev [key]             read the next/previous record
+  get|ge|gt|le|lt <key> <v..> find a record (=, >=, >, <=, <) by key value
+  scan [key] [limit]          list records in key order
+  insert <field=value ...>    insert a record (needs a schema)
+  insert hex:<bytes>          insert raw record bytes
+  delete [-n]                 delete the current record (-n: only show it)
+  history                     show command history
+  quit                        leave the shell
+
+Key values are given per segment: numbers for integer keys, text for
+string keys, or 0x<hex> for raw bytes.
+`)
+}
+
+// open opens a file in normal mode (0) unless -r asks for read-only (-1,
+// as xtrieved reads the mode's low bit) or a mode is given
+func (sh *shell) open(args []string) error {
+	mode := int16(0)
+	if len(args) > 0 && args[0] == "-r" {
+		mode, args = -1, args[1:]
+	}
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: open [-r] <path> [mode]")
+	}
+	if len(args) == 2 {
+		m, err := strconv.ParseInt(args[1], 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid mode %q", args[1])
+		}
+		mode = int16(m)
+	}
+	f, err := sh.client.OpenFile(args[0], mode)
+	if err != nil {
+		return err
+	}
+	sh.files[args[0]] = f
+	sh.current = args[0]
+	fmt.Fprintf(sh.out, "opened %s (record length %d)\n", args[0], f.RecordLength())
+	return nil
+}
+
+func (sh *shell) loadSchema(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: schema <file.json>")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	schema, err := xtrieve.ParseSchemaJSON(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	sh.schemas[sh.current] = schema
+	fmt.Fprintf(sh.out, "schema with %d fields attached\n", len(schema.Fields))
+	return nil
+}
+
+func (sh *shell) stat(f *xtrieve.File) error {
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "record length %d, page size %d, %d records, flags 0x%04x\n",
+		st.RecordLength, st.PageSize, st.NumRecords, st.Flags)
+	key := 0
+	for _, k := range st.Keys {
+		fmt.Fprintf(sh.out, "  key %d: position %d, length %d, type %d, flags 0x%04x, %d unique\n",
+			key, k.Position, k.Length, k.Type, k.Flags, k.UniqueCount)
+		if k.Flags&xtrieve.KeyFlagSegmented == 0 {
+			key++
+		}
+	}
+	return nil
+}
+
+func (sh *shell) analyze(f *xtrieve.File, args []string) error {
+	probes := 100
+	if len(args) > 1 {
+		return errors.New("usage: analyze [probes]")
+	}
+	if len(args) == 1 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid probe count %q", args[0])
+		}
+		probes = n
+	}
+	a, err := xtrieve.AnalyzeKeys(context.Background(), f, probes, 10)
+	if err != nil {
+		return err
+	}
+	f.SetStatistics(a.Statistics())
+	return a.WriteReport(sh.out)
+}
+
+func (sh *shell) move(f *xtrieve.File, cmd string, args []string) error {
+	keyNumber, err := keyArg(args, 0)
+	if err != nil {
+		return err
+	}
+	var resp *xtrieve.Response
+	switch cmd {
+	case "first":
+		resp, err = f.GetFirst(keyNumber)
+	case "last":
+		resp, err = f.GetLast(keyNumber)
+	case "next":
+		resp, err = f.GetNext(keyNumber)
+	case "prev":
+		resp, err = f.GetPrevious(keyNumber)
+	}
+	return sh.status(resp, err, true)
+}
+
+func (sh *shell) get(f *xtrieve.File, cmd string, args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s <key> <value...>", cmd)
+	}
+	keyNumber, err := keyArg(args, 0)
+	if err != nil {
+		return err
+	}
+	key, err := parseKey(f.KeySegments(keyNumber), args[1:])
+	if err != nil {
+		return err
+	}
+	ops := map[string]uint16{
+		"get": xtrieve.OpGetEqual,
+		"ge":  xtrieve.OpGetGreaterOrEqual,
+		"gt":  xtrieve.OpGetGreater,
+		"le":  xtrieve.OpGetLessOrEqual,
+		"lt":  xtrieve.OpGetLess,
+	}
+	resp, err := f.Get(ops[cmd], key, keyNumber)
+	return sh.status(resp, err, true)
+}
+
+func (sh *shell) scan(f *xtrieve.File, args []string) error {
+	keyNumber, err := keyArg(args, 0)
+	if err != nil {
+		return err
+	}
+	limit := 20
+	if len(args) > 1 {
+		if limit, err = strconv.Atoi(args[1]); err != nil {
+			return fmt.Errorf("invalid limit %q", args[1])
+		}
+	}
+
+	it := f.Scan(keyNumber)
+	n := 0
+	for n < limit && it.Next() {
+		n++
+		fmt.Fprintf(sh.out, "-- record %d\n", n)
+		sh.print(it.Record())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(sh.out, "(%d records)\n", n)
+	return nil
+}
+
+func (sh *shell) insert(f *xtrieve.File, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: insert <field=value ...> | insert hex:<bytes>")
+	}
+
+	var record []byte
+	if raw, ok := strings.CutPrefix(args[0], "hex:"); ok {
+		b, err := hex.DecodeString(raw)
+		if err != nil {
+			return err
+		}
+		record = b
+	} else {
+		schema := sh.schemas[sh.current]
+		if schema == nil {
+			return errors.New("insert by field needs a schema; use \"schema <file.json>\"")
+		}
+		record = make([]byte, f.RecordLength())
+		for _, arg := range args {
+			name, text, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("expected field=value, got %q", arg)
+			}
+			field, ok := schema.Field(name)
+			if !ok {
+				return fmt.Errorf("unknown field %s", name)
+			}
+			v, err := xtrieve.ParseValue(field.Type, text)
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			if err := field.Encode(record, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	resp, err := f.Insert(record)
+	return sh.status(resp, err, false)
+}
+
+// previewDelete shows the record delete would remove, rereading it by
+// its physical position
+func (sh *shell) previewDelete(f *xtrieve.File) error {
+	pos, err := f.GetPosition()
+	if err != nil {
+		return err
+	}
+	resp, err := f.GetDirect(pos, 0)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == xtrieve.StatusSuccess {
+		fmt.Fprintf(sh.out, "would delete the record at position %d:\n", pos)
+	}
+	return sh.status(resp, nil, true)
+}
+
+// status reports a response and optionally prints its record
+func (sh *shell) status(resp *xtrieve.Response, err error, show bool) error {
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != xtrieve.StatusSuccess {
+		fmt.Fprintf(sh.out, "status %d\n", resp.StatusCode)
+		return nil
+	}
+	if show {
+		sh.print(resp.DataBuffer)
+	} else {
+		fmt.Fprintln(sh.out, "ok")
+	}
+	return nil
+}
+
+// print shows a record decoded with the current schema, or as a hex dump
+func (sh *shell) print(record []byte) {
+	schema := sh.schemas[sh.current]
+	if schema == nil {
+		fmt.Fprint(sh.out, hex.Dump(record))
+		return
+	}
+	values, err := schema.Decode(record)
+	if err != nil {
+		fmt.Fprintf(sh.out, "decode: %v\n", err)
+		fmt.Fprint(sh.out, hex.Dump(record))
+		return
+	}
+	width := 0
+	for _, field := range schema.Fields {
+		width = max(width, len(field.Name))
+	}
+	for _, field := range schema.Fields {
+		v := values[field.Name]
+		if raw, ok := v.([]byte); ok {
+			v = hex.EncodeToString(raw)
+		}
+		fmt.Fprintf(sh.out, "  %-*s  %v\n", width, field.Name, v)
+	}
+}
+
+func keyArg(args []string, i int) (int16, error) {
+	if len(args) <= i {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(args[i], 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid key number %q", args[i])
+	}
+	return int16(n), nil
+}
+
+// parseKey builds a key buffer from one value per key segment
+func parseKey(segments []xtrieve.KeySpec, values []string) ([]byte, error) {
+	if len(segments) == 0 {
+		return nil, errors.New("no such key")
+	}
+	if len(values) != len(segments) {
+		return nil, fmt.Errorf("key has %d segments, got %d values", len(segments), len(values))
+	}
+
+	var key []byte
+	for i, seg := range segments {
+		field := xtrieve.Field{Name: fmt.Sprintf("segment %d", i), Length: int(seg.Length), Type: seg.Type}
+		buf := make([]byte, seg.Length)
+		v, err := xtrieve.ParseValue(seg.Type, values[i])
+		if err != nil {
+			return nil, err
+		}
+		if err := field.Encode(buf, v); err != nil {
+			return nil, err
+		}
+		key = append(key, buf...)
+	}
+	return key, nil
+}
+
+func (sh *shell) historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, historyFile)
+}
+
+func (sh *shell) loadHistory() {
+	path := sh.historyPath()
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			sh.history = append(sh.history, line)
+		}
+	}
+}
+
+func (sh *shell) saveHistory() {
+	path := sh.historyPath()
+	if path == "" {
+		return
+	}
+	const keep = 500
+	history := sh.history
+	if len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+	os.WriteFile(path, []byte(strings.Join(history, "\n")+"\n"), 0o600)
+}
+
+// sortedKeys lists the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
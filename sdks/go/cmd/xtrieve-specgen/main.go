@@ -0,0 +1,155 @@
+// Command xtrieve-specgen generates the FileSpec and Schema of record
+// structs from their xtrieve tags (see xtrieve.StructSpec)
+//
+//	//go:generate go run github.com/eduardostern/xtrieve-go/cmd/xtrieve-specgen -type Customer,Order
+//
+// For each type it writes <type>_xtrieve.go in the package directory with
+// functions <Type>Spec and <Type>Schema, so the layout is reviewed as code
+// and Create and TypedTable use the same one without reflection. Fields
+// are named by their msgpack tag like TypedTable; embedded structs are
+// not supported.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+func main() {
+	typeNames := flag.String("type", "", "comma-separated struct types to generate for")
+	dir := flag.String("dir", ".", "package directory")
+	flag.Parse()
+
+	if *typeNames == "" {
+		fmt.Fprintln(os.Stderr, "usage: xtrieve-specgen -type Customer[,Order...] [-dir package]")
+		os.Exit(2)
+	}
+	pkg, structs, err := parsePackage(*dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, name := range strings.Split(*typeNames, ",") {
+		st, ok := structs[name]
+		if !ok {
+			log.Fatalf("%s: no struct type %s", *dir, name)
+		}
+		src, err := generate(pkg, name, st)
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		path := filepath.Join(*dir, strings.ToLower(name)+"_xtrieve.go")
+		if err := os.WriteFile(path, src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// parsePackage returns the package name and struct types of the Go files
+// in dir, tests and generated files excluded
+func parsePackage(dir string) (string, map[string]*ast.StructType, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", nil, err
+	}
+	fset := token.NewFileSet()
+	pkg := ""
+	structs := make(map[string]*ast.StructType)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") || strings.HasSuffix(path, "_xtrieve.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			return "", nil, err
+		}
+		pkg = file.Name.Name
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ts, ok := n.(*ast.TypeSpec); ok {
+				if st, ok := ts.Type.(*ast.StructType); ok {
+					structs[ts.Name.Name] = st
+				}
+			}
+			return true
+		})
+	}
+	return pkg, structs, nil
+}
+
+// generate returns the source of the spec and schema functions of a type
+func generate(pkg, name string, st *ast.StructType) ([]byte, error) {
+	var fields []xtrieve.SpecField
+	for _, field := range st.Fields.List {
+		var tag reflect.StructTag
+		if field.Tag != nil {
+			text, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(text)
+		}
+		xtag, ok := tag.Lookup("xtrieve")
+		if !ok || xtag == "-" {
+			continue
+		}
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("embedded field %s: not supported", types.ExprString(field.Type))
+		}
+		for _, ident := range field.Names {
+			if !ident.IsExported() {
+				continue
+			}
+			fieldName := ident.Name
+			if mp, _, _ := strings.Cut(tag.Get("msgpack"), ","); mp != "" {
+				fieldName = mp
+			}
+			fields = append(fields, xtrieve.SpecField{Name: fieldName, GoType: types.ExprString(field.Type), Tag: xtag})
+		}
+	}
+	spec, schema, err := xtrieve.SpecFromFields(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by xtrieve-specgen -type %s; DO NOT EDIT.\n\n", name)
+	fmt.Fprintf(&b, "package %s\n\n", pkg)
+	fmt.Fprintf(&b, "import xtrieve %q\n\n", "github.com/eduardostern/xtrieve-go")
+	fmt.Fprintf(&b, "// %sSpec returns the FileSpec that creates files of %s records\n", name, name)
+	fmt.Fprintf(&b, "func %sSpec() *xtrieve.FileSpec {\n", name)
+	fmt.Fprintf(&b, "return &xtrieve.FileSpec{\nRecordLength: %d,\nPageSize: %d,\nKeys: []xtrieve.KeySpec{\n", spec.RecordLength, spec.PageSize)
+	for _, k := range spec.Keys {
+		fmt.Fprintf(&b, "{Position: %d, Length: %d, Flags: 0x%04x, Type: %d},\n", k.Position, k.Length, k.Flags, k.Type)
+	}
+	fmt.Fprintf(&b, "},\n}\n}\n\n")
+	fmt.Fprintf(&b, "// %sSchema returns the Schema of %s records\n", name, name)
+	fmt.Fprintf(&b, "func %sSchema() *xtrieve.Schema {\nschema, err := xtrieve.NewSchema(\n", name)
+	for _, f := range schema.Fields {
+		fmt.Fprintf(&b, "xtrieve.Field{Name: %q, Offset: %d, Length: %d, Type: %d", f.Name, f.Offset, f.Length, f.Type)
+		if f.Scale != 0 {
+			fmt.Fprintf(&b, ", Scale: %d", f.Scale)
+		}
+		if f.Charset != "" {
+			fmt.Fprintf(&b, ", Charset: %q", f.Charset)
+		}
+		if f.Sensitive {
+			fmt.Fprintf(&b, ", Sensitive: true")
+		}
+		fmt.Fprintf(&b, "},\n")
+	}
+	fmt.Fprintf(&b, ")\nif err != nil {\npanic(err)\n}\nreturn schema\n}\n")
+	return format.Source(b.Bytes())
+}
@@ -0,0 +1,145 @@
+// Command xtrieve-sqlite mirrors Xtrieve files into a SQLite database
+//
+//	xtrieve-sqlite -db reports.sqlite \
+//	    -schema customers.dat=customers.json \
+//	    -incremental customers.dat=id \
+//	    customers.dat
+//
+// Each file becomes a table named after the file, with one column per
+// schema field and an index per key. Files with -incremental only append
+// records newer than those already in the table; others are reloaded.
+// With -every the export repeats until interrupted.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+	_ "modernc.org/sqlite"
+)
+
+type fileFlags map[string]string
+
+func (m fileFlags) String() string { return fmt.Sprint(map[string]string(m)) }
+
+func (m fileFlags) Set(v string) error {
+	file, value, ok := strings.Cut(v, "=")
+	if !ok {
+		return errors.New("expected <file>=<value>")
+	}
+	m[file] = value
+	return nil
+}
+
+func main() {
+	host := flag.String("host", "127.0.0.1", "server host")
+	port := flag.Int("port", xtrieve.DefaultPort, "server port")
+	dbPath := flag.String("db", "xtrieve.sqlite", "SQLite database to write")
+	every := flag.Duration("every", 0, "repeat the export at this interval")
+	schemas := fileFlags{}
+	incremental := fileFlags{}
+	flag.Var(schemas, "schema", "schema for a file, as <file>=<schema.json> (required per file)")
+	flag.Var(incremental, "incremental", "export a file incrementally by a field, as <file>=<field>")
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: xtrieve-sqlite [-db out.sqlite] -schema file=schema.json [-incremental file=field] [-every 5m] file...")
+		os.Exit(2)
+	}
+
+	exports, err := loadExports(flag.Args(), schemas, incremental)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite", *dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for {
+		if err := exportAll(ctx, *host, *port, db, exports); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+			log.Fatal(err)
+		}
+		if *every == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(*every):
+		}
+	}
+}
+
+// loadExports builds one export per file from the command line
+func loadExports(paths []string, schemas, incremental fileFlags) ([]*xtrieve.SQLExport, error) {
+	exports := make([]*xtrieve.SQLExport, 0, len(paths))
+	for _, path := range paths {
+		schemaPath, ok := schemas[path]
+		if !ok {
+			return nil, fmt.Errorf("%s: no -schema given", path)
+		}
+		data, err := os.ReadFile(schemaPath)
+		if err != nil {
+			return nil, err
+		}
+		schema, err := xtrieve.ParseSchemaJSON(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", schemaPath, err)
+		}
+		exports = append(exports, &xtrieve.SQLExport{
+			Schema:      schema,
+			Incremental: incremental[path],
+		})
+	}
+	return exports, nil
+}
+
+// exportAll runs every export over a fresh connection
+func exportAll(ctx context.Context, host string, port int, db *sql.DB, exports []*xtrieve.SQLExport) error {
+	client, err := xtrieve.Connect(host, port)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for i, path := range flag.Args() {
+		f, err := client.OpenFile(path, -1)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		export := exports[i]
+		export.File = f
+		export.Progress = xtrieve.ProgressFunc(func(p xtrieve.ProgressInfo) {
+			if !p.Done {
+				log.Printf("%s: %d/%d rows, %v left", path, p.Records, p.Total, p.ETA.Round(time.Second))
+			}
+		})
+
+		start := time.Now()
+		n, err := export.RunContext(ctx, db)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		log.Printf("%s: %d rows in %v", path, n, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package xtrieve
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// Collation orders the values of string key segments for comparisons made
+// on the client: Range termination, GetEqualPartial and merge scans. It
+// should match the order the server's index uses, or ranges end early.
+// A *collate.Collator from golang.org/x/text/collate satisfies it.
+type Collation interface {
+	Compare(a, b []byte) int
+}
+
+// CollationFunc adapts a function to the Collation interface
+type CollationFunc func(a, b []byte) int
+
+// Compare calls fn(a, b)
+func (fn CollationFunc) Compare(a, b []byte) int {
+	return fn(a, b)
+}
+
+// acsSize is the size of an ACS as stored in a file or ACS definition:
+// a 0xAC signature byte, an 8-byte name and the 256-byte table
+const acsSize = 265
+
+// ErrInvalidACS is returned by ParseACS for data that is not an ACS
+var ErrInvalidACS = errors.New("xtrieve: invalid alternate collating sequence")
+
+// ACS is an alternate collating sequence: each byte sorts by its weight in
+// Table, the order keys flagged KeyFlagAltSequence are indexed in
+type ACS struct {
+	Name  string
+	Table [256]byte
+}
+
+// ParseACS parses an ACS definition in the 265-byte Btrieve layout
+func ParseACS(b []byte) (*ACS, error) {
+	if len(b) < acsSize || b[0] != 0xAC {
+		return nil, ErrInvalidACS
+	}
+	a := &ACS{Name: strings.TrimRight(string(b[1:9]), " \x00")}
+	copy(a.Table[:], b[9:acsSize])
+	return a, nil
+}
+
+// UpperACS returns the ACS that sorts ASCII letters without regard to case,
+// as the UPPER.ALT sequence shipped with Btrieve does
+func UpperACS() *ACS {
+	a := &ACS{Name: "UPPER"}
+	for i := range a.Table {
+		a.Table[i] = byte(i)
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		a.Table[c] = byte(unicode.ToUpper(c))
+	}
+	return a
+}
+
+// Bytes returns the ACS in the 265-byte Btrieve layout
+func (a *ACS) Bytes() []byte {
+	b := make([]byte, acsSize)
+	b[0] = 0xAC
+	copy(b[1:9], a.Name+"        ")
+	copy(b[9:], a.Table[:])
+	return b
+}
+
+// Compare compares a and b by the weights of their bytes
+func (a *ACS) Compare(x, y []byte) int {
+	for i := 0; i < len(x) && i < len(y); i++ {
+		wx, wy := a.Table[x[i]], a.Table[y[i]]
+		if wx != wy {
+			if wx < wy {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(x) < len(y):
+		return -1
+	case len(x) > len(y):
+		return 1
+	}
+	return 0
+}
+
+// TextCollation returns a collation that decodes values from cs (UTF-8
+// when cs is nil) and compares them ignoring case and the accents of
+// Latin letters, so "Émile" sorts with "emile". Trailing spaces and NULs
+// are ignored. It is a simple approximation; use x/text/collate for
+// locale-correct ordering.
+func TextCollation(cs *Charset) Collation {
+	return CollationFunc(func(a, b []byte) int {
+		return compareFolded(foldText(cs.string(a)), foldText(cs.string(b)))
+	})
+}
+
+// foldText returns s without padding, folded to lower case without accents
+func foldText(s string) []rune {
+	s = strings.TrimRight(s, " \x00")
+	folded := make([]rune, 0, len(s))
+	for _, r := range s {
+		if base, ok := latinFolds[r]; ok {
+			folded = append(folded, []rune(base)...)
+			continue
+		}
+		folded = append(folded, unicode.ToLower(r))
+	}
+	return folded
+}
+
+func compareFolded(a, b []rune) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return 0
+}
+
+// latinFolds maps accented Latin letters and ligatures to their base letters
+var latinFolds = func() map[rune]string {
+	m := make(map[rune]string)
+	const upper = "AAAAAAACEEEEIIIIDNOOOOO OUUUUY"
+	const lower = "aaaaaaaceeeeiiiidnooooo ouuuuy y"
+	for i, c := range upper {
+		if c != ' ' {
+			m[0xC0+rune(i)] = strings.ToLower(string(c))
+		}
+	}
+	for i, c := range lower {
+		if c != ' ' {
+			m[0xE0+rune(i)] = string(c)
+		}
+	}
+	for r, s := range map[rune]string{
+		'Æ': "ae", 'æ': "ae", 'ß': "ss", 'Œ': "oe", 'œ': "oe",
+		'Š': "s", 'š': "s", 'Ž': "z", 'ž': "z", 'Ÿ': "y",
+	} {
+		m[r] = s
+	}
+	return m
+}()
+
+// SetCollation orders the string segments of a key by c in client-side
+// comparisons on the File; nil restores bytewise comparison
+func (f *File) SetCollation(keyNumber int16, c Collation) {
+	if c == nil {
+		delete(f.collations, keyNumber)
+		return
+	}
+	if f.collations == nil {
+		f.collations = make(map[int16]Collation)
+	}
+	f.collations[keyNumber] = c
+}
+
+// Collation returns the collation set for a key, nil when it compares
+// bytewise
+func (f *File) Collation(keyNumber int16) Collation {
+	return f.collations[keyNumber]
+}
+
+// CompareKeys compares two values of a key the way the File orders them,
+// using the key's collation when one is set
+func (f *File) CompareKeys(keyNumber int16, a, b []byte) int {
+	return CompareKeyCollated(f.KeySegments(keyNumber), f.Collation(keyNumber), a, b)
+}
+
+// KeyOrder returns a record comparison for MergeScan that orders records
+// by a key of the File, using the key's collation when one is set
+func (f *File) KeyOrder(keyNumber int16) func(a, b []byte) int {
+	segments, coll := f.KeySegments(keyNumber), f.Collation(keyNumber)
+	return func(a, b []byte) int {
+		return CompareKeyCollated(segments, coll, ExtractKey(segments, a), ExtractKey(segments, b))
+	}
+}
@@ -0,0 +1,198 @@
+package xtrieve
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// KeyPart is one segment of a CompositeKey: a record field, encoded and
+// decoded like Field does, and the order the key keeps it in. Offset is
+// only used by Segments; a Nullable part is preceded in the key by its
+// null indicator.
+type KeyPart struct {
+	Field
+	Descending bool
+	NoCase     bool
+}
+
+// CompositeKey is a key made of several typed fields, e.g. (last name,
+// date, branch). It builds key buffers from Go values so that segments
+// are padded and sized the way the index stores them, instead of
+// concatenating byte slices by hand:
+//
+//	key, err := xtrieve.NewCompositeKey(
+//	    xtrieve.KeyPart{Field: xtrieve.Field{Name: "Name", Offset: 0, Length: 20, Type: xtrieve.KeyTypeString}},
+//	    xtrieve.KeyPart{Field: xtrieve.Field{Name: "Date", Offset: 20, Length: 4, Type: xtrieve.KeyTypeDate}, Descending: true},
+//	    xtrieve.KeyPart{Field: xtrieve.Field{Name: "Branch", Offset: 24, Length: 4, Type: xtrieve.KeyTypeInteger}},
+//	)
+//	buf, err := key.BuildKey("SMITH", time.Now(), int32(7))
+//	resp, err := f.GetEqual(buf, 1)
+type CompositeKey struct {
+	Parts []KeyPart
+}
+
+// NewCompositeKey returns the composite key made of parts, in order
+func NewCompositeKey(parts ...KeyPart) (*CompositeKey, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("xtrieve: composite key has no parts")
+	}
+	for _, p := range parts {
+		switch {
+		case p.Length <= 0:
+			return nil, fmt.Errorf("xtrieve: key part %s: length %d", p.Name, p.Length)
+		case p.Bits > 0:
+			return nil, fmt.Errorf("xtrieve: key part %s: bit fields cannot be indexed", p.Name)
+		case p.Encrypted:
+			return nil, fmt.Errorf("xtrieve: key part %s: encrypted fields cannot be indexed", p.Name)
+		}
+		if err := p.checkNullable(); err != nil {
+			return nil, err
+		}
+	}
+	return &CompositeKey{Parts: parts}, nil
+}
+
+// Length returns the length of a full key
+func (k *CompositeKey) Length() int {
+	n := 0
+	for _, p := range k.Parts {
+		n += p.keyLength()
+	}
+	return n
+}
+
+// Segments returns the key's segments for a FileSpec, each with flags
+// and the part's own descending and case flags, and KeyFlagSegmented on
+// every segment but the last
+func (k *CompositeKey) Segments(flags uint16) []KeySpec {
+	var segments []KeySpec
+	for _, p := range k.Parts {
+		f := flags
+		if p.Descending {
+			f |= KeyFlagDescending
+		}
+		if p.NoCase {
+			f |= KeyFlagNoCase
+		}
+		specs := p.KeySpecs(f)
+		specs[len(specs)-1].Flags |= KeyFlagSegmented
+		segments = append(segments, specs...)
+	}
+	segments[len(segments)-1].Flags &^= KeyFlagSegmented
+	return segments
+}
+
+// BuildKey encodes values, one per part in order, into a key buffer.
+// Fewer values than parts build a partial key on the leading parts, for
+// Prefix, GetEqualPartial or Bounds. A nil value searches for null in a
+// Nullable part.
+func (k *CompositeKey) BuildKey(values ...any) ([]byte, error) {
+	if len(values) > len(k.Parts) {
+		return nil, fmt.Errorf("xtrieve: %d values for a key of %d parts", len(values), len(k.Parts))
+	}
+	key := make([]byte, 0, k.Length())
+	for i, v := range values {
+		b, err := k.Parts[i].SearchKey(v)
+		if err != nil {
+			return nil, fmt.Errorf("xtrieve: key part %d: %w", i, err)
+		}
+		key = append(key, b...)
+	}
+	return key, nil
+}
+
+// BuildKeyStruct builds a full key from the fields of the struct v, or v
+// points to, matched to the parts by name like TypedTable matches them
+func (k *CompositeKey) BuildKeyStruct(v any) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xtrieve: BuildKeyStruct needs a struct, not %T", v)
+	}
+	fields := make(map[string]any)
+	for _, f := range structFields(rv) {
+		fields[f.name] = basicValue(f.value)
+	}
+	values := make([]any, len(k.Parts))
+	for i, p := range k.Parts {
+		value, ok := fields[p.Name]
+		if !ok {
+			return nil, fmt.Errorf("xtrieve: %s has no field %s", rv.Type(), p.Name)
+		}
+		values[i] = value
+	}
+	return k.BuildKey(values...)
+}
+
+// ParseKey decodes a key buffer, such as Response.KeyBuffer, into one
+// value per part. A partial key decodes to the values of the parts it
+// holds whole.
+func (k *CompositeKey) ParseKey(key []byte) ([]any, error) {
+	var values []any
+	offset := 0
+	for _, p := range k.Parts {
+		end := offset + p.keyLength()
+		if end > len(key) {
+			break
+		}
+		f := p.Field
+		f.Offset = 0
+		if f.Nullable {
+			f.Offset = 1
+		}
+		v, err := f.Decode(key[offset:end])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+		offset = end
+	}
+	if offset != len(key) {
+		return nil, fmt.Errorf("xtrieve: key of %d bytes ends inside part %d", len(key), len(values))
+	}
+	return values, nil
+}
+
+// ParseKeyStruct decodes a key buffer into the fields of the struct v
+// points to
+func (k *CompositeKey) ParseKeyStruct(key []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("xtrieve: ParseKeyStruct needs a pointer to a struct, not %T", v)
+	}
+	values, err := k.ParseKey(key)
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]any, len(values))
+	for i, value := range values {
+		fields[k.Parts[i].Name] = value
+	}
+	return assignStruct(rv.Elem(), fields)
+}
+
+// Bounds returns the lowest and highest full keys starting with the
+// leading parts set to values, as PartialKeyBounds does, e.g. for Range
+func (k *CompositeKey) Bounds(values ...any) (low, high []byte, err error) {
+	partial, err := k.BuildKey(values...)
+	if err != nil {
+		return nil, nil, err
+	}
+	low, high = PartialKeyBounds(k.Segments(0), partial)
+	return low, high, nil
+}
+
+// Compare compares two keys in index order, as CompareKey does. NoCase
+// parts compare ignoring case, which matches the index only if the server
+// kept KeyFlagNoCase; File.Range and File.Prefix compare with the
+// segments Stat reports instead.
+func (k *CompositeKey) Compare(a, b []byte) int {
+	return CompareKey(k.Segments(0), a, b)
+}
+
+// keyLength is the length of the part in the key
+func (p KeyPart) keyLength() int {
+	if p.Nullable {
+		return p.Length + 1
+	}
+	return p.Length
+}
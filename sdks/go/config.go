@@ -0,0 +1,530 @@
+package xtrieve
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is a complete client or pool configuration, loaded from a file
+// with ConfigFromFile or from XTRIEVE_* environment variables with
+// ConfigFromEnv.
+//
+//	cfg, err := xtrieve.ConfigFromFile("xtrieve.toml")
+//	pool, err := cfg.NewPool()
+type Config struct {
+	// Address is the server, or the primary of a pool (see Dial)
+	Address string `json:"address" env:"XTRIEVE_ADDRESS"`
+	// Replicas are read-only replicas used by NewPool
+	Replicas []string `json:"replicas" env:"XTRIEVE_REPLICAS"`
+
+	TLS TLSConfig `json:"tls"`
+
+	DialTimeout Duration `json:"dial_timeout" env:"XTRIEVE_DIAL_TIMEOUT"`
+	// Timeout limits each operation
+	Timeout Duration `json:"timeout" env:"XTRIEVE_TIMEOUT"`
+	// ScanTimeout, BulkTimeout and CreateTimeout replace Timeout for
+	// extended scans, pipelined batches, and Create and Extend
+	ScanTimeout   Duration `json:"scan_timeout" env:"XTRIEVE_SCAN_TIMEOUT"`
+	BulkTimeout   Duration `json:"bulk_timeout" env:"XTRIEVE_BULK_TIMEOUT"`
+	CreateTimeout Duration `json:"create_timeout" env:"XTRIEVE_CREATE_TIMEOUT"`
+	// LogLevel (debug, info, warn or error) makes a pool log through
+	// slog.Default; operations are logged at debug
+	LogLevel string `json:"log_level" env:"XTRIEVE_LOG_LEVEL"`
+	// Strict rejects malformed responses (see Client.SetStrict)
+	Strict bool `json:"strict" env:"XTRIEVE_STRICT"`
+
+	Pool   PoolSettings   `json:"pool"`
+	Retry  RetrySettings  `json:"retry"`
+	Budget BudgetSettings `json:"budget"`
+}
+
+// TLSConfig holds the TLS settings of a Config. Files are PEM encoded.
+type TLSConfig struct {
+	Enabled bool `json:"enabled" env:"XTRIEVE_TLS"`
+	// CAFile verifies the server instead of the system roots
+	CAFile string `json:"ca_file" env:"XTRIEVE_TLS_CA_FILE"`
+	// CertFile and KeyFile hold a client certificate
+	CertFile           string `json:"cert_file" env:"XTRIEVE_TLS_CERT_FILE"`
+	KeyFile            string `json:"key_file" env:"XTRIEVE_TLS_KEY_FILE"`
+	ServerName         string `json:"server_name" env:"XTRIEVE_TLS_SERVER_NAME"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify" env:"XTRIEVE_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// PoolSettings are the PoolConfig fields of a Config
+type PoolSettings struct {
+	ConnsPerServer      int      `json:"conns_per_server" env:"XTRIEVE_POOL_CONNS_PER_SERVER"`
+	MinConns            int      `json:"min_conns" env:"XTRIEVE_POOL_MIN_CONNS"`
+	HotFiles            []string `json:"hot_files" env:"XTRIEVE_POOL_HOT_FILES"`
+	RefreshInterval     Duration `json:"refresh_interval" env:"XTRIEVE_POOL_REFRESH_INTERVAL"`
+	MaxIdleTime         Duration `json:"max_idle_time" env:"XTRIEVE_POOL_MAX_IDLE_TIME"`
+	MaxConnAge          Duration `json:"max_conn_age" env:"XTRIEVE_POOL_MAX_CONN_AGE"`
+	HealthCheckInterval Duration `json:"health_check_interval" env:"XTRIEVE_POOL_HEALTH_CHECK_INTERVAL"`
+	// Consistency is "eventual", "read-your-writes" or "primary"
+	Consistency Consistency `json:"consistency" env:"XTRIEVE_POOL_CONSISTENCY"`
+	PinFor      Duration    `json:"pin_for" env:"XTRIEVE_POOL_PIN_FOR"`
+	// Selection is "round-robin" or "latency"
+	Selection Selection `json:"selection" env:"XTRIEVE_POOL_SELECTION"`
+}
+
+// RetrySettings are the Backoff fields of a Config
+type RetrySettings struct {
+	Initial     Duration `json:"initial" env:"XTRIEVE_RETRY_INITIAL"`
+	Max         Duration `json:"max" env:"XTRIEVE_RETRY_MAX"`
+	Multiplier  float64  `json:"multiplier" env:"XTRIEVE_RETRY_MULTIPLIER"`
+	Jitter      float64  `json:"jitter" env:"XTRIEVE_RETRY_JITTER"`
+	MaxAttempts int      `json:"max_attempts" env:"XTRIEVE_RETRY_MAX_ATTEMPTS"`
+}
+
+// BudgetSettings are the Budget fields of a Config
+type BudgetSettings struct {
+	MaxScanRecords     int `json:"max_scan_records" env:"XTRIEVE_BUDGET_MAX_SCAN_RECORDS"`
+	MaxOperationBytes  int `json:"max_operation_bytes" env:"XTRIEVE_BUDGET_MAX_OPERATION_BYTES"`
+	MaxConcurrentScans int `json:"max_concurrent_scans" env:"XTRIEVE_BUDGET_MAX_CONCURRENT_SCANS"`
+}
+
+// Duration is a time.Duration written as a string such as "5s" or "1m30s"
+// in configuration files
+type Duration time.Duration
+
+// UnmarshalText parses a duration string
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalText formats the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// ConfigFromEnv builds a Config from XTRIEVE_* environment variables, e.g.
+// XTRIEVE_ADDRESS, XTRIEVE_REPLICAS (comma separated), XTRIEVE_TIMEOUT,
+// XTRIEVE_TLS, XTRIEVE_POOL_CONNS_PER_SERVER or XTRIEVE_RETRY_MAX. The
+// names are listed in the env tags of Config and its settings types.
+func ConfigFromEnv() (*Config, error) {
+	cfg := &Config{}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ConfigFromFile reads a Config from a JSON (.json) or TOML (.toml) file,
+// then applies XTRIEVE_* environment variables on top, so deployments can
+// override single settings. The TOML reader takes tables, dotted keys and
+// single-line values and rejects other TOML; full TOML and other formats
+// such as YAML can be read with ParseConfig and a decoder of the caller's
+// choice.
+func ConfigFromFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var unmarshal func([]byte, any) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		unmarshal = json.Unmarshal
+	case ".toml":
+		unmarshal = unmarshalTOML
+	default:
+		return nil, fmt.Errorf("xtrieve: unsupported config format %q; use ParseConfig", filepath.Ext(path))
+	}
+	cfg, err := ParseConfig(data, unmarshal)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// ParseConfig decodes a Config with unmarshal, which must honour the json
+// field names (as do yaml.Unmarshal and most TOML decoders, given the
+// names) and encoding.TextUnmarshaler for durations
+func ParseConfig(data []byte, unmarshal func([]byte, any) error) (*Config, error) {
+	cfg := &Config{}
+	if err := unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// DialOptions returns the connection settings of the configuration
+func (c *Config) DialOptions() (DialOptions, error) {
+	opts := DialOptions{
+		DialTimeout:   time.Duration(c.DialTimeout),
+		Timeout:       time.Duration(c.Timeout),
+		ScanTimeout:   time.Duration(c.ScanTimeout),
+		BulkTimeout:   time.Duration(c.BulkTimeout),
+		CreateTimeout: time.Duration(c.CreateTimeout),
+		Strict:        c.Strict,
+		Backoff: Backoff{
+			Initial:     time.Duration(c.Retry.Initial),
+			Max:         time.Duration(c.Retry.Max),
+			Multiplier:  c.Retry.Multiplier,
+			Jitter:      c.Retry.Jitter,
+			MaxAttempts: c.Retry.MaxAttempts,
+		},
+		Budget: Budget{
+			MaxScanRecords:     c.Budget.MaxScanRecords,
+			MaxOperationBytes:  c.Budget.MaxOperationBytes,
+			MaxConcurrentScans: c.Budget.MaxConcurrentScans,
+		},
+	}
+	if c.TLS.Enabled {
+		config, err := c.TLS.config()
+		if err != nil {
+			return opts, err
+		}
+		opts.TLS = config
+	}
+	return opts, nil
+}
+
+// Dial connects a single client to Address
+func (c *Config) Dial(ctx context.Context) (*Client, error) {
+	opts, err := c.DialOptions()
+	if err != nil {
+		return nil, err
+	}
+	return DialWithOptions(ctx, c.Address, opts)
+}
+
+// PoolConfig returns the pool settings of the configuration, with Address
+// as the primary
+func (c *Config) PoolConfig() (PoolConfig, error) {
+	opts, err := c.DialOptions()
+	if err != nil {
+		return PoolConfig{}, err
+	}
+	cfg := PoolConfig{
+		Primary:             c.Address,
+		Replicas:            c.Replicas,
+		ConnsPerServer:      c.Pool.ConnsPerServer,
+		MinConns:            c.Pool.MinConns,
+		HotFiles:            c.Pool.HotFiles,
+		RefreshInterval:     time.Duration(c.Pool.RefreshInterval),
+		MaxIdleTime:         time.Duration(c.Pool.MaxIdleTime),
+		MaxConnAge:          time.Duration(c.Pool.MaxConnAge),
+		HealthCheckInterval: time.Duration(c.Pool.HealthCheckInterval),
+		Consistency:         c.Pool.Consistency,
+		PinFor:              time.Duration(c.Pool.PinFor),
+		Selection:           c.Pool.Selection,
+		Dial:                opts,
+	}
+	if c.LogLevel != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			return cfg, fmt.Errorf("log_level: %w", err)
+		}
+		cfg.Logger = slog.Default()
+	}
+	return cfg, nil
+}
+
+// NewPool creates a pool from the configuration
+func (c *Config) NewPool() (*Pool, error) {
+	cfg, err := c.PoolConfig()
+	if err != nil {
+		return nil, err
+	}
+	return NewPool(cfg)
+}
+
+// Apply reconfigures a running pool with the configuration (see
+// Pool.Reconfigure), e.g. after reloading the file on SIGHUP. The pool
+// keeps its Discoverer, and its logger and level if LogLevel is unset.
+func (c *Config) Apply(p *Pool) error {
+	cfg, err := c.PoolConfig()
+	if err != nil {
+		return err
+	}
+	current := p.config()
+	cfg.Discover = current.Discover
+	if current.Logger != nil {
+		cfg.Logger = current.Logger
+	}
+	if c.LogLevel == "" {
+		cfg.LogLevel = current.LogLevel
+	}
+	return p.Reconfigure(cfg)
+}
+
+// config builds the crypto/tls configuration
+func (t *TLSConfig) config() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         t.ServerName,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("xtrieve: no certificates in %s", t.CAFile)
+		}
+	}
+	if t.CertFile != "" || t.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// applyEnv sets the fields whose environment variable is set
+func (c *Config) applyEnv() error {
+	return applyEnv(reflect.ValueOf(c).Elem())
+}
+
+func applyEnv(v reflect.Value) error {
+	for i := 0; i < v.NumField(); i++ {
+		field, sf := v.Field(i), v.Type().Field(i)
+		name := sf.Tag.Get("env")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				if err := applyEnv(field); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		text, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		if err := setText(field, text); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// setText parses text into a configuration field
+func setText(field reflect.Value, text string) error {
+	if u, ok := field.Addr().Interface().(interface{ UnmarshalText([]byte) error }); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(text)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		x, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(x)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(text, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return errors.New("unsupported setting type")
+	}
+	return nil
+}
+
+// unmarshalTOML decodes the subset of TOML configuration files need:
+// [table] headers, key = value pairs with strings, numbers, booleans and
+// single-line arrays of them, dotted names for nesting, and # comments.
+// Other TOML, such as [[arrays of tables]], inline tables, multi-line
+// strings and arrays, nested arrays and dates, is an error rather than
+// guessed at. The result is passed through encoding/json, so field names
+// and durations work as in JSON files.
+func unmarshalTOML(data []byte, v any) error {
+	root := map[string]any{}
+	table := root
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[[") {
+			return fmt.Errorf("line %d: arrays of tables are not supported", n+1)
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: bad table header", n+1)
+			}
+			var err error
+			if table, err = tomlTable(root, line[1:len(line)-1]); err != nil {
+				return fmt.Errorf("line %d: %w", n+1, err)
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", n+1)
+		}
+		parsed, err := tomlValue(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("line %d: %w", n+1, err)
+		}
+		// A dotted key sets a value in a nested table
+		parent, name := table, strings.TrimSpace(key)
+		if i := strings.LastIndexByte(name, '.'); i >= 0 && !strings.HasPrefix(name, `"`) {
+			if parent, err = tomlTable(table, name[:i]); err != nil {
+				return fmt.Errorf("line %d: %w", n+1, err)
+			}
+			name = strings.TrimSpace(name[i+1:])
+		}
+		if name = strings.Trim(name, `"`); name == "" {
+			return fmt.Errorf("line %d: empty key", n+1)
+		}
+		if _, ok := parent[name]; ok {
+			return fmt.Errorf("line %d: %s is already defined", n+1, name)
+		}
+		parent[name] = parsed
+	}
+
+	b, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// tomlTable returns the table at a dotted path below table, creating the
+// tables on the way
+func tomlTable(table map[string]any, path string) (map[string]any, error) {
+	for _, name := range strings.Split(path, ".") {
+		name = strings.Trim(strings.TrimSpace(name), `"`)
+		if name == "" {
+			return nil, fmt.Errorf("bad table name %q", path)
+		}
+		switch next := table[name].(type) {
+		case map[string]any:
+			table = next
+		case nil:
+			created := map[string]any{}
+			table[name] = created
+			table = created
+		default:
+			return nil, fmt.Errorf("%s is already defined as a value", name)
+		}
+	}
+	return table, nil
+}
+
+// tomlValue parses a TOML scalar or single-line array
+func tomlValue(s string) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "{"):
+		return nil, errors.New("inline tables are not supported")
+	case strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''"):
+		return nil, errors.New("multi-line strings are not supported")
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, errors.New("arrays must be on one line")
+		}
+		items := []any{}
+		for _, item := range splitArray(s[1 : len(s)-1]) {
+			if strings.HasPrefix(item, "[") || strings.HasPrefix(item, "{") {
+				return nil, errors.New("nested arrays and tables are not supported")
+			}
+			v, err := tomlValue(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case strings.HasPrefix(s, `"`):
+		return strconv.Unquote(s)
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") || strings.Contains(s[1:len(s)-1], "'") {
+			return nil, fmt.Errorf("bad string %s", s)
+		}
+		return s[1 : len(s)-1], nil
+	case s == "true" || s == "false":
+		return s == "true", nil
+	}
+	if n, err := strconv.ParseInt(strings.ReplaceAll(s, "_", ""), 10, 64); err == nil {
+		return n, nil
+	}
+	if x, err := strconv.ParseFloat(s, 64); err == nil {
+		return x, nil
+	}
+	return nil, fmt.Errorf("unsupported value %s", s)
+}
+
+// splitArray splits array items at commas outside quotes
+func splitArray(s string) []string {
+	var items []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	return items
+}
+
+// stripComment removes a # comment outside quotes
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
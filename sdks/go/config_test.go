@@ -0,0 +1,92 @@
+package xtrieve
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigTOML(t *testing.T) {
+	data := `# primary and replicas
+address = "db1:7419"   # trailing comment
+replicas = ["db2:7419", 'db3:7419']
+timeout = "5s"
+strict = true
+tls.enabled = true
+tls.server_name = "db.example # not a comment"
+
+[pool]
+conns_per_server = 4
+hot_files = []
+max_idle_time = "1m30s"
+
+[retry]
+multiplier = 1.5
+max_attempts = -1
+`
+	cfg, err := ParseConfig([]byte(data), unmarshalTOML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		Address:  "db1:7419",
+		Replicas: []string{"db2:7419", "db3:7419"},
+		Timeout:  Duration(5 * time.Second),
+		Strict:   true,
+		TLS:      TLSConfig{Enabled: true, ServerName: "db.example # not a comment"},
+		Pool: PoolSettings{ConnsPerServer: 4, HotFiles: []string{},
+			MaxIdleTime: Duration(90 * time.Second)},
+		Retry: RetrySettings{Multiplier: 1.5, MaxAttempts: -1},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestConfigTOMLUnsupported(t *testing.T) {
+	tests := map[string]string{
+		"array of tables":    "[[replica]]\naddress = \"a\"",
+		"inline table":       "tls = { enabled = true }",
+		"multi-line string":  "address = \"\"\"a\"\"\"",
+		"multi-line array":   "replicas = [\n\"a\",\n]",
+		"nested array":       "replicas = [[\"a\"]]",
+		"date":               "timeout = 1979-05-27",
+		"duplicate key":      "address = \"a\"\naddress = \"b\"",
+		"value as table":     "tls = true\n[tls]\nenabled = true",
+		"bad header":         "[pool",
+		"missing value":      "address",
+		"unterminated quote": "address = 'a",
+	}
+	for name, data := range tests {
+		var v map[string]any
+		if err := unmarshalTOML([]byte(data), &v); err == nil {
+			t.Errorf("%s: unmarshalTOML(%q) = %v, want an error", name, data, v)
+		}
+	}
+}
+
+func TestConfigFromFileEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "xtrieve.toml")
+	if err := os.WriteFile(path, []byte("address = \"db1:7419\"\ntimeout = \"5s\"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XTRIEVE_TIMEOUT", "10s")
+	cfg, err := ConfigFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Address != "db1:7419" || cfg.Timeout != Duration(10*time.Second) {
+		t.Errorf("config = %+v, want the file's address and the environment's timeout", cfg)
+	}
+
+	yaml := strings.TrimSuffix(path, ".toml") + ".yaml"
+	if err := os.WriteFile(yaml, []byte("address: db1:7419\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConfigFromFile(yaml); err == nil || !strings.Contains(err.Error(), "unsupported config format") {
+		t.Errorf("ConfigFromFile(%s) = %v, want an unsupported format error", yaml, err)
+	}
+}
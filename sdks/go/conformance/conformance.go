@@ -0,0 +1,240 @@
+// Package conformance holds the golden wire fixtures of the Xtrieve
+// protocol and runners that check a client against them, so every SDK
+// encodes requests and decodes responses byte for byte the same way.
+//
+// The fixtures live in suite.json, next to this file, in a form any SDK
+// can load. They have two parts. Wire cases pair a request, given field by
+// field, with the exact bytes it encodes to, and a response with the bytes
+// it decodes from; they need no server. The scenario is a sequence of
+// requests to run against a live server, with the status, record and key
+// each must return.
+//
+// The Go SDK runs the wire cases in its tests through Server, which plays
+// the server side of the fixtures and reports any request that does not
+// match byte for byte. Other SDKs can do the same against
+//
+//	xtrieve-conformance -serve 127.0.0.1:7420
+//
+// and run the scenario against a real server with
+//
+//	xtrieve-conformance -host localhost -port 7419
+package conformance
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+//go:embed suite.json
+var suiteJSON []byte
+
+// Suite is the content of suite.json
+type Suite struct {
+	// Version changes whenever a fixture does
+	Version  int        `json:"version"`
+	Wire     []WireCase `json:"wire"`
+	Scenario []Step     `json:"scenario"`
+}
+
+// WireCase is an operation's request and response with their exact bytes
+// on the wire. Omitted response data and key are empty.
+type WireCase struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description,omitempty"`
+	Request      Request  `json:"request"`
+	RequestWire  string   `json:"request_wire"`
+	Response     Response `json:"response"`
+	ResponseWire string   `json:"response_wire"`
+}
+
+// Step is one request of the live scenario and the response it must get.
+// Omitted response data and key are not checked; the position block never
+// is.
+type Step struct {
+	Name    string   `json:"name"`
+	Request Request  `json:"request"`
+	Expect  Response `json:"expect"`
+}
+
+// Request describes a request field by field. Byte fields are hex; the
+// position block is zero-filled to 128 bytes. In scenario steps, a
+// position block of "$" is the last non-blank one the server returned,
+// and data of "$name" is the data returned by the step of that name.
+type Request struct {
+	Operation     uint16 `json:"operation"`
+	PositionBlock string `json:"position_block,omitempty"`
+	Data          string `json:"data,omitempty"`
+	Key           string `json:"key,omitempty"`
+	KeyNumber     int16  `json:"key_number"`
+	Path          string `json:"path,omitempty"`
+	LockBias      uint16 `json:"lock_bias,omitempty"`
+}
+
+// Response describes a response field by field, in hex like Request
+type Response struct {
+	Status        uint16  `json:"status"`
+	PositionBlock string  `json:"position_block,omitempty"`
+	Data          *string `json:"data,omitempty"`
+	Key           *string `json:"key,omitempty"`
+}
+
+// Load parses the embedded suite
+func Load() (*Suite, error) {
+	return Parse(suiteJSON)
+}
+
+// Parse parses a suite in the form of suite.json
+func Parse(data []byte) (*Suite, error) {
+	s := &Suite{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("conformance: %w", err)
+	}
+	return s, nil
+}
+
+// JSON returns the embedded suite as stored, for SDKs without a copy
+func JSON() []byte {
+	return bytes.Clone(suiteJSON)
+}
+
+// XtrieveRequest returns the request as the Go SDK's Request
+func (r Request) XtrieveRequest() (*xtrieve.Request, error) {
+	pb, err := positionBlock(r.PositionBlock)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(r.Data)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: data: %w", err)
+	}
+	key, err := hex.DecodeString(r.Key)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: key: %w", err)
+	}
+	return &xtrieve.Request{
+		Operation:     r.Operation,
+		PositionBlock: pb,
+		DataBuffer:    data,
+		KeyBuffer:     key,
+		KeyNumber:     r.KeyNumber,
+		FilePath:      r.Path,
+		LockBias:      r.LockBias,
+	}, nil
+}
+
+// Encode returns the request's bytes on the wire, encoded from the layout
+// in docs/PROTOCOL.md independently of the SDK
+func (r Request) Encode() ([]byte, error) {
+	req, err := r.XtrieveRequest()
+	if err != nil {
+		return nil, err
+	}
+	b := binary.LittleEndian.AppendUint16(nil, req.Operation)
+	b = append(b, req.PositionBlock...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(req.DataBuffer)))
+	b = append(b, req.DataBuffer...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(req.KeyBuffer)))
+	b = append(b, req.KeyBuffer...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(req.KeyNumber))
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(req.FilePath)))
+	b = append(b, req.FilePath...)
+	return binary.LittleEndian.AppendUint16(b, req.LockBias), nil
+}
+
+// Encode returns the response's bytes on the wire
+func (r Response) Encode() ([]byte, error) {
+	pb, err := positionBlock(r.PositionBlock)
+	if err != nil {
+		return nil, err
+	}
+	data, err := optionalHex(r.Data)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: data: %w", err)
+	}
+	key, err := optionalHex(r.Key)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: key: %w", err)
+	}
+	b := binary.LittleEndian.AppendUint16(nil, r.Status)
+	b = append(b, pb...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(data)))
+	b = append(b, data...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(key)))
+	return append(b, key...), nil
+}
+
+// Check compares a decoded response with the expected one, checking data
+// and key only where they are given
+func (r Response) Check(resp *xtrieve.Response) error {
+	if resp.StatusCode != r.Status {
+		return fmt.Errorf("status %d, want %d", resp.StatusCode, r.Status)
+	}
+	if r.Data != nil {
+		if got := hex.EncodeToString(resp.DataBuffer); got != strings.ToLower(*r.Data) {
+			return fmt.Errorf("data %s, want %s", got, *r.Data)
+		}
+	}
+	if r.Key != nil {
+		if got := hex.EncodeToString(resp.KeyBuffer); got != strings.ToLower(*r.Key) {
+			return fmt.Errorf("key %s, want %s", got, *r.Key)
+		}
+	}
+	return nil
+}
+
+// Validate checks that every wire case's bytes are those of its fields,
+// and that no two cases send the same request
+func (s *Suite) Validate() error {
+	seen := make(map[string]string)
+	for _, c := range s.Wire {
+		for _, part := range []struct {
+			name string
+			wire string
+			enc  func() ([]byte, error)
+		}{
+			{"request", c.RequestWire, c.Request.Encode},
+			{"response", c.ResponseWire, c.Response.Encode},
+		} {
+			want, err := part.enc()
+			if err != nil {
+				return fmt.Errorf("conformance: %s %s: %w", c.Name, part.name, err)
+			}
+			if got := strings.ToLower(part.wire); got != hex.EncodeToString(want) {
+				return fmt.Errorf("conformance: %s: %s_wire does not match its fields", c.Name, part.name)
+			}
+		}
+		if other, ok := seen[c.RequestWire]; ok {
+			return fmt.Errorf("conformance: %s sends the same request as %s", c.Name, other)
+		}
+		seen[c.RequestWire] = c.Name
+	}
+	return nil
+}
+
+// positionBlock decodes a hex position block, zero-filled to full size
+func positionBlock(s string) ([]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("conformance: position block: %w", err)
+	}
+	if len(b) > xtrieve.PositionBlockSize {
+		return nil, fmt.Errorf("conformance: position block of %d bytes", len(b))
+	}
+	pb := make([]byte, xtrieve.PositionBlockSize)
+	copy(pb, b)
+	return pb, nil
+}
+
+func optionalHex(s *string) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return hex.DecodeString(*s)
+}
@@ -0,0 +1,176 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"testing"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+// serve starts a Server for the embedded suite and connects to it
+func serve(t *testing.T) (*Suite, *Server, *xtrieve.Client) {
+	t.Helper()
+	suite, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv, err := NewServer(suite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go srv.Serve(ln)
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	c, err := xtrieve.Connect("127.0.0.1", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return suite, srv, c
+}
+
+func checkServer(t *testing.T, srv *Server) {
+	t.Helper()
+	for _, m := range srv.Mismatches() {
+		t.Error(m)
+	}
+}
+
+func TestWireCases(t *testing.T) {
+	suite, srv, c := serve(t)
+	for _, wc := range suite.Wire {
+		req, err := wc.Request.XtrieveRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := c.Execute(req)
+		if err != nil {
+			t.Fatalf("%s: %v", wc.Name, err)
+		}
+		checkResponse(t, wc, resp)
+	}
+	checkServer(t, srv)
+	if unserved := srv.Unserved(); len(unserved) > 0 {
+		t.Errorf("cases not served: %v", unserved)
+	}
+}
+
+// TestConvenienceMethods checks that the Client methods build the
+// requests of the wire cases
+func TestConvenienceMethods(t *testing.T) {
+	suite, srv, c := serve(t)
+	cases := make(map[string]WireCase)
+	for _, wc := range suite.Wire {
+		cases[wc.Name] = wc
+	}
+	pb, _ := positionBlock(cases["open"].Response.PositionBlock)
+	record := func(name string) []byte {
+		b, _ := hex.DecodeString(cases[name].Request.Data)
+		return b
+	}
+	key := func(name string) []byte {
+		b, _ := hex.DecodeString(cases[name].Request.Key)
+		return b
+	}
+	spec := &xtrieve.FileSpec{
+		RecordLength: 16,
+		PageSize:     4096,
+		Keys: []xtrieve.KeySpec{
+			{Position: 0, Length: 4, Type: xtrieve.KeyTypeInteger},
+			{Position: 4, Length: 12, Flags: xtrieve.KeyFlagDuplicates | xtrieve.KeyFlagModifiable, Type: xtrieve.KeyTypeString},
+		},
+	}
+
+	calls := map[string]func() (*xtrieve.Response, error){
+		"create":            func() (*xtrieve.Response, error) { return c.Create("conformance.dat", spec) },
+		"open":              func() (*xtrieve.Response, error) { return c.Open("conformance.dat", 0) },
+		"open_read_only":    func() (*xtrieve.Response, error) { return c.Open("conformance.dat", -2) },
+		"close":             func() (*xtrieve.Response, error) { return c.CloseFile(pb) },
+		"stat":              func() (*xtrieve.Response, error) { return c.Stat(pb) },
+		"insert":            func() (*xtrieve.Response, error) { return c.Insert(pb, record("insert")) },
+		"update":            func() (*xtrieve.Response, error) { return c.Update(pb, record("update"), 0) },
+		"delete":            func() (*xtrieve.Response, error) { return c.Delete(pb, 0) },
+		"get_equal":         func() (*xtrieve.Response, error) { return c.GetEqual(pb, key("get_equal"), 0) },
+		"get_equal_key_1":   func() (*xtrieve.Response, error) { return c.GetEqual(pb, key("get_equal_key_1"), 1) },
+		"get_next":          func() (*xtrieve.Response, error) { return c.GetNext(pb, 0) },
+		"get_previous":      func() (*xtrieve.Response, error) { return c.GetPrevious(pb, 0) },
+		"get_first":         func() (*xtrieve.Response, error) { return c.GetFirst(pb, 0) },
+		"get_last":          func() (*xtrieve.Response, error) { return c.GetLast(pb, 0) },
+		"begin_transaction": func() (*xtrieve.Response, error) { return c.BeginTransaction(nil, 0) },
+		"end_transaction":   func() (*xtrieve.Response, error) { return c.EndTransaction(nil) },
+		"abort_transaction": func() (*xtrieve.Response, error) { return c.AbortTransaction(nil) },
+	}
+	for name, call := range calls {
+		resp, err := call()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkResponse(t, cases[name], resp)
+	}
+	checkServer(t, srv)
+}
+
+// checkResponse compares a decoded response with a wire case's, where
+// omitted data and key are empty
+func checkResponse(t *testing.T, wc WireCase, resp *xtrieve.Response) {
+	t.Helper()
+	want := wc.Response
+	empty := ""
+	if want.Data == nil {
+		want.Data = &empty
+	}
+	if want.Key == nil {
+		want.Key = &empty
+	}
+	if err := want.Check(resp); err != nil {
+		t.Errorf("%s: %v", wc.Name, err)
+	}
+	pb, _ := positionBlock(want.PositionBlock)
+	if !bytes.Equal(resp.PositionBlock, pb) {
+		t.Errorf("%s: position block %x, want %x", wc.Name, resp.PositionBlock, pb)
+	}
+}
+
+// TestFilePositionBlock checks that Stat and Close, whose responses carry
+// a blank position block, leave the File's position block in place:
+// every later request must still match a case made with the open one
+func TestFilePositionBlock(t *testing.T) {
+	suite, srv, c := serve(t)
+	var open string
+	for _, wc := range suite.Wire {
+		if wc.Name == "open" {
+			open = wc.Response.PositionBlock
+		}
+	}
+	want, _ := positionBlock(open)
+
+	f, err := c.OpenFile("conformance.dat", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Stat(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.PositionBlock(), want) {
+		t.Errorf("position block after Stat = %x, want %x", f.PositionBlock(), want)
+	}
+	if resp, err := f.GetFirst(0); err != nil || resp.StatusCode != xtrieve.StatusSuccess {
+		t.Errorf("GetFirst after Stat = %v, %v", resp, err)
+	}
+	if _, err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(f.PositionBlock(), want) {
+		t.Errorf("position block after Close = %x, want %x", f.PositionBlock(), want)
+	}
+	checkServer(t, srv)
+}
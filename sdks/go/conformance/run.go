@@ -0,0 +1,74 @@
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+// Result is the outcome of one scenario step
+type Result struct {
+	Step string
+	// Err is nil when the step got the response it expects
+	Err error
+}
+
+// Run runs the scenario against a live server through c, creating its
+// file in dir on the server, and returns the outcome of each step. The
+// scenario stops at the first step that fails; the error is only set
+// when the connection fails.
+func (s *Suite) Run(ctx context.Context, c *xtrieve.Client, dir string) ([]Result, error) {
+	var results []Result
+	var posBlock []byte
+	data := make(map[string][]byte)
+	for _, step := range s.Scenario {
+		req, err := step.request(dir, posBlock, data)
+		if err != nil {
+			return results, fmt.Errorf("conformance: %s: %w", step.Name, err)
+		}
+		resp, err := c.ExecuteContext(ctx, req)
+		if err != nil {
+			return results, fmt.Errorf("conformance: %s: %w", step.Name, err)
+		}
+		if !isBlank(resp.PositionBlock) {
+			posBlock = resp.PositionBlock
+		}
+		data[step.Name] = resp.DataBuffer
+
+		err = step.Expect.Check(resp)
+		results = append(results, Result{Step: step.Name, Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return results, nil
+}
+
+// request builds a step's request, filling in references to earlier
+// responses
+func (step Step) request(dir string, posBlock []byte, data map[string][]byte) (*xtrieve.Request, error) {
+	r := step.Request
+	if r.PositionBlock == "$" {
+		r.PositionBlock = hex.EncodeToString(posBlock)
+	}
+	if name, ok := strings.CutPrefix(r.Data, "$"); ok {
+		d, ok := data[name]
+		if !ok {
+			return nil, fmt.Errorf("no step %q before", name)
+		}
+		r.Data = hex.EncodeToString(d)
+	}
+	if r.Path != "" && dir != "" {
+		r.Path = path.Join(dir, r.Path)
+	}
+	return r.XtrieveRequest()
+}
+
+func isBlank(b []byte) bool {
+	return len(bytes.Trim(b, "\x00")) == 0
+}
@@ -0,0 +1,255 @@
+package conformance
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+// Server plays the server side of the wire cases. A request that matches
+// a case's request bytes exactly gets the case's response bytes; any
+// other request is recorded as a Mismatch and answered with status 1
+// (invalid operation). A client under test sends each case's request
+// through its own API and checks what it decodes against the case's
+// response.
+type Server struct {
+	// OnMismatch, if set, is called with each request that matches no case
+	OnMismatch func(Mismatch)
+
+	cases map[string]*wireCase
+	byOp  map[uint16][]*wireCase
+
+	mu         sync.Mutex
+	mismatches []Mismatch
+	served     map[string]bool
+}
+
+type wireCase struct {
+	name     string
+	request  []byte
+	response []byte
+}
+
+// Mismatch is a request that matched no wire case
+type Mismatch struct {
+	// Case is the case of the same operation the request comes closest
+	// to, if any, and Want its request
+	Case string
+	Got  []byte
+	Want []byte
+	// Offset is the first byte that differs from Want, and Field the
+	// request field it falls in
+	Offset int
+	Field  string
+}
+
+func (m Mismatch) String() string {
+	if m.Case == "" {
+		return fmt.Sprintf("no case for %s request", xtrieve.OpName(binary.LittleEndian.Uint16(m.Got)))
+	}
+	got, want := "end of request", "end of request"
+	if m.Offset < len(m.Got) {
+		got = fmt.Sprintf("%02x", m.Got[m.Offset])
+	}
+	if m.Offset < len(m.Want) {
+		want = fmt.Sprintf("%02x", m.Want[m.Offset])
+	}
+	return fmt.Sprintf("%s: byte %d (%s) is %s, want %s", m.Case, m.Offset, m.Field, got, want)
+}
+
+// NewServer returns a Server for the wire cases of a suite
+func NewServer(suite *Suite) (*Server, error) {
+	if err := suite.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Server{
+		cases:  make(map[string]*wireCase),
+		byOp:   make(map[uint16][]*wireCase),
+		served: make(map[string]bool),
+	}
+	for _, c := range suite.Wire {
+		req, _ := hex.DecodeString(c.RequestWire)
+		resp, _ := hex.DecodeString(c.ResponseWire)
+		wc := &wireCase{name: c.Name, request: req, response: resp}
+		s.cases[string(req)] = wc
+		s.byOp[c.Request.Operation] = append(s.byOp[c.Request.Operation], wc)
+	}
+	return s, nil
+}
+
+// Serve answers connections accepted on ln until it is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		req, err := readRequest(r)
+		if err != nil {
+			return
+		}
+		resp, m := s.answer(req)
+		if m != nil && s.OnMismatch != nil {
+			s.OnMismatch(*m)
+		}
+		if _, err := conn.Write(resp); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the response to a request, and the mismatch if it
+// matched no case
+func (s *Server) answer(req []byte) ([]byte, *Mismatch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.cases[string(req)]; ok {
+		s.served[c.name] = true
+		return c.response, nil
+	}
+
+	m := Mismatch{Got: req, Offset: -1}
+	for _, c := range s.byOp[binary.LittleEndian.Uint16(req)] {
+		if off := firstDifference(req, c.request); off > m.Offset {
+			m.Case, m.Want, m.Offset = c.name, c.request, off
+		}
+	}
+	if m.Case != "" {
+		m.Field = fieldAt(req, m.Offset)
+	}
+	s.mismatches = append(s.mismatches, m)
+
+	resp := make([]byte, 2+xtrieve.PositionBlockSize+4+2)
+	binary.LittleEndian.PutUint16(resp, xtrieve.StatusInvalidOperation)
+	return resp, &m
+}
+
+// Mismatches returns the requests that matched no case so far
+func (s *Server) Mismatches() []Mismatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Mismatch(nil), s.mismatches...)
+}
+
+// Unserved returns the names of the cases no request has matched so far
+func (s *Server) Unserved() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for _, c := range s.cases {
+		if !s.served[c.name] {
+			names = append(names, c.name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readRequest reads one request's bytes as sent
+func readRequest(r *bufio.Reader) ([]byte, error) {
+	var req []byte
+	read := func(n int) ([]byte, error) {
+		start := len(req)
+		req = append(req, make([]byte, n)...)
+		_, err := io.ReadFull(r, req[start:])
+		return req[start:], err
+	}
+	head, err := read(2 + xtrieve.PositionBlockSize + 4)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := read(int(binary.LittleEndian.Uint32(head[2+xtrieve.PositionBlockSize:]))); err != nil {
+		return nil, err
+	}
+	for _, lengthThenBytes := range []bool{true, false, true, false} {
+		// key, key number, path, lock bias
+		b, err := read(2)
+		if err != nil {
+			return nil, err
+		}
+		if lengthThenBytes {
+			if _, err := read(int(binary.LittleEndian.Uint16(b))); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return req, nil
+}
+
+// fieldAt names the request field holding byte off of req
+func fieldAt(req []byte, off int) string {
+	pos := 0
+	field := func(n int) bool {
+		pos += n
+		return off < pos
+	}
+	u16 := func() int {
+		if pos+2 > len(req) {
+			return 0
+		}
+		return int(binary.LittleEndian.Uint16(req[pos:]))
+	}
+	if field(2) {
+		return "operation"
+	}
+	if field(xtrieve.PositionBlockSize) {
+		return "position_block"
+	}
+	dataLen := 0
+	if pos+4 <= len(req) {
+		dataLen = int(binary.LittleEndian.Uint32(req[pos:]))
+	}
+	if field(4) {
+		return "data_length"
+	}
+	if field(dataLen) {
+		return "data_buffer"
+	}
+	keyLen := u16()
+	if field(2) {
+		return "key_length"
+	}
+	if field(keyLen) {
+		return "key_buffer"
+	}
+	if field(2) {
+		return "key_number"
+	}
+	pathLen := u16()
+	if field(2) {
+		return "path_length"
+	}
+	if field(pathLen) {
+		return "file_path"
+	}
+	return "lock_bias"
+}
+
+func firstDifference(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
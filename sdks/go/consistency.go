@@ -0,0 +1,126 @@
+package xtrieve
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Consistency selects which reads of pooled files may go to a replica
+type Consistency int
+
+const (
+	// ConsistencyEventual sends reads to a replica, which may not have
+	// the latest writes yet
+	ConsistencyEventual Consistency = iota
+	// ConsistencyReadYourWrites sends reads to the primary once the file,
+	// or any file of its Session, has written, for PoolConfig.PinFor
+	ConsistencyReadYourWrites
+	// ConsistencyPrimary sends every read to the primary
+	ConsistencyPrimary
+)
+
+var consistencyNames = map[Consistency]string{
+	ConsistencyEventual:       "eventual",
+	ConsistencyReadYourWrites: "read-your-writes",
+	ConsistencyPrimary:        "primary",
+}
+
+func (c Consistency) String() string {
+	if name, ok := consistencyNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Consistency(%d)", int(c))
+}
+
+// UnmarshalText parses "eventual", "read-your-writes" or "primary"
+func (c *Consistency) UnmarshalText(text []byte) error {
+	for value, name := range consistencyNames {
+		if string(text) == name {
+			*c = value
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown consistency %q", text)
+}
+
+// MarshalText returns the consistency's name
+func (c Consistency) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// readPin pins the reads of the files sharing it to the primary after a
+// write
+type readPin struct {
+	pinFor time.Duration
+	mu     sync.Mutex
+	wrote  time.Time
+}
+
+// written records a write
+func (p *readPin) written() {
+	p.mu.Lock()
+	p.wrote = time.Now()
+	p.mu.Unlock()
+}
+
+// pinned reports whether reads must go to the primary
+func (p *readPin) pinned() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.wrote.IsZero() && (p.pinFor <= 0 || time.Since(p.wrote) < p.pinFor)
+}
+
+// isWrite reports whether an operation changes records
+func isWrite(op uint16) bool {
+	switch op {
+	case OpInsert, OpUpdate, OpDelete:
+		return true
+	}
+	return false
+}
+
+// Session groups the files one unit of work, such as an HTTP request,
+// opens through a pool. They share one primary connection, so they see
+// each other's uncommitted writes and transactions, and with
+// ConsistencyReadYourWrites a write through any of them pins the reads of
+// all of them to that connection.
+//
+//	s, err := pool.Session()
+//	orders, err := s.OpenFile("orders.dat", 0)
+//	lines, err := s.OpenFile("lines.dat", 0)
+//	orders.Insert(order)
+//	lines.GetEqual(key, 0) // primary: the session has written
+type Session struct {
+	pool    *Pool
+	primary *Client
+	pin     *readPin
+}
+
+// Session starts a session on the next primary connection
+func (p *Pool) Session() (*Session, error) {
+	primary, err := p.Primary()
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.config()
+	s := &Session{pool: p, primary: primary}
+	if cfg.Consistency == ConsistencyReadYourWrites {
+		s.pin = &readPin{pinFor: cfg.PinFor}
+	}
+	return s, nil
+}
+
+// OpenFile opens a file like Pool.OpenFile, on the session's primary
+// connection
+func (s *Session) OpenFile(path string, mode int16) (*File, error) {
+	return s.pool.openOn(s.primary, s.pin, path, mode, "")
+}
+
+// OpenFileOwner is like OpenFile for a file protected by an owner name
+func (s *Session) OpenFileOwner(path string, mode int16, owner string) (*File, error) {
+	return s.pool.openOn(s.primary, s.pin, path, mode, owner)
+}
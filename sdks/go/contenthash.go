@@ -0,0 +1,127 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"sort"
+)
+
+// ContentHash is a hash of a file's logical content, see HashContent
+type ContentHash struct {
+	Records uint64
+	Sum     [sha256.Size]byte
+}
+
+// String returns the hash in hex
+func (h ContentHash) String() string {
+	return hex.EncodeToString(h.Sum[:])
+}
+
+// HashOptions control how HashContent canonicalizes records
+type HashOptions struct {
+	// KeyNumber is the key the records are read in
+	KeyNumber int16
+	// Schema, when set, normalizes the padding of string fields: STRING
+	// fields padded with blanks or zeros hash alike, as do ZSTRING and
+	// LSTRING fields with different bytes after their value. Without a
+	// schema, only trailing blanks and zeros of whole records are ignored.
+	Schema *Schema
+}
+
+// HashContent computes a SHA-256 hash of the records of f that depends on
+// their content only, so that two copies of a file, on two servers or a
+// backup and the live file, can be compared by their hashes. Records are
+// hashed in the order of opts.KeyNumber with their padding normalized;
+// records with equal keys are hashed in byte order, since the order of
+// duplicates depends on how the file was built. The file's position
+// moves.
+func HashContent(ctx context.Context, f *File, opts HashOptions) (*ContentHash, error) {
+	segments := f.KeySegments(opts.KeyNumber)
+	if segments == nil {
+		return nil, fmt.Errorf("xtrieve: file has no key %d", opts.KeyNumber)
+	}
+	h := &contentHasher{hash: sha256.New(), segments: segments}
+	it := f.Scan(opts.KeyNumber)
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := normalizeRecord(it.Record(), opts.Schema)
+		if err != nil {
+			return nil, err
+		}
+		h.add(ExtractKey(segments, it.Record()), record)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	h.flush()
+
+	sum := &ContentHash{Records: h.records}
+	h.hash.Sum(sum.Sum[:0])
+	return sum, nil
+}
+
+// contentHasher hashes records group by group of equal keys
+type contentHasher struct {
+	hash     hash.Hash
+	segments []KeySpec
+	records  uint64
+	key      []byte
+	group    [][]byte
+}
+
+func (h *contentHasher) add(key, record []byte) {
+	if h.group != nil && CompareKey(h.segments, key, h.key) != 0 {
+		h.flush()
+	}
+	h.key = key
+	h.group = append(h.group, record)
+}
+
+// flush hashes the current group in byte order, each record preceded by
+// its length
+func (h *contentHasher) flush() {
+	sort.Slice(h.group, func(i, j int) bool { return bytes.Compare(h.group[i], h.group[j]) < 0 })
+	var n [4]byte
+	for _, record := range h.group {
+		binary.LittleEndian.PutUint32(n[:], uint32(len(record)))
+		h.hash.Write(n[:])
+		h.hash.Write(record)
+		h.records++
+	}
+	h.group = nil
+}
+
+// normalizeRecord returns a copy of record with its padding in canonical
+// form
+func normalizeRecord(record []byte, schema *Schema) ([]byte, error) {
+	if schema == nil {
+		return bytes.Clone(bytes.TrimRight(record, " \x00")), nil
+	}
+	record = bytes.Clone(record)
+	for _, f := range schema.Fields {
+		if f.Encrypted || f.Bits > 0 || f.Offset+f.Length > len(record) {
+			continue
+		}
+		switch f.Type {
+		case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+		default:
+			continue
+		}
+		v, err := f.Decode(record)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Encode(record, v); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
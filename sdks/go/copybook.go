@@ -0,0 +1,577 @@
+package xtrieve
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CopybookOptions controls how COBOL data items map to field types
+type CopybookOptions struct {
+	// NativeBinary maps COMP, COMP-4 and BINARY items to little-endian
+	// INTEGER or UNSIGNED BINARY fields, for compilers that store them in
+	// native byte order. Without it such items are an error, since
+	// mainframe compilers store them big-endian; COMP-5 is always native.
+	NativeBinary bool
+	// Zoned is the key type of signed DISPLAY numbers: KeyTypeNumeric
+	// (the default, EBCDIC-style overpunch) or KeyTypeNumericSA (Micro
+	// Focus ASCII overpunch)
+	Zoned uint8
+}
+
+// Copybook is a record layout parsed from a COBOL copybook
+type Copybook struct {
+	// Records holds the 01-level records, or the top-level items of a
+	// copybook without one
+	Records []*CopybookItem
+}
+
+// CopybookItem is a data item of a copybook with its computed layout.
+// Group items have Items; elementary items have a field Type.
+type CopybookItem struct {
+	Level     int
+	Name      string
+	Picture   string
+	Usage     string
+	Occurs    int
+	Redefines string
+	// Offset is the item's position in the record and Length the size of
+	// one occurrence
+	Offset int
+	Length int
+	Type   uint8
+	Scale  int
+	Items  []*CopybookItem
+
+	sign string
+}
+
+// ParseCopybook reads a COBOL copybook in fixed or free format. Level 66
+// and 88 entries and VALUE clauses are skipped, OCCURS ... DEPENDING ON
+// items take their maximum size, and REDEFINES items overlay the item
+// they redefine.
+func ParseCopybook(r io.Reader, opts CopybookOptions) (*Copybook, error) {
+	if opts.Zoned == 0 {
+		opts.Zoned = KeyTypeNumeric
+	}
+	entries, err := copybookEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Copybook{}
+	var stack []*CopybookItem
+	for _, tokens := range entries {
+		item, err := parseCopybookEntry(tokens)
+		if err != nil {
+			return nil, err
+		}
+		if item == nil {
+			continue
+		}
+		for len(stack) > 0 && stack[len(stack)-1].Level >= item.Level {
+			stack = stack[:len(stack)-1]
+		}
+		if len(stack) == 0 {
+			c.Records = append(c.Records, item)
+		} else {
+			parent := stack[len(stack)-1]
+			if parent.Picture != "" {
+				return nil, fmt.Errorf("copybook: %s has a PICTURE and subordinate items", parent.Name)
+			}
+			parent.Items = append(parent.Items, item)
+		}
+		stack = append(stack, item)
+	}
+	if len(c.Records) == 0 {
+		return nil, fmt.Errorf("copybook: no data items")
+	}
+	for _, rec := range c.Records {
+		if _, err := layoutItem(rec, 0, "", "", opts); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// copybookEntries splits a copybook into the tokens of each entry
+func copybookEntries(r io.Reader) ([][]string, error) {
+	var text strings.Builder
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text.WriteString(copybookCode(scanner.Text()))
+		text.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var entries [][]string
+	var tokens []string
+	for _, tok := range tokenizeCobol(text.String()) {
+		end := strings.HasSuffix(tok, ".")
+		if quoted := tok[0] == '\'' || tok[0] == '"'; quoted && end {
+			// A period inside a literal does not end the entry
+			end = len(tok) > 2 && tok[len(tok)-2] == tok[0]
+		}
+		if tok = strings.TrimSuffix(tok, "."); end && tok == "" {
+			// A lone period
+		} else {
+			tokens = append(tokens, tok)
+		}
+		if end && len(tokens) > 0 {
+			entries = append(entries, tokens)
+			tokens = nil
+		}
+	}
+	if len(tokens) > 0 {
+		entries = append(entries, tokens)
+	}
+	return entries, nil
+}
+
+// copybookCode returns the code of a line, without the sequence and
+// indicator areas of fixed format or comments
+func copybookCode(line string) string {
+	if len(line) >= 7 && strings.Trim(line[:6], "0123456789 ") == "" && strings.ContainsRune(" */-Dd", rune(line[6])) {
+		if line[6] == '*' || line[6] == '/' {
+			return ""
+		}
+		line = line[7:]
+		if len(line) > 65 {
+			line = line[:65] // columns 73 and on are the identification area
+		}
+	}
+	if i := strings.Index(line, "*>"); i >= 0 {
+		line = line[:i]
+	}
+	if strings.HasPrefix(strings.TrimSpace(line), "*") {
+		return ""
+	}
+	return line
+}
+
+// tokenizeCobol splits text on spaces, keeping quoted literals whole
+func tokenizeCobol(text string) []string {
+	var tokens []string
+	var cur strings.Builder
+	var quote rune
+	for _, c := range text {
+		switch {
+		case quote != 0:
+			cur.WriteRune(c)
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			cur.WriteRune(c)
+		case unicode.IsSpace(c) || c == ',' && cur.Len() == 0:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(c)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+// parseCopybookEntry parses the clauses of an entry, returning nil for
+// entries that do not describe storage
+func parseCopybookEntry(tokens []string) (*CopybookItem, error) {
+	level, err := strconv.Atoi(tokens[0])
+	if err != nil {
+		return nil, fmt.Errorf("copybook: entry %q does not start with a level number", strings.Join(tokens, " "))
+	}
+	if level == 66 || level == 88 {
+		return nil, nil
+	}
+	if level < 1 || level > 49 && level != 77 {
+		return nil, fmt.Errorf("copybook: invalid level %d", level)
+	}
+	item := &CopybookItem{Level: level, Name: "FILLER", Occurs: 1}
+	rest := tokens[1:]
+	if len(rest) > 0 && !isCobolKeyword(rest[0]) {
+		item.Name, rest = strings.ToUpper(rest[0]), rest[1:]
+	}
+
+	for i := 0; i < len(rest); i++ {
+		word := strings.ToUpper(rest[i])
+		next := func() string {
+			i++
+			if i < len(rest) && strings.ToUpper(rest[i]) == "IS" {
+				i++
+			}
+			if i < len(rest) {
+				return rest[i]
+			}
+			return ""
+		}
+		switch word {
+		case "PIC", "PICTURE":
+			item.Picture = strings.ToUpper(next())
+		case "USAGE":
+			item.Usage = cobolUsage(strings.ToUpper(next()))
+		case "REDEFINES":
+			item.Redefines = strings.ToUpper(next())
+		case "OCCURS":
+			n, err := strconv.Atoi(next())
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("copybook: %s: invalid OCCURS", item.Name)
+			}
+			if i+2 < len(rest) && strings.ToUpper(rest[i+1]) == "TO" {
+				// OCCURS min TO max DEPENDING ON: reserve the maximum
+				if n, err = strconv.Atoi(rest[i+2]); err != nil {
+					return nil, fmt.Errorf("copybook: %s: invalid OCCURS", item.Name)
+				}
+				i += 2
+			}
+			item.Occurs = n
+		case "SIGN":
+			item.sign = strings.ToUpper(next())
+			if i+1 < len(rest) && strings.ToUpper(rest[i+1]) == "SEPARATE" {
+				item.sign += " SEPARATE"
+			}
+		case "LEADING", "TRAILING":
+			item.sign = word
+			if i+1 < len(rest) && strings.ToUpper(rest[i+1]) == "SEPARATE" {
+				item.sign += " SEPARATE"
+			}
+		default:
+			switch usage := cobolUsage(word); usage {
+			case "DISPLAY", "COMP", "COMP-1", "COMP-2", "COMP-3", "COMP-5", "BINARY":
+				item.Usage = usage
+			}
+		}
+	}
+	return item, nil
+}
+
+// cobolUsage normalizes a usage name, e.g. COMPUTATIONAL-3 to COMP-3
+func cobolUsage(word string) string {
+	switch word = strings.Replace(word, "COMPUTATIONAL", "COMP", 1); word {
+	case "PACKED-DECIMAL":
+		return "COMP-3"
+	case "COMP-4":
+		return "BINARY"
+	}
+	return word
+}
+
+func isCobolKeyword(word string) bool {
+	switch strings.ToUpper(word) {
+	case "PIC", "PICTURE", "USAGE", "REDEFINES", "OCCURS", "VALUE", "VALUES", "SIGN",
+		"COMP", "COMP-1", "COMP-2", "COMP-3", "COMP-4", "COMP-5", "BINARY", "DISPLAY",
+		"PACKED-DECIMAL", "SYNC", "SYNCHRONIZED", "JUST", "JUSTIFIED", "BLANK":
+		return true
+	}
+	return false
+}
+
+// layoutItem computes the offset, length and type of an item and its
+// subordinates, returning the item's total size
+func layoutItem(item *CopybookItem, offset int, usage, sign string, opts CopybookOptions) (int, error) {
+	item.Offset = offset
+	if item.Usage == "" {
+		item.Usage = usage
+	}
+	if item.sign == "" {
+		item.sign = sign
+	}
+	if len(item.Items) == 0 {
+		if err := elementaryType(item, opts); err != nil {
+			return 0, fmt.Errorf("copybook: %s: %w", item.Name, err)
+		}
+		return item.Length * item.Occurs, nil
+	}
+
+	at, end := offset, offset
+	placed := make(map[string]*CopybookItem)
+	for _, child := range item.Items {
+		start := at
+		if child.Redefines != "" {
+			target, ok := placed[child.Redefines]
+			if !ok {
+				return 0, fmt.Errorf("copybook: %s redefines unknown item %s", child.Name, child.Redefines)
+			}
+			start = target.Offset
+		}
+		size, err := layoutItem(child, start, item.Usage, item.sign, opts)
+		if err != nil {
+			return 0, err
+		}
+		placed[child.Name] = child
+		if child.Redefines == "" {
+			at = start + size
+		}
+		end = max(end, start+size)
+	}
+	item.Length = end - offset
+	return item.Length * item.Occurs, nil
+}
+
+// elementaryType maps an elementary item's PICTURE and USAGE to a field
+func elementaryType(item *CopybookItem, opts CopybookOptions) error {
+	switch item.Usage {
+	case "COMP-1":
+		item.Type, item.Length = KeyTypeFloat, 4
+		return nil
+	case "COMP-2":
+		item.Type, item.Length = KeyTypeFloat, 8
+		return nil
+	}
+	pic := expandPicture(item.Picture)
+	if pic == "" {
+		return fmt.Errorf("no PICTURE")
+	}
+
+	switch {
+	case strings.Trim(pic, "XA") == "":
+		item.Type, item.Length = KeyTypeString, len(pic)
+		return nil
+	case strings.Trim(pic, "N") == "":
+		item.Type, item.Length = KeyTypeWString, 2*len(pic)
+		return nil
+	}
+
+	signed := strings.HasPrefix(pic, "S")
+	digits := strings.TrimPrefix(pic, "S")
+	whole, frac, _ := strings.Cut(digits, "V")
+	if strings.Trim(whole, "9") != "" || strings.Trim(frac, "9") != "" {
+		if signed || strings.Contains(pic, "V") || item.Usage != "" && item.Usage != "DISPLAY" {
+			return fmt.Errorf("unsupported PICTURE %s", item.Picture)
+		}
+		// Numeric-edited items are display text
+		item.Type, item.Length = KeyTypeString, len(pic)
+		return nil
+	}
+	n := len(whole) + len(frac)
+	item.Scale = len(frac)
+
+	switch item.Usage {
+	case "", "DISPLAY":
+		item.Type, item.Length = KeyTypeNumeric, n
+		switch {
+		case !signed:
+		case item.sign == "TRAILING SEPARATE":
+			item.Type, item.Length = KeyTypeNumericSTS, n+1
+		case strings.HasPrefix(item.sign, "LEADING"):
+			return fmt.Errorf("SIGN LEADING is not supported")
+		default:
+			item.Type = opts.Zoned
+		}
+	case "COMP-3":
+		item.Type, item.Length = KeyTypeDecimal, n/2+1
+	case "COMP", "BINARY", "COMP-5":
+		if item.Usage != "COMP-5" && !opts.NativeBinary {
+			return fmt.Errorf("%s items are big-endian; set NativeBinary if this compiler stores them little-endian", item.Usage)
+		}
+		if item.Scale > 0 {
+			return fmt.Errorf("scaled binary items are not supported")
+		}
+		item.Type = KeyTypeUnsignedBinary
+		if signed {
+			item.Type = KeyTypeInteger
+		}
+		switch {
+		case n <= 4:
+			item.Length = 2
+		case n <= 9:
+			item.Length = 4
+		default:
+			item.Length = 8
+		}
+	default:
+		return fmt.Errorf("unsupported USAGE %s", item.Usage)
+	}
+	return nil
+}
+
+// expandPicture expands repeat counts, e.g. S9(5)V99 to S99999V99
+func expandPicture(pic string) string {
+	var b strings.Builder
+	for i := 0; i < len(pic); i++ {
+		c := pic[i]
+		if c == '(' {
+			continue
+		}
+		if i+1 < len(pic) && pic[i+1] == '(' {
+			end := strings.IndexByte(pic[i:], ')')
+			if end < 0 {
+				return pic
+			}
+			n, err := strconv.Atoi(pic[i+2 : i+end])
+			if err != nil {
+				return pic
+			}
+			b.WriteString(strings.Repeat(string(c), n))
+			i += end
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// Schema returns the schema of the first record
+func (c *Copybook) Schema() (*Schema, error) {
+	return c.Records[0].Schema()
+}
+
+// Schema returns the elementary items under item as schema fields. Names
+// are lower-cased with underscores, e.g. CUST-NAME becomes cust_name;
+// items under an OCCURS get the 1-based index appended, as in amount_1,
+// and names used twice are qualified with their group's name. FILLER
+// items are left out.
+func (item *CopybookItem) Schema() (*Schema, error) {
+	var fields []Field
+	seen := make(map[string]bool)
+	// shift moves items from the first occurrence of their enclosing
+	// OCCURS groups to the one being walked
+	var walk func(it *CopybookItem, parent, suffix string, shift int) error
+	walk = func(it *CopybookItem, parent, suffix string, shift int) error {
+		for i := 0; i < it.Occurs; i++ {
+			sfx := suffix
+			if it.Occurs > 1 {
+				sfx += "_" + strconv.Itoa(i+1)
+			}
+			if len(it.Items) > 0 {
+				for _, child := range it.Items {
+					if err := walk(child, it.Name, sfx, shift+i*it.Length); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			offset := shift + it.Offset + i*it.Length
+			if it.Name == "FILLER" {
+				continue
+			}
+			name := cobolFieldName(it.Name) + sfx
+			if seen[name] {
+				name = cobolFieldName(parent) + "_" + name
+			}
+			if seen[name] {
+				return fmt.Errorf("copybook: field name %s is ambiguous", name)
+			}
+			seen[name] = true
+			fields = append(fields, Field{Name: name, Offset: offset, Length: it.Length, Type: it.Type, Scale: it.Scale})
+		}
+		return nil
+	}
+	if err := walk(item, "", "", -item.Offset); err != nil {
+		return nil, err
+	}
+	return NewSchema(fields...)
+}
+
+// GoStruct returns Go source declaring a struct for the record, named
+// name, with msgpack tags naming the schema fields. OCCURS items become
+// arrays, of a nested struct type for groups; TypedTable matches struct
+// fields to schema fields by name, so it only handles records without
+// OCCURS.
+func (c *Copybook) GoStruct(name string) (string, error) {
+	var decls []string
+	var build func(typeName string, it *CopybookItem) string
+	build = func(typeName string, it *CopybookItem) string {
+		var b strings.Builder
+		fmt.Fprintf(&b, "type %s struct {\n", typeName)
+		var fields func(items []*CopybookItem)
+		fields = func(items []*CopybookItem) {
+			for _, child := range items {
+				if child.Name == "FILLER" {
+					continue
+				}
+				goName := cobolGoName(child.Name)
+				var typ string
+				switch {
+				case len(child.Items) > 0 && child.Occurs == 1:
+					fields(child.Items)
+					continue
+				case len(child.Items) > 0:
+					typ = typeName + goName
+					decls = append(decls, build(typ, child))
+				default:
+					typ = goFieldType(child)
+				}
+				if child.Occurs > 1 {
+					typ = fmt.Sprintf("[%d]%s", child.Occurs, typ)
+				}
+				fmt.Fprintf(&b, "%s %s `msgpack:%q` // %s\n", goName, typ, cobolFieldName(child.Name), describeItem(child))
+			}
+		}
+		fields(it.Items)
+		b.WriteString("}\n")
+		return b.String()
+	}
+	record := c.Records[0]
+	if len(record.Items) == 0 {
+		record = &CopybookItem{Name: record.Name, Items: []*CopybookItem{record}, Occurs: 1}
+	}
+	top := build(name, record)
+	src, err := format.Source([]byte(top + "\n" + strings.Join(decls, "\n")))
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSpace(src)) + "\n", nil
+}
+
+// goFieldType returns the Go type a field of the item decodes to
+func goFieldType(it *CopybookItem) string {
+	switch it.Type {
+	case KeyTypeString, KeyTypeWString:
+		return "string"
+	case KeyTypeFloat:
+		return "float64"
+	case KeyTypeUnsignedBinary:
+		return "uint64"
+	}
+	if it.Scale > 0 {
+		return "xtrieve.FixedPoint"
+	}
+	return "int64"
+}
+
+// describeItem summarizes an item's COBOL definition for a comment
+func describeItem(it *CopybookItem) string {
+	s := "offset " + strconv.Itoa(it.Offset)
+	if it.Picture != "" {
+		s += ", PIC " + it.Picture
+	}
+	if it.Usage != "" && it.Usage != "DISPLAY" {
+		s += " " + it.Usage
+	}
+	if it.Occurs > 1 {
+		s += fmt.Sprintf(", OCCURS %d", it.Occurs)
+	}
+	return s
+}
+
+// cobolFieldName converts a COBOL name to a schema field name
+func cobolFieldName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "-", "_"))
+}
+
+// cobolGoName converts a COBOL name to an exported Go identifier
+func cobolGoName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' }) {
+		part = strings.ToLower(part)
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter(rune(s[0])) {
+		s = "F" + s
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+package xtrieve
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testCopybook = `
+000100* CUSTOMER MASTER RECORD                                          CUST0001
+000200 01  CUSTOMER-RECORD.                                             CUST0002
+000300     05  CUST-ID             PIC 9(6).                            CUST0003
+000400     05  CUST-NAME           PIC X(20).                           CUST0004
+000500     05  CUST-BALANCE        PIC S9(7)V99 COMP-3.                 CUST0005
+000600     05  CUST-LIMIT          PIC S9(5)V99                         CUST0006
+000700                             SIGN TRAILING SEPARATE.              CUST0007
+000800     05  CUST-STATUS         PIC X.                               CUST0008
+000900         88  CUST-ACTIVE     VALUE 'A'.                           CUST0009
+001000     05  CUST-PHONES OCCURS 2 TIMES.                              CUST0010
+001100         10  PHONE-TYPE      PIC X.                               CUST0011
+001200         10  PHONE-NUMBER    PIC X(10).                           CUST0012
+001300     05  CUST-OPENED         PIC 9(8).                            CUST0013
+001400     05  CUST-OPENED-PARTS REDEFINES CUST-OPENED.                 CUST0014
+001500         10  OPENED-YEAR     PIC 9(4).                            CUST0015
+001600         10  FILLER          PIC 9(4).                            CUST0016
+001700     05  CUST-COUNT          PIC S9(4) COMP-5.                    CUST0017
+001800     05  CUST-RATE           COMP-2.                              CUST0018
+`
+
+func TestParseCopybook(t *testing.T) {
+	c, err := ParseCopybook(strings.NewReader(testCopybook), CopybookOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{Name: "cust_id", Offset: 0, Length: 6, Type: KeyTypeNumeric},
+		{Name: "cust_name", Offset: 6, Length: 20, Type: KeyTypeString},
+		{Name: "cust_balance", Offset: 26, Length: 5, Type: KeyTypeDecimal, Scale: 2},
+		{Name: "cust_limit", Offset: 31, Length: 8, Type: KeyTypeNumericSTS, Scale: 2},
+		{Name: "cust_status", Offset: 39, Length: 1, Type: KeyTypeString},
+		{Name: "phone_type_1", Offset: 40, Length: 1, Type: KeyTypeString},
+		{Name: "phone_number_1", Offset: 41, Length: 10, Type: KeyTypeString},
+		{Name: "phone_type_2", Offset: 51, Length: 1, Type: KeyTypeString},
+		{Name: "phone_number_2", Offset: 52, Length: 10, Type: KeyTypeString},
+		{Name: "cust_opened", Offset: 62, Length: 8, Type: KeyTypeNumeric},
+		{Name: "opened_year", Offset: 62, Length: 4, Type: KeyTypeNumeric},
+		{Name: "cust_count", Offset: 70, Length: 2, Type: KeyTypeInteger},
+		{Name: "cust_rate", Offset: 72, Length: 8, Type: KeyTypeFloat},
+	}
+	if !reflect.DeepEqual(s.Fields, want) {
+		t.Errorf("fields =\n%+v\nwant\n%+v", s.Fields, want)
+	}
+	if n := c.Records[0].Length; n != 80 {
+		t.Errorf("record length = %d, want 80", n)
+	}
+
+	values := map[string]any{
+		"cust_id":      int64(42),
+		"cust_name":    "ACME",
+		"cust_balance": NewFixedPoint(-1234567, 2),
+		"cust_limit":   NewFixedPoint(500000, 2),
+		"cust_count":   int64(-3),
+	}
+	record, err := s.Encode(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := record[26:31]; string(got) != "\x00\x12\x34\x56\x7d" {
+		t.Errorf("cust_balance = % x, want packed 001234567d", got)
+	}
+	for name, want := range values {
+		if got, err := s.Get(record, name); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, %v, want %v", name, got, err, want)
+		}
+	}
+}
+
+func TestParseCopybookFreeFormat(t *testing.T) {
+	src := `01 REC. *> free format
+  05 AMOUNT PIC S9(3) USAGE IS COMPUTATIONAL-3.
+  05 CODE-A PIC S99.
+  05 FLAGS PIC X OCCURS 2 TO 5 DEPENDING ON N.`
+	c, err := ParseCopybook(strings.NewReader(src), CopybookOptions{Zoned: KeyTypeNumericSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := c.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{Name: "amount", Offset: 0, Length: 2, Type: KeyTypeDecimal},
+		{Name: "code_a", Offset: 2, Length: 2, Type: KeyTypeNumericSA},
+		{Name: "flags_1", Offset: 4, Length: 1, Type: KeyTypeString},
+		{Name: "flags_2", Offset: 5, Length: 1, Type: KeyTypeString},
+		{Name: "flags_3", Offset: 6, Length: 1, Type: KeyTypeString},
+		{Name: "flags_4", Offset: 7, Length: 1, Type: KeyTypeString},
+		{Name: "flags_5", Offset: 8, Length: 1, Type: KeyTypeString},
+	}
+	if !reflect.DeepEqual(s.Fields, want) {
+		t.Errorf("fields =\n%+v\nwant\n%+v", s.Fields, want)
+	}
+}
+
+func TestParseCopybookErrors(t *testing.T) {
+	tests := map[string]string{
+		"empty":             "",
+		"no level":          "REC PIC X.",
+		"bad level":         "55 REC PIC X.",
+		"big-endian COMP":   "01 N PIC S9(4) COMP.",
+		"scaled binary":     "01 N PIC S9(4)V9 COMP-5.",
+		"sign leading":      "01 N PIC S9(4) SIGN LEADING.",
+		"no picture":        "01 N.",
+		"picture and items": "01 R PIC X.\n 05 A PIC X.",
+		"unknown redefines": "01 R.\n 05 A PIC X.\n 05 B REDEFINES C PIC X.",
+		"bad occurs":        "01 R.\n 05 A PIC X OCCURS 0.",
+	}
+	for name, src := range tests {
+		if c, err := ParseCopybook(strings.NewReader(src), CopybookOptions{}); err == nil {
+			t.Errorf("%s: ParseCopybook = %+v, want an error", name, c.Records)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package xtrieve
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// EncryptionOverhead is the number of bytes an encrypted field needs on top
+// of its value: a 4-byte key ID, a 12-byte nonce and a 16-byte tag
+const EncryptionOverhead = 4 + 12 + 16
+
+// KeyProvider supplies AES keys (16, 24 or 32 bytes) for encrypted fields.
+// Each ciphertext stores the ID of the key it was made with, so keys can be
+// rotated: new values use the current key while old ones stay readable as
+// long as Key still returns their key.
+type KeyProvider interface {
+	// CurrentKey returns the key to encrypt new values with
+	CurrentKey() (id uint32, key []byte, err error)
+	// Key returns the key with the given ID
+	Key(id uint32) ([]byte, error)
+}
+
+// StaticKeys is a KeyProvider holding keys in memory
+type StaticKeys struct {
+	Current uint32
+	Keys    map[uint32][]byte
+}
+
+// CurrentKey returns the key with ID Current
+func (k *StaticKeys) CurrentKey() (uint32, []byte, error) {
+	key, err := k.Key(k.Current)
+	return k.Current, key, err
+}
+
+// Key returns the key with the given ID
+func (k *StaticKeys) Key(id uint32) ([]byte, error) {
+	key, ok := k.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("xtrieve: unknown encryption key %d", id)
+	}
+	return key, nil
+}
+
+// plain returns the field as it looks before encryption: same type, at
+// the start of a buffer of the plaintext length
+func (f Field) plain() Field {
+	return Field{Name: f.Name, Length: f.Length - EncryptionOverhead, Type: f.Type, Charset: f.Charset}
+}
+
+// encrypt seals the encoded value into the field's bytes of record
+func (s *Schema) encrypt(f Field, record []byte, value any) error {
+	if s.Keys == nil {
+		return fmt.Errorf("field %s: encrypted but the schema has no KeyProvider", f.Name)
+	}
+	b, err := f.bytes(record)
+	if err != nil {
+		return err
+	}
+	plain := f.plain()
+	buf := make([]byte, plain.Length)
+	if err := plain.Encode(buf, value); err != nil {
+		return err
+	}
+
+	id, key, err := s.Keys.CurrentKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(b, id)
+	nonce := b[4:16]
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	ad, err := s.associatedData(f, record)
+	if err != nil {
+		return err
+	}
+	aead.Seal(b[16:16], nonce, buf, ad)
+	return nil
+}
+
+// decrypt opens the field's bytes of record and decodes the value. A field
+// that was never written (all zeros) decodes as the zero value.
+func (s *Schema) decrypt(f Field, record []byte) (any, error) {
+	b, err := f.bytes(record)
+	if err != nil {
+		return nil, err
+	}
+	plain := f.plain()
+	if allZero(b) {
+		return plain.Decode(make([]byte, plain.Length))
+	}
+	if s.Keys == nil {
+		return nil, fmt.Errorf("field %s: encrypted but the schema has no KeyProvider", f.Name)
+	}
+
+	key, err := s.Keys.Key(binary.LittleEndian.Uint32(b))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	ad, err := s.associatedData(f, record)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := aead.Open(nil, b[4:16], b[16:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", f.Name, ErrDecrypt)
+	}
+	return plain.Decode(buf)
+}
+
+// associatedData is what an encrypted field's value is bound to: the
+// field name, and with RecordKey or Scope set, the scope and the stored
+// bytes of the record key fields
+func (s *Schema) associatedData(f Field, record []byte) ([]byte, error) {
+	ad := []byte(f.Name)
+	if len(s.RecordKey) == 0 && s.Scope == "" {
+		return ad, nil
+	}
+	ad = append(ad, 0)
+	ad = binary.AppendUvarint(ad, uint64(len(s.Scope)))
+	ad = append(ad, s.Scope...)
+	for _, name := range s.RecordKey {
+		k, ok := s.Field(name)
+		if !ok || k.Encrypted {
+			return nil, fmt.Errorf("field %s: record key field %s must be a plain field", f.Name, name)
+		}
+		b, err := k.bytes(record)
+		if err != nil {
+			return nil, err
+		}
+		ad = binary.AppendUvarint(ad, uint64(len(b)))
+		ad = append(ad, b...)
+	}
+	return ad, nil
+}
+
+// rebind runs write, which changes a record key field, and encrypts the
+// record's encrypted fields again for the new key
+func (s *Schema) rebind(record []byte, write func() error) error {
+	type sealed struct {
+		field Field
+		value any
+	}
+	var values []sealed
+	for _, f := range s.Fields {
+		if !f.Encrypted {
+			continue
+		}
+		if b, err := f.bytes(record); err != nil || allZero(b) {
+			continue
+		}
+		f, err := s.withCharset(f)
+		if err != nil {
+			return err
+		}
+		v, err := s.decrypt(f, record)
+		if err != nil {
+			return err
+		}
+		values = append(values, sealed{f, v})
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	for _, v := range values {
+		if err := s.encrypt(v.field, record, v.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
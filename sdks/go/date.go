@@ -0,0 +1,146 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// julianUnixEpoch is the Julian day number of 1970-01-01
+const julianUnixEpoch = 2440588
+
+// DecodeDate decodes a Btrieve DATE: day and month bytes followed by a
+// little-endian 16-bit year. A date with year 0, such as all zeros, is the
+// zero time.Time; dates that do not exist, such as February 30, are an
+// error.
+func DecodeDate(b []byte) (time.Time, error) {
+	if len(b) != 4 {
+		return time.Time{}, fmt.Errorf("DATE needs 4 bytes, not %d", len(b))
+	}
+	day, month, year := int(b[0]), time.Month(b[1]), int(binary.LittleEndian.Uint16(b[2:]))
+	if year == 0 {
+		return time.Time{}, nil
+	}
+	t := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	if t.Day() != day || t.Month() != month || t.Year() != year {
+		return time.Time{}, fmt.Errorf("invalid DATE %04d-%02d-%02d", year, month, day)
+	}
+	return t, nil
+}
+
+// EncodeDate encodes the calendar date of t as a Btrieve DATE, e.g. for a
+// search key. The zero time.Time encodes as all zeros.
+func EncodeDate(t time.Time) []byte {
+	b := make([]byte, 4)
+	putDate(b, t)
+	return b
+}
+
+func putDate(b []byte, t time.Time) {
+	if t.IsZero() {
+		clear(b)
+		return
+	}
+	b[0] = byte(t.Day())
+	b[1] = byte(t.Month())
+	binary.LittleEndian.PutUint16(b[2:], uint16(t.Year()))
+}
+
+// JulianDay returns the Julian day number of t's calendar date, the count
+// of days since January 1, 4713 BC in the proleptic Julian calendar, as
+// used by date arithmetic in many legacy programs: 2000-01-01 is 2451545.
+func JulianDay(t time.Time) int {
+	y, m, d := t.Date()
+	days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / 86400
+	return int(days) + julianUnixEpoch
+}
+
+// FromJulianDay returns midnight UTC of the date with Julian day number jd
+func FromJulianDay(jd int) time.Time {
+	return time.Unix(int64(jd-julianUnixEpoch)*86400, 0).UTC()
+}
+
+// CenturyWindow expands the 2-digit years of legacy fields into the
+// hundred years starting at Start: with Start 1950, 49 is 2049 and 50 is
+// 1950
+type CenturyWindow struct {
+	Start int
+}
+
+// DefaultCenturyWindow maps 00-49 to 2000-2049 and 50-99 to 1950-1999
+var DefaultCenturyWindow = CenturyWindow{Start: 1950}
+
+// SlidingCenturyWindow returns the window ending future years after now,
+// so that it moves with the calendar
+func SlidingCenturyWindow(now time.Time, future int) CenturyWindow {
+	return CenturyWindow{Start: now.Year() + future - 99}
+}
+
+// Year expands a 2-digit year. Values outside 0-99 are returned unchanged.
+func (w CenturyWindow) Year(yy int) int {
+	if yy < 0 || yy > 99 {
+		return yy
+	}
+	return w.Start + (yy-w.Start%100+100)%100
+}
+
+// FromYYMMDD converts a date stored as the integer YYMMDD, e.g. 991231
+func (w CenturyWindow) FromYYMMDD(n int) (time.Time, error) {
+	return checkedDate(w.Year(n/10000), n/100%100, n%100, n)
+}
+
+// FromYYDDD converts a mainframe "Julian" date stored as the integer YYDDD,
+// a 2-digit year and the day of the year, e.g. 24060 for 2024-02-29
+func (w CenturyWindow) FromYYDDD(n int) (time.Time, error) {
+	return ordinalDate(w.Year(n/1000), n%1000, n)
+}
+
+// FromYYYYMMDD converts a date stored as the integer YYYYMMDD, e.g. 20241231
+func FromYYYYMMDD(n int) (time.Time, error) {
+	return checkedDate(n/10000, n/100%100, n%100, n)
+}
+
+// FromYYYYDDD converts a date stored as the integer YYYYDDD, a year and the
+// day of the year
+func FromYYYYDDD(n int) (time.Time, error) {
+	return ordinalDate(n/1000, n%1000, n)
+}
+
+// YYMMDD returns t's date as the integer YYMMDD. The century is lost;
+// read it back with a CenturyWindow that covers t.
+func YYMMDD(t time.Time) int {
+	return YYYYMMDD(t) % 1000000
+}
+
+// YYYYMMDD returns t's date as the integer YYYYMMDD
+func YYYYMMDD(t time.Time) int {
+	y, m, d := t.Date()
+	return y*10000 + int(m)*100 + d
+}
+
+// YYDDD returns t's date as the integer YYDDD
+func YYDDD(t time.Time) int {
+	return YYYYDDD(t) % 100000
+}
+
+// YYYYDDD returns t's date as the integer YYYYDDD
+func YYYYDDD(t time.Time) int {
+	return t.Year()*1000 + t.YearDay()
+}
+
+// checkedDate builds a date, rejecting values time.Date would normalize
+func checkedDate(year, month, day, n int) (time.Time, error) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if n < 0 || t.Year() != year || int(t.Month()) != month || t.Day() != day {
+		return time.Time{}, fmt.Errorf("invalid date %d", n)
+	}
+	return t, nil
+}
+
+func ordinalDate(year, yday, n int) (time.Time, error) {
+	t := time.Date(year, time.January, yday, 0, 0, 0, 0, time.UTC)
+	if n < 0 || yday < 1 || t.Year() != year {
+		return time.Time{}, fmt.Errorf("invalid ordinal date %d", n)
+	}
+	return t, nil
+}
@@ -0,0 +1,165 @@
+package xtrieve
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+)
+
+func day(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func TestDate(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		raw  string
+	}{
+		{time.Time{}, "00000000"},
+		{day(1970, 1, 1), "0101b207"},
+		{day(2024, 2, 29), "1d02e807"},
+		{day(1899, 12, 31), "1f0c6b07"},
+		{day(9999, 12, 31), "1f0c0f27"},
+	}
+	for _, tt := range tests {
+		if got := hex.EncodeToString(EncodeDate(tt.date)); got != tt.raw {
+			t.Errorf("EncodeDate(%v) = %s, want %s", tt.date, got, tt.raw)
+		}
+		raw, _ := hex.DecodeString(tt.raw)
+		if got, err := DecodeDate(raw); err != nil || !got.Equal(tt.date) {
+			t.Errorf("DecodeDate(%s) = %v, %v, want %v", tt.raw, got, err, tt.date)
+		}
+	}
+
+	// February 29 of a year that is not a leap year, and a 13th month
+	for _, raw := range []string{"1d02e707", "1d026c07", "010de807", "00010000"[:6]} {
+		b, _ := hex.DecodeString(raw)
+		if got, err := DecodeDate(b); err == nil {
+			t.Errorf("DecodeDate(%s) = %v, want an error", raw, got)
+		}
+	}
+}
+
+func TestJulianDay(t *testing.T) {
+	tests := []struct {
+		date time.Time
+		jd   int
+	}{
+		{day(1970, 1, 1), 2440588},
+		{day(1969, 12, 31), 2440587},
+		{day(2000, 1, 1), 2451545},
+		{day(2000, 2, 29), 2451604},
+		{day(2000, 3, 1), 2451605},
+		{day(1900, 2, 28), 2415079},
+		{day(1900, 3, 1), 2415080}, // 1900 is not a leap year
+		{day(1858, 11, 17), 2400001},
+		{day(1582, 10, 15), 2299161},
+		{day(-4713, 11, 24), 0},
+	}
+	for _, tt := range tests {
+		if got := JulianDay(tt.date); got != tt.jd {
+			t.Errorf("JulianDay(%v) = %d, want %d", tt.date, got, tt.jd)
+		}
+		if got := FromJulianDay(tt.jd); !got.Equal(tt.date) {
+			t.Errorf("FromJulianDay(%d) = %v, want %v", tt.jd, got, tt.date)
+		}
+	}
+
+	// The time of day and location do not change the day number
+	late := time.Date(2000, 1, 1, 23, 59, 59, 0, time.FixedZone("", -10*3600))
+	if got := JulianDay(late); got != 2451545 {
+		t.Errorf("JulianDay(%v) = %d, want 2451545", late, got)
+	}
+}
+
+func TestCenturyWindow(t *testing.T) {
+	tests := []struct {
+		start, yy, want int
+	}{
+		{1950, 49, 2049},
+		{1950, 50, 1950},
+		{1950, 0, 2000},
+		{1950, 99, 1999},
+		{1900, 0, 1900},
+		{1900, 99, 1999},
+		{1980, 79, 2079},
+		{1980, 80, 1980},
+		{1999, 98, 2098},
+		{1999, 99, 1999},
+		{1950, 100, 100},
+		{1950, -1, -1},
+	}
+	for _, tt := range tests {
+		if got := (CenturyWindow{Start: tt.start}).Year(tt.yy); got != tt.want {
+			t.Errorf("window %d: Year(%d) = %d, want %d", tt.start, tt.yy, got, tt.want)
+		}
+	}
+
+	w := SlidingCenturyWindow(day(2026, 10, 15), 10)
+	if w.Start != 1937 || w.Year(36) != 2036 || w.Year(37) != 1937 {
+		t.Errorf("sliding window = %+v, want 1937-2036", w)
+	}
+}
+
+func TestIntegerDates(t *testing.T) {
+	w := DefaultCenturyWindow
+	valid := []struct {
+		date                          time.Time
+		yymmdd, yyyymmdd, yyddd, yyyy int
+	}{
+		{day(1999, 12, 31), 991231, 19991231, 99365, 1999365},
+		{day(2000, 1, 1), 101, 20000101, 1, 2000001},
+		{day(2024, 2, 29), 240229, 20240229, 24060, 2024060},
+		{day(2024, 12, 31), 241231, 20241231, 24366, 2024366},
+		{day(2049, 3, 1), 490301, 20490301, 49060, 2049060},
+		{day(1950, 1, 1), 500101, 19500101, 50001, 1950001},
+	}
+	for _, tt := range valid {
+		if got := YYMMDD(tt.date); got != tt.yymmdd {
+			t.Errorf("YYMMDD(%v) = %d, want %d", tt.date, got, tt.yymmdd)
+		}
+		if got := YYYYMMDD(tt.date); got != tt.yyyymmdd {
+			t.Errorf("YYYYMMDD(%v) = %d, want %d", tt.date, got, tt.yyyymmdd)
+		}
+		if got := YYDDD(tt.date); got != tt.yyddd {
+			t.Errorf("YYDDD(%v) = %d, want %d", tt.date, got, tt.yyddd)
+		}
+		if got := YYYYDDD(tt.date); got != tt.yyyy {
+			t.Errorf("YYYYDDD(%v) = %d, want %d", tt.date, got, tt.yyyy)
+		}
+		if got, err := w.FromYYMMDD(tt.yymmdd); err != nil || !got.Equal(tt.date) {
+			t.Errorf("FromYYMMDD(%d) = %v, %v, want %v", tt.yymmdd, got, err, tt.date)
+		}
+		if got, err := FromYYYYMMDD(tt.yyyymmdd); err != nil || !got.Equal(tt.date) {
+			t.Errorf("FromYYYYMMDD(%d) = %v, %v, want %v", tt.yyyymmdd, got, err, tt.date)
+		}
+		if got, err := w.FromYYDDD(tt.yyddd); err != nil || !got.Equal(tt.date) {
+			t.Errorf("FromYYDDD(%d) = %v, %v, want %v", tt.yyddd, got, err, tt.date)
+		}
+		if got, err := FromYYYYDDD(tt.yyyy); err != nil || !got.Equal(tt.date) {
+			t.Errorf("FromYYYYDDD(%d) = %v, %v, want %v", tt.yyyy, got, err, tt.date)
+		}
+	}
+
+	invalid := []struct {
+		name string
+		fn   func(int) (time.Time, error)
+		n    int
+	}{
+		{"FromYYMMDD", w.FromYYMMDD, 230229},     // 2023 is not a leap year
+		{"FromYYMMDD", w.FromYYMMDD, 1301},       // month 0
+		{"FromYYMMDD", w.FromYYMMDD, -240101},    // negative
+		{"FromYYYYMMDD", FromYYYYMMDD, 19000229}, // 1900 is not a leap year
+		{"FromYYYYMMDD", FromYYYYMMDD, 20241301},
+		{"FromYYYYMMDD", FromYYYYMMDD, 20240431},
+		{"FromYYDDD", w.FromYYDDD, 23366}, // 2023 has 365 days
+		{"FromYYDDD", w.FromYYDDD, 24000},
+		{"FromYYYYDDD", FromYYYYDDD, 2024367},
+		{"FromYYYYDDD", FromYYYYDDD, 2024999},
+	}
+	for _, tt := range invalid {
+		if got, err := tt.fn(tt.n); err == nil {
+			t.Errorf("%s(%d) = %v, want an error", tt.name, tt.n, got)
+		}
+	}
+}
@@ -0,0 +1,671 @@
+package xtrieve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DBF reads the records of a dBASE, Clipper or FoxPro table, with memos
+// from its .dbt or .fpt memo file
+//
+//	d, err := xtrieve.OpenDBF("CUSTOMER.DBF")
+//	defer d.Close()
+//	schema, err := d.Schema()
+//	for {
+//	    values, err := d.Next() // io.EOF after the last record
+//	    ...
+//	}
+type DBF struct {
+	Version byte
+	// Updated is the date of the last update in the header
+	Updated time.Time
+	// Count is the number of records in the header, deleted ones included
+	Count  int
+	Fields []DBFField
+	// Charset is the code page of character fields and memos, taken from
+	// the header's language driver byte. Clipper leaves it unset, in which
+	// case it is "cp437"; set it before reading if the application used
+	// another code page.
+	Charset string
+
+	r      *bufio.Reader
+	closer io.Closer
+	memo   *dbfMemo
+	record []byte
+	read   int
+}
+
+// DBFField is a field descriptor of a DBF table
+type DBFField struct {
+	Name string
+	// Type is the dBASE type letter: C, N, F, D, L, M, B, G or I
+	Type     byte
+	Length   int
+	Decimals int
+	offset   int
+}
+
+// dbfCharsets maps DBF language driver IDs to character sets
+var dbfCharsets = map[byte]string{
+	0x01: "cp437",
+	0x02: "cp850",
+	0x03: "cp1252",
+	0x57: "cp1252",
+	0x58: "cp1252",
+	0x59: "cp1252",
+}
+
+// OpenDBF opens a DBF file and the memo file next to it, if any: the same
+// name with a .dbt or .fpt extension, in either case
+func OpenDBF(path string) (*DBF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	var memo *os.File
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".dbt", ".DBT", ".fpt", ".FPT"} {
+		if memo, err = os.Open(base + ext); err == nil {
+			break
+		}
+	}
+	var r io.ReaderAt
+	if memo != nil {
+		r = memo
+	}
+	d, err := NewDBF(f, r)
+	if err != nil {
+		f.Close()
+		if memo != nil {
+			memo.Close()
+		}
+		return nil, err
+	}
+	d.closer = multiCloser{f, memo}
+	return d, nil
+}
+
+// multiCloser closes a DBF file and its memo file
+type multiCloser struct {
+	dbf  *os.File
+	memo *os.File
+}
+
+func (c multiCloser) Close() error {
+	err := c.dbf.Close()
+	if c.memo != nil {
+		if merr := c.memo.Close(); err == nil {
+			err = merr
+		}
+	}
+	return err
+}
+
+// NewDBF reads a DBF header from r. memo is the memo file, or nil if the
+// table has none.
+func NewDBF(r io.Reader, memo io.ReaderAt) (*DBF, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, 32)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("dbf header: %w", err)
+	}
+	d := &DBF{
+		Version: header[0],
+		Count:   int(binary.LittleEndian.Uint32(header[4:])),
+		r:       br,
+	}
+	if header[2] >= 1 && header[2] <= 12 {
+		d.Updated = time.Date(1900+int(header[1]), time.Month(header[2]), int(header[3]), 0, 0, 0, 0, time.UTC)
+	}
+	d.Charset = dbfCharsets[header[29]]
+	if d.Charset == "" {
+		d.Charset = "cp437"
+	}
+	headerLength := int(binary.LittleEndian.Uint16(header[8:]))
+	recordLength := int(binary.LittleEndian.Uint16(header[10:]))
+	if headerLength < 33 || recordLength < 1 {
+		return nil, errors.New("dbf header: not a DBF file")
+	}
+
+	// Field descriptors follow until a 0x0D terminator; FoxPro adds a
+	// backlink before the first record, which headerLength skips
+	rest := make([]byte, headerLength-32)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return nil, fmt.Errorf("dbf header: %w", err)
+	}
+	offset := 1 // the deletion flag
+	for i := 0; i+32 <= len(rest) && rest[i] != 0x0D; i += 32 {
+		desc := rest[i : i+32]
+		name, _, _ := strings.Cut(string(desc[:11]), "\x00")
+		f := DBFField{
+			Name:     strings.TrimSpace(name),
+			Type:     desc[11],
+			Length:   int(desc[16]),
+			Decimals: int(desc[17]),
+			offset:   offset,
+		}
+		if f.Type == 'C' {
+			// Clipper and FoxPro store long character lengths in both bytes
+			f.Length |= f.Decimals << 8
+			f.Decimals = 0
+		}
+		offset += f.Length
+		d.Fields = append(d.Fields, f)
+	}
+	if offset != recordLength {
+		return nil, fmt.Errorf("dbf header: fields cover %d bytes of %d-byte records", offset, recordLength)
+	}
+	d.record = make([]byte, recordLength)
+
+	if memo != nil {
+		m, err := newDBFMemo(memo, d.Version)
+		if err != nil {
+			return nil, err
+		}
+		d.memo = m
+	}
+	return d, nil
+}
+
+// Close closes the files opened by OpenDBF
+func (d *DBF) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer.Close()
+}
+
+// Next returns the next record's values keyed by lower-case field name,
+// skipping deleted records, or io.EOF after the last record. Blank
+// numeric, date and logical fields and empty memos are left out of the
+// map. Character fields are trimmed of trailing spaces, N and F fields are
+// int64 or, with decimals, FixedPoint, and dates are time.Time.
+func (d *DBF) Next() (map[string]any, error) {
+	for d.read < d.Count {
+		if _, err := io.ReadFull(d.r, d.record); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("dbf record %d: %w", d.read+1, err)
+		}
+		d.read++
+		switch d.record[0] {
+		case 0x1A: // end of file
+			return nil, io.EOF
+		case '*': // deleted
+			continue
+		}
+		values := make(map[string]any, len(d.Fields))
+		for _, f := range d.Fields {
+			v, err := d.value(f, d.record[f.offset:f.offset+f.Length])
+			if err != nil {
+				return nil, fmt.Errorf("dbf record %d: field %s: %w", d.read, f.Name, err)
+			}
+			if v != nil {
+				values[strings.ToLower(f.Name)] = v
+			}
+		}
+		return values, nil
+	}
+	return nil, io.EOF
+}
+
+// value decodes a field, returning nil for a blank one
+func (d *DBF) value(f DBFField, b []byte) (any, error) {
+	text := strings.TrimSpace(string(b))
+	switch f.Type {
+	case 'C':
+		return strings.TrimRight(d.decodeText(b), " "), nil
+	case 'N', 'F':
+		if text == "" || strings.HasPrefix(text, "*") { // blank or overflowed
+			return nil, nil
+		}
+		switch {
+		case f.Decimals > 0:
+			return ParseFixedPoint(text, f.Decimals)
+		case f.Length > 18:
+			return strconv.ParseFloat(text, 64)
+		}
+		return strconv.ParseInt(text, 10, 64)
+	case 'D':
+		if text == "" || text == "00000000" {
+			return nil, nil
+		}
+		return time.Parse("20060102", text)
+	case 'L':
+		switch b[0] {
+		case 'T', 't', 'Y', 'y':
+			return true, nil
+		case 'F', 'f', 'N', 'n':
+			return false, nil
+		}
+		return nil, nil
+	case 'I':
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	case 'M', 'B', 'G':
+		var block int
+		if f.Length == 4 {
+			block = int(binary.LittleEndian.Uint32(b))
+		} else if text != "" {
+			n, err := strconv.Atoi(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid memo block %q", text)
+			}
+			block = n
+		}
+		if block == 0 {
+			return nil, nil
+		}
+		if d.memo == nil {
+			return nil, errors.New("memo file missing")
+		}
+		data, text, err := d.memo.read(block)
+		if err != nil || !text || f.Type != 'M' {
+			return data, err
+		}
+		return d.decodeText(data), nil
+	}
+	return nil, fmt.Errorf("unsupported field type %c", f.Type)
+}
+
+func (d *DBF) decodeText(b []byte) string {
+	if cs, ok := CharsetByName(d.Charset); ok {
+		return cs.Decode(b)
+	}
+	return string(b)
+}
+
+// Schema lays out a record for the table's fields, named in lower case:
+// C as STRING in the table's Charset, N and F as INTEGER or, with
+// decimals, scaled DECIMAL, D as DATE, L as LOGICAL and I as a 4-byte
+// INTEGER. Memos do not fit in a fixed-length record, so a table with memo
+// fields gets a Document schema that stores them after the fields, and
+// can only be imported into a variable-length file.
+func (d *DBF) Schema() (*Schema, error) {
+	var fields []Field
+	document := false
+	offset := 0
+	for _, f := range d.Fields {
+		field := Field{Name: strings.ToLower(f.Name), Offset: offset}
+		switch f.Type {
+		case 'C':
+			field.Type, field.Length, field.Charset = KeyTypeString, f.Length, d.Charset
+		case 'N', 'F':
+			switch {
+			case f.Decimals > 0:
+				// Digits without the decimal point, at most what FixedPoint holds
+				digits := min(f.Length-1, 18)
+				field.Type, field.Length, field.Scale = KeyTypeDecimal, digits/2+1, f.Decimals
+			case f.Length > 18:
+				field.Type, field.Length = KeyTypeFloat, 8
+			case f.Length > 9:
+				field.Type, field.Length = KeyTypeInteger, 8
+			case f.Length > 4:
+				field.Type, field.Length = KeyTypeInteger, 4
+			default:
+				field.Type, field.Length = KeyTypeInteger, 2
+			}
+		case 'D':
+			field.Type, field.Length = KeyTypeDate, 4
+		case 'L':
+			field.Type, field.Length = KeyTypeLogical, 1
+		case 'I':
+			field.Type, field.Length = KeyTypeInteger, 4
+		case 'M', 'B', 'G':
+			document = true
+			continue
+		default:
+			return nil, fmt.Errorf("dbf field %s: unsupported type %c", f.Name, f.Type)
+		}
+		fields = append(fields, field)
+		offset += field.Length
+	}
+	s, err := NewSchema(fields...)
+	if err != nil {
+		return nil, err
+	}
+	s.Document = document
+	return s, nil
+}
+
+// dbfMemo reads memos from a .dbt or .fpt file
+type dbfMemo struct {
+	r         io.ReaderAt
+	blockSize int
+	// fox is set for FoxPro .fpt files, whose blocks have a big-endian
+	// type and length header
+	fox bool
+}
+
+func newDBFMemo(r io.ReaderAt, version byte) (*dbfMemo, error) {
+	header := make([]byte, 22)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("dbf memo header: %w", err)
+	}
+	m := &dbfMemo{r: r, blockSize: 512}
+	switch version {
+	case 0xF5, 0x30, 0x31, 0x32: // FoxPro and Visual FoxPro
+		m.fox = true
+		m.blockSize = int(binary.BigEndian.Uint16(header[6:]))
+	case 0x8B, 0xCB: // dBASE IV
+		if n := int(binary.LittleEndian.Uint16(header[20:])); n > 0 {
+			m.blockSize = n
+		}
+	}
+	if m.blockSize == 0 {
+		return nil, errors.New("dbf memo header: block size 0")
+	}
+	return m, nil
+}
+
+// dbfMemoLimit bounds a dBASE III memo, which has no length but runs to a
+// 0x1A terminator
+const dbfMemoLimit = 1 << 24
+
+// read returns the memo starting at block and whether it is text
+func (m *dbfMemo) read(block int) ([]byte, bool, error) {
+	off := int64(block) * int64(m.blockSize)
+	head := make([]byte, 8)
+	if n, err := m.r.ReadAt(head, off); err != nil && !(err == io.EOF && n > 0) {
+		return nil, false, fmt.Errorf("memo block %d: %w", block, err)
+	}
+	switch {
+	case m.fox:
+		// Type 1 is text; 0 is a picture and 2 an OLE object
+		text := binary.BigEndian.Uint32(head) == 1
+		data, err := m.readAt(off+8, int(binary.BigEndian.Uint32(head[4:])))
+		return data, text, err
+	case head[0] == 0xFF && head[1] == 0xFF && head[2] == 0x08 && head[3] == 0x00:
+		// dBASE IV: the length includes the 8-byte header
+		n := int(binary.LittleEndian.Uint32(head[4:])) - 8
+		data, err := m.readAt(off+8, n)
+		return data, true, err
+	}
+
+	// dBASE III and Clipper
+	var data []byte
+	buf := make([]byte, m.blockSize)
+	for len(data) < dbfMemoLimit {
+		n, err := m.r.ReadAt(buf, off+int64(len(data)))
+		if i := bytes.IndexByte(buf[:n], 0x1A); i >= 0 {
+			return append(data, buf[:i]...), true, nil
+		}
+		data = append(data, buf[:n]...)
+		if err == io.EOF {
+			return data, true, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("memo block %d: %w", block, err)
+		}
+	}
+	return nil, false, fmt.Errorf("memo block %d: no terminator in %d bytes", block, dbfMemoLimit)
+}
+
+func (m *dbfMemo) readAt(off int64, n int) ([]byte, error) {
+	if n < 0 || n > dbfMemoLimit {
+		return nil, fmt.Errorf("memo at %d: invalid length %d", off, n)
+	}
+	data := make([]byte, n)
+	if _, err := m.r.ReadAt(data, off); err != nil && !(err == io.EOF && n == 0) {
+		return nil, fmt.Errorf("memo at %d: %w", off, err)
+	}
+	return data, nil
+}
+
+// ReadDBFIndex returns the key expression of a Clipper .ntx or dBASE III
+// .ndx index file, e.g. "UPPER(LASTNAME)+DTOS(BIRTHDATE)", for DBFKey
+func ReadDBFIndex(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	start := 24 // .ndx
+	if strings.EqualFold(filepath.Ext(path), ".ntx") {
+		start = 22
+	}
+	if len(data) < start+256 {
+		return "", fmt.Errorf("%s: index header too short", path)
+	}
+	expr, _, _ := strings.Cut(string(data[start:start+256]), "\x00")
+	if expr = strings.TrimSpace(expr); expr == "" {
+		return "", fmt.Errorf("%s: no key expression", path)
+	}
+	return expr, nil
+}
+
+// DBFKey translates a dBASE key expression into the segments of a key on
+// schema's fields. The expression joins field names with +, optionally
+// wrapped in UPPER (a case-insensitive segment), DTOS, STR or LEFT(field,
+// n); other functions are an error. Segments are modifiable and allow
+// duplicates unless unique is set. Clipper's UNIQUE indexes only skip
+// duplicates rather than reject them, so they usually import as keys with
+// duplicates.
+func DBFKey(schema *Schema, expr string, unique bool) ([]KeySpec, error) {
+	var flags uint16 = KeyFlagModifiable
+	if !unique {
+		flags |= KeyFlagDuplicates
+	}
+	var segments []KeySpec
+	for _, term := range splitDBFExpr(expr) {
+		seg, err := dbfSegment(schema, strings.ToUpper(strings.TrimSpace(term)), flags)
+		if err != nil {
+			return nil, fmt.Errorf("dbf key %q: %w", expr, err)
+		}
+		segments = append(segments, seg)
+	}
+	for i := range segments[:len(segments)-1] {
+		segments[i].Flags |= KeyFlagSegmented
+	}
+	return segments, nil
+}
+
+// splitDBFExpr splits a key expression at the + signs outside parentheses
+func splitDBFExpr(expr string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range expr {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case '+':
+			if depth == 0 {
+				terms = append(terms, expr[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, expr[start:])
+}
+
+// dbfSegment translates one term of a key expression
+func dbfSegment(schema *Schema, term string, flags uint16) (KeySpec, error) {
+	length := 0
+	if name, args, ok := strings.Cut(term, "("); ok {
+		inner, rest, _ := strings.Cut(strings.TrimSuffix(strings.TrimSpace(args), ")"), ",")
+		switch strings.TrimSpace(name) {
+		case "UPPER":
+			flags |= KeyFlagNoCase
+		case "DTOS", "STR":
+		case "LEFT":
+			n, err := strconv.Atoi(strings.TrimSpace(rest))
+			if err != nil || n <= 0 {
+				return KeySpec{}, fmt.Errorf("invalid LEFT length in %s", term)
+			}
+			length = n
+		default:
+			return KeySpec{}, fmt.Errorf("unsupported function %s", name)
+		}
+		term = strings.TrimSpace(inner)
+	}
+	if _, field, ok := strings.Cut(term, "->"); ok {
+		term = strings.TrimSpace(field) // alias->FIELD
+	}
+	field, ok := schema.Field(strings.ToLower(term))
+	if !ok {
+		return KeySpec{}, fmt.Errorf("unknown field %s", term)
+	}
+	if length == 0 || length > field.Length {
+		length = field.Length
+	}
+	if flags&KeyFlagNoCase != 0 && field.Type != KeyTypeString {
+		return KeySpec{}, fmt.Errorf("UPPER of non-character field %s", term)
+	}
+	return KeySpec{
+		Position: uint16(field.Offset),
+		Length:   uint16(length),
+		Flags:    flags,
+		Type:     field.Type,
+	}, nil
+}
+
+// DBFImport loads the records of a DBF table into a file, creating the
+// file if it does not exist
+//
+//	d, err := xtrieve.OpenDBF("CUSTOMER.DBF")
+//	expr, err := xtrieve.ReadDBFIndex("CUSTNO.NTX")
+//	im := &xtrieve.DBFImport{
+//	    Client:  client,
+//	    Path:    "customer.dat",
+//	    DBF:     d,
+//	    Indexes: []string{expr},
+//	}
+//	n, err := im.Run(ctx)
+type DBFImport struct {
+	Client *Client
+	Path   string
+	DBF    *DBF
+	// Schema defaults to DBF.Schema(). Its fields are matched to the
+	// table's fields by lower-case name.
+	Schema *Schema
+	// Indexes are key expressions, such as those of the table's index
+	// files, translated by DBFKey into keys with duplicates when the file
+	// is created. Keys, if set, are used instead. Without either the file
+	// has a key with duplicates on the first field.
+	Indexes  []string
+	Keys     []KeySpec
+	PageSize uint16
+	// Progress, if set, receives progress reports against the header's
+	// record count
+	Progress Progress
+	// DryRun, if set, makes Run encode every record and count it in the
+	// report, as SQLImport does, instead of writing
+	DryRun *DryRunReport
+}
+
+// Run inserts the table's records that are not deleted and returns the
+// number inserted. Inserts are pipelined as by SQLImport: a failed insert
+// stops the import with a *StatusError after its batch, whose other
+// records may be in the file, and are counted, as well as earlier ones.
+func (im *DBFImport) Run(ctx context.Context) (int, error) {
+	if im.Client == nil && im.DryRun == nil || im.DBF == nil {
+		return 0, errors.New("xtrieve: DBFImport needs a Client and a DBF")
+	}
+	schema := im.Schema
+	if schema == nil {
+		var err error
+		if schema, err = im.DBF.Schema(); err != nil {
+			return 0, err
+		}
+	}
+	keys, err := im.keys(schema)
+	if err != nil {
+		return 0, err
+	}
+
+	var posBlock []byte
+	var segments []KeySpec
+	if im.DryRun != nil {
+		segments = keySegments(schemaFileSpec(schema, keys, im.PageSize).Keys, 0)
+	} else {
+		posBlock, err = openOrCreate(im.Client, im.Path, schema.Document, func() *FileSpec {
+			return schemaFileSpec(schema, keys, im.PageSize)
+		})
+		if err != nil {
+			return 0, err
+		}
+		defer im.Client.CloseFile(posBlock)
+	}
+
+	count := 0
+	progress := newProgressTracker(im.Progress, int64(im.DBF.Count))
+	batch := im.Client.Batch()
+	flush := func() error {
+		n, err := sendInserts(batch, progress)
+		count += n
+		return err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		values, err := im.DBF.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, err
+		}
+		record, err := schema.Encode(values)
+		if err != nil {
+			return count, fmt.Errorf("dbf record %d: %w", im.DBF.read, err)
+		}
+		if im.DryRun != nil {
+			im.DryRun.add(ExtractKey(segments, record), len(record))
+			count++
+			continue
+		}
+		batch.Add(&Request{
+			Operation:     OpInsert,
+			PositionBlock: posBlock,
+			DataBuffer:    record,
+		})
+		if batch.Len() == pipelineDepth {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	progress.done()
+	return count, nil
+}
+
+// keys returns the keys to create the file with
+func (im *DBFImport) keys(schema *Schema) ([]KeySpec, error) {
+	if im.Keys != nil {
+		return im.Keys, nil
+	}
+	var keys []KeySpec
+	for _, expr := range im.Indexes {
+		segments, err := DBFKey(schema, expr, false)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, segments...)
+	}
+	if keys == nil && len(schema.Fields) > 0 {
+		first := schema.Fields[0]
+		keys = []KeySpec{{
+			Position: uint16(first.Offset),
+			Length:   uint16(first.Length),
+			Flags:    KeyFlagDuplicates | KeyFlagModifiable,
+			Type:     first.Type,
+		}}
+	}
+	return keys, nil
+}
@@ -0,0 +1,199 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testDBF builds a table in memory from field descriptors and records,
+// each starting with its deletion flag
+func testDBF(version byte, fields []DBFField, records ...string) []byte {
+	recordLength := 1
+	for _, f := range fields {
+		recordLength += f.Length
+	}
+	var b bytes.Buffer
+	header := make([]byte, 32)
+	header[0] = version
+	header[1], header[2], header[3] = 124, 3, 15 // 2024-03-15
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(records)))
+	binary.LittleEndian.PutUint16(header[8:], uint16(32+32*len(fields)+1))
+	binary.LittleEndian.PutUint16(header[10:], uint16(recordLength))
+	header[29] = 0x03 // cp1252
+	b.Write(header)
+	for _, f := range fields {
+		desc := make([]byte, 32)
+		copy(desc, f.Name)
+		desc[11] = f.Type
+		desc[16], desc[17] = byte(f.Length), byte(f.Decimals)
+		b.Write(desc)
+	}
+	b.WriteByte(0x0D)
+	for _, r := range records {
+		b.WriteString(r)
+	}
+	b.WriteByte(0x1A)
+	return b.Bytes()
+}
+
+var testDBFFields = []DBFField{
+	{Name: "NAME", Type: 'C', Length: 8},
+	{Name: "AMOUNT", Type: 'N', Length: 8, Decimals: 2},
+	{Name: "QTY", Type: 'N', Length: 4},
+	{Name: "BORN", Type: 'D', Length: 8},
+	{Name: "ACTIVE", Type: 'L', Length: 1},
+	{Name: "NOTES", Type: 'M', Length: 10},
+}
+
+func TestDBF(t *testing.T) {
+	// dBASE III memos run from their block to a 0x1A terminator
+	memo := make([]byte, 1024)
+	copy(memo[512:], "caf\xe9 au lait\x1a\x1a")
+
+	data := testDBF(0x83, testDBFFields,
+		" "+"Ren\xe9e   "+"  -12.50"+"  42"+"19690720"+"T"+"         1",
+		"*"+"Deleted "+"    1.00"+"   1"+"20000101"+"F"+"          ",
+		" "+"Bob     "+"        "+"    "+"        "+" "+"          ",
+	)
+	d, err := NewDBF(bytes.NewReader(data), bytes.NewReader(memo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Count != 3 || d.Charset != "cp1252" || !d.Updated.Equal(time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("header = count %d, charset %s, updated %v", d.Count, d.Charset, d.Updated)
+	}
+
+	want := []map[string]any{
+		{
+			"name": "Renée", "amount": NewFixedPoint(-1250, 2), "qty": int64(42),
+			"born":   time.Date(1969, 7, 20, 0, 0, 0, 0, time.UTC),
+			"active": true, "notes": "café au lait",
+		},
+		{"name": "Bob"},
+	}
+	var got []map[string]any
+	for {
+		values, err := d.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, values)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records =\n%v\nwant\n%v", got, want)
+	}
+
+	s, err := d.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantFields := []Field{
+		{Name: "name", Offset: 0, Length: 8, Type: KeyTypeString, Charset: "cp1252"},
+		{Name: "amount", Offset: 8, Length: 4, Type: KeyTypeDecimal, Scale: 2},
+		{Name: "qty", Offset: 12, Length: 2, Type: KeyTypeInteger},
+		{Name: "born", Offset: 14, Length: 4, Type: KeyTypeDate},
+		{Name: "active", Offset: 18, Length: 1, Type: KeyTypeLogical},
+	}
+	if !reflect.DeepEqual(s.Fields, wantFields) || !s.Document {
+		t.Errorf("schema = %+v (document %v), want %+v with memos in the document", s.Fields, s.Document, wantFields)
+	}
+	for _, values := range want {
+		record, err := s.Encode(values)
+		if err != nil {
+			t.Errorf("Encode(%v): %v", values, err)
+			continue
+		}
+		back, err := s.Decode(record)
+		if err != nil {
+			t.Errorf("Decode(%v): %v", values, err)
+			continue
+		}
+		for name, v := range values {
+			if !reflect.DeepEqual(back[name], v) {
+				t.Errorf("%s round trip = %v, want %v", name, back[name], v)
+			}
+		}
+	}
+}
+
+func TestDBFFoxProMemo(t *testing.T) {
+	// FoxPro memo blocks start with a big-endian type and length; the
+	// header gives the block size
+	memo := make([]byte, 128)
+	binary.BigEndian.PutUint16(memo[6:], 64)
+	binary.BigEndian.PutUint32(memo[64:], 1)
+	binary.BigEndian.PutUint32(memo[68:], 5)
+	copy(memo[72:], "notes")
+
+	memoField := []DBFField{{Name: "NOTES", Type: 'M', Length: 4}}
+	data := testDBF(0xF5, memoField, " \x01\x00\x00\x00", " \x09\x00\x00\x00")
+	d, err := NewDBF(bytes.NewReader(data), bytes.NewReader(memo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := d.Next()
+	if err != nil || values["notes"] != "notes" {
+		t.Errorf("Next = %v, %v, want the memo", values, err)
+	}
+	if values, err := d.Next(); err == nil {
+		t.Errorf("Next = %v for a block past the end of the memo file", values)
+	}
+}
+
+func TestDBFInvalid(t *testing.T) {
+	tests := map[string][]byte{
+		"short header":  make([]byte, 10),
+		"not a dbf":     make([]byte, 64),
+		"wrong lengths": append(testDBF(0x03, testDBFFields[:1])[:10], make([]byte, 60)...),
+	}
+	for name, data := range tests {
+		if _, err := NewDBF(bytes.NewReader(data), nil); err == nil {
+			t.Errorf("%s: NewDBF succeeded", name)
+		}
+	}
+
+	data := testDBF(0x03, testDBFFields[5:], "          1")
+	d, err := NewDBF(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Next(); err == nil {
+		t.Error("Next read a memo without a memo file")
+	}
+}
+
+func TestDBFKey(t *testing.T) {
+	d, err := NewDBF(bytes.NewReader(testDBF(0x03, testDBFFields[:5])), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := d.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DBFKey(s, "UPPER(NAME)+DTOS(BORN)+LEFT(C->NAME, 3)", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []KeySpec{
+		{Position: 0, Length: 8, Flags: KeyFlagModifiable | KeyFlagNoCase | KeyFlagSegmented, Type: KeyTypeString},
+		{Position: 14, Length: 4, Flags: KeyFlagModifiable | KeyFlagSegmented, Type: KeyTypeDate},
+		{Position: 0, Length: 3, Flags: KeyFlagModifiable, Type: KeyTypeString},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DBFKey = %+v, want %+v", got, want)
+	}
+
+	for _, expr := range []string{"MISSING", "UPPER(QTY)", "SUBSTR(NAME,1,2)", "LEFT(NAME, 0)"} {
+		if _, err := DBFKey(s, expr, false); err == nil {
+			t.Errorf("DBFKey(%q) succeeded", expr)
+		}
+	}
+}
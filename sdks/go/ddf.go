@@ -0,0 +1,696 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Data dictionary files and their record lengths
+const (
+	ddfFileName  = "FILE.DDF"
+	ddfFieldName = "FIELD.DDF"
+	ddfIndexName = "INDEX.DDF"
+
+	ddfFileLength  = 97
+	ddfFieldLength = 32
+	ddfIndexLength = 10
+)
+
+// DDF data types whose codes are not key types
+const (
+	ddfTypeNote       = 12
+	ddfTypeLvar       = 13
+	ddfTypeBit        = 16
+	ddfTypeNumericSTS = 17
+	ddfTypeNumericSA  = 18
+	// ddfTypeIndexName marks the FIELD.DDF entry naming an index in
+	// version 4 dictionaries; its offset is the index number
+	ddfTypeIndexName = 255
+)
+
+// Xf$Flags, Xe$Flags and Xi$Flags bits
+const (
+	ddfFileDictionary = 0x10
+
+	ddfFieldNoCase = 0x0001
+
+	ddfIndexDuplicates  = 0x0001
+	ddfIndexModifiable  = 0x0002
+	ddfIndexAltSequence = 0x0004
+	ddfIndexNullKey     = 0x0008
+	ddfIndexSegmented   = 0x0010
+	ddfIndexNoCase      = 0x0020
+	ddfIndexDescending  = 0x0040
+	ddfIndexNamed       = 0x0080
+)
+
+// ddfIndexFlags maps Xi$Flags bits to key flags
+var ddfIndexFlags = []struct{ ddf, key uint16 }{
+	{ddfIndexDuplicates, KeyFlagDuplicates},
+	{ddfIndexModifiable, KeyFlagModifiable},
+	{ddfIndexAltSequence, KeyFlagAltSequence},
+	{ddfIndexNullKey, KeyFlagNullKey},
+	{ddfIndexSegmented, KeyFlagSegmented},
+	{ddfIndexNoCase, KeyFlagNoCase},
+	{ddfIndexDescending, KeyFlagDescending},
+}
+
+// Dictionary is a data dictionary: the FILE.DDF, FIELD.DDF and INDEX.DDF
+// files through which ODBC drivers and report writers see Btrieve files as
+// tables. Both version 3 dictionaries and version 4 ones, which add index
+// names and mark the dictionary's own tables, are read; Add writes entries
+// in the dictionary's version.
+//
+//	dict, err := xtrieve.OpenDictionary(client, "data")
+//	t, ok := dict.Table("Customers")
+//	schema, err := t.Schema()
+type Dictionary struct {
+	// Version is 4 if the dictionary uses version 4 features, else 3
+	Version int
+	Tables  []*DictTable
+	client  *Client
+	dir     string
+}
+
+// DictTable is a table of a dictionary: a file and its fields and indexes
+type DictTable struct {
+	ID       uint16
+	Name     string
+	Location string
+	Flags    uint8
+	Fields   []DictField
+	Indexes  []DictIndex
+}
+
+// DictField is a column of a table. DataType is the dictionary's type
+// code, which matches the key type for most types.
+type DictField struct {
+	ID       uint16
+	Name     string
+	DataType uint8
+	Offset   int
+	Size     int
+	Decimals int
+	Flags    uint16
+}
+
+// DictIndex is an index of a table. Name is only stored in version 4
+// dictionaries.
+type DictIndex struct {
+	Number   int
+	Name     string
+	Segments []DictSegment
+}
+
+// DictSegment is a field of an index with its key flags
+type DictSegment struct {
+	Field string
+	Flags uint16
+}
+
+// OpenDictionary reads the dictionary in dir
+func OpenDictionary(client *Client, dir string) (*Dictionary, error) {
+	d := &Dictionary{Version: 3, client: client, dir: dir}
+	byID := make(map[uint16]*DictTable)
+	fieldNames := make(map[uint16]string)
+
+	err := d.scan(ddfFileName, ddfFileLength, func(r []byte) error {
+		t := &DictTable{
+			ID:       binary.LittleEndian.Uint16(r),
+			Name:     ddfString(r[2:22]),
+			Location: ddfString(r[22:86]),
+			Flags:    r[86],
+		}
+		if t.Flags&ddfFileDictionary != 0 {
+			d.Version = 4
+		}
+		byID[t.ID] = t
+		d.Tables = append(d.Tables, t)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	indexNames := make(map[uint16]map[int]string)
+	err = d.scan(ddfFieldName, ddfFieldLength, func(r []byte) error {
+		f := DictField{
+			ID:       binary.LittleEndian.Uint16(r),
+			Name:     ddfString(r[4:24]),
+			DataType: r[24],
+			Offset:   int(binary.LittleEndian.Uint16(r[25:])),
+			Size:     int(binary.LittleEndian.Uint16(r[27:])),
+			Decimals: int(r[29]),
+			Flags:    binary.LittleEndian.Uint16(r[30:]),
+		}
+		file := binary.LittleEndian.Uint16(r[2:])
+		t, ok := byID[file]
+		if !ok {
+			return nil // orphaned entry
+		}
+		if f.DataType == ddfTypeIndexName {
+			d.Version = 4
+			if indexNames[file] == nil {
+				indexNames[file] = make(map[int]string)
+			}
+			indexNames[file][f.Offset] = f.Name
+			return nil
+		}
+		fieldNames[f.ID] = f.Name
+		t.Fields = append(t.Fields, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type part struct {
+		number, part int
+		segment      DictSegment
+	}
+	parts := make(map[uint16][]part)
+	err = d.scan(ddfIndexName, ddfIndexLength, func(r []byte) error {
+		file := binary.LittleEndian.Uint16(r)
+		flags := binary.LittleEndian.Uint16(r[8:])
+		seg := DictSegment{Field: fieldNames[binary.LittleEndian.Uint16(r[2:])]}
+		for _, m := range ddfIndexFlags {
+			if flags&m.ddf != 0 {
+				seg.Flags |= m.key
+			}
+		}
+		parts[file] = append(parts[file], part{
+			number:  int(binary.LittleEndian.Uint16(r[4:])),
+			part:    int(binary.LittleEndian.Uint16(r[6:])),
+			segment: seg,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for file, ps := range parts {
+		t, ok := byID[file]
+		if !ok {
+			continue
+		}
+		sort.Slice(ps, func(i, j int) bool {
+			if ps[i].number != ps[j].number {
+				return ps[i].number < ps[j].number
+			}
+			return ps[i].part < ps[j].part
+		})
+		for _, p := range ps {
+			if n := len(t.Indexes); n == 0 || t.Indexes[n-1].Number != p.number {
+				t.Indexes = append(t.Indexes, DictIndex{Number: p.number, Name: indexNames[file][p.number]})
+			}
+			idx := &t.Indexes[len(t.Indexes)-1]
+			idx.Segments = append(idx.Segments, p.segment)
+		}
+	}
+	return d, nil
+}
+
+// CreateDictionary creates an empty dictionary of the given version (3 or
+// 4) in dir. The dictionary describes its own three files, as the tools
+// that read dictionaries expect.
+func CreateDictionary(client *Client, dir string, version int) (*Dictionary, error) {
+	if version != 3 && version != 4 {
+		return nil, fmt.Errorf("xtrieve: dictionary version %d, want 3 or 4", version)
+	}
+	for _, def := range ddfSystemTables {
+		resp, err := client.Create(path.Join(dir, def.file), &FileSpec{
+			RecordLength: uint16(def.length),
+			PageSize:     1024,
+			Keys:         def.keys,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(OpCreate, resp); err != nil {
+			return nil, fmt.Errorf("%s: %w", def.file, err)
+		}
+	}
+
+	d := &Dictionary{Version: version, client: client, dir: dir}
+	for _, def := range ddfSystemTables {
+		t := &DictTable{Name: def.table, Location: def.file, Fields: append([]DictField(nil), def.fields...)}
+		if version == 4 {
+			t.Flags = ddfFileDictionary
+		}
+		for i, key := range splitKeys(def.keys) {
+			idx := DictIndex{Number: i}
+			for _, seg := range key {
+				idx.Segments = append(idx.Segments, DictSegment{Field: def.fieldAt(int(seg.Position)), Flags: seg.Flags})
+			}
+			t.Indexes = append(t.Indexes, idx)
+		}
+		if err := d.Add(t); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Table returns the table with the given name, ignoring case
+func (d *Dictionary) Table(name string) (*DictTable, bool) {
+	for _, t := range d.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// NewDictTable describes a file with schema's fields and the indexes of
+// keys, such as those the file was created with. Every key segment must
+// cover exactly one schema field. Bit fields must be single LOGICAL bits,
+// and encrypted fields are described as strings of the bytes they hold.
+func NewDictTable(name, location string, schema *Schema, keys []KeySpec) (*DictTable, error) {
+	t := &DictTable{Name: name, Location: location}
+	for _, f := range schema.Fields {
+		df := DictField{Name: f.Name, Offset: f.Offset, Size: f.Length}
+		switch {
+		case f.Bits == 1 && f.Type == KeyTypeLogical:
+			// A BIT column is one bit of a byte, numbered in Xe$Dec
+			df.DataType, df.Offset, df.Size, df.Decimals = ddfTypeBit, f.Offset+f.Bit/8, 1, f.Bit%8
+		case f.Bits != 0:
+			return nil, fmt.Errorf("field %s: only single LOGICAL bits can be described", f.Name)
+		case f.Encrypted:
+			df.DataType = KeyTypeString
+		default:
+			dt, ok := ddfDataType(f.Type)
+			if !ok {
+				return nil, fmt.Errorf("field %s: key type %d has no dictionary type", f.Name, f.Type)
+			}
+			df.DataType, df.Decimals = dt, f.scale()
+		}
+		t.Fields = append(t.Fields, df)
+	}
+
+	for i, key := range splitKeys(keys) {
+		idx := DictIndex{Number: i}
+		for _, seg := range key {
+			field, ok := t.fieldCovering(seg)
+			if !ok {
+				return nil, fmt.Errorf("key %d: segment at %d (%d bytes) does not match a field", i, seg.Position, seg.Length)
+			}
+			if seg.Flags&KeyFlagNoCase != 0 {
+				field.Flags |= ddfFieldNoCase
+			}
+			idx.Segments = append(idx.Segments, DictSegment{Field: field.Name, Flags: seg.Flags})
+		}
+		t.Indexes = append(t.Indexes, idx)
+	}
+	return t, nil
+}
+
+// fieldCovering returns the field a key segment covers
+func (t *DictTable) fieldCovering(seg KeySpec) (*DictField, bool) {
+	for i := range t.Fields {
+		f := &t.Fields[i]
+		if f.DataType != ddfTypeBit && f.Offset == int(seg.Position) && f.Size == int(seg.Length) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// Add writes a table to the dictionary in one transaction, assigning the
+// table and field IDs. Names longer than 20 bytes, locations longer than
+// 64 and existing table names are an error.
+func (d *Dictionary) Add(t *DictTable) error {
+	if len(t.Name) > 20 || len(t.Location) > 64 {
+		return fmt.Errorf("xtrieve: table %s: name or location too long for the dictionary", t.Name)
+	}
+	if _, exists := d.Table(t.Name); exists {
+		return fmt.Errorf("xtrieve: table %s already in the dictionary", t.Name)
+	}
+	for _, f := range t.Fields {
+		if len(f.Name) > 20 {
+			return fmt.Errorf("xtrieve: field %s: name too long for the dictionary", f.Name)
+		}
+	}
+
+	files := make([]*File, 3)
+	for i, name := range []string{ddfFileName, ddfFieldName, ddfIndexName} {
+		f, err := d.client.OpenFile(path.Join(d.dir, name), 0)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		defer f.Close()
+		files[i] = f
+	}
+
+	var tableID, fieldID uint16
+	for _, other := range d.Tables {
+		tableID = max(tableID, other.ID)
+		for _, f := range other.Fields {
+			fieldID = max(fieldID, f.ID)
+		}
+	}
+	t.ID = tableID + 1
+
+	resp, err := files[0].BeginTransaction(LockNone)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpBeginTransaction, resp); err != nil {
+		return err
+	}
+	if err := d.insert(files, t, fieldID); err != nil {
+		files[0].AbortTransaction()
+		return err
+	}
+	resp, err = files[0].EndTransaction()
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpEndTransaction, resp); err != nil {
+		return err
+	}
+	d.Tables = append(d.Tables, t)
+	return nil
+}
+
+// AddFile adds a table named name describing an open file, such as one
+// the application created, with its keys as the indexes. The location is
+// the file's path relative to the dictionary's directory when it is inside
+// it.
+func (d *Dictionary) AddFile(name string, f *File, schema *Schema) (*DictTable, error) {
+	location := f.Path()
+	if rel, ok := strings.CutPrefix(location, strings.TrimSuffix(d.dir, "/")+"/"); ok && d.dir != "" {
+		location = rel
+	}
+	t, err := NewDictTable(name, location, schema, f.keys)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.Add(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// insert writes the FILE.DDF, FIELD.DDF and INDEX.DDF records of a table,
+// numbering its fields after lastField
+func (d *Dictionary) insert(files []*File, t *DictTable, lastField uint16) error {
+	put := func(f *File, record []byte) error {
+		resp, err := f.Insert(record)
+		if err != nil {
+			return err
+		}
+		return checkStatus(OpInsert, resp)
+	}
+
+	r := make([]byte, ddfFileLength)
+	binary.LittleEndian.PutUint16(r, t.ID)
+	putDDFString(r[2:22], t.Name)
+	putDDFString(r[22:86], t.Location)
+	r[86] = t.Flags
+	if err := put(files[0], r); err != nil {
+		return fmt.Errorf("%s: %w", ddfFileName, err)
+	}
+
+	ids := make(map[string]uint16, len(t.Fields))
+	field := func(id uint16, f DictField) []byte {
+		r := make([]byte, ddfFieldLength)
+		binary.LittleEndian.PutUint16(r, id)
+		binary.LittleEndian.PutUint16(r[2:], t.ID)
+		putDDFString(r[4:24], f.Name)
+		r[24] = f.DataType
+		binary.LittleEndian.PutUint16(r[25:], uint16(f.Offset))
+		binary.LittleEndian.PutUint16(r[27:], uint16(f.Size))
+		r[29] = byte(f.Decimals)
+		binary.LittleEndian.PutUint16(r[30:], f.Flags)
+		return r
+	}
+	for i := range t.Fields {
+		lastField++
+		t.Fields[i].ID = lastField
+		ids[t.Fields[i].Name] = lastField
+		if err := put(files[1], field(lastField, t.Fields[i])); err != nil {
+			return fmt.Errorf("%s: field %s: %w", ddfFieldName, t.Fields[i].Name, err)
+		}
+	}
+
+	for _, idx := range t.Indexes {
+		named := d.Version >= 4 && idx.Name != ""
+		if named {
+			if len(idx.Name) > 20 {
+				return fmt.Errorf("xtrieve: index %s: name too long for the dictionary", idx.Name)
+			}
+			lastField++
+			entry := DictField{Name: idx.Name, DataType: ddfTypeIndexName, Offset: idx.Number}
+			if err := put(files[1], field(lastField, entry)); err != nil {
+				return fmt.Errorf("%s: index %s: %w", ddfFieldName, idx.Name, err)
+			}
+		}
+		for part, seg := range idx.Segments {
+			id, ok := ids[seg.Field]
+			if !ok {
+				return fmt.Errorf("xtrieve: index %d: unknown field %s", idx.Number, seg.Field)
+			}
+			var flags uint16
+			for _, m := range ddfIndexFlags {
+				if seg.Flags&m.key != 0 {
+					flags |= m.ddf
+				}
+			}
+			if named {
+				flags |= ddfIndexNamed
+			}
+			r := make([]byte, ddfIndexLength)
+			binary.LittleEndian.PutUint16(r, t.ID)
+			binary.LittleEndian.PutUint16(r[2:], id)
+			binary.LittleEndian.PutUint16(r[4:], uint16(idx.Number))
+			binary.LittleEndian.PutUint16(r[6:], uint16(part))
+			binary.LittleEndian.PutUint16(r[8:], flags)
+			if err := put(files[2], r); err != nil {
+				return fmt.Errorf("%s: index %d: %w", ddfIndexName, idx.Number, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Schema returns the layout of the table's records. BIT columns become
+// single-bit LOGICAL fields; NOTE and LVAR columns, which hold the
+// variable-length tail of a record, are left out.
+func (t *DictTable) Schema() (*Schema, error) {
+	fields := make([]Field, 0, len(t.Fields))
+	for _, df := range t.Fields {
+		f := Field{Name: df.Name, Offset: df.Offset, Length: df.Size}
+		switch df.DataType {
+		case ddfTypeNote, ddfTypeLvar:
+			continue
+		case ddfTypeBit:
+			f.Type, f.Bit, f.Bits = KeyTypeLogical, df.Decimals, 1
+		default:
+			kt, ok := keyTypeOfDDF(df.DataType)
+			if !ok {
+				return nil, fmt.Errorf("field %s: unsupported dictionary type %d", df.Name, df.DataType)
+			}
+			f.Type = kt
+			switch kt {
+			case KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS, KeyTypeDecimal, KeyTypeMoney:
+				f.Scale = df.Decimals
+			}
+		}
+		fields = append(fields, f)
+	}
+	return NewSchema(fields...)
+}
+
+// KeySpecs returns the table's indexes as the key segments of a FileSpec,
+// e.g. to create the file a dictionary describes
+func (t *DictTable) KeySpecs() ([]KeySpec, error) {
+	var keys []KeySpec
+	for _, idx := range t.Indexes {
+		for i, seg := range idx.Segments {
+			var field *DictField
+			for j := range t.Fields {
+				if t.Fields[j].Name == seg.Field {
+					field = &t.Fields[j]
+				}
+			}
+			if field == nil {
+				return nil, fmt.Errorf("index %d: unknown field %q", idx.Number, seg.Field)
+			}
+			kt, ok := keyTypeOfDDF(field.DataType)
+			if !ok {
+				return nil, fmt.Errorf("index %d: field %s cannot be a key", idx.Number, field.Name)
+			}
+			flags := seg.Flags &^ KeyFlagSegmented
+			if i < len(idx.Segments)-1 {
+				flags |= KeyFlagSegmented
+			}
+			keys = append(keys, KeySpec{
+				Position: uint16(field.Offset),
+				Length:   uint16(field.Size),
+				Flags:    flags | KeyFlagExtendedType,
+				Type:     kt,
+			})
+		}
+	}
+	return keys, nil
+}
+
+// scan calls fn with each record of a dictionary file
+func (d *Dictionary) scan(name string, length int, fn func([]byte) error) error {
+	f, err := d.client.OpenFile(path.Join(d.dir, name), 0)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer f.Close()
+	it := f.Scan(0)
+	defer it.Close()
+	for it.Next() {
+		r := it.Record()
+		if len(r) < length {
+			return fmt.Errorf("%s: %d-byte record, want %d", name, len(r), length)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// ddfDataType returns the dictionary type of a key type
+func ddfDataType(keyType uint8) (uint8, bool) {
+	switch keyType {
+	case KeyTypeNumericSTS:
+		return ddfTypeNumericSTS, true
+	case KeyTypeNumericSA:
+		return ddfTypeNumericSA, true
+	case KeyTypeString, KeyTypeInteger, KeyTypeFloat, KeyTypeDate, KeyTypeTime,
+		KeyTypeDecimal, KeyTypeMoney, KeyTypeLogical, KeyTypeNumeric, KeyTypeBfloat,
+		KeyTypeLstring, KeyTypeZstring, KeyTypeUnsignedBinary, KeyTypeAutoincrement,
+		KeyTypeWString, KeyTypeWZstring:
+		return keyType, true
+	}
+	return 0, false
+}
+
+// keyTypeOfDDF returns the key type of a dictionary type
+func keyTypeOfDDF(dataType uint8) (uint8, bool) {
+	switch dataType {
+	case ddfTypeNumericSTS:
+		return KeyTypeNumericSTS, true
+	case KeyTypeNumericSTS:
+		return 0, false // CURRENCY in a dictionary
+	}
+	if _, ok := ddfDataType(dataType); ok {
+		return dataType, true
+	}
+	return 0, false
+}
+
+// splitKeys groups key segments into keys
+func splitKeys(segments []KeySpec) [][]KeySpec {
+	var keys [][]KeySpec
+	start := 0
+	for i, seg := range segments {
+		if seg.Flags&KeyFlagSegmented == 0 {
+			keys = append(keys, segments[start:i+1])
+			start = i + 1
+		}
+	}
+	return keys
+}
+
+// ddfString reads a space- or NUL-padded name
+func ddfString(b []byte) string {
+	s, _, _ := strings.Cut(string(b), "\x00")
+	return strings.TrimRight(s, " ")
+}
+
+// putDDFString writes a space-padded name
+func putDDFString(b []byte, s string) {
+	n := copy(b, s)
+	for i := n; i < len(b); i++ {
+		b[i] = ' '
+	}
+}
+
+// ddfSystemTable describes one of the dictionary's own files
+type ddfSystemTable struct {
+	table, file string
+	length      int
+	fields      []DictField
+	keys        []KeySpec
+}
+
+func (t ddfSystemTable) fieldAt(offset int) string {
+	for _, f := range t.fields {
+		if f.Offset == offset {
+			return f.Name
+		}
+	}
+	return ""
+}
+
+// ddfSystemTables are the layouts of FILE.DDF, FIELD.DDF and INDEX.DDF
+var ddfSystemTables = []ddfSystemTable{
+	{
+		table: "X$File", file: ddfFileName, length: ddfFileLength,
+		fields: []DictField{
+			{Name: "Xf$Id", DataType: KeyTypeInteger, Offset: 0, Size: 2},
+			{Name: "Xf$Name", DataType: KeyTypeString, Offset: 2, Size: 20, Flags: ddfFieldNoCase},
+			{Name: "Xf$Loc", DataType: KeyTypeString, Offset: 22, Size: 64},
+			{Name: "Xf$Flags", DataType: KeyTypeInteger, Offset: 86, Size: 1},
+			{Name: "Xf$Reserved", DataType: KeyTypeString, Offset: 87, Size: 10},
+		},
+		keys: []KeySpec{
+			{Position: 0, Length: 2, Flags: KeyFlagExtendedType, Type: KeyTypeInteger},
+			{Position: 2, Length: 20, Flags: KeyFlagExtendedType | KeyFlagNoCase, Type: KeyTypeString},
+		},
+	},
+	{
+		table: "X$Field", file: ddfFieldName, length: ddfFieldLength,
+		fields: []DictField{
+			{Name: "Xe$Id", DataType: KeyTypeInteger, Offset: 0, Size: 2},
+			{Name: "Xe$File", DataType: KeyTypeInteger, Offset: 2, Size: 2},
+			{Name: "Xe$Name", DataType: KeyTypeString, Offset: 4, Size: 20, Flags: ddfFieldNoCase},
+			{Name: "Xe$DataType", DataType: KeyTypeInteger, Offset: 24, Size: 1},
+			{Name: "Xe$Offset", DataType: KeyTypeInteger, Offset: 25, Size: 2},
+			{Name: "Xe$Size", DataType: KeyTypeInteger, Offset: 27, Size: 2},
+			{Name: "Xe$Dec", DataType: KeyTypeInteger, Offset: 29, Size: 1},
+			{Name: "Xe$Flags", DataType: KeyTypeInteger, Offset: 30, Size: 2},
+		},
+		keys: []KeySpec{
+			{Position: 0, Length: 2, Flags: KeyFlagExtendedType, Type: KeyTypeInteger},
+			{Position: 2, Length: 2, Flags: KeyFlagExtendedType | KeyFlagDuplicates, Type: KeyTypeInteger},
+			{Position: 4, Length: 20, Flags: KeyFlagExtendedType | KeyFlagDuplicates | KeyFlagNoCase, Type: KeyTypeString},
+			{Position: 2, Length: 2, Flags: KeyFlagExtendedType | KeyFlagSegmented, Type: KeyTypeInteger},
+			{Position: 4, Length: 20, Flags: KeyFlagExtendedType | KeyFlagNoCase, Type: KeyTypeString},
+			{Position: 2, Length: 2, Flags: KeyFlagExtendedType | KeyFlagDuplicates | KeyFlagSegmented, Type: KeyTypeInteger},
+			{Position: 25, Length: 2, Flags: KeyFlagExtendedType | KeyFlagDuplicates | KeyFlagSegmented, Type: KeyTypeInteger},
+			{Position: 29, Length: 1, Flags: KeyFlagExtendedType | KeyFlagDuplicates, Type: KeyTypeInteger},
+		},
+	},
+	{
+		table: "X$Index", file: ddfIndexName, length: ddfIndexLength,
+		fields: []DictField{
+			{Name: "Xi$File", DataType: KeyTypeInteger, Offset: 0, Size: 2},
+			{Name: "Xi$Field", DataType: KeyTypeInteger, Offset: 2, Size: 2},
+			{Name: "Xi$Number", DataType: KeyTypeInteger, Offset: 4, Size: 2},
+			{Name: "Xi$Part", DataType: KeyTypeInteger, Offset: 6, Size: 2},
+			{Name: "Xi$Flags", DataType: KeyTypeInteger, Offset: 8, Size: 2},
+		},
+		keys: []KeySpec{
+			{Position: 0, Length: 2, Flags: KeyFlagExtendedType | KeyFlagDuplicates, Type: KeyTypeInteger},
+			{Position: 2, Length: 2, Flags: KeyFlagExtendedType | KeyFlagDuplicates, Type: KeyTypeInteger},
+			{Position: 0, Length: 2, Flags: KeyFlagExtendedType | KeyFlagSegmented, Type: KeyTypeInteger},
+			{Position: 4, Length: 2, Flags: KeyFlagExtendedType | KeyFlagSegmented, Type: KeyTypeInteger},
+			{Position: 6, Length: 2, Flags: KeyFlagExtendedType, Type: KeyTypeInteger},
+		},
+	},
+}
@@ -0,0 +1,144 @@
+package xtrieve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDictTableRoundTrip(t *testing.T) {
+	schema, err := NewSchema(
+		Field{Name: "id", Offset: 0, Length: 4, Type: KeyTypeAutoincrement},
+		Field{Name: "name", Offset: 4, Length: 20, Type: KeyTypeString},
+		Field{Name: "balance", Offset: 24, Length: 6, Type: KeyTypeDecimal, Scale: 2},
+		Field{Name: "total", Offset: 30, Length: 8, Type: KeyTypeMoney, Scale: 2},
+		Field{Name: "code", Offset: 38, Length: 5, Type: KeyTypeNumericSTS, Scale: 1},
+		Field{Name: "zoned", Offset: 43, Length: 4, Type: KeyTypeNumericSA},
+		Field{Name: "active", Offset: 47, Length: 1, Type: KeyTypeLogical, Bit: 0, Bits: 1},
+		Field{Name: "vip", Offset: 47, Length: 1, Type: KeyTypeLogical, Bit: 3, Bits: 1},
+		Field{Name: "born", Offset: 48, Length: 4, Type: KeyTypeDate},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := []KeySpec{
+		{Position: 0, Length: 4, Flags: KeyFlagExtendedType, Type: KeyTypeAutoincrement},
+		{Position: 4, Length: 20, Flags: KeyFlagExtendedType | KeyFlagSegmented | KeyFlagNoCase | KeyFlagDuplicates, Type: KeyTypeString},
+		{Position: 48, Length: 4, Flags: KeyFlagExtendedType | KeyFlagDescending | KeyFlagDuplicates, Type: KeyTypeDate},
+	}
+	dt, err := NewDictTable("Customers", "cust.dat", schema, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name := dt.Fields[1]; name.Flags&ddfFieldNoCase == 0 {
+		t.Errorf("name flags = %#x, want the case-insensitive flag", name.Flags)
+	}
+	if vip := dt.Fields[7]; vip.DataType != ddfTypeBit || vip.Offset != 47 || vip.Size != 1 || vip.Decimals != 3 {
+		t.Errorf("vip = %+v, want bit 3 of byte 47", vip)
+	}
+	wantIndexes := []DictIndex{
+		{Number: 0, Segments: []DictSegment{{Field: "id", Flags: KeyFlagExtendedType}}},
+		{Number: 1, Segments: []DictSegment{
+			{Field: "name", Flags: KeyFlagExtendedType | KeyFlagSegmented | KeyFlagNoCase | KeyFlagDuplicates},
+			{Field: "born", Flags: KeyFlagExtendedType | KeyFlagDescending | KeyFlagDuplicates},
+		}},
+	}
+	if !reflect.DeepEqual(dt.Indexes, wantIndexes) {
+		t.Errorf("indexes = %+v, want %+v", dt.Indexes, wantIndexes)
+	}
+
+	back, err := dt.Schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back.Fields, schema.Fields) {
+		t.Errorf("schema =\n%+v\nwant\n%+v", back.Fields, schema.Fields)
+	}
+	gotKeys, err := dt.KeySpecs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(gotKeys, keys) {
+		t.Errorf("keys =\n%+v\nwant\n%+v", gotKeys, keys)
+	}
+}
+
+func TestNewDictTableErrors(t *testing.T) {
+	tests := map[string]struct {
+		field Field
+		keys  []KeySpec
+	}{
+		"multi-bit field": {Field{Name: "f", Length: 1, Type: KeyTypeUnsignedBinary, Bits: 3}, nil},
+		"no ddf type":     {Field{Name: "f", Length: 8, Type: 20}, nil}, // TIMESTAMP
+		"partial segment": {Field{Name: "f", Length: 8, Type: KeyTypeString},
+			[]KeySpec{{Position: 0, Length: 4, Type: KeyTypeString}}},
+	}
+	for name, tt := range tests {
+		schema, err := NewSchema(tt.field)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := NewDictTable("t", "t.dat", schema, tt.keys); err == nil {
+			t.Errorf("%s: NewDictTable succeeded", name)
+		}
+	}
+}
+
+func TestDDFDataTypes(t *testing.T) {
+	for kt := 0; kt < 256; kt++ {
+		dt, ok := ddfDataType(uint8(kt))
+		if !ok {
+			continue
+		}
+		if back, ok := keyTypeOfDDF(dt); !ok || back != uint8(kt) {
+			t.Errorf("key type %d: dictionary type %d maps back to %d, %v", kt, dt, back, ok)
+		}
+	}
+	// NUMERICSTS is type 17 in a dictionary, where 19 is CURRENCY
+	if dt, _ := ddfDataType(KeyTypeNumericSTS); dt != ddfTypeNumericSTS {
+		t.Errorf("NUMERICSTS dictionary type = %d, want %d", dt, ddfTypeNumericSTS)
+	}
+	for _, dt := range []uint8{ddfTypeNote, ddfTypeLvar, ddfTypeBit, ddfTypeIndexName} {
+		if kt, ok := keyTypeOfDDF(dt); ok {
+			t.Errorf("dictionary type %d maps to key type %d", dt, kt)
+		}
+	}
+}
+
+func TestDDFString(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"Customers", "Customers"},
+		{"", ""},
+		{"exactly-twenty-bytes", "exactly-twenty-bytes"},
+	}
+	for _, tt := range tests {
+		b := make([]byte, 20)
+		putDDFString(b, tt.in)
+		if got := ddfString(b); got != tt.out {
+			t.Errorf("ddfString(putDDFString(%q)) = %q", tt.in, got)
+		}
+	}
+	if got := ddfString([]byte("NAME\x00\x00garbage")); got != "NAME" {
+		t.Errorf("ddfString of a NUL-padded name = %q, want NAME", got)
+	}
+}
+
+func TestDDFSystemTables(t *testing.T) {
+	// The dictionary's own files must describe themselves consistently
+	for _, def := range ddfSystemTables {
+		end := 0
+		for _, f := range def.fields {
+			end = max(end, f.Offset+f.Size)
+		}
+		if end != def.length {
+			t.Errorf("%s: fields end at %d, records are %d bytes", def.file, end, def.length)
+		}
+		for _, key := range splitKeys(def.keys) {
+			for _, seg := range key {
+				if def.fieldAt(int(seg.Position)) == "" {
+					t.Errorf("%s: key segment at %d has no field", def.file, seg.Position)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package xtrieve
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// recentErrorCount is the number of failed operations a client remembers
+const recentErrorCount = 32
+
+// debugPathLength bounds the path kept for the operation in flight
+const debugPathLength = 128
+
+// RecentError is a failed operation remembered for DebugHandler
+type RecentError struct {
+	Time      time.Time `json:"time"`
+	Operation string    `json:"operation"`
+	File      string    `json:"file,omitempty"`
+	Status    uint16    `json:"status,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// ActiveOperation is the operation a client is waiting on the server for
+type ActiveOperation struct {
+	Operation string        `json:"operation"`
+	File      string        `json:"file,omitempty"`
+	Started   time.Time     `json:"started"`
+	Elapsed   time.Duration `json:"elapsed"`
+}
+
+// ClientDebug is a snapshot of a client's live state, see Client.Debug
+type ClientDebug struct {
+	Address  string    `json:"address"`
+	LastUsed time.Time `json:"last_used"`
+	// InFlight counts the operations running or waiting for the
+	// connection, and Active is the one on the wire
+	InFlight int              `json:"in_flight"`
+	Active   *ActiveOperation `json:"active,omitempty"`
+	// OpenFiles counts the handles open on each path
+	OpenFiles map[string]int `json:"open_files"`
+	// Scans is the number of iterators in progress
+	Scans        int           `json:"scans"`
+	RecentErrors []RecentError `json:"recent_errors"`
+	Stats        *ClientStats  `json:"stats"`
+}
+
+// PoolDebug is a snapshot of a pool's live state, see Pool.Debug
+type PoolDebug struct {
+	Servers []ServerDebug `json:"servers"`
+}
+
+// ServerDebug is the state of one server of a pool. Role is empty for a
+// server no longer in the topology whose connections are still open.
+type ServerDebug struct {
+	Address string   `json:"address"`
+	Role    Role     `json:"role,omitempty"`
+	Files   []string `json:"files,omitempty"`
+	// Latency is the moving average measured for SelectLatency
+	Latency     time.Duration `json:"latency"`
+	IdleTxConns int           `json:"idle_tx_conns"`
+	Clients     []ClientDebug `json:"clients"`
+}
+
+// debugState is what Client.Debug reports besides the statistics. It has
+// its own lock so a snapshot never waits for an operation in flight.
+type debugState struct {
+	inFlight atomic.Int32
+
+	mu      sync.Mutex
+	active  bool
+	op      uint16
+	started time.Time
+	file    [debugPathLength]byte
+	fileLen int
+	open    map[string]int
+	errors  [recentErrorCount]RecentError
+	nerrors int
+}
+
+// begin marks req as the operation on the wire. The path is copied, so
+// tracking does not allocate.
+func (d *debugState) begin(req *Request) {
+	path := requestFileBytes(req.PositionBlock)
+	d.mu.Lock()
+	d.active, d.op, d.started = true, req.Operation, time.Now()
+	if req.FilePath != "" {
+		d.fileLen = copy(d.file[:], req.FilePath)
+	} else {
+		d.fileLen = copy(d.file[:], path)
+	}
+	d.mu.Unlock()
+}
+
+// end clears the operation marked by begin
+func (d *debugState) end() {
+	d.mu.Lock()
+	d.active = false
+	d.mu.Unlock()
+	d.inFlight.Add(-1)
+}
+
+// record follows the open files and remembers failures. Reads past the
+// end of a file or missing keys are part of normal work and not kept.
+func (d *debugState) record(req *Request, resp *Response, err error) {
+	if err == nil {
+		switch resp.StatusCode {
+		case StatusSuccess:
+			if req.Operation == OpOpen || req.Operation == OpClose {
+				d.track(req)
+			}
+			return
+		case StatusEndOfFile, StatusKeyNotFound:
+			return
+		}
+	}
+	d.remember(req, resp, err)
+}
+
+// track counts a file opened or closed
+func (d *debugState) track(req *Request) {
+	path := requestFile(req)
+	if path == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.open == nil {
+		d.open = make(map[string]int)
+	}
+	if req.Operation == OpOpen {
+		d.open[path]++
+	} else if d.open[path] <= 1 {
+		delete(d.open, path)
+	} else {
+		d.open[path]--
+	}
+}
+
+// remember adds a failed operation to the ring of recent errors
+func (d *debugState) remember(req *Request, resp *Response, err error) {
+	e := RecentError{Time: time.Now(), Operation: OpName(req.Operation), File: requestFile(req)}
+	if err != nil {
+		e.Error = err.Error()
+		var se *StatusError
+		if errors.As(err, &se) {
+			e.Status = se.Status
+		}
+	} else {
+		e.Status = resp.StatusCode
+	}
+	d.mu.Lock()
+	d.errors[d.nerrors%recentErrorCount] = e
+	d.nerrors++
+	d.mu.Unlock()
+}
+
+// Debug returns a snapshot of what the client is doing: the operation in
+// flight, its open files, iterators and most recent failures, and its
+// statistics. It never waits for the operation in flight, so it can be
+// taken while the client hangs.
+func (c *Client) Debug() ClientDebug {
+	snap := ClientDebug{
+		Address:   c.addr,
+		InFlight:  int(c.debug.inFlight.Load()),
+		Scans:     int(c.scans.Load()),
+		OpenFiles: make(map[string]int),
+		Stats:     c.Stats(),
+	}
+	if used := c.lastUsed.Load(); used != 0 {
+		snap.LastUsed = time.Unix(0, used)
+	}
+
+	d := &c.debug
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.active {
+		snap.Active = &ActiveOperation{
+			Operation: OpName(d.op),
+			File:      string(d.file[:d.fileLen]),
+			Started:   d.started,
+			Elapsed:   time.Since(d.started),
+		}
+	}
+	for path, n := range d.open {
+		snap.OpenFiles[path] = n
+	}
+	// Newest first
+	n := min(d.nerrors, recentErrorCount)
+	snap.RecentErrors = make([]RecentError, 0, n)
+	for i := 1; i <= n; i++ {
+		snap.RecentErrors = append(snap.RecentErrors, d.errors[(d.nerrors-i)%recentErrorCount])
+	}
+	return snap
+}
+
+// Debug returns a snapshot of the pool's servers and their connections,
+// those of WithTransaction included
+func (p *Pool) Debug() PoolDebug {
+	p.mu.RLock()
+	roles := map[*poolServer]Role{p.primary: RolePrimary}
+	for _, s := range p.replicas {
+		roles[s] = RoleReplica
+	}
+	servers := make([]*poolServer, 0, len(p.servers))
+	for _, s := range p.servers {
+		servers = append(servers, s)
+	}
+	p.mu.RUnlock()
+
+	var snap PoolDebug
+	for _, s := range servers {
+		s.mu.Lock()
+		clients := append(append([]*Client(nil), s.clients...), s.txIdle...)
+		server := ServerDebug{
+			Address:     s.addr,
+			Role:        roles[s],
+			Files:       s.files,
+			IdleTxConns: len(s.txIdle),
+		}
+		s.mu.Unlock()
+		server.Latency = time.Duration(s.latency.score())
+		for _, c := range clients {
+			server.Clients = append(server.Clients, c.Debug())
+		}
+		snap.Servers = append(snap.Servers, server)
+	}
+	return snap
+}
+
+// DebugHandler returns a handler serving the live state of a pool and of
+// clients as JSON, for production triage. pool may be nil. The handler
+// exposes file paths and error messages, so mount it where only operators
+// can reach it:
+//
+//	mux.Handle("/debug/xtrieve", xtrieve.DebugHandler(pool))
+func DebugHandler(pool *Pool, clients ...*Client) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var state struct {
+			Pool    *PoolDebug    `json:"pool,omitempty"`
+			Clients []ClientDebug `json:"clients,omitempty"`
+		}
+		if pool != nil {
+			snap := pool.Debug()
+			state.Pool = &snap
+		}
+		for _, c := range clients {
+			state.Clients = append(state.Clients, c.Debug())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(state)
+	})
+}
@@ -0,0 +1,219 @@
+package xtrieve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+)
+
+// unpackDecimal reads a packed BCD number as stored in DECIMAL and MONEY
+// fields: two digits per byte, the low nibble of the last byte holding the
+// sign (0xD or 0xB negative, anything else positive)
+func unpackDecimal(b []byte) (*big.Int, error) {
+	n := new(big.Int)
+	ten := big.NewInt(10)
+	for i, c := range b {
+		digits := []byte{c >> 4, c & 0x0F}
+		if i == len(b)-1 {
+			digits = digits[:1]
+		}
+		for _, d := range digits {
+			if d > 9 {
+				return nil, fmt.Errorf("invalid packed decimal digit %#x", d)
+			}
+			n.Mul(n, ten).Add(n, big.NewInt(int64(d)))
+		}
+	}
+	if len(b) > 0 {
+		if sign := b[len(b)-1] & 0x0F; sign == 0x0D || sign == 0x0B {
+			n.Neg(n)
+		}
+	}
+	return n, nil
+}
+
+// packDecimal stores n as packed BCD in b, with 0xC or 0xD as sign
+func packDecimal(b []byte, n *big.Int) error {
+	digits := new(big.Int).Abs(n).String()
+	if len(digits) > 2*len(b)-1 {
+		return fmt.Errorf("%s does not fit in %d packed decimal digits", n, 2*len(b)-1)
+	}
+	nibbles := make([]byte, 2*len(b))
+	start := len(nibbles) - 1 - len(digits)
+	for i := range digits {
+		nibbles[start+i] = digits[i] - '0'
+	}
+	nibbles[len(nibbles)-1] = 0x0C
+	if n.Sign() < 0 {
+		nibbles[len(nibbles)-1] = 0x0D
+	}
+	for i := range b {
+		b[i] = nibbles[2*i]<<4 | nibbles[2*i+1]
+	}
+	return nil
+}
+
+// unpackZoned reads a zoned decimal as stored in NUMERIC fields: one ASCII
+// digit per byte, the last one overpunched with the sign ('{' and 'A'-'I'
+// for +0 to +9, '}' and 'J'-'R' for -0 to -9). Plain last digits are
+// positive, and leading spaces are ignored.
+func unpackZoned(b []byte) (int64, error) {
+	var n int64
+	negative := false
+	for i, c := range b {
+		if c == ' ' && n == 0 {
+			continue
+		}
+		digit := c
+		if i == len(b)-1 {
+			switch {
+			case c == '{':
+				digit = '0'
+			case c == '}':
+				digit, negative = '0', true
+			case c >= 'A' && c <= 'I':
+				digit = c - 'A' + '1'
+			case c >= 'J' && c <= 'R':
+				digit, negative = c-'J'+'1', true
+			}
+		}
+		if digit < '0' || digit > '9' {
+			return 0, fmt.Errorf("invalid zoned decimal digit %q", c)
+		}
+		if n > (math.MaxInt64-int64(digit-'0'))/10 {
+			return 0, errors.New("zoned decimal out of range")
+		}
+		n = n*10 + int64(digit-'0')
+	}
+	if negative {
+		n = -n
+	}
+	return n, nil
+}
+
+// packZoned stores n as a zoned decimal in b, right-aligned with leading
+// zeros and the sign overpunched on the last digit
+func packZoned(b []byte, n int64) error {
+	if len(b) == 0 {
+		return errors.New("empty zoned decimal field")
+	}
+	digits := strconv.FormatUint(uint64(max(n, -n)), 10)
+	if n == math.MinInt64 {
+		digits = "9223372036854775808"
+	}
+	if len(digits) > len(b) {
+		return fmt.Errorf("%d does not fit in %d zoned decimal digits", n, len(b))
+	}
+	pad := len(b) - len(digits)
+	for i := 0; i < pad; i++ {
+		b[i] = '0'
+	}
+	copy(b[pad:], digits)
+	last := b[len(b)-1] - '0'
+	switch {
+	case n < 0 && last == 0:
+		b[len(b)-1] = '}'
+	case n < 0:
+		b[len(b)-1] = 'J' + last - 1
+	case last == 0:
+		b[len(b)-1] = '{'
+	default:
+		b[len(b)-1] = 'A' + last - 1
+	}
+	return nil
+}
+
+// unpackSTS reads a NUMERICSTS value: ASCII digits followed by a separate
+// '+' or '-' sign byte
+func unpackSTS(b []byte) (int64, error) {
+	if len(b) < 2 {
+		return 0, errors.New("NUMERICSTS field shorter than 2 bytes")
+	}
+	sign := b[len(b)-1]
+	if sign != '+' && sign != '-' && sign != ' ' {
+		return 0, fmt.Errorf("invalid NUMERICSTS sign %q", sign)
+	}
+	digits := b[:len(b)-1]
+	for _, c := range digits {
+		if c != ' ' && (c < '0' || c > '9') {
+			return 0, fmt.Errorf("invalid NUMERICSTS digit %q", c)
+		}
+	}
+	n, err := unpackZoned(digits)
+	if sign == '-' {
+		n = -n
+	}
+	return n, err
+}
+
+// packSTS stores n in b as NUMERICSTS, right-aligned with leading zeros
+func packSTS(b []byte, n int64) error {
+	if len(b) < 2 {
+		return errors.New("NUMERICSTS field shorter than 2 bytes")
+	}
+	if err := putDigits(b[:len(b)-1], n); err != nil {
+		return err
+	}
+	b[len(b)-1] = '+'
+	if n < 0 {
+		b[len(b)-1] = '-'
+	}
+	return nil
+}
+
+// unpackSA reads a NUMERICSA value, the ASCII signed zoned decimal of
+// Micro Focus COBOL: digits whose last one is 'p' to 'y' (0x70 | digit)
+// when the number is negative
+func unpackSA(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	digits := bytes.Clone(b)
+	last := digits[len(digits)-1]
+	negative := last >= 'p' && last <= 'y'
+	if negative {
+		digits[len(digits)-1] = last &^ 0x40
+	} else if last < '0' || last > '9' {
+		return 0, fmt.Errorf("invalid NUMERICSA digit %q", last)
+	}
+	n, err := unpackZoned(digits)
+	if negative {
+		n = -n
+	}
+	return n, err
+}
+
+// packSA stores n in b as NUMERICSA
+func packSA(b []byte, n int64) error {
+	if len(b) == 0 {
+		return errors.New("empty NUMERICSA field")
+	}
+	if err := putDigits(b, n); err != nil {
+		return err
+	}
+	if n < 0 {
+		b[len(b)-1] |= 0x40
+	}
+	return nil
+}
+
+// putDigits stores the digits of n's magnitude in b, right-aligned with
+// leading zeros
+func putDigits(b []byte, n int64) error {
+	digits := strconv.FormatUint(uint64(max(n, -n)), 10)
+	if n == math.MinInt64 {
+		digits = "9223372036854775808"
+	}
+	if len(digits) > len(b) {
+		return fmt.Errorf("%d does not fit in %d digits", n, len(b))
+	}
+	pad := len(b) - len(digits)
+	for i := 0; i < pad; i++ {
+		b[i] = '0'
+	}
+	copy(b[pad:], digits)
+	return nil
+}
@@ -0,0 +1,107 @@
+package xtrieve
+
+import (
+	"encoding/hex"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestPackedDecimal(t *testing.T) {
+	tests := []struct {
+		n      string
+		length int
+		packed string
+	}{
+		{"0", 1, "0c"},
+		{"7", 1, "7c"},
+		{"-7", 1, "7d"},
+		{"12345", 3, "12345c"},
+		{"-12345", 3, "12345d"},
+		{"42", 4, "0000042c"},
+		{"9999999", 4, "9999999c"},
+		{"-9223372036854775808", 10, "9223372036854775808d"},
+		{"123456789012345678901234567890", 16, "0123456789012345678901234567890c"},
+	}
+	for _, tt := range tests {
+		n, _ := new(big.Int).SetString(tt.n, 10)
+		b := make([]byte, tt.length)
+		if err := packDecimal(b, n); err != nil {
+			t.Errorf("packDecimal(%s): %v", tt.n, err)
+			continue
+		}
+		if got := hex.EncodeToString(b); got != tt.packed {
+			t.Errorf("packDecimal(%s) = %s, want %s", tt.n, got, tt.packed)
+		}
+		back, err := unpackDecimal(b)
+		if err != nil || back.Cmp(n) != 0 {
+			t.Errorf("unpackDecimal(%s) = %v, %v, want %s", tt.packed, back, err, tt.n)
+		}
+	}
+}
+
+func TestPackedDecimalSigns(t *testing.T) {
+	// Any sign nibble but 0xB and 0xD is positive, including unsigned 0xF
+	tests := map[string]int64{"123f": 123, "123a": 123, "123e": 123, "123b": -123, "123d": -123}
+	for packed, want := range tests {
+		b, _ := hex.DecodeString(packed)
+		got, err := unpackDecimal(b)
+		if err != nil || got.Int64() != want {
+			t.Errorf("unpackDecimal(%s) = %v, %v, want %d", packed, got, err, want)
+		}
+	}
+}
+
+func TestPackedDecimalInvalid(t *testing.T) {
+	if err := packDecimal(make([]byte, 2), big.NewInt(1000)); err == nil {
+		t.Error("packDecimal stored 1000 in 3 digits")
+	}
+	for _, packed := range []string{"1a3c", "a0"} {
+		b, _ := hex.DecodeString(packed)
+		if n, err := unpackDecimal(b); err == nil {
+			t.Errorf("unpackDecimal(%s) = %v, want an error", packed, n)
+		}
+	}
+}
+
+func TestZonedDecimal(t *testing.T) {
+	tests := []struct {
+		n      int64
+		zoned  string
+		sa     string
+		sts    string
+		length int
+	}{
+		{0, "0000{", "00000", "0000+", 5},
+		{10, "0001{", "00010", "0010+", 5},
+		{-10, "0001}", "0001p", "0010-", 5},
+		{123, "0012C", "00123", "0123+", 5},
+		{-123, "0012L", "0012s", "0123-", 5},
+		{-9, "R", "y", "", 1},
+		{math.MaxInt64, "922337203685477580G", "9223372036854775807", "", 19},
+	}
+	for _, tt := range tests {
+		b := make([]byte, tt.length)
+		if err := packZoned(b, tt.n); err != nil || string(b) != tt.zoned {
+			t.Errorf("packZoned(%d) = %q, %v, want %q", tt.n, b, err, tt.zoned)
+		}
+		if n, err := unpackZoned([]byte(tt.zoned)); err != nil || n != tt.n {
+			t.Errorf("unpackZoned(%q) = %d, %v, want %d", tt.zoned, n, err, tt.n)
+		}
+		if err := packSA(b, tt.n); err != nil || string(b) != tt.sa {
+			t.Errorf("packSA(%d) = %q, %v, want %q", tt.n, b, err, tt.sa)
+		}
+		if n, err := unpackSA([]byte(tt.sa)); err != nil || n != tt.n {
+			t.Errorf("unpackSA(%q) = %d, %v, want %d", tt.sa, n, err, tt.n)
+		}
+		if tt.sts == "" {
+			continue
+		}
+		if err := packSTS(b, tt.n); err != nil || string(b) != tt.sts {
+			t.Errorf("packSTS(%d) = %q, %v, want %q", tt.n, b, err, tt.sts)
+		}
+		if n, err := unpackSTS([]byte(tt.sts)); err != nil || n != tt.n {
+			t.Errorf("unpackSTS(%q) = %d, %v, want %d", tt.sts, n, err, tt.n)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package xtrieve
+
+import "context"
+
+// DeleteRange deletes the records whose key lies between from and to, both
+// inclusive, and returns how many were deleted. Bounds work as for Range;
+// a nil bound leaves that end of the range open. The deletes are not atomic: when ctx is cancelled
+// or a delete fails, the records deleted so far stay deleted. Wrap the
+// call in a transaction to make it all-or-nothing.
+func (f *File) DeleteRange(ctx context.Context, keyNumber int16, from, to []byte, progress Progress) (int, error) {
+	segments := f.KeySegments(keyNumber)
+	coll := f.Collation(keyNumber)
+	from, to = rangeBounds(segments, coll, from, to)
+	tracker := newProgressTracker(progress, 0)
+
+	var resp *Response
+	var err error
+	if from != nil {
+		resp, err = f.Get(OpGetGreaterOrEqual, from, keyNumber)
+	} else {
+		resp, err = f.GetFirst(keyNumber)
+	}
+
+	n := 0
+	for {
+		if err != nil {
+			return n, err
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		switch resp.StatusCode {
+		case StatusSuccess:
+		case StatusEndOfFile, StatusKeyNotFound:
+			tracker.done()
+			return n, nil
+		default:
+			return n, &StatusError{Operation: OpGetGreaterOrEqual, Status: resp.StatusCode}
+		}
+		if to != nil && CompareKeyCollated(segments, coll, resp.KeyBuffer, to) > 0 {
+			tracker.done()
+			return n, nil
+		}
+
+		key, size := resp.KeyBuffer, len(resp.DataBuffer)
+		del, derr := f.Delete(keyNumber)
+		if derr != nil {
+			return n, derr
+		}
+		if err := checkStatus(OpDelete, del); err != nil {
+			return n, err
+		}
+		n++
+		tracker.add(1, size)
+
+		// Deleting drops the cursor; seek to the next record, which may be
+		// another duplicate of the same key
+		resp, err = f.Get(OpGetGreaterOrEqual, key, keyNumber)
+	}
+}
@@ -0,0 +1,217 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// DerivedIndex keeps an index file mapping a key computed from the records
+// of a primary file to their primary key, for lookups the primary file's
+// own keys do not support, e.g. by a field that was never indexed in a
+// vendor file that cannot take supplemental keys. Hooks on the primary
+// File keep the index in sync with its Insert, Update and Delete; writes
+// made another way, or by other programs, are picked up by Rebuild.
+//
+// Each index record is the derived key followed by the primary key, and
+// the index file's only key covers both (see DerivedIndexSpec). Open the
+// index file on the primary file's connection, e.g. through the same
+// Pool.WithTransaction, to update both in one transaction.
+//
+//	byEmail := xtrieve.NewDerivedIndex(customers, index, 0, 40, func(rec []byte) ([]byte, error) {
+//	    return bytes.ToLower(rec[50:90]), nil
+//	})
+//	ids, err := byEmail.Lookup(bytes.ToLower(email))
+//	resp, err := customers.GetEqual(ids[0], 0)
+type DerivedIndex struct {
+	// Primary is the indexed file and Index the index file
+	Primary *File
+	Index   *File
+	// KeyNumber is the unique key of the primary file the index points to
+	KeyNumber int16
+	// KeyLength is the length of the derived keys
+	KeyLength int
+	// Key derives the key of a record, exactly KeyLength bytes, or nil to
+	// leave the record out of the index
+	Key func(record []byte) ([]byte, error)
+
+	// old is the entry of the record an Update or Delete is about to
+	// change, read by the before hook
+	old []byte
+}
+
+// DerivedIndexSpec returns the spec of an index file for derived keys of
+// keyLength bytes pointing to primary keys of primaryKeyLength bytes
+func DerivedIndexSpec(keyLength, primaryKeyLength int) *FileSpec {
+	return &FileSpec{
+		RecordLength: uint16(keyLength + primaryKeyLength),
+		PageSize:     4096,
+		Keys: []KeySpec{
+			{Position: 0, Length: uint16(keyLength), Flags: KeyFlagSegmented, Type: KeyTypeString},
+			{Position: uint16(keyLength), Length: uint16(primaryKeyLength), Type: KeyTypeString},
+		},
+	}
+}
+
+// NewDerivedIndex returns an index of primary kept in the index file and
+// registers the hooks that maintain it on primary
+func NewDerivedIndex(primary, index *File, keyNumber int16, keyLength int, key func(record []byte) ([]byte, error)) *DerivedIndex {
+	x := &DerivedIndex{Primary: primary, Index: index, KeyNumber: keyNumber, KeyLength: keyLength, Key: key}
+	primary.Before(x.before)
+	primary.After(x.after)
+	return x
+}
+
+// entry returns the index record of a primary record, nil if the record
+// is not indexed
+func (x *DerivedIndex) entry(record []byte) ([]byte, error) {
+	segments := x.Primary.KeySegments(x.KeyNumber)
+	if segments == nil {
+		return nil, fmt.Errorf("xtrieve: file has no key %d", x.KeyNumber)
+	}
+	key, err := x.Key(record)
+	if err != nil || key == nil {
+		return nil, err
+	}
+	if len(key) != x.KeyLength {
+		return nil, fmt.Errorf("xtrieve: derived key is %d bytes, index has %d", len(key), x.KeyLength)
+	}
+	return append(bytes.Clone(key), ExtractKey(segments, record)...), nil
+}
+
+// before reads the entry of the record an Update or Delete will change,
+// leaving the primary file's position as it was
+func (x *DerivedIndex) before(f *File, op uint16, record []byte) error {
+	x.old = nil
+	if op == OpInsert {
+		return nil
+	}
+	current, err := currentRecord(f, x.KeyNumber)
+	if err != nil {
+		return err
+	}
+	x.old, err = x.entry(current)
+	return err
+}
+
+// after brings the index in line with a write
+func (x *DerivedIndex) after(f *File, op uint16, record []byte) error {
+	old := x.old
+	x.old = nil
+	var entry []byte
+	if op != OpDelete {
+		var err error
+		if entry, err = x.entry(record); err != nil {
+			return err
+		}
+	}
+	if bytes.Equal(old, entry) {
+		return nil
+	}
+	if old != nil {
+		if err := x.remove(old); err != nil {
+			return err
+		}
+	}
+	if entry != nil {
+		return x.insert(entry)
+	}
+	return nil
+}
+
+func (x *DerivedIndex) insert(entry []byte) error {
+	resp, err := x.Index.Insert(entry)
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpInsert, resp)
+}
+
+func (x *DerivedIndex) remove(entry []byte) error {
+	resp, err := x.Index.GetEqual(entry, 0)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == StatusKeyNotFound {
+		return nil // not indexed yet; Rebuild was never run
+	}
+	if err := checkStatus(OpGetEqual, resp); err != nil {
+		return err
+	}
+	resp, err = x.Index.Delete(0)
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpDelete, resp)
+}
+
+// Lookup returns the primary keys of the records whose derived key is key
+func (x *DerivedIndex) Lookup(key []byte) ([][]byte, error) {
+	if len(key) != x.KeyLength {
+		return nil, fmt.Errorf("xtrieve: derived key is %d bytes, index has %d", len(key), x.KeyLength)
+	}
+	n := x.Index.RecordLength() - x.KeyLength
+	from := append(bytes.Clone(key), make([]byte, n)...)
+	to := append(bytes.Clone(key), bytes.Repeat([]byte{0xFF}, n)...)
+	var keys [][]byte
+	it := x.Index.Range(0, from, to)
+	for it.Next() {
+		keys = append(keys, bytes.Clone(it.Record()[x.KeyLength:]))
+	}
+	return keys, it.Err()
+}
+
+// Rebuild empties the index and indexes every record of the primary file
+// again, returning the number of entries
+func (x *DerivedIndex) Rebuild(ctx context.Context, progress Progress) (int, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		resp, err := x.Index.GetFirst(0)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode == StatusEndOfFile || resp.StatusCode == StatusKeyNotFound {
+			break
+		}
+		if err := checkStatus(OpGetFirst, resp); err != nil {
+			return 0, err
+		}
+		resp, err = x.Index.Delete(0)
+		if err != nil {
+			return 0, err
+		}
+		if err := checkStatus(OpDelete, resp); err != nil {
+			return 0, err
+		}
+	}
+
+	tracker := newProgressTracker(progress, 0)
+	n := 0
+	it := x.Primary.ScanPhysical()
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		record := it.Record()
+		entry, err := x.entry(record)
+		if err != nil {
+			return n, err
+		}
+		tracker.add(1, len(record))
+		if entry == nil {
+			continue
+		}
+		if err := x.insert(entry); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	tracker.done()
+	return n, nil
+}
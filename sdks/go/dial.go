@@ -0,0 +1,168 @@
+package xtrieve
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DialOptions configure how a client connects and how long operations
+// may take
+type DialOptions struct {
+	// TLS, if set, wraps TCP connections in TLS. Addresses of the form
+	// tls://host:port use TLS with default settings when TLS is nil.
+	TLS *tls.Config
+	// DialTimeout limits each connection attempt (default: none)
+	DialTimeout time.Duration
+	// Timeout limits each operation, from sending the request to reading
+	// the response. A connection whose operation timed out is dropped and
+	// redialed before the next operation, as after ExecuteContext gives up.
+	Timeout time.Duration
+	// ScanTimeout, BulkTimeout and CreateTimeout replace Timeout for the
+	// operations of their OpClass; zero leaves them at Timeout
+	ScanTimeout   time.Duration
+	BulkTimeout   time.Duration
+	CreateTimeout time.Duration
+	// Backoff retries failed dials; see DialContext
+	Backoff Backoff
+	// Strict rejects malformed responses; see Client.SetStrict
+	Strict bool
+	// Budget caps scans and operation sizes; see Client.SetBudget
+	Budget Budget
+	// WireTrace receives a hex dump of every frame; see
+	// Client.WithWireTrace
+	WireTrace io.Writer
+	// Interceptors wrap every operation; see Client.Use
+	Interceptors []Interceptor
+}
+
+// DialWithOptions connects to address like DialContext, with TLS, timeouts
+// and retries taken from opts
+func DialWithOptions(ctx context.Context, address string, opts DialOptions) (*Client, error) {
+	dial, err := dialerWith(address, opts)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := opts.Backoff.retry(ctx, dial)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	c := newClient(conn, address, dial)
+	c.backoff = opts.Backoff
+	c.timeout = opts.Timeout
+	c.classTimeouts = [classCount]time.Duration{
+		ClassScan:   opts.ScanTimeout,
+		ClassBulk:   opts.BulkTimeout,
+		ClassCreate: opts.CreateTimeout,
+	}
+	c.strict = opts.Strict
+	c.budget = opts.Budget
+	c.trace = opts.WireTrace
+	c.Use(opts.Interceptors...)
+	return c, nil
+}
+
+// withoutContext returns opts for dials that have no context to cancel
+// them, as those of pools and routers, so they cannot retry without bound
+func (opts DialOptions) withoutContext() DialOptions {
+	if opts.Backoff.MaxAttempts == 0 {
+		opts.Backoff = Backoff{}
+	}
+	return opts
+}
+
+// dialerWith returns a function connecting to address with opts
+func dialerWith(address string, opts DialOptions) (dialFunc, error) {
+	config := opts.TLS
+	switch {
+	case strings.HasPrefix(address, "npipe://"):
+		path := `\\` + strings.ReplaceAll(strings.TrimPrefix(address, "npipe://"), "/", `\`)
+		return func(ctx context.Context) (net.Conn, error) { return dialPipe(ctx, path) }, nil
+	case strings.HasPrefix(address, "tcp://"):
+		address = strings.TrimPrefix(address, "tcp://")
+	case strings.HasPrefix(address, "tls://"):
+		address = strings.TrimPrefix(address, "tls://")
+		if config == nil {
+			config = &tls.Config{}
+		}
+	case strings.Contains(address, "://"):
+		return nil, fmt.Errorf("unsupported address %q", address)
+	}
+
+	d := &net.Dialer{Timeout: opts.DialTimeout}
+	if config == nil {
+		return func(ctx context.Context) (net.Conn, error) { return d.DialContext(ctx, "tcp", address) }, nil
+	}
+	if config.ServerName == "" {
+		config = config.Clone()
+		config.ServerName, _, _ = net.SplitHostPort(address)
+	}
+	td := &tls.Dialer{NetDialer: d, Config: config}
+	return func(ctx context.Context) (net.Conn, error) { return td.DialContext(ctx, "tcp", address) }, nil
+}
+
+// SetTimeout changes the limit on each operation; zero means none.
+// Classes given their own timeout with SetClassTimeout keep it.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = d
+}
+
+// SetClassTimeout changes the limit on the operations of a class; zero
+// puts them back under the timeout of SetTimeout. ClassPoint always uses
+// that one.
+func (c *Client) SetClassTimeout(class OpClass, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if class != ClassPoint && class < classCount {
+		c.classTimeouts[class] = d
+	}
+}
+
+// timeoutFor returns the limit on the operations of a class. The caller
+// holds c.mu.
+func (c *Client) timeoutFor(class OpClass) time.Duration {
+	if d := c.classTimeouts[class]; d > 0 {
+		return d
+	}
+	return c.timeout
+}
+
+// startDeadline arms the operation timeout, clearing the deadline an
+// earlier operation of another class left. The caller holds c.mu.
+func (c *Client) startDeadline(timeout time.Duration) {
+	if timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(timeout))
+		c.deadline = true
+	} else if c.deadline {
+		c.conn.SetDeadline(time.Time{})
+		c.deadline = false
+	}
+}
+
+// checkTimeout drops the connection after an operation timed out, since
+// its response may still arrive. The caller holds c.mu.
+func (c *Client) checkTimeout(err error, timeout time.Duration) error {
+	if err == nil || timeout == 0 {
+		return err
+	}
+	return c.timedOut(err, timeout)
+}
+
+// timedOut is checkTimeout's slow path, kept apart so the error target
+// does not escape on every operation
+func (c *Client) timedOut(err error, timeout time.Duration) error {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		c.conn.Close()
+		c.broken = true
+		return fmt.Errorf("operation timed out after %v: %w", timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,73 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+)
+
+// MaxDryRunSamples is the number of sample keys a DryRunReport keeps
+const MaxDryRunSamples = 10
+
+// DryRunReport describes what a destructive operation would change,
+// without changing it
+type DryRunReport struct {
+	// Records and Bytes count the records that would be written or deleted
+	Records int
+	Bytes   int64
+	// Keys holds the keys of the first MaxDryRunSamples of them
+	Keys [][]byte
+}
+
+// add counts a record that would be changed
+func (r *DryRunReport) add(key []byte, size int) {
+	r.Records++
+	r.Bytes += int64(size)
+	if len(r.Keys) < MaxDryRunSamples {
+		r.Keys = append(r.Keys, bytes.Clone(key))
+	}
+}
+
+func (r *DryRunReport) String() string {
+	return fmt.Sprintf("%d records, %d bytes", r.Records, r.Bytes)
+}
+
+// DeleteRangeDryRun reports the records DeleteRange would delete with the
+// same arguments, reading them without deleting anything
+func (f *File) DeleteRangeDryRun(ctx context.Context, keyNumber int16, from, to []byte) (*DryRunReport, error) {
+	report := &DryRunReport{}
+	it := f.Range(keyNumber, from, to)
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.add(it.Key(), len(it.Record()))
+	}
+	return report, it.Err()
+}
+
+// PurgeDryRun reports the records Purge would remove with the same
+// cutoff, reading them without deleting anything. Sample keys are values
+// of the table's key.
+func (t *Table) PurgeDryRun(ctx context.Context, cutoff time.Time) (*DryRunReport, error) {
+	field, ok := t.softDeleteField()
+	if !ok {
+		return nil, fmt.Errorf("xtrieve: schema has no soft-delete field")
+	}
+	report := &DryRunReport{}
+	it := t.File.Scan(t.KeyNumber)
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		record := it.Record()
+		if !isDeleted(field, record) || (!cutoff.IsZero() && !deletedBefore(field, record, cutoff)) {
+			continue
+		}
+		report.add(it.Key(), len(record))
+	}
+	return report, it.Err()
+}
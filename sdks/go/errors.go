@@ -0,0 +1,84 @@
+package xtrieve
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrRecordLength is returned when a record buffer does not match the file's
+// record length and the file's LengthPolicy does not allow fixing it up
+var ErrRecordLength = errors.New("record length mismatch")
+
+// ErrFixedLength is returned when a Document schema is used with a file
+// that does not report variable-length records, which cannot hold the
+// document after the fixed fields
+var ErrFixedLength = errors.New("document schema needs a variable-length file")
+
+// ErrReplicaStale is returned when a record read from a replica cannot be
+// found on the primary to update or delete it, usually because the replica
+// lags behind
+var ErrReplicaStale = errors.New("record read from replica not found on primary")
+
+// ErrNoCurrentShard is returned by ShardedFile.Update and Delete when no
+// retrieval has positioned the file on a record
+var ErrNoCurrentShard = errors.New("no current record on any shard")
+
+// ErrShardKeyChanged is returned by ShardedFile.Update when the new shard
+// key belongs on a different shard; delete and reinsert the record instead
+var ErrShardKeyChanged = errors.New("update would move record to another shard")
+
+// ErrLeaseExpired is returned by operations on a File whose lease could not
+// be renewed in time. The server may have released the file's position
+// and locks; reopen the file and reposition before continuing.
+var ErrLeaseExpired = errors.New("file lease expired")
+
+// ErrStaleVersion is returned by Table.Update and Delete when the record's
+// version field no longer matches the version that was read, because the
+// record was changed in the meantime
+var ErrStaleVersion = errors.New("record version is stale")
+
+// ErrDecrypt is returned when an encrypted field fails authentication,
+// because the key is wrong or the stored bytes were altered
+var ErrDecrypt = errors.New("cannot decrypt field")
+
+// ErrOwnerRequired is returned by OpenFile when the file is protected by
+// an owner name and none was given; use OpenFileOwner. The error also
+// carries the StatusInvalidOwner *StatusError. xtrieved ignores owner
+// names and never returns it.
+var ErrOwnerRequired = errors.New("file requires an owner name")
+
+// ErrTimestampSupplied is returned by Table.Insert and Update when the
+// schema has StrictTimestamps and the caller supplied a Created or
+// Modified value of their own
+var ErrTimestampSupplied = errors.New("timestamp field is maintained automatically")
+
+// StatusError reports a non-success Btrieve status code for an operation
+type StatusError struct {
+	Operation uint16
+	Status    uint16
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("operation %d failed with status %d", e.Operation, e.Status)
+}
+
+// IsStatus reports whether err is a StatusError carrying the given status code
+func IsStatus(err error, status uint16) bool {
+	var se *StatusError
+	return errors.As(err, &se) && se.Status == status
+}
+
+// checkStatus turns a non-success response into a StatusError
+func checkStatus(op uint16, resp *Response) error {
+	if resp.StatusCode != StatusSuccess {
+		return &StatusError{Operation: op, Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// isStatusError reports whether err carries a Btrieve status, as opposed to
+// a transport failure
+func isStatusError(err error) bool {
+	var se *StatusError
+	return errors.As(err, &se)
+}
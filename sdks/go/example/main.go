@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"log"
 
-	xtrieve ".."
+	xtrieve "github.com/eduardostern/xtrieve-go"
 )
 
 func main() {
@@ -0,0 +1,170 @@
+package xtrieve
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Plan describes how a Query will run, as reported by Query.Explain
+type Plan struct {
+	// KeyNumber is the key the scan walks, and Chosen is set when the
+	// planner picked it
+	KeyNumber int16
+	Chosen    bool
+	// Positioning is the operation that starts the scan, OpGetFirst or
+	// OpGetGreaterOrEqual, and Next the one that continues it,
+	// OpGetNextExtended or OpGetNext
+	Positioning uint16
+	Next        uint16
+	// Descending is set when the key's first segment is descending, so
+	// records come from the largest key down
+	Descending bool
+	// ServerTerms is the number of filter terms sent to the server with
+	// the extended operations, and ClientMatchers the number of Match
+	// patterns checked on each returned record
+	ServerTerms    int
+	ClientMatchers int
+	// ServerProjection is set when Select is done by the server's
+	// extractor; matchers need whole records, so they move it client-side
+	ServerProjection bool
+	// Records is the file's record count from Stat, and Estimate the
+	// number of records the scan is expected to read before filtering,
+	// worked out as EstimateBasis says
+	Records       uint64
+	Estimate      uint64
+	EstimateBasis string
+}
+
+func (p *Plan) String() string {
+	var b strings.Builder
+	direction := "ascending"
+	if p.Descending {
+		direction = "descending"
+	}
+	chosen := ""
+	if p.Chosen {
+		chosen = " (chosen)"
+	}
+	fmt.Fprintf(&b, "key %d%s, %s, %s then %s\n", p.KeyNumber, chosen, direction, OpName(p.Positioning), OpName(p.Next))
+	switch {
+	case p.ServerTerms > 0:
+		fmt.Fprintf(&b, "filter: %d terms on the server\n", p.ServerTerms)
+	case p.Next == OpGetNextExtended:
+		fmt.Fprintf(&b, "filter: none\n")
+	}
+	if p.ClientMatchers > 0 {
+		fmt.Fprintf(&b, "match: %d patterns on the client\n", p.ClientMatchers)
+	}
+	if p.ServerProjection {
+		fmt.Fprintf(&b, "select: on the server\n")
+	}
+	fmt.Fprintf(&b, "records: %d of %d estimated (%s)", p.Estimate, p.Records, p.EstimateBasis)
+	return b.String()
+}
+
+// Explain reports how the query will run without running it: the key and
+// operations of the scan, which predicates the server evaluates, and how
+// many records the scan is expected to read. Filters count as pushed down
+// whenever the server supports extended operations, which is only found
+// out by running the query.
+//
+// The estimate comes from File.Statistics, refined for a key range by
+// positioning on its bounds and asking the server how far through the
+// index they lie, so Explain moves the file's position.
+func (q *Query) Explain() (*Plan, error) {
+	it, _, err := q.Iter()
+	if err != nil {
+		return nil, err
+	}
+	segments := q.file.KeySegments(it.keyNumber)
+	if segments == nil {
+		return nil, fmt.Errorf("xtrieve: file has no key %d", it.keyNumber)
+	}
+	p := &Plan{
+		KeyNumber:        it.keyNumber,
+		Chosen:           q.chosen,
+		Positioning:      OpGetFirst,
+		Next:             OpGetNext,
+		Descending:       segments[0].Flags&KeyFlagDescending != 0,
+		ClientMatchers:   len(it.matchers),
+		ServerProjection: it.extract != nil && it.matchers == nil,
+	}
+	if it.from != nil {
+		p.Positioning = OpGetGreaterOrEqual
+	}
+	if it.extended {
+		p.Next = OpGetNextExtended
+		if it.active != nil {
+			p.ServerTerms = len(it.active.terms)
+		}
+	}
+
+	stats, err := q.file.Statistics()
+	if err != nil {
+		return nil, err
+	}
+	p.Records = stats.Records
+	p.Estimate, p.EstimateBasis = q.estimate(stats, it.keyNumber, it.from, it.to)
+	return p, nil
+}
+
+// estimate returns the expected number of records between the bounds of
+// a scan and how it was worked out
+func (q *Query) estimate(stats *FileStatistics, keyNumber int16, from, to []byte) (uint64, string) {
+	if from == nil && to == nil {
+		return stats.Records, stats.Source
+	}
+	if from != nil && bytes.Equal(from, to) && int(keyNumber) < len(stats.Keys) {
+		if distinct := stats.Keys[keyNumber].Distinct; distinct > 0 {
+			return stats.Records / distinct, "distinct key count"
+		}
+	}
+	// Percentages need the position on the server that answers them,
+	// which a pooled file may not have
+	if q.file.replica != nil {
+		return stats.Records, stats.Source
+	}
+	lo, hi := 0, MaxPercentage
+	if from != nil {
+		pct, ok := q.percentageAt(OpGetGreaterOrEqual, keyNumber, from)
+		if !ok {
+			return stats.Records, stats.Source
+		}
+		lo = pct
+	}
+	if to != nil {
+		pct, ok := q.percentageAt(OpGetLessOrEqual, keyNumber, to)
+		if !ok {
+			return stats.Records, stats.Source
+		}
+		hi = pct
+	}
+	if hi < lo {
+		return 0, "key percentages"
+	}
+	return RecordAtPercentage(hi-lo, stats.Records) + 1, "key percentages"
+}
+
+// percentageAt positions on key with op and returns how far through the
+// index the record found lies. A bound with no record beyond it lies at
+// the end of the index it points away from.
+func (q *Query) percentageAt(op uint16, keyNumber int16, key []byte) (int, bool) {
+	resp, err := q.file.Get(op, key, keyNumber)
+	if err != nil {
+		return 0, false
+	}
+	switch resp.StatusCode {
+	case StatusSuccess:
+	case StatusKeyNotFound, StatusEndOfFile:
+		if op == OpGetGreaterOrEqual {
+			return MaxPercentage + 1, true
+		}
+		return -1, true
+	default:
+		return 0, false
+	}
+	// Counting records to estimate a range would cost more than the scan
+	pct, err := q.file.findPercentage(&Request{Operation: OpFindPercentage, KeyNumber: keyNumber})
+	return pct, err == nil
+}
@@ -0,0 +1,110 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ExtendedRecord is one record returned by an extended operation
+type ExtendedRecord struct {
+	Position uint32
+	Data     []byte
+}
+
+// Extractor selects a byte range of each record returned by an extended
+// operation
+type Extractor struct {
+	Offset uint16
+	Length uint16
+}
+
+// BuildExtendedDescriptor builds the data buffer of an extended get or step
+// operation: a header, the filter (nil for none) and the extractor, which
+// returns up to maxRecords records made of the given byte ranges
+func BuildExtendedDescriptor(filter *Filter, rejectCount, maxRecords uint16, extract []Extractor) ([]byte, error) {
+	if len(extract) == 0 {
+		return nil, errors.New("extended descriptor needs at least one extractor")
+	}
+
+	// Header: total length (filled in below) and the "EG" signature
+	buf := []byte{0, 0, 'E', 'G'}
+
+	buf, err := filter.appendDescriptor(buf, rejectCount)
+	if err != nil {
+		return nil, err
+	}
+
+	buf = binary.LittleEndian.AppendUint16(buf, maxRecords)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(extract)))
+	for _, e := range extract {
+		buf = binary.LittleEndian.AppendUint16(buf, e.Length)
+		buf = binary.LittleEndian.AppendUint16(buf, e.Offset)
+	}
+
+	if len(buf) > maxDescriptorSize {
+		return nil, errors.New("extended descriptor exceeds 65535 bytes")
+	}
+	binary.LittleEndian.PutUint16(buf[0:], uint16(len(buf)))
+	return buf, nil
+}
+
+// ParseExtendedResponse decodes the data buffer returned by an extended
+// operation: a record count followed by length, position and data for
+// each record
+func ParseExtendedResponse(buf []byte) ([]ExtendedRecord, error) {
+	if len(buf) < 2 {
+		return nil, nil
+	}
+	count := int(binary.LittleEndian.Uint16(buf))
+	records := make([]ExtendedRecord, 0, count)
+
+	offset := 2
+	for i := 0; i < count; i++ {
+		if offset+6 > len(buf) {
+			return nil, errors.New("extended response truncated")
+		}
+		length := int(binary.LittleEndian.Uint16(buf[offset:]))
+		position := binary.LittleEndian.Uint32(buf[offset+2:])
+		offset += 6
+		if offset+length > len(buf) {
+			return nil, errors.New("extended response truncated")
+		}
+		records = append(records, ExtendedRecord{Position: position, Data: buf[offset : offset+length]})
+		offset += length
+	}
+	return records, nil
+}
+
+// GetNextExtended returns the following records in key order that match
+// filter, starting after the current position. Besides StatusSuccess the
+// server may report StatusEndOfFile or StatusRejectCountReached together
+// with the records found so far.
+func (f *File) GetNextExtended(keyNumber int16, descriptor []byte) (*Response, []ExtendedRecord, error) {
+	return f.extended(OpGetNextExtended, keyNumber, descriptor)
+}
+
+// StepNextExtended is GetNextExtended in physical order
+func (f *File) StepNextExtended(descriptor []byte) (*Response, []ExtendedRecord, error) {
+	return f.extended(OpStepNextExtended, 0, descriptor)
+}
+
+func (f *File) extended(op uint16, keyNumber int16, descriptor []byte) (*Response, []ExtendedRecord, error) {
+	resp, err := f.exec(&Request{
+		Operation:  op,
+		DataBuffer: descriptor,
+		KeyNumber:  keyNumber,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch resp.StatusCode {
+	case StatusSuccess, StatusEndOfFile, StatusRejectCountReached, StatusFilterLimitReached:
+		records, err := ParseExtendedResponse(resp.DataBuffer)
+		if err != nil {
+			return nil, nil, err
+		}
+		return resp, records, nil
+	}
+	return resp, nil, nil
+}
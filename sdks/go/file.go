@@ -0,0 +1,394 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// positionBlockPathOffset is where the server stores the file path
+const positionBlockPathOffset = 64
+
+// LengthPolicy controls how File.Insert and File.Update treat buffers whose
+// length differs from the file's record length
+type LengthPolicy uint8
+
+// Length policies. Policies may be combined, e.g. LengthPad|LengthTruncate.
+const (
+	// LengthStrict rejects mismatched buffers with ErrRecordLength
+	LengthStrict LengthPolicy = 0
+	// LengthPad zero-pads short buffers up to the record length
+	LengthPad LengthPolicy = 0x01
+	// LengthTruncate cuts long buffers down to the record length
+	LengthTruncate LengthPolicy = 0x02
+)
+
+// File is an open file bound to a client. It keeps the current position
+// block so callers do not have to thread it through every call.
+// A File is not safe for concurrent use.
+//
+// Responses returned by File methods share the File's position block
+// buffers: Response.PositionBlock is only valid until the next operation
+// on the File. Use SnapshotPosition to keep a copy.
+type File struct {
+	client         *Client
+	path           string
+	mode           int16
+	owner          string
+	posBlock       []byte
+	scratch        []byte
+	recordLength   int
+	variableLength bool
+	keys           []KeySpec
+	policy         LengthPolicy
+	collations     map[int16]Collation
+	// statistics are the query planner's, see Statistics
+	statistics *FileStatistics
+	// before and after are the write hooks, see FileHook
+	before []FileHook
+	after  []FileHook
+
+	// replica, when set by Pool.OpenFile, serves read-only operations
+	replica *File
+	// onReplica is set while the cursor was last positioned on the replica
+	onReplica bool
+	// pin, set by pools with ConsistencyReadYourWrites, keeps reads on
+	// the primary after a write
+	pin  *readPin
+	inTx bool
+
+	lease *lease
+	// shadow repeats reads on another server, see Shadow
+	shadow *shadowReads
+	// ctx is the caller's context, see SetContext
+	ctx context.Context
+}
+
+// OpenFile opens a file and returns a handle for it. The file's record length
+// is read with Stat and enforced on Insert and Update using LengthStrict
+// until the caller chooses another policy with SetLengthPolicy.
+func (c *Client) OpenFile(filePath string, mode int16) (*File, error) {
+	return c.openFile(filePath, mode, "")
+}
+
+func (c *Client) openFile(filePath string, mode int16, owner string) (*File, error) {
+	resp, err := c.OpenOwner(filePath, mode, owner)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkOpen(resp, owner); err != nil {
+		return nil, err
+	}
+
+	f := &File{
+		client:   c,
+		path:     filePath,
+		mode:     mode,
+		owner:    owner,
+		posBlock: resp.PositionBlock,
+		scratch:  make([]byte, PositionBlockSize),
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		c.CloseFile(f.posBlock)
+		return nil, err
+	}
+	f.recordLength = int(stat.RecordLength)
+	f.variableLength = stat.VariableLength()
+	for _, k := range stat.Keys {
+		f.keys = append(f.keys, k.KeySpec)
+	}
+
+	return f, nil
+}
+
+// Path returns the path the file was opened with
+func (f *File) Path() string {
+	return f.path
+}
+
+// RecordLength returns the fixed record length of the file
+func (f *File) RecordLength() int {
+	return f.recordLength
+}
+
+// KeySegments returns the segments making up a key, or nil if the file
+// has no such key
+func (f *File) KeySegments(keyNumber int16) []KeySpec {
+	return keySegments(f.keys, keyNumber)
+}
+
+// SetLengthPolicy sets how mismatched record buffers are handled
+func (f *File) SetLengthPolicy(policy LengthPolicy) {
+	f.policy = policy
+}
+
+// PositionBlock returns the current position block. The returned slice is
+// reused by later operations on the File; use SnapshotPosition to keep it.
+func (f *File) PositionBlock() []byte {
+	return f.posBlock
+}
+
+// SnapshotPosition returns a copy of the current position block
+func (f *File) SnapshotPosition() []byte {
+	snapshot := make([]byte, PositionBlockSize)
+	copy(snapshot, f.posBlock)
+	return snapshot
+}
+
+// RestorePosition replaces the current position block with a snapshot
+// taken earlier with SnapshotPosition
+func (f *File) RestorePosition(snapshot []byte) {
+	copy(f.posBlock, snapshot)
+}
+
+// Close closes the file
+func (f *File) Close() (*Response, error) {
+	if f.lease != nil {
+		f.lease.stop()
+	}
+	if f.replica != nil {
+		f.replica.Close()
+	}
+	return f.execLocal(&Request{Operation: OpClose})
+}
+
+// Reopen opens the file again with its original mode and owner name and
+// replaces the position block, e.g. after the client reconnected
+func (f *File) Reopen() error {
+	resp, err := f.client.executeWith(f.Context(), &Request{
+		Operation:  OpOpen,
+		FilePath:   f.path,
+		KeyNumber:  f.mode,
+		DataBuffer: ownerBuffer(f.owner),
+	}, f.scratch)
+	if err != nil {
+		return err
+	}
+	if err := checkOpen(resp, f.owner); err != nil {
+		return err
+	}
+	f.posBlock, f.scratch = f.scratch, f.posBlock
+	f.onReplica = false
+	if f.lease != nil {
+		f.lease.restart()
+	}
+	if f.replica != nil {
+		return f.replica.Reopen()
+	}
+	return nil
+}
+
+// reconnect re-establishes the connections the file uses
+func (f *File) reconnect() error {
+	if f.replica != nil {
+		if err := f.replica.client.Reconnect(); err != nil {
+			return err
+		}
+	}
+	return f.client.Reconnect()
+}
+
+// Stat retrieves and decodes the file's attributes
+func (f *File) Stat() (*FileStat, error) {
+	resp, err := f.exec(&Request{Operation: OpStat})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(OpStat, resp); err != nil {
+		return nil, err
+	}
+	stat, err := ParseStat(resp.DataBuffer)
+	if err != nil {
+		return nil, err
+	}
+	// The key buffer names the extension file of an extended file
+	stat.Extension, _, _ = strings.Cut(string(resp.KeyBuffer), "\x00")
+	stat.Extension = strings.TrimSpace(stat.Extension)
+	return stat, nil
+}
+
+// Insert inserts a record after applying the length policy
+func (f *File) Insert(data []byte) (*Response, error) {
+	data, err := f.fitRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.write(&Request{
+		Operation:  OpInsert,
+		DataBuffer: data,
+	})
+}
+
+// Update updates the current record after applying the length policy
+func (f *File) Update(data []byte, keyNumber int16) (*Response, error) {
+	data, err := f.fitRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	return f.write(&Request{
+		Operation:  OpUpdate,
+		DataBuffer: data,
+		KeyNumber:  keyNumber,
+	})
+}
+
+// Delete deletes the current record
+func (f *File) Delete(keyNumber int16) (*Response, error) {
+	return f.write(&Request{
+		Operation: OpDelete,
+		KeyNumber: keyNumber,
+	})
+}
+
+// write runs a write request between the file's hooks. The after hooks
+// only run when the write succeeds.
+func (f *File) write(req *Request) (*Response, error) {
+	if len(f.before) > 0 {
+		// Hooks of pooled files find the primary on the record to change
+		if f.onReplica && req.Operation != OpInsert {
+			if err := f.positionPrimary(req.KeyNumber); err != nil {
+				return nil, err
+			}
+			f.onReplica = false
+		}
+		if err := f.runHooks(f.before, req.Operation, req.DataBuffer); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := f.exec(req)
+	if err != nil || resp.StatusCode != StatusSuccess || len(f.after) == 0 {
+		return resp, err
+	}
+	return resp, f.runHooks(f.after, req.Operation, req.DataBuffer)
+}
+
+// Get executes a key-based retrieval operation such as OpGetGreater.
+// Keys of case-insensitive segments are folded to upper case.
+func (f *File) Get(op uint16, key []byte, keyNumber int16) (*Response, error) {
+	return f.exec(&Request{
+		Operation: op,
+		KeyBuffer: FoldKey(f.KeySegments(keyNumber), key),
+		KeyNumber: keyNumber,
+	})
+}
+
+// GetEqual gets a record by exact key match
+func (f *File) GetEqual(key []byte, keyNumber int16) (*Response, error) {
+	return f.Get(OpGetEqual, key, keyNumber)
+}
+
+// GetFirst gets the first record in key order
+func (f *File) GetFirst(keyNumber int16) (*Response, error) {
+	return f.Get(OpGetFirst, nil, keyNumber)
+}
+
+// GetLast gets the last record in key order
+func (f *File) GetLast(keyNumber int16) (*Response, error) {
+	return f.Get(OpGetLast, nil, keyNumber)
+}
+
+// GetNext gets the next record in key order
+func (f *File) GetNext(keyNumber int16) (*Response, error) {
+	return f.Get(OpGetNext, nil, keyNumber)
+}
+
+// GetPrevious gets the previous record in key order
+func (f *File) GetPrevious(keyNumber int16) (*Response, error) {
+	return f.Get(OpGetPrevious, nil, keyNumber)
+}
+
+// StepFirst gets the first record in physical order
+func (f *File) StepFirst() (*Response, error) {
+	return f.exec(&Request{Operation: OpStepFirst})
+}
+
+// StepNext gets the next record in physical order
+func (f *File) StepNext() (*Response, error) {
+	return f.exec(&Request{Operation: OpStepNext})
+}
+
+// fitRecord applies the length policy to a record buffer
+func (f *File) fitRecord(data []byte) ([]byte, error) {
+	switch {
+	case len(data) < f.recordLength:
+		if f.policy&LengthPad == 0 {
+			return nil, fmt.Errorf("%w: %d bytes, record length is %d", ErrRecordLength, len(data), f.recordLength)
+		}
+		padded := make([]byte, f.recordLength)
+		copy(padded, data)
+		return padded, nil
+
+	case len(data) > f.recordLength && !f.variableLength:
+		if f.policy&LengthTruncate == 0 {
+			return nil, fmt.Errorf("%w: %d bytes, record length is %d", ErrRecordLength, len(data), f.recordLength)
+		}
+		return data[:f.recordLength], nil
+	}
+
+	return data, nil
+}
+
+// BeginTransaction starts a transaction. Files opened through a Pool send
+// every operation to the primary until the transaction ends, reads included.
+func (f *File) BeginTransaction(lockMode uint16) (*Response, error) {
+	return f.exec(&Request{Operation: OpBeginTransaction, LockBias: lockMode})
+}
+
+// EndTransaction commits the current transaction
+func (f *File) EndTransaction() (*Response, error) {
+	return f.exec(&Request{Operation: OpEndTransaction})
+}
+
+// AbortTransaction rolls back the current transaction
+func (f *File) AbortTransaction() (*Response, error) {
+	return f.exec(&Request{Operation: OpAbortTransaction})
+}
+
+// exec runs a request, routing it to the replica when the file has one
+// and repeating reads on the shadow
+func (f *File) exec(req *Request) (*Response, error) {
+	if f.shadow != nil {
+		return f.shadow.exec(f, req)
+	}
+	return f.execPrimary(req)
+}
+
+// execPrimary runs a request on the file's own server or its replica
+func (f *File) execPrimary(req *Request) (*Response, error) {
+	if f.replica != nil {
+		return f.route(req)
+	}
+	return f.execLocal(req)
+}
+
+// execLocal runs a request against the file's position block and keeps the
+// updated position block whenever the server returns one (extended
+// operations move the cursor even when they end with a non-zero status).
+// The response position block is decoded into the scratch buffer, which is
+// swapped in rather than copied.
+func (f *File) execLocal(req *Request) (*Response, error) {
+	if f.lease != nil && f.lease.expired() {
+		return nil, ErrLeaseExpired
+	}
+	req.PositionBlock = f.posBlock
+	resp, err := f.client.executeWith(f.Context(), req, f.scratch)
+	if err != nil {
+		return nil, err
+	}
+	if f.lease != nil {
+		f.lease.renewed()
+	}
+	if hasFileRef(resp.PositionBlock) {
+		f.posBlock, f.scratch = f.scratch, f.posBlock
+	}
+	return resp, nil
+}
+
+// hasFileRef reports whether a position block references an open file.
+// Operations that do not touch the cursor (Stat, Close) and failed
+// operations return a blank block, which must not replace the current one.
+func hasFileRef(positionBlock []byte) bool {
+	return len(positionBlock) > positionBlockPathOffset && positionBlock[positionBlockPathOffset] != 0
+}
@@ -0,0 +1,53 @@
+package xtrieve
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestFitRecord(t *testing.T) {
+	short, exact, long := []byte("abc"), []byte("abcd"), []byte("abcdef")
+	tests := []struct {
+		policy   LengthPolicy
+		variable bool
+		data     []byte
+		want     []byte // nil for ErrRecordLength
+	}{
+		{LengthStrict, false, exact, exact},
+		{LengthStrict, false, short, nil},
+		{LengthStrict, false, long, nil},
+		{LengthPad, false, short, []byte("abc\x00")},
+		{LengthPad, false, long, nil},
+		{LengthTruncate, false, short, nil},
+		{LengthTruncate, false, long, exact},
+		{LengthPad | LengthTruncate, false, short, []byte("abc\x00")},
+		{LengthPad | LengthTruncate, false, long, exact},
+		{LengthPad | LengthTruncate, false, exact, exact},
+		// Variable-length records may run past the fixed part but not
+		// stop short of it
+		{LengthStrict, true, long, long},
+		{LengthStrict, true, short, nil},
+		{LengthTruncate, true, long, long},
+		{LengthPad, true, short, []byte("abc\x00")},
+		{LengthPad | LengthTruncate, true, long, long},
+	}
+	for _, tt := range tests {
+		f := &File{recordLength: 4, variableLength: tt.variable, policy: tt.policy}
+		got, err := f.fitRecord(tt.data)
+		switch {
+		case tt.want == nil && !errors.Is(err, ErrRecordLength):
+			t.Errorf("policy %d, variable %v: fitRecord(%q) = %q, %v, want ErrRecordLength", tt.policy, tt.variable, tt.data, got, err)
+		case tt.want != nil && (err != nil || !bytes.Equal(got, tt.want)):
+			t.Errorf("policy %d, variable %v: fitRecord(%q) = %q, %v, want %q", tt.policy, tt.variable, tt.data, got, err, tt.want)
+		}
+	}
+
+	// Padding copies rather than growing the caller's buffer
+	buf := make([]byte, 3, 8)
+	copy(buf, "xyz")
+	f := &File{recordLength: 4, policy: LengthPad}
+	if got, _ := f.fitRecord(buf); &got[0] == &buf[0] {
+		t.Error("fitRecord padded the caller's buffer in place")
+	}
+}
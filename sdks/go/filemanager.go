@@ -0,0 +1,233 @@
+package xtrieve
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// FileManager caches open Files per path and mode so that request
+// handlers can open files cheaply without leaking server file handles.
+// Open lends a File for the caller's exclusive use and Release returns it;
+// a released File is lent again by the next Open of the same path and
+// mode, and more are opened while all of them are lent out. Files left
+// unused for the idle time are closed.
+//
+// After the client reconnected, a cached File is checked with Stat before
+// it is lent again and reopened if the server lost it, e.g. because it
+// restarted. xtrieved keeps sessions across connections, so the check
+// usually succeeds and the server's handle is kept.
+//
+//	files := xtrieve.NewFileManager(client, 5*time.Minute)
+//	defer files.Close()
+//
+//	f, err := files.Open("customers.dat", 0)
+//	if err != nil {
+//		return err
+//	}
+//	defer files.Release(f)
+type FileManager struct {
+	client *Client
+	idle   time.Duration
+
+	mu     sync.Mutex
+	files  map[fileKey]*managedFiles
+	lent   map[*File]time.Time
+	closed bool
+	stop   chan struct{}
+}
+
+// fileKey identifies the Files a FileManager can lend interchangeably
+type fileKey struct {
+	path string
+	mode int16
+}
+
+// managedFiles are the Files of one path and mode
+type managedFiles struct {
+	// refs counts the Files lent out
+	refs int
+	free []idleFile
+}
+
+// idleFile is a released File waiting to be lent again
+type idleFile struct {
+	f     *File
+	since time.Time
+	// connected is when the client's connection the File was last
+	// checked on was made
+	connected time.Time
+}
+
+// NewFileManager returns a FileManager for files opened through c that
+// closes Files idle for longer than idle. With idle 0 Files stay open
+// until Close.
+func NewFileManager(c *Client, idle time.Duration) *FileManager {
+	m := &FileManager{
+		client: c,
+		idle:   idle,
+		files:  make(map[fileKey]*managedFiles),
+		lent:   make(map[*File]time.Time),
+		stop:   make(chan struct{}),
+	}
+	if idle > 0 {
+		go m.closeIdleLoop()
+	}
+	return m
+}
+
+// Open lends a File for path opened in mode, opening it if none is free.
+// The caller has exclusive use of the File until it passes it to Release
+// and must not close it.
+func (m *FileManager) Open(path string, mode int16) (*File, error) {
+	key := fileKey{path, mode}
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, errors.New("xtrieve: file manager closed")
+	}
+	files := m.files[key]
+	if files == nil {
+		files = &managedFiles{}
+		m.files[key] = files
+	}
+	files.refs++
+	var cached *idleFile
+	if n := len(files.free); n > 0 {
+		idle := files.free[n-1]
+		cached = &idle
+		files.free = files.free[:n-1]
+	}
+	m.mu.Unlock()
+
+	connected := m.client.connectedAt()
+	var f *File
+	var err error
+	if cached != nil {
+		f = cached.f
+		if cached.connected != connected || connected.IsZero() {
+			err = revalidate(f)
+		}
+	} else {
+		f, err = m.client.OpenFile(path, mode)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		files.refs--
+		if cached != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+	m.lent[f] = connected
+	return f, nil
+}
+
+// Release returns a File lent by Open. The File is kept open for the next
+// Open of the same path and mode, or closed if the manager is closed.
+func (m *FileManager) Release(f *File) {
+	m.mu.Lock()
+	connected, ok := m.lent[f]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	delete(m.lent, f)
+	files := m.files[fileKey{f.path, f.mode}]
+	files.refs--
+	if m.closed {
+		m.mu.Unlock()
+		f.Close()
+		return
+	}
+	files.free = append(files.free, idleFile{f: f, since: time.Now(), connected: connected})
+	m.mu.Unlock()
+}
+
+// Close closes the cached Files and stops lending. Files still lent out
+// are closed when they are released.
+func (m *FileManager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	close(m.stop)
+	var free []*File
+	for _, files := range m.files {
+		for _, idle := range files.free {
+			free = append(free, idle.f)
+		}
+		files.free = nil
+	}
+	m.mu.Unlock()
+
+	var errs []error
+	for _, f := range free {
+		if _, err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *FileManager) closeIdleLoop() {
+	ticker := time.NewTicker(max(m.idle/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.closeIdle()
+		}
+	}
+}
+
+// closeIdle closes the Files released longer than the idle time ago
+func (m *FileManager) closeIdle() {
+	now := time.Now()
+	var expired []*File
+	m.mu.Lock()
+	for key, files := range m.files {
+		// free is in release order, so the oldest come first
+		n := 0
+		for n < len(files.free) && now.Sub(files.free[n].since) >= m.idle {
+			expired = append(expired, files.free[n].f)
+			n++
+		}
+		files.free = files.free[n:]
+		if files.refs == 0 && len(files.free) == 0 {
+			delete(m.files, key)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, f := range expired {
+		f.Close()
+	}
+}
+
+// revalidate checks a File after its client reconnected and reopens it
+// if the server no longer has it open
+func revalidate(f *File) error {
+	_, err := f.Stat()
+	if isStatusError(err) {
+		return f.Reopen()
+	}
+	return err
+}
+
+// connectedAt returns when the current connection was made, or the zero
+// time while the client waits to reconnect
+func (c *Client) connectedAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return time.Time{}
+	}
+	return c.connected
+}
@@ -0,0 +1,257 @@
+package xtrieve
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Comparison operators for filter terms
+const (
+	CmpEqual          = 1
+	CmpGreater        = 2
+	CmpLess           = 3
+	CmpNotEqual       = 4
+	CmpGreaterOrEqual = 5
+	CmpLessOrEqual    = 6
+)
+
+// Filter term connectors
+const (
+	connectorLast = 0
+	connectorAnd  = 1
+	connectorOr   = 2
+)
+
+// maxDescriptorSize is the largest descriptor the 2-byte length can express
+const maxDescriptorSize = 0xFFFF
+
+// Filter is a list of field comparisons joined by AND/OR. It compiles to
+// the filter part of an extended-operation descriptor so the server only
+// returns matching records, and can also be evaluated client-side.
+//
+// Like Btrieve, terms are evaluated left to right without precedence:
+// a AND b OR c means (a AND b) OR c.
+//
+//	filter := xtrieve.NewFilter(schema).
+//	    Where("status", xtrieve.CmpEqual, "A").
+//	    And("balance", xtrieve.CmpGreater, 100.0)
+type Filter struct {
+	schema *Schema
+	terms  []filterTerm
+	err    error
+}
+
+type filterTerm struct {
+	field     Field
+	cmp       uint8
+	connector uint8
+	value     []byte
+}
+
+// NewFilter starts a filter over fields of schema
+func NewFilter(schema *Schema) *Filter {
+	return &Filter{schema: schema}
+}
+
+// Where adds the first comparison
+func (f *Filter) Where(field string, cmp uint8, value any) *Filter {
+	return f.add(connectorLast, field, cmp, value)
+}
+
+// And adds a comparison joined to the previous one with AND
+func (f *Filter) And(field string, cmp uint8, value any) *Filter {
+	return f.add(connectorAnd, field, cmp, value)
+}
+
+// Or adds a comparison joined to the previous one with OR
+func (f *Filter) Or(field string, cmp uint8, value any) *Filter {
+	return f.add(connectorOr, field, cmp, value)
+}
+
+// Err returns the first error encountered while building the filter
+func (f *Filter) Err() error {
+	return f.err
+}
+
+func (f *Filter) add(connector uint8, name string, cmp uint8, value any) *Filter {
+	if f.err != nil {
+		return f
+	}
+	if cmp < CmpEqual || cmp > CmpLessOrEqual {
+		f.err = fmt.Errorf("filter: invalid comparison %d", cmp)
+		return f
+	}
+	if (len(f.terms) == 0) != (connector == connectorLast) {
+		f.err = fmt.Errorf("filter: Where must start the filter and And/Or continue it")
+		return f
+	}
+
+	field, ok := f.schema.Field(name)
+	if !ok {
+		f.err = fmt.Errorf("filter: unknown field %s", name)
+		return f
+	}
+	if field.Bits > 0 {
+		// The server would compare the whole bytes, other flags included
+		f.err = fmt.Errorf("filter: bit field %s cannot be filtered", name)
+		return f
+	}
+
+	// Encode the value exactly as it is stored in the record
+	buf := make([]byte, field.Offset+field.Length)
+	if err := field.Encode(buf, value); err != nil {
+		f.err = fmt.Errorf("filter: %w", err)
+		return f
+	}
+
+	if len(f.terms) > 0 {
+		f.terms[len(f.terms)-1].connector = connector
+	}
+	f.terms = append(f.terms, filterTerm{
+		field: field,
+		cmp:   cmp,
+		value: buf[field.Offset:],
+	})
+	return f
+}
+
+// Match evaluates the filter against a record client-side
+func (f *Filter) Match(record []byte) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	if len(f.terms) == 0 {
+		return true, nil
+	}
+
+	result := false
+	connector := uint8(connectorLast)
+	for _, t := range f.terms {
+		b, err := t.field.bytes(record)
+		if err != nil {
+			return false, err
+		}
+		c, err := compareField(t.field, b, t.value)
+		if err != nil {
+			return false, fmt.Errorf("filter: %w", err)
+		}
+		ok := compareMatches(t.cmp, c)
+
+		switch connector {
+		case connectorLast:
+			result = ok
+		case connectorAnd:
+			result = result && ok
+		case connectorOr:
+			result = result || ok
+		}
+		connector = t.connector
+	}
+	return result, nil
+}
+
+// and returns a copy of f that also requires terms. Terms are evaluated
+// left to right, so the extra terms apply to the whole of f.
+func (f *Filter) and(terms ...filterTerm) *Filter {
+	g := &Filter{}
+	if f != nil {
+		g.schema, g.err = f.schema, f.err
+		g.terms = append(g.terms, f.terms...)
+	}
+	for _, t := range terms {
+		if len(g.terms) > 0 {
+			g.terms[len(g.terms)-1].connector = connectorAnd
+		}
+		t.connector = connectorLast
+		g.terms = append(g.terms, t)
+	}
+	return g
+}
+
+// zeroTerm requires field to be all zero bytes
+func zeroTerm(field Field) filterTerm {
+	return filterTerm{field: field, cmp: CmpEqual, value: make([]byte, field.Length)}
+}
+
+// compareField compares a field's stored bytes with a filter value. Dates,
+// times, packed and zoned numbers and BFLOAT do not order bytewise, so
+// they are compared by the values they decode to; other types compare as
+// key segments do.
+func compareField(field Field, a, b []byte) (int, error) {
+	switch field.Type {
+	case KeyTypeDate, KeyTypeTime, KeyTypeDecimal, KeyTypeMoney,
+		KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS, KeyTypeBfloat:
+	default:
+		return compareSegment(KeySpec{Type: field.Type, Length: uint16(field.Length)}, nil, a, b), nil
+	}
+	// Decode the bytes on their own; the null indicator lives elsewhere
+	field.Offset, field.Nullable = 0, false
+	x, err := field.Decode(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := field.Decode(b)
+	if err != nil {
+		return 0, err
+	}
+	switch x := x.(type) {
+	case time.Time:
+		return x.Compare(y.(time.Time)), nil
+	case time.Duration:
+		return cmp.Compare(x, y.(time.Duration)), nil
+	case int64:
+		return cmp.Compare(x, y.(int64)), nil
+	case float64:
+		return cmp.Compare(x, y.(float64)), nil
+	case FixedPoint:
+		return x.Cmp(y.(FixedPoint)), nil
+	}
+	// Undecodable lengths are returned raw
+	return bytes.Compare(a, b), nil
+}
+
+// compareMatches reports whether a comparison result satisfies an operator
+func compareMatches(op uint8, c int) bool {
+	switch op {
+	case CmpEqual:
+		return c == 0
+	case CmpGreater:
+		return c > 0
+	case CmpLess:
+		return c < 0
+	case CmpNotEqual:
+		return c != 0
+	case CmpGreaterOrEqual:
+		return c >= 0
+	case CmpLessOrEqual:
+		return c <= 0
+	}
+	return false
+}
+
+// appendDescriptor appends the filter part of an extended-operation
+// descriptor: reject count, term count, then each term as type, length,
+// offset, comparison, connector and value
+func (f *Filter) appendDescriptor(buf []byte, rejectCount uint16) ([]byte, error) {
+	if f != nil && f.err != nil {
+		return nil, f.err
+	}
+
+	var terms []filterTerm
+	if f != nil {
+		terms = f.terms
+	}
+	buf = binary.LittleEndian.AppendUint16(buf, rejectCount)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(terms)))
+	for _, t := range terms {
+		buf = append(buf, t.field.Type)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(t.field.Length))
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(t.field.Offset))
+		buf = append(buf, t.cmp, t.connector)
+		buf = append(buf, t.value...)
+	}
+	return buf, nil
+}
@@ -0,0 +1,266 @@
+package xtrieve
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxFixedPointScale is the largest scale a FixedPoint can have
+const MaxFixedPointScale = 18
+
+// ErrFixedPointOverflow is returned when a FixedPoint result does not fit
+// in 64 bits of units
+var ErrFixedPointOverflow = errors.New("fixed-point overflow")
+
+// ErrFixedPointPrecision is returned when a value has more decimal places
+// than the scale it is converted to; use Round to drop them deliberately
+var ErrFixedPointPrecision = errors.New("fixed-point value has more decimal places than its scale")
+
+// FixedPoint is an exact decimal number: a count of units of 10^-scale,
+// e.g. 1234 units at scale 2 is 12.34. Schema fields of type NUMERIC or
+// NUMERICSTS with a Scale decode to FixedPoint, so amounts such as cents
+// never pass through float64. The zero value is 0 at scale 0.
+//
+// Arithmetic never rounds silently: Add and Sub are exact, Mul and Div
+// round half away from zero to the receiver's scale, and every result that
+// overflows returns ErrFixedPointOverflow.
+type FixedPoint struct {
+	units int64
+	scale int
+}
+
+// NewFixedPoint returns units*10^-scale. It panics if scale is negative or
+// larger than MaxFixedPointScale.
+func NewFixedPoint(units int64, scale int) FixedPoint {
+	if scale < 0 || scale > MaxFixedPointScale {
+		panic(fmt.Sprintf("xtrieve: fixed-point scale %d out of range", scale))
+	}
+	return FixedPoint{units: units, scale: scale}
+}
+
+// FixedPointFromInt returns the whole number n at the given scale
+func FixedPointFromInt(n int64, scale int) (FixedPoint, error) {
+	return NewFixedPoint(n, 0).Rescale(scale)
+}
+
+// ParseFixedPoint parses a decimal such as "-12.34" at the given scale.
+// Decimal places beyond the scale are an ErrFixedPointPrecision error
+// unless they are zeros. A negative scale takes the number of decimal
+// places in s.
+func ParseFixedPoint(s string, scale int) (FixedPoint, error) {
+	text := strings.TrimSpace(s)
+	sign := ""
+	if len(text) > 0 && (text[0] == '-' || text[0] == '+') {
+		sign, text = text[:1], text[1:]
+	}
+	whole, frac, _ := strings.Cut(text, ".")
+	if whole == "" && frac == "" || !isDigits(whole) || !isDigits(frac) {
+		return FixedPoint{}, fmt.Errorf("invalid fixed-point number %q", s)
+	}
+	if scale < 0 {
+		scale = len(frac)
+	}
+	if scale > MaxFixedPointScale {
+		return FixedPoint{}, fmt.Errorf("fixed-point scale %d out of range", scale)
+	}
+	if len(frac) > scale {
+		if strings.TrimRight(frac[scale:], "0") != "" {
+			return FixedPoint{}, fmt.Errorf("%q at scale %d: %w", s, scale, ErrFixedPointPrecision)
+		}
+		frac = frac[:scale]
+	}
+	digits := whole + frac + strings.Repeat("0", scale-len(frac))
+	units, err := strconv.ParseInt(sign+digits, 10, 64)
+	if err != nil {
+		return FixedPoint{}, fmt.Errorf("%q: %w", s, ErrFixedPointOverflow)
+	}
+	return FixedPoint{units: units, scale: scale}, nil
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Units returns the value as a count of units of 10^-Scale
+func (x FixedPoint) Units() int64 {
+	return x.units
+}
+
+// Scale returns the number of decimal places
+func (x FixedPoint) Scale() int {
+	return x.scale
+}
+
+// Sign returns -1, 0 or 1 as x is negative, zero or positive
+func (x FixedPoint) Sign() int {
+	switch {
+	case x.units < 0:
+		return -1
+	case x.units > 0:
+		return 1
+	}
+	return 0
+}
+
+// String formats x with exactly Scale decimal places, e.g. "-12.30"
+func (x FixedPoint) String() string {
+	digits := strconv.FormatUint(uint64(max(x.units, -x.units)), 10)
+	if x.units == math.MinInt64 {
+		digits = "9223372036854775808"
+	}
+	if x.scale > 0 {
+		if len(digits) <= x.scale {
+			digits = strings.Repeat("0", x.scale-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-x.scale] + "." + digits[len(digits)-x.scale:]
+	}
+	if x.units < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Float64 returns the nearest float64, for display or statistics only
+func (x FixedPoint) Float64() float64 {
+	f, _ := x.Rat().Float64()
+	return f
+}
+
+// Rat returns x as an exact rational number
+func (x FixedPoint) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(big.NewInt(x.units), pow10(x.scale))
+}
+
+// Cmp compares x and y by value, whatever their scales, returning -1, 0
+// or 1
+func (x FixedPoint) Cmp(y FixedPoint) int {
+	s := max(x.scale, y.scale)
+	return x.big(s).Cmp(y.big(s))
+}
+
+// Add returns x+y at the larger of the two scales
+func (x FixedPoint) Add(y FixedPoint) (FixedPoint, error) {
+	s := max(x.scale, y.scale)
+	return fixedFromBig(new(big.Int).Add(x.big(s), y.big(s)), s)
+}
+
+// Sub returns x-y at the larger of the two scales
+func (x FixedPoint) Sub(y FixedPoint) (FixedPoint, error) {
+	s := max(x.scale, y.scale)
+	return fixedFromBig(new(big.Int).Sub(x.big(s), y.big(s)), s)
+}
+
+// MulInt returns x*n at x's scale, e.g. a unit price times a quantity
+func (x FixedPoint) MulInt(n int64) (FixedPoint, error) {
+	return fixedFromBig(new(big.Int).Mul(big.NewInt(x.units), big.NewInt(n)), x.scale)
+}
+
+// Mul returns x*y rounded half away from zero to x's scale, e.g. an
+// amount times a tax rate
+func (x FixedPoint) Mul(y FixedPoint) (FixedPoint, error) {
+	product := new(big.Int).Mul(big.NewInt(x.units), big.NewInt(y.units))
+	return fixedFromBig(roundQuo(product, pow10(y.scale)), x.scale)
+}
+
+// Div returns x/y rounded half away from zero to x's scale
+func (x FixedPoint) Div(y FixedPoint) (FixedPoint, error) {
+	if y.units == 0 {
+		return FixedPoint{}, errors.New("fixed-point division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(x.units), pow10(y.scale))
+	return fixedFromBig(roundQuo(n, big.NewInt(y.units)), x.scale)
+}
+
+// Rescale returns x at another scale. Lowering the scale fails with
+// ErrFixedPointPrecision unless the dropped places are zeros.
+func (x FixedPoint) Rescale(scale int) (FixedPoint, error) {
+	if scale < 0 || scale > MaxFixedPointScale {
+		return FixedPoint{}, fmt.Errorf("fixed-point scale %d out of range", scale)
+	}
+	if scale >= x.scale {
+		return fixedFromBig(x.big(scale), scale)
+	}
+	q, r := new(big.Int).QuoRem(big.NewInt(x.units), pow10(x.scale-scale), new(big.Int))
+	if r.Sign() != 0 {
+		return FixedPoint{}, fmt.Errorf("%s at scale %d: %w", x, scale, ErrFixedPointPrecision)
+	}
+	return fixedFromBig(q, scale)
+}
+
+// Round returns x rounded half away from zero to scale decimal places
+func (x FixedPoint) Round(scale int) (FixedPoint, error) {
+	if scale < 0 || scale > MaxFixedPointScale {
+		return FixedPoint{}, fmt.Errorf("fixed-point scale %d out of range", scale)
+	}
+	if scale >= x.scale {
+		return x.Rescale(scale)
+	}
+	return fixedFromBig(roundQuo(big.NewInt(x.units), pow10(x.scale-scale)), scale)
+}
+
+// MarshalJSON encodes x as a JSON number with Scale decimal places
+func (x FixedPoint) MarshalJSON() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string, keeping its decimal
+// places. null leaves x unchanged.
+func (x *FixedPoint) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	return x.UnmarshalText([]byte(strings.Trim(string(data), `"`)))
+}
+
+// MarshalText encodes x as String does
+func (x FixedPoint) MarshalText() ([]byte, error) {
+	return []byte(x.String()), nil
+}
+
+// UnmarshalText parses a decimal, keeping its decimal places
+func (x *FixedPoint) UnmarshalText(text []byte) error {
+	v, err := ParseFixedPoint(string(text), -1)
+	if err != nil {
+		return err
+	}
+	*x = v
+	return nil
+}
+
+// big returns x's units at a scale no lower than x's
+func (x FixedPoint) big(scale int) *big.Int {
+	return new(big.Int).Mul(big.NewInt(x.units), pow10(scale-x.scale))
+}
+
+func fixedFromBig(n *big.Int, scale int) (FixedPoint, error) {
+	if !n.IsInt64() {
+		return FixedPoint{}, ErrFixedPointOverflow
+	}
+	return FixedPoint{units: n.Int64(), scale: scale}, nil
+}
+
+// roundQuo returns n/d rounded half away from zero
+func roundQuo(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Abs(new(big.Int).Lsh(r, 1)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
@@ -0,0 +1,209 @@
+package xtrieve
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+// errInvalid marks test cases that fail with an error of their own
+var errInvalid = errors.New("invalid")
+
+func TestParseFixedPoint(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int
+		want  FixedPoint
+		err   error // nil for success, else the error wrapped or errInvalid
+	}{
+		{"12.34", 2, NewFixedPoint(1234, 2), nil},
+		{"-12.3", 2, NewFixedPoint(-1230, 2), nil},
+		{"+.5", 1, NewFixedPoint(5, 1), nil},
+		{"7.", 0, NewFixedPoint(7, 0), nil},
+		{" 1.2300 ", 2, NewFixedPoint(123, 2), nil},
+		{"1.25", -1, NewFixedPoint(125, 2), nil},
+		{"9223372036854775807", 0, NewFixedPoint(math.MaxInt64, 0), nil},
+		{"-92233720368547758.08", 2, NewFixedPoint(math.MinInt64, 2), nil},
+		{"1.234", 2, FixedPoint{}, ErrFixedPointPrecision},
+		{"9223372036854775808", 0, FixedPoint{}, ErrFixedPointOverflow},
+		{"92233720368547758.08", 2, FixedPoint{}, ErrFixedPointOverflow},
+		{"1", 19, FixedPoint{}, errInvalid},
+		{"", 2, FixedPoint{}, errInvalid},
+		{".", 2, FixedPoint{}, errInvalid},
+		{"1e3", 0, FixedPoint{}, errInvalid},
+		{"--1", 0, FixedPoint{}, errInvalid},
+		{"1.2.3", 2, FixedPoint{}, errInvalid},
+	}
+	for _, tt := range tests {
+		got, err := ParseFixedPoint(tt.in, tt.scale)
+		switch {
+		case tt.err == nil && (err != nil || got != tt.want):
+			t.Errorf("ParseFixedPoint(%q, %d) = %v, %v, want %v", tt.in, tt.scale, got, err, tt.want)
+		case tt.err != nil && err == nil:
+			t.Errorf("ParseFixedPoint(%q, %d) = %v, want an error", tt.in, tt.scale, got)
+		case tt.err != errInvalid:
+			if !errors.Is(err, tt.err) {
+				t.Errorf("ParseFixedPoint(%q, %d) = %v, want %v", tt.in, tt.scale, err, tt.err)
+			}
+		}
+	}
+}
+
+func TestFixedPointString(t *testing.T) {
+	tests := []struct {
+		x    FixedPoint
+		want string
+	}{
+		{FixedPoint{}, "0"},
+		{NewFixedPoint(0, 2), "0.00"},
+		{NewFixedPoint(5, 3), "0.005"},
+		{NewFixedPoint(-5, 3), "-0.005"},
+		{NewFixedPoint(123, 3), "0.123"},
+		{NewFixedPoint(-1230, 2), "-12.30"},
+		{NewFixedPoint(1, 18), "0.000000000000000001"},
+		{NewFixedPoint(math.MinInt64, 0), "-9223372036854775808"},
+		{NewFixedPoint(math.MinInt64, 4), "-922337203685477.5808"},
+		{NewFixedPoint(math.MaxInt64, 18), "9.223372036854775807"},
+	}
+	for _, tt := range tests {
+		if got := tt.x.String(); got != tt.want {
+			t.Errorf("String(%d at scale %d) = %q, want %q", tt.x.Units(), tt.x.Scale(), got, tt.want)
+		}
+		back, err := ParseFixedPoint(tt.want, tt.x.Scale())
+		if err != nil || back != tt.x {
+			t.Errorf("ParseFixedPoint(%q) = %v, %v, want the original", tt.want, back, err)
+		}
+	}
+}
+
+func TestFixedPointArithmetic(t *testing.T) {
+	fp := func(s string) FixedPoint {
+		x, err := ParseFixedPoint(s, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return x
+	}
+	tests := []struct {
+		op   string
+		x, y FixedPoint
+		want string
+	}{
+		// Half away from zero, whatever the signs
+		{"mul", fp("2.50"), fp("0.5"), "1.25"},
+		{"mul", fp("1.05"), fp("0.5"), "0.53"},
+		{"mul", fp("-1.05"), fp("0.5"), "-0.53"},
+		{"mul", fp("1.05"), fp("-0.5"), "-0.53"},
+		{"mul", fp("-1.05"), fp("-0.5"), "0.53"},
+		{"mul", fp("-1.04"), fp("0.5"), "-0.52"},
+		{"mul", fp("10.00"), fp("0.075"), "0.75"},
+		{"div", fp("1.00"), fp("3"), "0.33"},
+		{"div", fp("2.00"), fp("3"), "0.67"},
+		{"div", fp("-2.00"), fp("3"), "-0.67"},
+		{"div", fp("2.00"), fp("-3"), "-0.67"},
+		{"div", fp("-0.05"), fp("10"), "-0.01"},
+		{"div", fp("1"), fp("0.5"), "2"},
+		{"add", fp("1.5"), fp("-0.25"), "1.25"},
+		{"sub", fp("-1.5"), fp("0.25"), "-1.75"},
+	}
+	for _, tt := range tests {
+		var got FixedPoint
+		var err error
+		switch tt.op {
+		case "mul":
+			got, err = tt.x.Mul(tt.y)
+		case "div":
+			got, err = tt.x.Div(tt.y)
+		case "add":
+			got, err = tt.x.Add(tt.y)
+		case "sub":
+			got, err = tt.x.Sub(tt.y)
+		}
+		if err != nil || got.String() != tt.want {
+			t.Errorf("%v %s %v = %v, %v, want %s", tt.x, tt.op, tt.y, got, err, tt.want)
+		}
+	}
+
+	if _, err := fp("1").Div(fp("0.00")); err == nil {
+		t.Error("division by zero succeeded")
+	}
+	if _, err := NewFixedPoint(math.MaxInt64, 0).Add(NewFixedPoint(1, 0)); !errors.Is(err, ErrFixedPointOverflow) {
+		t.Errorf("MaxInt64+1 = %v, want ErrFixedPointOverflow", err)
+	}
+	if _, err := NewFixedPoint(math.MaxInt64/2+1, 0).MulInt(2); !errors.Is(err, ErrFixedPointOverflow) {
+		t.Errorf("MulInt overflow = %v, want ErrFixedPointOverflow", err)
+	}
+}
+
+func TestFixedPointRound(t *testing.T) {
+	tests := []struct {
+		x     FixedPoint
+		scale int
+		want  string
+	}{
+		{NewFixedPoint(1235, 3), 2, "1.24"},
+		{NewFixedPoint(-1235, 3), 2, "-1.24"},
+		{NewFixedPoint(1234, 3), 2, "1.23"},
+		{NewFixedPoint(-1234, 3), 2, "-1.23"},
+		{NewFixedPoint(-5, 1), 0, "-1"},
+		{NewFixedPoint(-4, 1), 0, "0"},
+		{NewFixedPoint(15, 1), 3, "1.500"},
+	}
+	for _, tt := range tests {
+		got, err := tt.x.Round(tt.scale)
+		if err != nil || got.String() != tt.want || got.Scale() != tt.scale {
+			t.Errorf("Round(%v, %d) = %v, %v, want %s", tt.x, tt.scale, got, err, tt.want)
+		}
+	}
+}
+
+func TestFixedPointRescale(t *testing.T) {
+	tests := []struct {
+		x     FixedPoint
+		scale int
+		want  string
+		err   error // as in TestParseFixedPoint
+	}{
+		{NewFixedPoint(1200, 3), 1, "1.2", nil},
+		{NewFixedPoint(-12, 1), 4, "-1.2000", nil},
+		{NewFixedPoint(1201, 3), 1, "", ErrFixedPointPrecision},
+		{NewFixedPoint(-5, 1), 0, "", ErrFixedPointPrecision},
+		{NewFixedPoint(math.MaxInt64, 0), 1, "", ErrFixedPointOverflow},
+		{NewFixedPoint(1, 0), 19, "", errInvalid},
+		{NewFixedPoint(1, 0), -1, "", errInvalid},
+	}
+	for _, tt := range tests {
+		got, err := tt.x.Rescale(tt.scale)
+		switch {
+		case tt.err == nil:
+			if err != nil || got.String() != tt.want {
+				t.Errorf("Rescale(%v, %d) = %v, %v, want %s", tt.x, tt.scale, got, err, tt.want)
+			}
+		case err == nil:
+			t.Errorf("Rescale(%v, %d) = %v, want an error", tt.x, tt.scale, got)
+		case tt.err != errInvalid:
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Rescale(%v, %d) = %v, want %v", tt.x, tt.scale, err, tt.err)
+			}
+		}
+	}
+}
+
+func TestFixedPointJSON(t *testing.T) {
+	var v struct {
+		Price FixedPoint
+		Tax   FixedPoint
+	}
+	v.Tax = NewFixedPoint(7, 0)
+	if err := json.Unmarshal([]byte(`{"Price": "12.50", "Tax": null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Price != NewFixedPoint(1250, 2) || v.Tax != NewFixedPoint(7, 0) {
+		t.Errorf("decoded %+v, want price 12.50 and tax unchanged", v)
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) != `{"Price":12.50,"Tax":7}` {
+		t.Errorf("Marshal = %s, %v", data, err)
+	}
+}
@@ -0,0 +1,157 @@
+package xtrieve
+
+import (
+	"context"
+	"sort"
+)
+
+// pipelineDepth bounds the number of requests written before reading their
+// responses, so neither side's socket buffers fill up
+const pipelineDepth = 32
+
+// GetResult is the outcome of one lookup made by GetMany
+type GetResult struct {
+	Key    []byte
+	Record []byte
+	Found  bool
+}
+
+// GetMany looks up a record for every key and returns the results in the
+// order of keys, with Found false for missing keys. The GetEqual requests
+// are pipelined, costing one round trip per batch instead of one per key,
+// and each runs through the client's interceptors, logging and statistics
+// under the file's context. Unlike GetEqual they are not repeated on a
+// Shadow. Afterwards the file is positioned on the last key found.
+func (f *File) GetMany(keys [][]byte, keyNumber int16) ([]GetResult, error) {
+	if f.replica != nil && !f.inTx {
+		f.onReplica = true
+		return f.replica.GetMany(keys, keyNumber)
+	}
+	if f.lease != nil && f.lease.expired() {
+		return nil, ErrLeaseExpired
+	}
+
+	results := make([]GetResult, 0, len(keys))
+	segments := f.KeySegments(keyNumber)
+
+	for start := 0; start < len(keys); start += pipelineDepth {
+		end := min(start+pipelineDepth, len(keys))
+
+		reqs := make([]*Request, 0, end-start)
+		for _, key := range keys[start:end] {
+			reqs = append(reqs, &Request{
+				Operation:     OpGetEqual,
+				PositionBlock: f.posBlock,
+				KeyBuffer:     FoldKey(segments, key),
+				KeyNumber:     keyNumber,
+			})
+		}
+
+		resps, errs := f.client.pipelineObserved(f.Context(), reqs)
+		for _, err := range errs {
+			if err != nil {
+				return nil, err
+			}
+		}
+		if f.lease != nil {
+			f.lease.renewed()
+		}
+
+		for i, resp := range resps {
+			result := GetResult{Key: keys[start+i]}
+			switch resp.StatusCode {
+			case StatusSuccess:
+				result.Record = resp.DataBuffer
+				result.Found = true
+				if hasFileRef(resp.PositionBlock) {
+					copy(f.posBlock, resp.PositionBlock)
+				}
+			case StatusKeyNotFound:
+			default:
+				return nil, &StatusError{Operation: OpGetEqual, Status: resp.StatusCode}
+			}
+			results = append(results, result)
+		}
+	}
+
+	return results, nil
+}
+
+// pipelineKey is the context key of a pipelineSlot
+type pipelineKey struct{}
+
+// pipelineSlot holds the place of one request of a pipelined exchange.
+// roundTrip parks the request in it instead of sending it alone, so the
+// request has been through the interceptors, logging and statistics when
+// it goes out with the others.
+type pipelineSlot struct {
+	i    int
+	park chan<- *pipelineSlot
+	req  *Request
+	resp *Response
+	done chan error
+	// used is set once the slot has been taken: a second round trip of
+	// the same request, e.g. a retry by an interceptor, goes alone
+	used bool
+}
+
+// wait parks req and waits for its response
+func (s *pipelineSlot) wait(ctx context.Context, req *Request, resp *Response) error {
+	s.used = true
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.req, s.resp = req, resp
+	s.park <- s
+	return <-s.done
+}
+
+// pipelineObserved runs each request through the interceptors, logging
+// and statistics as ExecuteContext does, and pipelines those that reach
+// the connection in their original order. Each request is timed over the
+// whole exchange, and its context only decides whether it is sent: the
+// exchange runs under the bulk timeout. errs holds each request's error.
+func (c *Client) pipelineObserved(ctx context.Context, reqs []*Request) (resps []*Response, errs []error) {
+	resps = make([]*Response, len(reqs))
+	errs = make([]error, len(reqs))
+	park := make(chan *pipelineSlot, len(reqs))
+	finished := make(chan struct{}, len(reqs))
+	for i, req := range reqs {
+		resps[i] = &Response{}
+		slot := &pipelineSlot{i: i, park: park, done: make(chan error, 1)}
+		go func(i int, req *Request) {
+			errs[i] = c.executeInto(context.WithValue(ctx, pipelineKey{}, slot), req, resps[i])
+			finished <- struct{}{}
+		}(i, req)
+	}
+
+	// A parked request waits for its response, so every request has
+	// either parked or ended without reaching the connection
+	var parked []*pipelineSlot
+	for ended := 0; len(parked)+ended < len(reqs); {
+		select {
+		case slot := <-park:
+			parked = append(parked, slot)
+		case <-finished:
+			ended++
+		}
+	}
+	if len(parked) > 0 {
+		sort.Slice(parked, func(a, b int) bool { return parked[a].i < parked[b].i })
+		sent := make([]*Request, len(parked))
+		for j, slot := range parked {
+			sent[j] = slot.req
+		}
+		got, err := c.pipeline(sent)
+		for j, slot := range parked {
+			if err == nil {
+				*slot.resp = *got[j]
+			}
+			slot.done <- err
+		}
+	}
+	for range parked {
+		<-finished
+	}
+	return resps, errs
+}
@@ -0,0 +1,82 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// opCount counts the operations an interceptor saw and refuses refuse
+type opCount struct {
+	mu     sync.Mutex
+	seen   map[uint16]int
+	refuse uint16
+}
+
+var errRefused = errors.New("refused")
+
+func (o *opCount) intercept(ctx context.Context, req *Request, resp *Response, next Handler) error {
+	o.mu.Lock()
+	o.seen[req.Operation]++
+	o.mu.Unlock()
+	if req.Operation == o.refuse {
+		return errRefused
+	}
+	return next(ctx, req, resp)
+}
+
+func TestGetManyIntercepted(t *testing.T) {
+	c := fakeServer(t, 8, 4)
+	count := &opCount{seen: make(map[uint16]int)}
+	c.Use(count.intercept)
+	f := &File{client: c, posBlock: make([]byte, PositionBlockSize), scratch: make([]byte, PositionBlockSize)}
+
+	keys := make([][]byte, pipelineDepth+1)
+	for i := range keys {
+		keys[i] = le32(int32(i))
+	}
+	results, err := f.GetMany(keys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(keys) || !results[len(keys)-1].Found {
+		t.Fatalf("%d results, last %+v", len(results), results[len(results)-1])
+	}
+	if n := count.seen[OpGetEqual]; n != len(keys) {
+		t.Errorf("interceptor saw %d lookups, want %d", n, len(keys))
+	}
+	if n := c.Stats().Ops[OpName(OpGetEqual)].Calls; n != uint64(len(keys)) {
+		t.Errorf("statistics count %d lookups, want %d", n, len(keys))
+	}
+
+	f.lease = &lease{ttl: time.Hour, last: time.Now(), lapsed: true, done: make(chan struct{})}
+	if _, err := f.GetMany(keys, 0); !errors.Is(err, ErrLeaseExpired) {
+		t.Errorf("GetMany on an expired lease = %v, want ErrLeaseExpired", err)
+	}
+	if n := count.seen[OpGetEqual]; n != len(keys) {
+		t.Errorf("an expired lease sent %d lookups", n-len(keys))
+	}
+}
+
+func TestPipelineCanceled(t *testing.T) {
+	c := fakeServer(t, 8, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resps, errs := c.pipelineObserved(ctx, []*Request{{Operation: OpStepNext}, {Operation: OpStepNext}})
+	for i, err := range errs {
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("request %d: %v, want context.Canceled", i, err)
+		}
+	}
+	if len(resps) != 2 {
+		t.Errorf("%d responses, want 2", len(resps))
+	}
+
+	// The connection is still in step after requests that were not sent
+	resps, errs = c.pipelineObserved(context.Background(), []*Request{{Operation: OpStepNext}})
+	if errs[0] != nil || resps[0].StatusCode != StatusSuccess {
+		t.Errorf("after cancellation: %+v, %v", resps[0], errs[0])
+	}
+}
@@ -0,0 +1,76 @@
+package xtrieve
+
+// FileHook runs client-side around the writes of a File, like a trigger.
+// op is OpInsert, OpUpdate or OpDelete and record the record written, nil
+// for a delete. A hook registered with Before may change the record in
+// place, e.g. to maintain a denormalized field, and stops the write by
+// returning an error.
+//
+// Hooks run on the file's connection between the caller's operations, so
+// writes a hook makes to files on the same connection (such as the files
+// of a Pool.WithTransaction) belong to the caller's transaction. An error
+// from an After hook is returned once the write is done; in a
+// transaction, aborting undoes both. f.Context() is the caller's context,
+// see File.SetContext.
+type FileHook func(f *File, op uint16, record []byte) error
+
+// TableHook runs client-side around the writes of a Table with the field
+// values passed to Insert, Update or Delete. A hook registered with Before
+// may change the values, which Update and Delete then use to find the
+// record. Deleting from a table with a soft-delete field runs the delete
+// hooks, not the update ones. t.File.Context() is the caller's context,
+// see Table.SetContext.
+type TableHook func(t *Table, op uint16, values map[string]any) error
+
+// Before registers a hook run before every Insert, Update and Delete of
+// the file, after the hooks already registered
+func (f *File) Before(hook FileHook) {
+	f.before = append(f.before, hook)
+}
+
+// After registers a hook run after every successful Insert, Update and
+// Delete of the file
+func (f *File) After(hook FileHook) {
+	f.after = append(f.after, hook)
+}
+
+// runHooks runs hooks in order, stopping at the first error
+func (f *File) runHooks(hooks []FileHook, op uint16, record []byte) error {
+	for _, hook := range hooks {
+		if err := hook(f, op, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Before registers a hook run before every Insert, Update and Delete of
+// the table, after the hooks already registered. The hooks of the table's
+// File run as well, when the record is written.
+func (t *Table) Before(hook TableHook) {
+	t.before = append(t.before, hook)
+}
+
+// After registers a hook run after every successful Insert, Update and
+// Delete of the table
+func (t *Table) After(hook TableHook) {
+	t.after = append(t.after, hook)
+}
+
+// withHooks runs write between the table's hooks for op
+func (t *Table) withHooks(op uint16, values map[string]any, write func() error) error {
+	for _, hook := range t.before {
+		if err := hook(t, op, values); err != nil {
+			return err
+		}
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	for _, hook := range t.after {
+		if err := hook(t, op, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
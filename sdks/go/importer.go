@@ -0,0 +1,184 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Importer applies a stream of records to a file in parallel. Records are
+// sharded by their value of a unique key, so all records of one key go to
+// the same worker and are applied in the order they arrive, while other
+// keys proceed in parallel. Each worker applies its records in
+// transactions of BatchSize records; a record whose key already exists
+// replaces the stored one.
+//
+//	im := &xtrieve.Importer{
+//	    Open:    func() (*xtrieve.File, error) { return pool.OpenFile("accounts.dat", 0) },
+//	    Workers: 4, // the pool needs ConnsPerServer >= 4
+//	}
+//	n, err := im.Run(ctx, next) // next returns io.EOF after the last record
+type Importer struct {
+	// Open opens the file for one worker. Transactions belong to a
+	// connection, so every call must return a file on a connection of its
+	// own, e.g. through a pool whose ConnsPerServer is at least Workers.
+	Open func() (*File, error)
+	// KeyNumber is the unique key records are sharded and matched by
+	KeyNumber int16
+	// Workers is the number of parallel workers (default 4)
+	Workers int
+	// BatchSize is the number of records per transaction (default 100)
+	BatchSize int
+	// Progress, if set, receives progress reports as batches commit.
+	// Total, if known, is the expected record count.
+	Progress Progress
+	Total    int64
+}
+
+// importBatch is a worker's open transaction
+type importBatch struct {
+	records int
+	bytes   int
+}
+
+// Run applies the records returned by next until it returns io.EOF and
+// returns the number of records committed. The first failure rolls back
+// the open transaction of every worker and stops the import; batches
+// already committed stay in the file.
+func (im *Importer) Run(ctx context.Context, next func() ([]byte, error)) (int, error) {
+	if im.Open == nil {
+		return 0, errors.New("xtrieve: Importer needs Open")
+	}
+	segments, err := im.segments()
+	if err != nil {
+		return 0, err
+	}
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	workers := im.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+
+	var mu sync.Mutex
+	tracker := newProgressTracker(im.Progress, im.Total)
+	committed := 0
+	batches := make(map[*File]*importBatch)
+
+	// commit ends a worker's transaction, or rolls it back if failed
+	commit := func(f *File, failed bool) error {
+		mu.Lock()
+		b := batches[f]
+		delete(batches, f)
+		mu.Unlock()
+		if b == nil {
+			return nil
+		}
+		if failed {
+			f.AbortTransaction()
+			return nil
+		}
+		resp, err := f.EndTransaction()
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(OpEndTransaction, resp); err != nil {
+			return err
+		}
+		mu.Lock()
+		committed += b.records
+		tracker.add(b.records, b.bytes)
+		mu.Unlock()
+		return nil
+	}
+
+	g := newWorkGroup(ctx, workers, im.Open, commit)
+	for {
+		record, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			g.fail(err)
+			break
+		}
+		record = bytes.Clone(record)
+		key := FoldKey(segments, ExtractKey(segments, record))
+		err = g.GoOrdered(key, func(f *File) error {
+			mu.Lock()
+			b := batches[f]
+			mu.Unlock()
+			if b == nil {
+				resp, err := f.BeginTransaction(LockNone)
+				if err != nil {
+					return err
+				}
+				if err := checkStatus(OpBeginTransaction, resp); err != nil {
+					return err
+				}
+				b = &importBatch{}
+				mu.Lock()
+				batches[f] = b
+				mu.Unlock()
+			}
+			if err := im.apply(f, key, record); err != nil {
+				return err
+			}
+			b.records++
+			b.bytes += len(record)
+			if b.records >= batchSize {
+				return commit(f, false)
+			}
+			return nil
+		})
+		if err != nil {
+			break
+		}
+	}
+	err = g.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	tracker.done()
+	return committed, err
+}
+
+// segments reads the key's segments from a file opened for the purpose
+func (im *Importer) segments() ([]KeySpec, error) {
+	f, err := im.Open()
+	if err != nil {
+		return nil, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+	segments := f.KeySegments(im.KeyNumber)
+	if segments == nil {
+		return nil, fmt.Errorf("xtrieve: file has no key %d", im.KeyNumber)
+	}
+	return segments, nil
+}
+
+// apply inserts record, or replaces the stored record with the same key
+func (im *Importer) apply(f *File, key, record []byte) error {
+	resp, err := f.Insert(record)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != StatusDuplicateKey {
+		return checkStatus(OpInsert, resp)
+	}
+	if resp, err = f.GetEqual(key, im.KeyNumber); err != nil {
+		return err
+	}
+	if err := checkStatus(OpGetEqual, resp); err != nil {
+		return err
+	}
+	if resp, err = f.Update(record, im.KeyNumber); err != nil {
+		return err
+	}
+	return checkStatus(OpUpdate, resp)
+}
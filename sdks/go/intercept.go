@@ -0,0 +1,42 @@
+package xtrieve
+
+import "context"
+
+// Handler runs an operation under ctx, decoding the response into resp
+type Handler func(ctx context.Context, req *Request, resp *Response) error
+
+// Interceptor wraps every operation of a client, for cross-cutting code
+// such as tracing, metrics or authorization. It receives the caller's
+// context, that of ExecuteContext or File.SetContext, and runs the
+// operation by calling next, possibly with a derived context; returning
+// without calling next refuses the operation. resp is only filled once
+// next returns.
+//
+//	client.Use(func(ctx context.Context, req *xtrieve.Request, resp *xtrieve.Response, next xtrieve.Handler) error {
+//	    ctx, span := tracer.Start(ctx, xtrieve.OpName(req.Operation))
+//	    defer span.End()
+//	    return next(ctx, req, resp)
+//	})
+//
+// Interceptors run around the client's logging and statistics. They also
+// run for each request of a Batch or File.GetMany, which are then sent
+// together: next returns once the whole pipeline has been answered, so an
+// interceptor must not hold a lock across next that the other requests of
+// the pipeline need.
+type Interceptor func(ctx context.Context, req *Request, resp *Response, next Handler) error
+
+// Use adds interceptors to the client, outermost first, after those
+// already added. Call it before the client is used.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.interceptors = append(c.interceptors, interceptors...)
+}
+
+// intercept runs a request through the interceptors from the i-th on
+func (c *Client) intercept(ctx context.Context, req *Request, resp *Response, i int) error {
+	if i == len(c.interceptors) {
+		return c.observe(ctx, req, resp)
+	}
+	return c.interceptors[i](ctx, req, resp, func(ctx context.Context, req *Request, resp *Response) error {
+		return c.intercept(ctx, req, resp, i+1)
+	})
+}
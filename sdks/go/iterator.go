@@ -0,0 +1,458 @@
+package xtrieve
+
+import (
+	"errors"
+	"time"
+)
+
+// defaultExtendedBatch is the number of records requested per extended get
+const defaultExtendedBatch = 100
+
+// extendedRecordOverhead is the length and position preceding each record
+// of an extended response
+const extendedRecordOverhead = 6
+
+// ResumePolicy controls how an Iterator recovers from a lost connection.
+// On a transport error the iterator reconnects the client, reopens the file
+// and continues with GetGreater on the last key it returned.
+//
+// Resuming by key cannot tell apart records sharing a duplicate key: any
+// duplicates of the last key that were not yet returned are skipped.
+type ResumePolicy struct {
+	// MaxAttempts is the number of reconnect attempts per failure
+	MaxAttempts int
+	// Delay is the wait before each reconnect attempt
+	Delay time.Duration
+	// OnResume, if set, is called before each attempt
+	OnResume func(attempt int, err error)
+}
+
+// Iterator walks the records of a file in key order
+//
+//	it := f.Scan(0)
+//	for it.Next() {
+//	    process(it.Record())
+//	}
+//	if err := it.Err(); err != nil { ... }
+type Iterator struct {
+	file      *File
+	keyNumber int16
+	resume    *ResumePolicy
+	from, to  []byte
+	filter    *Filter
+	extract   []Extractor
+	// deleted is the soft-delete field of a Table scan; records with it
+	// set are skipped unless IncludeDeleted is called
+	deleted *Field
+	// matchers, added by Match, are applied client-side to whole records
+	matchers []*Matcher
+	active   *Filter
+	// equal positions with Get Equal on from instead of Get Greater or
+	// Equal, for GetAllEqual
+	equal bool
+	// prefix, set by Prefix on a collated key, ends the scan at the first
+	// key not starting with it under the collation
+	prefix []byte
+	// physical walks the file in physical order with Step operations
+	physical bool
+	// batch is the number of records per extended operation, 0 for the
+	// default
+	batch int
+
+	// extended is cleared when the server rejects extended operations,
+	// after which filter and projection are applied client-side
+	extended bool
+
+	// scans is the client whose scan slot the iterator holds, and
+	// maxRecords and returned enforce its record budget
+	scans      *Client
+	maxRecords int
+	returned   int
+
+	started bool
+	done    bool
+	pending []iterRecord
+	record  []byte
+	key     []byte
+	lastKey []byte
+	err     error
+}
+
+type iterRecord struct {
+	record []byte
+	key    []byte
+	// extended records were already filtered and projected by the server
+	extended bool
+}
+
+// Scan returns an iterator over all records in the order of keyNumber
+func (f *File) Scan(keyNumber int16) *Iterator {
+	return &Iterator{file: f, keyNumber: keyNumber}
+}
+
+// ScanPhysical returns an iterator over all records in physical order,
+// the fastest way to read a whole file: Step Next Extended fetches as
+// many records as fit in one response without walking an index. Records
+// have no key, and WithResume does not apply.
+func (f *File) ScanPhysical() *Iterator {
+	return &Iterator{file: f, physical: true, extended: true}
+}
+
+// Range returns an iterator over the records whose key lies between from
+// and to, both inclusive. A nil bound leaves that end of the range open.
+// Keys are compared with the file's key definition, as the server does,
+// and records are returned in index order: on a descending key the larger
+// bound comes first, whichever way round the bounds are given.
+func (f *File) Range(keyNumber int16, from, to []byte) *Iterator {
+	from, to = rangeBounds(f.KeySegments(keyNumber), f.Collation(keyNumber), from, to)
+	return &Iterator{file: f, keyNumber: keyNumber, from: from, to: to}
+}
+
+// GetAllEqual returns an iterator over every record whose key equals key,
+// in the order the server keeps the duplicates (insertion order for both
+// linked and repeating duplicates). The iterator positions with Get Equal
+// and follows Get Next until a key compares different under the key's
+// definition, so padded, case-insensitive and descending keys end where
+// the server's duplicate group ends rather than on a bytewise mismatch.
+func (f *File) GetAllEqual(key []byte, keyNumber int16) *Iterator {
+	return &Iterator{file: f, keyNumber: keyNumber, from: key, to: key, equal: true}
+}
+
+// WithResume enables reconnecting and resuming after connection loss
+func (it *Iterator) WithResume(policy ResumePolicy) *Iterator {
+	it.resume = &policy
+	return it
+}
+
+// Where restricts the iterator to records matching filter. The filter is
+// sent to the server with Get Next Extended so only matching records cross
+// the network; servers without extended operations fall back to filtering
+// client-side.
+func (it *Iterator) Where(filter *Filter) *Iterator {
+	it.filter = filter
+	it.extended = true
+	it.compileFilter()
+	return it
+}
+
+// IncludeDeleted makes an iterator over a Table return soft-deleted
+// records too
+func (it *Iterator) IncludeDeleted() *Iterator {
+	it.deleted = nil
+	it.compileFilter()
+	return it
+}
+
+// compileFilter combines the caller's filter with the soft-delete check
+// and the terms of the matcher
+func (it *Iterator) compileFilter() {
+	it.active = it.filter
+	var terms []filterTerm
+	if it.deleted != nil {
+		terms = append(terms, zeroTerm(*it.deleted))
+	}
+	for _, m := range it.matchers {
+		terms = append(terms, m.terms...)
+	}
+	if len(terms) > 0 {
+		it.active = it.filter.and(terms...)
+		it.extended = true
+	}
+}
+
+// Select restricts each returned record to the given byte ranges,
+// concatenated in order, using the extended-operation extractor so only
+// those bytes cross the network
+func (it *Iterator) Select(extract ...Extractor) *Iterator {
+	it.extract = extract
+	it.extended = true
+	return it
+}
+
+// Batch sets the number of records fetched per extended operation. The
+// default is 100 in key order, and in physical order as many as fit in
+// a 64 KB response.
+func (it *Iterator) Batch(n int) *Iterator {
+	it.batch = n
+	return it
+}
+
+// Next advances to the next record and reports whether one is available
+func (it *Iterator) Next() bool {
+	for {
+		for len(it.pending) > 0 {
+			r := it.pending[0]
+			it.pending = it.pending[1:]
+
+			if it.to != nil && it.file.CompareKeys(it.keyNumber, r.key, it.to) > 0 ||
+				it.prefix != nil && it.file.CompareKeys(it.keyNumber, sliceRange(r.key, 0, len(it.prefix)), it.prefix) != 0 {
+				it.finish(nil)
+				return false
+			}
+			it.lastKey = append(it.lastKey[:0], r.key...)
+			if !r.extended {
+				if it.active != nil {
+					ok, err := it.active.Match(r.record)
+					if err != nil {
+						it.finish(err)
+						return false
+					}
+					if !ok {
+						continue
+					}
+				}
+			}
+			ok, err := it.matches(r.record)
+			if err != nil {
+				it.finish(err)
+				return false
+			}
+			if !ok {
+				continue
+			}
+			if it.extract != nil && (!r.extended || it.matchers != nil) {
+				r.record = project(r.record, it.extract)
+			}
+			if it.maxRecords > 0 && it.returned >= it.maxRecords {
+				it.finish(&BudgetError{Limit: BudgetScanRecords, Max: it.maxRecords, Value: it.returned + 1})
+				return false
+			}
+			it.returned++
+			it.record, it.key = r.record, r.key
+			return true
+		}
+
+		if it.done {
+			it.release()
+			return false
+		}
+		err := it.fill()
+		if err != nil && it.resume != nil && !it.physical && !isStatusError(err) && !errors.Is(err, ErrBudgetExceeded) {
+			err = it.recover(err)
+		}
+		if err != nil {
+			it.finish(err)
+			return false
+		}
+	}
+}
+
+// Record returns the current record
+func (it *Iterator) Record() []byte {
+	return it.record
+}
+
+// Key returns the key of the current record
+func (it *Iterator) Key() []byte {
+	return it.key
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Close ends the iteration early, giving back its slot of the client's
+// MaxConcurrentScans. Iterators that run to their end or fail give it back
+// by themselves.
+func (it *Iterator) Close() {
+	it.done = true
+	it.pending = nil
+	it.release()
+}
+
+func (it *Iterator) finish(err error) {
+	it.err = err
+	it.done = true
+	it.pending = nil
+	it.release()
+}
+
+// release gives back the iterator's scan slot, if it holds one
+func (it *Iterator) release() {
+	if it.scans != nil {
+		it.scans.releaseScan()
+		it.scans = nil
+	}
+}
+
+// fill fetches the next record, or the next batch of matching records when
+// an extended filter is in use
+func (it *Iterator) fill() error {
+	if !it.started {
+		if it.scans == nil {
+			// Not when restarting after a lost connection
+			maxRecords, err := it.file.client.acquireScan()
+			if err != nil {
+				return err
+			}
+			it.scans, it.maxRecords = it.file.client, maxRecords
+		}
+		it.started = true
+		if it.physical {
+			return it.single(it.file.StepFirst())
+		}
+		if it.equal {
+			return it.single(it.file.GetEqual(it.from, it.keyNumber))
+		}
+		if it.from != nil {
+			return it.single(it.file.Get(OpGetGreaterOrEqual, it.from, it.keyNumber))
+		}
+		return it.single(it.file.GetFirst(it.keyNumber))
+	}
+
+	if !it.extended {
+		return it.single(it.next())
+	}
+
+	// Extract the selected ranges (or the whole record) followed by the
+	// key segments, which are needed for range checks and resuming
+	extract := it.extract
+	if extract == nil || it.matchers != nil {
+		// Matchers need the whole record; it is projected client-side
+		extract = []Extractor{{Offset: 0, Length: uint16(it.file.recordLength)}}
+	}
+	width := extractWidth(extract)
+	if !it.physical {
+		for _, seg := range it.file.KeySegments(it.keyNumber) {
+			extract = append(extract[:len(extract):len(extract)], Extractor{Offset: seg.Position, Length: seg.Length})
+		}
+	}
+
+	descriptor, err := BuildExtendedDescriptor(it.active, 0, it.batchSize(extractWidth(extract)), extract)
+	if err != nil {
+		return err
+	}
+	op := uint16(OpGetNextExtended)
+	var resp *Response
+	var records []ExtendedRecord
+	if it.physical {
+		op = OpStepNextExtended
+		resp, records, err = it.file.StepNextExtended(descriptor)
+	} else {
+		resp, records, err = it.file.GetNextExtended(it.keyNumber, descriptor)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch resp.StatusCode {
+	case StatusInvalidOperation:
+		// No extended operations on this server: filter and project
+		// client-side
+		it.extended = false
+		return it.single(it.next())
+	case StatusSuccess, StatusRejectCountReached, StatusFilterLimitReached:
+	case StatusEndOfFile:
+		it.done = true
+	default:
+		return &StatusError{Operation: op, Status: resp.StatusCode}
+	}
+
+	for _, r := range records {
+		if len(r.Data) < width {
+			return errors.New("extended record shorter than its extractors")
+		}
+		it.pending = append(it.pending, iterRecord{
+			record:   r.Data[:width:width],
+			key:      r.Data[width:],
+			extended: true,
+		})
+	}
+	return nil
+}
+
+// next fetches the record after the current one without extended
+// operations
+func (it *Iterator) next() (*Response, error) {
+	if it.physical {
+		return it.file.StepNext()
+	}
+	return it.file.GetNext(it.keyNumber)
+}
+
+// batchSize is the number of records to request per extended operation
+// for records of width bytes, within the client's operation budget
+func (it *Iterator) batchSize(width int) uint16 {
+	n := defaultExtendedBatch
+	switch {
+	case it.batch > 0:
+		n = min(it.batch, maxDescriptorSize)
+	case it.physical:
+		n = max(1, (maxDescriptorSize-2)/(width+extendedRecordOverhead))
+	}
+	if limit := it.file.client.Budget().MaxOperationBytes; limit > 0 {
+		n = min(n, max(1, (limit-2)/(width+extendedRecordOverhead)))
+	}
+	return uint16(n)
+}
+
+// project concatenates the selected byte ranges of a record
+func project(record []byte, extract []Extractor) []byte {
+	out := make([]byte, 0, extractWidth(extract))
+	for _, e := range extract {
+		part := sliceRange(record, int(e.Offset), int(e.Offset)+int(e.Length))
+		out = append(out, part...)
+		for i := len(part); i < int(e.Length); i++ {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+// extractWidth is the length of a record made of the given ranges
+func extractWidth(extract []Extractor) int {
+	n := 0
+	for _, e := range extract {
+		n += int(e.Length)
+	}
+	return n
+}
+
+// single queues the record of a positioning or GetNext response
+func (it *Iterator) single(resp *Response, err error) error {
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case StatusSuccess:
+		it.pending = append(it.pending, iterRecord{record: resp.DataBuffer, key: resp.KeyBuffer})
+	case StatusEndOfFile, StatusKeyNotFound:
+		it.done = true
+	default:
+		return &StatusError{Operation: OpGetNext, Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// recover reconnects, reopens the file and repositions after the last key
+func (it *Iterator) recover(cause error) error {
+	err := cause
+	for attempt := 1; attempt <= it.resume.MaxAttempts; attempt++ {
+		if it.resume.OnResume != nil {
+			it.resume.OnResume(attempt, err)
+		}
+		if it.resume.Delay > 0 {
+			time.Sleep(it.resume.Delay)
+		}
+
+		if err = it.file.reconnect(); err != nil {
+			continue
+		}
+		if err = it.file.Reopen(); err != nil {
+			continue
+		}
+
+		it.pending = nil
+		if it.lastKey == nil {
+			it.started = false
+			err = it.fill()
+		} else {
+			err = it.single(it.file.Get(OpGetGreater, it.lastKey, it.keyNumber))
+		}
+		if err == nil || isStatusError(err) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,124 @@
+package xtrieve
+
+import (
+	"errors"
+)
+
+const defaultJoinBatchSize = 64
+
+// Join looks up the detail record for every record of a driving (master)
+// iterator and hands the combined, typed result to a callback.
+//
+//	j := &xtrieve.Join[Order]{
+//	    Detail:     customers,
+//	    KeyNumber:  0,
+//	    ForeignKey: func(order []byte) []byte { return order[8:16] },
+//	    Combine:    decodeOrder,
+//	}
+//	err := j.Run(orders.Scan(0), func(o Order) error { ... })
+type Join[T any] struct {
+	// Detail is the file searched for matching records
+	Detail *File
+	// KeyNumber is the detail file key the foreign key is matched against
+	KeyNumber int16
+	// ForeignKey extracts the lookup key from a master record
+	ForeignKey func(master []byte) []byte
+	// Combine builds the result; detail is nil when no record matched
+	Combine func(master, detail []byte) (T, error)
+	// Inner drops master records without a matching detail record
+	Inner bool
+	// BatchSize is the number of master records whose lookups are
+	// de-duplicated together (default 64)
+	BatchSize int
+	// CacheSize keeps up to this many detail lookups across batches;
+	// zero disables caching
+	CacheSize int
+
+	cache map[string][]byte
+}
+
+// Run drives the join over master and calls fn for each combined result
+func (j *Join[T]) Run(master RecordIterator, fn func(T) error) error {
+	if j.Detail == nil || j.ForeignKey == nil || j.Combine == nil {
+		return errors.New("join needs Detail, ForeignKey and Combine")
+	}
+	batchSize := j.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultJoinBatchSize
+	}
+
+	batch := make([][]byte, 0, batchSize)
+	for master.Next() {
+		batch = append(batch, master.Record())
+		if len(batch) == batchSize {
+			if err := j.flush(batch, fn); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := master.Err(); err != nil {
+		return err
+	}
+	return j.flush(batch, fn)
+}
+
+// flush resolves the foreign keys of a batch, each distinct key once, and
+// emits the results in master order
+func (j *Join[T]) flush(batch [][]byte, fn func(T) error) error {
+	found := make(map[string][]byte, len(batch))
+	for _, rec := range batch {
+		key := string(j.ForeignKey(rec))
+		if _, ok := found[key]; ok {
+			continue
+		}
+		detail, err := j.lookup(key)
+		if err != nil {
+			return err
+		}
+		found[key] = detail
+	}
+
+	for _, rec := range batch {
+		detail := found[string(j.ForeignKey(rec))]
+		if detail == nil && j.Inner {
+			continue
+		}
+		result, err := j.Combine(rec, detail)
+		if err != nil {
+			return err
+		}
+		if err := fn(result); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup fetches a detail record by key, consulting the cache first
+func (j *Join[T]) lookup(key string) ([]byte, error) {
+	if detail, ok := j.cache[key]; ok {
+		return detail, nil
+	}
+
+	resp, err := j.Detail.GetEqual([]byte(key), j.KeyNumber)
+	if err != nil {
+		return nil, err
+	}
+	var detail []byte
+	switch resp.StatusCode {
+	case StatusSuccess:
+		detail = resp.DataBuffer
+	case StatusKeyNotFound:
+	default:
+		return nil, &StatusError{Operation: OpGetEqual, Status: resp.StatusCode}
+	}
+
+	if j.CacheSize > 0 {
+		if j.cache == nil || len(j.cache) >= j.CacheSize {
+			j.cache = make(map[string][]byte, j.CacheSize)
+		}
+		j.cache[key] = detail
+	}
+	return detail, nil
+}
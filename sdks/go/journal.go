@@ -0,0 +1,452 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Journal operations
+const (
+	JournalInsert = "insert"
+	JournalUpdate = "update"
+	JournalDelete = "delete"
+)
+
+// JournalEntry is one intended mutation recorded in a Journal. Records are
+// identified by their value of a unique key, so that replaying an entry
+// can tell whether it was applied.
+type JournalEntry struct {
+	Seq       uint64 `json:"seq"`
+	Op        string `json:"op,omitempty"`
+	File      string `json:"file,omitempty"`
+	KeyNumber int16  `json:"key_number,omitempty"`
+	Key       []byte `json:"key,omitempty"`
+	Data      []byte `json:"data,omitempty"`
+	// Token is the idempotency token of an InsertOnce or UpdateOnce
+	Token string `json:"token,omitempty"`
+	// Done marks the completion of the entry with the same Seq, and
+	// Failed, with it, that the server rejected the operation
+	Done   bool `json:"done,omitempty"`
+	Failed bool `json:"failed,omitempty"`
+}
+
+// ErrTokenReused is returned when an idempotency token is used again for
+// a different write
+var ErrTokenReused = errors.New("xtrieve: idempotency token reused for a different write")
+
+// Journal is a client-side write-ahead log of mutations. Each journaled
+// operation is appended to the journal before it is sent and marked done
+// after the server confirmed it. After a crash, Replay checks every entry
+// that was not marked done against the file and applies the ones that did
+// not reach it, so a batch restarted from the journal applies each
+// mutation exactly once.
+//
+//	j, err := xtrieve.OpenJournal("batch.journal")
+//	defer j.Close()
+//	if _, err := j.Replay(ctx, open); err != nil { ... } // finish last run
+//	for _, rec := range batch {
+//	    if err := j.Insert(f, 0, rec); err != nil { ... }
+//	}
+//	j.Reset() // batch complete
+type Journal struct {
+	// NoSync skips the fsync after each append. It is faster, but entries
+	// may be lost when the machine (not just the process) crashes.
+	NoSync bool
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	seq  uint64
+	// tokens holds the latest write under each idempotency token, also
+	// by sequence number
+	tokens map[string]*tokenState
+	bySeq  map[uint64]*tokenState
+}
+
+// tokenState is a write journaled under an idempotency token
+type tokenState struct {
+	entry JournalEntry
+	done  bool
+	// busy, while a call runs the write, is closed when it returns
+	busy chan struct{}
+}
+
+// OpenJournal opens or creates a journal file. A torn last line, left by a
+// crash during an append, is truncated away, so that the next append
+// starts on a line of its own.
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{path: path, file: f, tokens: make(map[string]*tokenState), bySeq: make(map[uint64]*tokenState)}
+	entries, err := j.repair()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, e := range entries {
+		j.seq = max(j.seq, e.Seq)
+		j.index(e)
+	}
+	return j, nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+// Insert journals and inserts a record. keyNumber names a unique key used
+// to recognise the record when replaying.
+func (j *Journal) Insert(f *File, keyNumber int16, record []byte) error {
+	key := ExtractKey(f.KeySegments(keyNumber), record)
+	return j.run(f, JournalEntry{Op: JournalInsert, File: f.Path(), KeyNumber: keyNumber, Key: key, Data: record})
+}
+
+// Update journals and applies an update of the record whose unique key
+// keyNumber matches record
+func (j *Journal) Update(f *File, keyNumber int16, record []byte) error {
+	key := ExtractKey(f.KeySegments(keyNumber), record)
+	return j.run(f, JournalEntry{Op: JournalUpdate, File: f.Path(), KeyNumber: keyNumber, Key: key, Data: record})
+}
+
+// Delete journals and applies the deletion of the record with the given
+// value of unique key keyNumber
+func (j *Journal) Delete(f *File, keyNumber int16, key []byte) error {
+	return j.run(f, JournalEntry{Op: JournalDelete, File: f.Path(), KeyNumber: keyNumber, Key: key})
+}
+
+// InsertOnce is Insert made idempotent by token, a name the caller gives
+// this one write, such as an order number: called again with the same
+// token after an error that left the outcome unknown, like a timeout, it
+// inserts the record only if the first attempt did not reach the file,
+// and after a success it does nothing. Tokens are remembered until Reset.
+// A write the server rejected can be retried under its token.
+func (j *Journal) InsertOnce(f *File, token string, keyNumber int16, record []byte) error {
+	key := ExtractKey(f.KeySegments(keyNumber), record)
+	return j.once(f, JournalEntry{Op: JournalInsert, File: f.Path(), KeyNumber: keyNumber, Key: key, Data: record, Token: token})
+}
+
+// UpdateOnce is Update made idempotent by token, like InsertOnce
+func (j *Journal) UpdateOnce(f *File, token string, keyNumber int16, record []byte) error {
+	key := ExtractKey(f.KeySegments(keyNumber), record)
+	return j.once(f, JournalEntry{Op: JournalUpdate, File: f.Path(), KeyNumber: keyNumber, Key: key, Data: record, Token: token})
+}
+
+// once runs an entry unless its token was already used: a completed write
+// is not repeated, and one left pending is checked against the file. The
+// token is reserved before the write is sent, so concurrent calls with it
+// run one at a time.
+func (j *Journal) once(f *File, e JournalEntry) error {
+	j.mu.Lock()
+	st := j.tokens[e.Token]
+	for st != nil && st.busy != nil {
+		busy := st.busy
+		j.mu.Unlock()
+		<-busy
+		j.mu.Lock()
+		st = j.tokens[e.Token]
+	}
+	if st == nil {
+		j.seq++
+		e.Seq = j.seq
+		st = &tokenState{entry: e, busy: make(chan struct{})}
+		j.tokens[e.Token], j.bySeq[e.Seq] = st, st
+		j.mu.Unlock()
+		defer j.release(st)
+		return j.write(f, e)
+	}
+	prev, done := st.entry, st.done
+	if prev.Op != e.Op || prev.File != e.File || prev.KeyNumber != e.KeyNumber ||
+		!bytes.Equal(prev.Key, e.Key) || !bytes.Equal(prev.Data, e.Data) {
+		j.mu.Unlock()
+		return fmt.Errorf("%w: %q", ErrTokenReused, e.Token)
+	}
+	if done {
+		j.mu.Unlock()
+		return nil
+	}
+	st.busy = make(chan struct{})
+	j.mu.Unlock()
+	defer j.release(st)
+
+	// The last attempt's outcome was lost with the connection
+	applied, err := isApplied(f, prev)
+	if err != nil {
+		return err
+	}
+	if !applied {
+		if err := apply(f, prev); err != nil {
+			if isStatusError(err) {
+				j.append(JournalEntry{Seq: prev.Seq, Done: true, Failed: true})
+			}
+			return err
+		}
+	}
+	return j.append(JournalEntry{Seq: prev.Seq, Done: true})
+}
+
+// release lets the calls waiting for a token's write proceed
+func (j *Journal) release(st *tokenState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	close(st.busy)
+	st.busy = nil
+}
+
+// run numbers the entry and writes it
+func (j *Journal) run(f *File, e JournalEntry) error {
+	j.mu.Lock()
+	j.seq++
+	e.Seq = j.seq
+	j.mu.Unlock()
+	return j.write(f, e)
+}
+
+// write appends the entry, applies it and marks it done. An entry whose
+// operation fails with a status is marked done too, since it did not
+// happen; after a transport error it stays pending for Replay.
+func (j *Journal) write(f *File, e JournalEntry) error {
+	if err := j.append(e); err != nil {
+		return err
+	}
+	if err := apply(f, e); err != nil {
+		// The server rejected the operation, so there is nothing to
+		// complete; transport errors leave the entry pending
+		if isStatusError(err) {
+			j.append(JournalEntry{Seq: e.Seq, Done: true, Failed: true})
+		}
+		return err
+	}
+	return j.append(JournalEntry{Seq: e.Seq, Done: true})
+}
+
+// Pending returns the entries that were not marked done, in order
+func (j *Journal) Pending() ([]JournalEntry, error) {
+	entries, err := j.read()
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[uint64]bool)
+	for _, e := range entries {
+		if e.Done {
+			done[e.Seq] = true
+		}
+	}
+	var pending []JournalEntry
+	for _, e := range entries {
+		if !e.Done && !done[e.Seq] {
+			pending = append(pending, e)
+		}
+	}
+	return pending, nil
+}
+
+// ReplayResult counts what Replay did with the pending entries
+type ReplayResult struct {
+	// Applied entries had not reached the file and were applied now
+	Applied int
+	// Verified entries had already been applied
+	Verified int
+}
+
+// Replay completes the pending entries in order. open returns the File for
+// a path; files are opened once per replay. Each entry is checked against
+// the file first: an insert or update whose record is already stored, or a
+// delete whose key is gone, is only marked done.
+func (j *Journal) Replay(ctx context.Context, open func(path string) (*File, error)) (ReplayResult, error) {
+	var result ReplayResult
+	pending, err := j.Pending()
+	if err != nil {
+		return result, err
+	}
+
+	files := make(map[string]*File)
+	for _, e := range pending {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		f, ok := files[e.File]
+		if !ok {
+			if f, err = open(e.File); err != nil {
+				return result, fmt.Errorf("journal entry %d: %w", e.Seq, err)
+			}
+			files[e.File] = f
+		}
+
+		done, err := isApplied(f, e)
+		if err != nil {
+			return result, fmt.Errorf("journal entry %d: %w", e.Seq, err)
+		}
+		if done {
+			result.Verified++
+		} else {
+			if err := apply(f, e); err != nil {
+				return result, fmt.Errorf("journal entry %d: %w", e.Seq, err)
+			}
+			result.Applied++
+		}
+		if err := j.append(JournalEntry{Seq: e.Seq, Done: true}); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// Reset empties the journal, e.g. once a batch has completed
+func (j *Journal) Reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.file.Truncate(0); err != nil {
+		return err
+	}
+	clear(j.tokens)
+	clear(j.bySeq)
+	return j.sync()
+}
+
+// append writes one entry as a JSON line
+func (j *Journal) append(e JournalEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("journal: %w", err)
+	}
+	j.index(e)
+	return j.sync()
+}
+
+// index tracks the idempotency tokens of an entry appended to the
+// journal. A rejected write frees its token, unless the token was taken
+// by a later write since. The caller holds j.mu.
+func (j *Journal) index(e JournalEntry) {
+	if e.Token != "" {
+		if st := j.tokens[e.Token]; st != nil && st.entry.Seq == e.Seq {
+			// Reserved by once
+			return
+		}
+		st := &tokenState{entry: e}
+		j.tokens[e.Token], j.bySeq[e.Seq] = st, st
+		return
+	}
+	st := j.bySeq[e.Seq]
+	if !e.Done || st == nil {
+		return
+	}
+	delete(j.bySeq, e.Seq)
+	if e.Failed {
+		if j.tokens[st.entry.Token] == st {
+			delete(j.tokens, st.entry.Token)
+		}
+	} else {
+		st.done = true
+	}
+}
+
+func (j *Journal) sync() error {
+	if j.NoSync {
+		return nil
+	}
+	return j.file.Sync()
+}
+
+// repair truncates the journal after its last complete line and returns
+// its entries
+func (j *Journal) repair() ([]JournalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	if complete := bytes.LastIndexByte(data, '\n') + 1; complete < len(data) {
+		if err := j.file.Truncate(int64(complete)); err != nil {
+			return nil, fmt.Errorf("journal: %w", err)
+		}
+		if err := j.sync(); err != nil {
+			return nil, err
+		}
+	}
+	return j.read()
+}
+
+// read parses every complete line of the journal. A torn last line is
+// ignored, since its append never returned; any other line that does not
+// parse fails the read, as entries after it cannot be trusted either.
+func (j *Journal) read() ([]JournalEntry, error) {
+	data, err := os.ReadFile(j.path)
+	if err != nil {
+		return nil, err
+	}
+	lines := bytes.Split(data, []byte{'\n'})
+	// The last element is empty or a torn line
+	lines = lines[:len(lines)-1]
+
+	entries := make([]JournalEntry, 0, len(lines))
+	for i, line := range lines {
+		var e JournalEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("journal %s line %d: %w", j.path, i+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// isApplied reports whether the effect of an entry is already in the file
+func isApplied(f *File, e JournalEntry) (bool, error) {
+	resp, err := f.GetEqual(e.Key, e.KeyNumber)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode {
+	case StatusSuccess:
+		if e.Op == JournalDelete {
+			return false, nil
+		}
+		return bytes.Equal(resp.DataBuffer, e.Data), nil
+	case StatusKeyNotFound:
+		return e.Op == JournalDelete, nil
+	}
+	return false, &StatusError{Operation: OpGetEqual, Status: resp.StatusCode}
+}
+
+// apply performs an entry's mutation
+func apply(f *File, e JournalEntry) error {
+	switch e.Op {
+	case JournalInsert:
+		resp, err := f.Insert(e.Data)
+		if err != nil {
+			return err
+		}
+		return checkStatus(OpInsert, resp)
+	case JournalUpdate, JournalDelete:
+		resp, err := f.GetEqual(e.Key, e.KeyNumber)
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(OpGetEqual, resp); err != nil {
+			return err
+		}
+		op := uint16(OpUpdate)
+		if e.Op == JournalUpdate {
+			resp, err = f.Update(e.Data, e.KeyNumber)
+		} else {
+			op = OpDelete
+			resp, err = f.Delete(e.KeyNumber)
+		}
+		if err != nil {
+			return err
+		}
+		return checkStatus(op, resp)
+	}
+	return errors.New("journal: unknown operation " + e.Op)
+}
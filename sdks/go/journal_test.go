@@ -0,0 +1,54 @@
+package xtrieve
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalTornLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.journal")
+	complete := `{"seq":1,"op":"insert","file":"a.dat","key":"AQ=="}` + "\n" +
+		`{"seq":1,"done":true}` + "\n" +
+		`{"seq":2,"op":"delete","file":"a.dat","key":"Ag=="}` + "\n"
+	if err := os.WriteFile(path, []byte(complete+`{"seq":3,"op":"ins`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	if data, _ := os.ReadFile(path); string(data) != complete {
+		t.Fatalf("journal after open = %q, want the torn line removed", data)
+	}
+	pending, err := j.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].Seq != 2 {
+		t.Fatalf("pending = %+v, want entry 2", pending)
+	}
+
+	// The next append starts on a line of its own
+	if err := j.append(JournalEntry{Seq: 2, Done: true}); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err = j.Pending(); err != nil || len(pending) != 0 {
+		t.Fatalf("pending after append = %+v, %v", pending, err)
+	}
+}
+
+func TestJournalCorruptLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.journal")
+	data := `{"seq":1,"op":"insert"}` + "\n" + "garbage\n" + `{"seq":1,"done":true}` + "\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := OpenJournal(path)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("OpenJournal = %v, want an error for line 2", err)
+	}
+}
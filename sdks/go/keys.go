@@ -0,0 +1,207 @@
+package xtrieve
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"math"
+)
+
+// keySegments groups the segments reported by Stat into keys. A segment
+// with KeyFlagSegmented set is continued by the next one.
+func keySegments(specs []KeySpec, keyNumber int16) []KeySpec {
+	if keyNumber < 0 {
+		return nil
+	}
+	n := int16(0)
+	start := 0
+	for i, spec := range specs {
+		if spec.Flags&KeyFlagSegmented != 0 {
+			continue
+		}
+		if n == keyNumber {
+			return specs[start : i+1]
+		}
+		n++
+		start = i + 1
+	}
+	return nil
+}
+
+// CompareKey compares two key values made of the given segments using the
+// same rules as the server: integers and floats numerically, strings
+// bytewise and wide strings by UTF-16 code unit (ignoring case for
+// KeyFlagNoCase), and descending segments reversed
+func CompareKey(segments []KeySpec, a, b []byte) int {
+	return CompareKeyCollated(segments, nil, a, b)
+}
+
+// CompareKeyCollated is CompareKey with STRING, LSTRING and ZSTRING
+// segments ordered by coll. A nil coll compares them as CompareKey does.
+// Null indicator segments order nulls first, and two nulls are equal
+// whatever the value segment after them holds.
+func CompareKeyCollated(segments []KeySpec, coll Collation, a, b []byte) int {
+	offset := 0
+	skip := false
+	for _, seg := range segments {
+		end := offset + int(seg.Length)
+		if skip {
+			skip = false
+		} else if seg.Type == KeyTypeNullIndicator {
+			x, y := sliceRange(a, offset, end), sliceRange(b, offset, end)
+			c := -cmp.Compare(boolInt(isNull(x)), boolInt(isNull(y)))
+			if seg.Flags&KeyFlagDescending != 0 {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+			skip = isNull(x)
+		} else if c := compareSegment(seg, coll, sliceRange(a, offset, end), sliceRange(b, offset, end)); c != 0 {
+			return c
+		}
+		offset = end
+	}
+	return 0
+}
+
+// compareSegment compares the values of a single key segment, ordering
+// narrow strings by coll when it is not nil
+func compareSegment(seg KeySpec, coll Collation, a, b []byte) int {
+	c := 0
+	switch seg.Type {
+	case KeyTypeString, KeyTypeLstring, KeyTypeZstring:
+		if coll == nil {
+			c = compareString(seg, a, b)
+		} else if seg.Type == KeyTypeLstring {
+			c = coll.Compare(lstringData(a), lstringData(b))
+		} else {
+			c = coll.Compare(zstringData(seg, a), zstringData(seg, b))
+		}
+	case KeyTypeInteger:
+		c = cmp.Compare(decodeInt(a), decodeInt(b))
+	case KeyTypeUnsignedBinary, KeyTypeAutoincrement:
+		c = cmp.Compare(decodeUint(a), decodeUint(b))
+	case KeyTypeFloat:
+		c = cmp.Compare(decodeFloat(a), decodeFloat(b))
+	case KeyTypeWString, KeyTypeWZstring:
+		c = compareUTF16(a, b, seg.Flags&KeyFlagNoCase != 0)
+	default:
+		c = bytes.Compare(a, b)
+	}
+	if seg.Flags&KeyFlagDescending != 0 {
+		c = -c
+	}
+	return c
+}
+
+// compareString compares narrow strings bytewise, folding case for
+// KeyFlagNoCase
+func compareString(seg KeySpec, a, b []byte) int {
+	if seg.Type == KeyTypeLstring {
+		a, b = lstringData(a), lstringData(b)
+	}
+	if seg.Flags&KeyFlagNoCase != 0 {
+		return foldedCompare(a, b)
+	}
+	return bytes.Compare(a, b)
+}
+
+// zstringData cuts a ZSTRING value at its terminator
+func zstringData(seg KeySpec, b []byte) []byte {
+	if seg.Type == KeyTypeZstring {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
+
+func sliceRange(b []byte, start, end int) []byte {
+	if start > len(b) {
+		return nil
+	}
+	if end > len(b) {
+		end = len(b)
+	}
+	return b[start:end]
+}
+
+func lstringData(b []byte) []byte {
+	if len(b) == 0 {
+		return nil
+	}
+	return sliceRange(b, 1, 1+int(b[0]))
+}
+
+// decodeInt decodes a little-endian signed integer of 1, 2, 4 or 8 bytes
+func decodeInt(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(int16(binary.LittleEndian.Uint16(b)))
+	case 4:
+		return int64(int32(binary.LittleEndian.Uint32(b)))
+	case 8:
+		return int64(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// decodeUint decodes a little-endian unsigned integer of 1, 2, 4 or 8 bytes
+func decodeUint(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(binary.LittleEndian.Uint16(b))
+	case 4:
+		return uint64(binary.LittleEndian.Uint32(b))
+	case 8:
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// decodeFloat decodes a little-endian IEEE float of 4 or 8 bytes
+func decodeFloat(b []byte) float64 {
+	switch len(b) {
+	case 4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	case 8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// rangeBounds puts the bounds of a key range into index order. Bounds are
+// values: when both are given the smaller one in index order comes first,
+// and a single bound on a key whose leading segment is descending moves to
+// the other end, so Range(nil, to) means "at most to" on any key.
+func rangeBounds(segments []KeySpec, coll Collation, from, to []byte) ([]byte, []byte) {
+	switch {
+	case from != nil && to != nil:
+		if CompareKeyCollated(segments, coll, from, to) > 0 {
+			return to, from
+		}
+	case len(segments) > 0 && segments[0].Flags&KeyFlagDescending != 0:
+		return to, from
+	}
+	return from, to
+}
+
+// ExtractKey builds the key value of a record from the key's segments
+func ExtractKey(segments []KeySpec, record []byte) []byte {
+	var key []byte
+	for _, seg := range segments {
+		start := int(seg.Position)
+		part := sliceRange(record, start, start+int(seg.Length))
+		key = append(key, part...)
+		// Pad segments that lie beyond a short record, as the server does
+		for i := len(part); i < int(seg.Length); i++ {
+			key = append(key, 0)
+		}
+	}
+	return key
+}
@@ -0,0 +1,190 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func le16(n int16) []byte { return binary.LittleEndian.AppendUint16(nil, uint16(n)) }
+func le32(n int32) []byte { return binary.LittleEndian.AppendUint32(nil, uint32(n)) }
+
+func cat(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+func TestKeySegments(t *testing.T) {
+	specs := []KeySpec{
+		{Position: 0, Length: 4, Type: KeyTypeInteger},
+		{Position: 4, Length: 10, Flags: KeyFlagSegmented, Type: KeyTypeString},
+		{Position: 14, Length: 2, Flags: KeyFlagSegmented | KeyFlagDescending, Type: KeyTypeInteger},
+		{Position: 16, Length: 4, Type: KeyTypeDate},
+		{Position: 20, Length: 8, Type: KeyTypeFloat},
+	}
+	tests := []struct {
+		key  int16
+		want []KeySpec
+	}{
+		{0, specs[0:1]},
+		{1, specs[1:4]},
+		{2, specs[4:5]},
+		{3, nil},
+		{-1, nil},
+	}
+	for _, tt := range tests {
+		if got := keySegments(specs, tt.key); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("keySegments(%d) = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestCompareKey(t *testing.T) {
+	seg := func(keyType uint8, length uint16, flags uint16) []KeySpec {
+		return []KeySpec{{Length: length, Flags: flags, Type: keyType}}
+	}
+	f64 := func(x float64) []byte { return binary.LittleEndian.AppendUint64(nil, math.Float64bits(x)) }
+	wide := func(s string) []byte { return EncodeUTF16LE(s) }
+	composite := []KeySpec{
+		{Length: 4, Flags: KeyFlagSegmented, Type: KeyTypeString},
+		{Length: 2, Flags: KeyFlagDescending, Type: KeyTypeInteger},
+	}
+	nullable := []KeySpec{
+		{Length: 1, Flags: KeyFlagSegmented, Type: KeyTypeNullIndicator},
+		{Length: 2, Type: KeyTypeInteger},
+	}
+
+	tests := []struct {
+		name     string
+		segments []KeySpec
+		a, b     []byte
+		want     int
+	}{
+		{"integer", seg(KeyTypeInteger, 2, 0), le16(-1), le16(1), -1},
+		{"integer equal", seg(KeyTypeInteger, 4, 0), le32(7), le32(7), 0},
+		{"integer descending", seg(KeyTypeInteger, 2, KeyFlagDescending), le16(-1), le16(1), 1},
+		{"unsigned", seg(KeyTypeUnsignedBinary, 2, 0), le16(-1), le16(1), 1},
+		{"autoincrement", seg(KeyTypeAutoincrement, 4, 0), le32(256), le32(255), 1},
+		{"float", seg(KeyTypeFloat, 8, 0), f64(-2.5), f64(0.5), -1},
+		{"float descending", seg(KeyTypeFloat, 8, KeyFlagDescending), f64(-2.5), f64(0.5), 1},
+		{"string", seg(KeyTypeString, 3, 0), []byte("abc"), []byte("abd"), -1},
+		{"string case", seg(KeyTypeString, 3, 0), []byte("abc"), []byte("ABC"), 1},
+		{"string no case", seg(KeyTypeString, 3, KeyFlagNoCase), []byte("abc"), []byte("ABC"), 0},
+		{"string no case descending", seg(KeyTypeString, 3, KeyFlagNoCase|KeyFlagDescending), []byte("abc"), []byte("ABD"), 1},
+		{"lstring ignores garbage", seg(KeyTypeLstring, 4, 0), []byte("\x02abX"), []byte("\x02abY"), 0},
+		{"lstring shorter first", seg(KeyTypeLstring, 4, 0), []byte("\x02ab\x00"), []byte("\x03abc"), -1},
+		{"wstring", seg(KeyTypeWString, 4, 0), wide("ab"), wide("aC"), 1},
+		{"wstring no case", seg(KeyTypeWString, 4, KeyFlagNoCase), wide("ab"), wide("aC"), -1},
+		{"composite first segment", composite, cat([]byte("abcd"), le16(1)), cat([]byte("abce"), le16(9)), -1},
+		{"composite descending second", composite, cat([]byte("abcd"), le16(1)), cat([]byte("abcd"), le16(9)), 1},
+		{"composite equal", composite, cat([]byte("abcd"), le16(5)), cat([]byte("abcd"), le16(5)), 0},
+		{"null first", nullable, cat([]byte{1}, le16(0)), cat([]byte{0}, le16(-5)), -1},
+		{"nulls equal", nullable, cat([]byte{1}, le16(3)), cat([]byte{1}, le16(4)), 0},
+		{"not null by value", nullable, cat([]byte{0}, le16(3)), cat([]byte{0}, le16(4)), -1},
+		{"short key", seg(KeyTypeString, 4, 0), []byte("ab"), []byte("abcd"), -1},
+	}
+	for _, tt := range tests {
+		if got := CompareKey(tt.segments, tt.a, tt.b); got != tt.want {
+			t.Errorf("%s: CompareKey(%x, %x) = %d, want %d", tt.name, tt.a, tt.b, got, tt.want)
+		}
+		if got := CompareKey(tt.segments, tt.b, tt.a); got != -tt.want {
+			t.Errorf("%s: CompareKey(%x, %x) = %d, want %d", tt.name, tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestCompareKeyCollated(t *testing.T) {
+	// A collation that orders strings by length before content
+	coll := CollationFunc(func(a, b []byte) int {
+		if len(a) != len(b) {
+			return len(a) - len(b)
+		}
+		return bytes.Compare(a, b)
+	})
+	tests := []struct {
+		seg  KeySpec
+		a, b []byte
+		want int
+	}{
+		{KeySpec{Length: 4, Type: KeyTypeZstring}, []byte("zz\x00\x00"), []byte("aaa\x00"), -1},
+		{KeySpec{Length: 4, Type: KeyTypeLstring}, []byte("\x02zzq"), []byte("\x03aaa"), -1},
+		{KeySpec{Length: 4, Type: KeyTypeLstring, Flags: KeyFlagDescending}, []byte("\x02zzq"), []byte("\x03aaa"), 1},
+		{KeySpec{Length: 2, Type: KeyTypeInteger}, le16(2), le16(10), -1},
+	}
+	for _, tt := range tests {
+		if got := CompareKeyCollated([]KeySpec{tt.seg}, coll, tt.a, tt.b); got != tt.want {
+			t.Errorf("type %d: CompareKeyCollated(%q, %q) = %d, want %d", tt.seg.Type, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestRangeBounds(t *testing.T) {
+	asc := []KeySpec{{Length: 2, Type: KeyTypeInteger}}
+	desc := []KeySpec{{Length: 2, Flags: KeyFlagDescending, Type: KeyTypeInteger}}
+	lo, hi := le16(1), le16(9)
+	tests := []struct {
+		name           string
+		segments       []KeySpec
+		from, to       []byte
+		wantFrom, want []byte
+	}{
+		{"ascending", asc, lo, hi, lo, hi},
+		{"ascending swapped", asc, hi, lo, lo, hi},
+		{"descending", desc, lo, hi, hi, lo},
+		{"descending in order", desc, hi, lo, hi, lo},
+		{"ascending from only", asc, lo, nil, lo, nil},
+		{"ascending to only", asc, nil, hi, nil, hi},
+		{"descending from only", desc, lo, nil, nil, lo},
+		{"descending to only", desc, nil, hi, hi, nil},
+		{"no segments", nil, nil, hi, nil, hi},
+	}
+	for _, tt := range tests {
+		from, to := rangeBounds(tt.segments, nil, tt.from, tt.to)
+		if !bytes.Equal(from, tt.wantFrom) || !bytes.Equal(to, tt.want) {
+			t.Errorf("%s: rangeBounds(%x, %x) = %x, %x, want %x, %x", tt.name, tt.from, tt.to, from, to, tt.wantFrom, tt.want)
+		}
+	}
+}
+
+func TestExtractKey(t *testing.T) {
+	record := []byte("0123456789")
+	tests := []struct {
+		segments []KeySpec
+		want     string
+	}{
+		{[]KeySpec{{Position: 2, Length: 3}}, "234"},
+		{[]KeySpec{{Position: 6, Length: 2, Flags: KeyFlagSegmented}, {Position: 0, Length: 2}}, "6701"},
+		{[]KeySpec{{Position: 8, Length: 4}}, "89\x00\x00"},
+		{[]KeySpec{{Position: 12, Length: 2, Flags: KeyFlagSegmented}, {Position: 1, Length: 1}}, "\x00\x001"},
+	}
+	for _, tt := range tests {
+		if got := ExtractKey(tt.segments, record); string(got) != tt.want {
+			t.Errorf("ExtractKey(%+v) = %q, want %q", tt.segments, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeNumbers(t *testing.T) {
+	tests := []struct {
+		b []byte
+		i int64
+		u uint64
+		f float64
+	}{
+		{[]byte{0xFF}, -1, 255, 0},
+		{le16(-2), -2, 0xFFFE, 0},
+		{le32(-3), -3, 0xFFFFFFFD, float64(math.Float32frombits(0xFFFFFFFD))},
+		{binary.LittleEndian.AppendUint32(nil, math.Float32bits(1.5)), 0x3FC00000, 0x3FC00000, 1.5},
+		{[]byte{1, 2, 3}, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := decodeInt(tt.b); got != tt.i {
+			t.Errorf("decodeInt(%x) = %d, want %d", tt.b, got, tt.i)
+		}
+		if got := decodeUint(tt.b); got != tt.u {
+			t.Errorf("decodeUint(%x) = %d, want %d", tt.b, got, tt.u)
+		}
+		if got := decodeFloat(tt.b); got != tt.f && !(math.IsNaN(got) && math.IsNaN(tt.f)) {
+			t.Errorf("decodeFloat(%x) = %v, want %v", tt.b, got, tt.f)
+		}
+	}
+}
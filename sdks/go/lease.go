@@ -0,0 +1,91 @@
+package xtrieve
+
+import (
+	"sync"
+	"time"
+)
+
+// Lease keeps the file's session alive while the application holds it.
+// A background goroutine contacts the server every ttl/3 when the file is
+// otherwise idle. If the server cannot be reached for a whole ttl the
+// lease expires and every later operation on the file fails with
+// ErrLeaseExpired until Reopen succeeds, since a server that reaps idle
+// sessions would by then have dropped the file's position and locks.
+//
+// Reaping is up to the server: xtrieved currently keeps a session's locks
+// until it restarts, so leases only detect the loss on the client side.
+func (f *File) Lease(ttl time.Duration) {
+	if f.lease != nil {
+		f.lease.stop()
+	}
+	l := &lease{ttl: ttl, last: time.Now(), done: make(chan struct{})}
+	f.lease = l
+	go l.run(f.client)
+}
+
+// lease tracks when the server was last reached on behalf of a File
+type lease struct {
+	ttl  time.Duration
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	last   time.Time
+	lapsed bool
+}
+
+// run renews the lease until it is stopped. Once expired, the lease stays
+// expired until restart even if the server becomes reachable again.
+func (l *lease) run(c *Client) {
+	ticker := time.NewTicker(max(l.ttl/3, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		l.mu.Lock()
+		idle := time.Since(l.last)
+		l.mu.Unlock()
+		if idle < l.ttl/3 || l.expired() {
+			continue
+		}
+
+		if _, err := c.Execute(&Request{Operation: OpVersion}); err == nil {
+			l.renewed()
+		}
+	}
+}
+
+// renewed records a successful contact with the server
+func (l *lease) renewed() {
+	l.mu.Lock()
+	if !l.lapsed {
+		l.last = time.Now()
+	}
+	l.mu.Unlock()
+}
+
+// expired reports whether the server went unreached for a whole ttl
+func (l *lease) expired() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.lapsed && time.Since(l.last) >= l.ttl {
+		l.lapsed = true
+	}
+	return l.lapsed
+}
+
+// restart renews an expired lease after the file was reopened
+func (l *lease) restart() {
+	l.mu.Lock()
+	l.lapsed = false
+	l.last = time.Now()
+	l.mu.Unlock()
+}
+
+func (l *lease) stop() {
+	l.once.Do(func() { close(l.done) })
+}
@@ -0,0 +1,149 @@
+package xtrieve
+
+import (
+	"fmt"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Matcher selects records by the text of one or more string fields, for
+// searches the comparisons of a Filter cannot express, such as a
+// reference number anywhere in a notes field. A record matches when any
+// of the fields does. Matching is done client-side on decoded values, so
+// every record of the scan is read; an Iterator sends the server what it
+// can to narrow the scan first (see Regexp).
+//
+//	m := xtrieve.Contains(schema, "INV-20931", "notes", "reference")
+//	it := f.Scan(0).Match(m)
+type Matcher struct {
+	schema *Schema
+	fields []Field
+	match  func(value string) bool
+	// terms are filter terms every match satisfies, sent to the server
+	terms []filterTerm
+	err   error
+}
+
+// Contains matches records whose fields contain substr
+func Contains(schema *Schema, substr string, fields ...string) *Matcher {
+	return MatchFunc(schema, func(value string) bool {
+		return strings.Contains(value, substr)
+	}, fields...)
+}
+
+// Regexp matches records whose fields match re; use (?i) for a search
+// that ignores case. A pattern on a single plain string field that is
+// anchored with a literal prefix, such as ^INV-2024, is also sent to the
+// server as a range of the field, so only records starting with the
+// prefix are read.
+func Regexp(schema *Schema, re *regexp.Regexp, fields ...string) *Matcher {
+	m := MatchFunc(schema, re.MatchString, fields...)
+	if m.err == nil && len(m.fields) == 1 {
+		m.terms = prefixTerms(m.fields[0], anchoredPrefix(re))
+	}
+	return m
+}
+
+// MatchFunc matches records for which match reports true for any of the
+// fields
+func MatchFunc(schema *Schema, match func(value string) bool, fields ...string) *Matcher {
+	m := &Matcher{schema: schema, match: match}
+	if len(fields) == 0 {
+		m.err = fmt.Errorf("match: no fields")
+	}
+	for _, name := range fields {
+		field, ok := schema.Field(name)
+		if !ok {
+			m.err = fmt.Errorf("match: unknown field %s", name)
+			break
+		}
+		if !isStringType(field.Type) || field.Bits > 0 {
+			m.err = fmt.Errorf("match: %s is not a string field", name)
+			break
+		}
+		m.fields = append(m.fields, field)
+	}
+	return m
+}
+
+// Err returns the error encountered while building the matcher
+func (m *Matcher) Err() error {
+	return m.err
+}
+
+// Match evaluates the matcher against a record. Null fields do not match.
+func (m *Matcher) Match(record []byte) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	for _, f := range m.fields {
+		v, err := m.schema.decode(f, record)
+		if err != nil {
+			return false, err
+		}
+		if s, ok := v.(string); ok && m.match(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// anchoredPrefix returns the literal that every match of re starts the
+// text with, or "" if there is none
+func anchoredPrefix(re *regexp.Regexp) string {
+	p, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil || p.Op != syntax.OpConcat || len(p.Sub) < 2 || p.Sub[0].Op != syntax.OpBeginText {
+		return ""
+	}
+	if lit := p.Sub[1]; lit.Op == syntax.OpLiteral && lit.Flags&syntax.FoldCase == 0 {
+		return string(lit.Rune)
+	}
+	return ""
+}
+
+// prefixTerms returns the filter terms selecting the values of a field
+// that start with prefix: at least the prefix padded with zero bytes and
+// less than the prefix's successor. Only fields stored as plain UTF-8
+// bytes qualify.
+func prefixTerms(field Field, prefix string) []filterTerm {
+	if prefix == "" || len(prefix) > field.Length || field.Encrypted || field.Nullable || field.charset() != nil ||
+		field.Type != KeyTypeString && field.Type != KeyTypeZstring {
+		return nil
+	}
+	from := make([]byte, field.Length)
+	copy(from, prefix)
+	to := []byte(prefix)
+	for len(to) > 0 && to[len(to)-1] == 0xFF {
+		to = to[:len(to)-1]
+	}
+	if len(to) == 0 {
+		return []filterTerm{{field: field, cmp: CmpGreaterOrEqual, value: from}}
+	}
+	to[len(to)-1]++
+	upper := make([]byte, field.Length)
+	copy(upper, to)
+	return []filterTerm{
+		{field: field, cmp: CmpGreaterOrEqual, value: from},
+		{field: field, cmp: CmpLess, value: upper},
+	}
+}
+
+// Match restricts the iterator to records m matches; several matchers
+// must all match. Matching is done client-side; the parts of m a filter
+// can express are sent to the server with the iterator's filter.
+func (it *Iterator) Match(m *Matcher) *Iterator {
+	it.matchers = append(it.matchers, m)
+	it.compileFilter()
+	return it
+}
+
+// matches reports whether a record satisfies every matcher
+func (it *Iterator) matches(record []byte) (bool, error) {
+	for _, m := range it.matchers {
+		if ok, err := m.Match(record); !ok || err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
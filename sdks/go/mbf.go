@@ -0,0 +1,68 @@
+package xtrieve
+
+import (
+	"errors"
+	"math"
+)
+
+// ErrMBFRange is returned when a value is too large for a BFLOAT field
+var ErrMBFRange = errors.New("value out of BFLOAT range")
+
+// BFLOAT fields hold Microsoft Binary Format reals, as written by BASIC
+// and early C compilers: the mantissa's low bytes first, then its top
+// seven bits under the sign bit, then an exponent byte biased by 128 that
+// is 0 for zero. The mantissa is a fraction 0.1m with its leading 1 implied,
+// so the value is 1.m × 2^(exponent-129).
+
+// decodeMBF decodes a 4- or 8-byte BFLOAT
+func decodeMBF(b []byte) float64 {
+	n := len(b)
+	if n != 4 && n != 8 || b[n-1] == 0 {
+		return 0
+	}
+	bits := uint(8*n - 9)
+	var m uint64
+	for i := n - 2; i >= 0; i-- {
+		m = m<<8 | uint64(b[i])
+	}
+	m = m&(1<<bits-1) | 1<<bits
+	x := math.Ldexp(float64(m), int(b[n-1])-129-int(bits))
+	if b[n-2]&0x80 != 0 {
+		x = -x
+	}
+	return x
+}
+
+// encodeMBF encodes x as a 4- or 8-byte BFLOAT into b. Values too small
+// for the exponent become zero.
+func encodeMBF(b []byte, x float64) error {
+	n := len(b)
+	clear(b)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return ErrMBFRange
+	}
+	frac, exp := math.Frexp(math.Abs(x))
+	if frac == 0 || exp+128 <= 0 {
+		return nil
+	}
+	bits := uint(8*n - 9)
+	m := uint64(math.Round(math.Ldexp(frac, int(bits)+1)))
+	exp += 128
+	if m == 1<<(bits+1) {
+		// Rounded up to the next power of two
+		m >>= 1
+		exp++
+	}
+	if exp > 255 {
+		return ErrMBFRange
+	}
+	m &^= 1 << bits
+	for i := 0; i < n-1; i++ {
+		b[i] = byte(m >> (8 * i))
+	}
+	if x < 0 {
+		b[n-2] |= 0x80
+	}
+	b[n-1] = byte(exp)
+	return nil
+}
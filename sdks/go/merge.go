@@ -0,0 +1,148 @@
+package xtrieve
+
+import (
+	"container/heap"
+)
+
+// RecordIterator yields records in order. It is implemented by Iterator and
+// MergeIterator, so merged streams can themselves be merged.
+type RecordIterator interface {
+	Next() bool
+	Record() []byte
+	Key() []byte
+	Err() error
+}
+
+// MergeIterator merges several ordered iterators into one ordered stream
+type MergeIterator struct {
+	sources []RecordIterator
+	cmp     func(a, b []byte) int
+	h       mergeHeap
+	started bool
+	current int
+	err     error
+	// moved, if set, is told the source of every record returned
+	moved func(source int)
+}
+
+// MergeScan merges ordered iterators, e.g. scans of partitioned monthly
+// files, into one stream ordered by cmp. cmp compares two records and
+// returns a negative number, zero or a positive number like bytes.Compare.
+// Each source must already be ordered by cmp; ties are returned in source
+// order.
+func MergeScan(cmp func(a, b []byte) int, sources ...RecordIterator) *MergeIterator {
+	return &MergeIterator{sources: sources, cmp: cmp, current: -1}
+}
+
+// Next advances to the next record across all sources
+func (m *MergeIterator) Next() bool {
+	if m.err != nil {
+		return false
+	}
+
+	if !m.started {
+		m.started = true
+		m.h = mergeHeap{cmp: m.cmp}
+		for i := range m.sources {
+			if !m.advance(i, false) {
+				return false
+			}
+		}
+		heap.Init(&m.h)
+	} else if m.current >= 0 {
+		// Refill from the source that produced the previous record
+		if !m.advance(m.current, true) {
+			return false
+		}
+	}
+
+	if m.h.Len() == 0 {
+		m.current = -1
+		return false
+	}
+	m.current = heap.Pop(&m.h).(mergeItem).source
+	if m.moved != nil {
+		m.moved(m.current)
+	}
+	return true
+}
+
+// Record returns the current record
+func (m *MergeIterator) Record() []byte {
+	return m.sources[m.current].Record()
+}
+
+// Key returns the key of the current record
+func (m *MergeIterator) Key() []byte {
+	return m.sources[m.current].Key()
+}
+
+// Source returns the index of the source that produced the current record
+func (m *MergeIterator) Source() int {
+	return m.current
+}
+
+// Err returns the first error reported by any source
+func (m *MergeIterator) Err() error {
+	return m.err
+}
+
+// Close closes the sources that can be closed, such as Iterators, to end
+// a merge early
+func (m *MergeIterator) Close() {
+	for _, src := range m.sources {
+		if c, ok := src.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
+
+// advance moves source i forward and puts its record on the heap. During
+// initialisation items are appended and the heap is built afterwards.
+func (m *MergeIterator) advance(i int, push bool) bool {
+	src := m.sources[i]
+	if src.Next() {
+		item := mergeItem{source: i, record: src.Record()}
+		if push {
+			heap.Push(&m.h, item)
+		} else {
+			m.h.items = append(m.h.items, item)
+		}
+		return true
+	}
+	if err := src.Err(); err != nil {
+		m.err = err
+		return false
+	}
+	return true
+}
+
+type mergeItem struct {
+	source int
+	record []byte
+}
+
+type mergeHeap struct {
+	items []mergeItem
+	cmp   func(a, b []byte) int
+}
+
+func (h mergeHeap) Len() int { return len(h.items) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if c := h.cmp(h.items[i].record, h.items[j].record); c != 0 {
+		return c < 0
+	}
+	return h.items[i].source < h.items[j].source
+}
+
+func (h mergeHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *mergeHeap) Push(x any) { h.items = append(h.items, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() any {
+	old := h.items
+	item := old[len(old)-1]
+	h.items = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,555 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// MarshalMsgpack encodes v in MessagePack. Structs become maps keyed by
+// field name or by the name in a `msgpack:"name,omitempty"` tag; a tag of
+// "-" skips the field. time.Time uses the timestamp extension.
+func MarshalMsgpack(v any) ([]byte, error) {
+	return appendMsgpack(nil, reflect.ValueOf(v))
+}
+
+// UnmarshalMsgpack decodes MessagePack data into the value v points to
+func UnmarshalMsgpack(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errors.New("msgpack: UnmarshalMsgpack needs a non-nil pointer")
+	}
+	r := &msgpackReader{b: data}
+	value, err := r.value()
+	if err != nil {
+		return err
+	}
+	if len(r.b) > 0 {
+		return fmt.Errorf("msgpack: %d bytes after the value", len(r.b))
+	}
+	return assignValue(rv.Elem(), value)
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	fixedType     = reflect.TypeOf(FixedPoint{})
+	timeOfDayType = reflect.TypeOf(TimeOfDay{})
+)
+
+func appendMsgpack(b []byte, v reflect.Value) ([]byte, error) {
+	if !v.IsValid() {
+		return append(b, 0xc0), nil
+	}
+	if v.Type() == timeType {
+		return appendMsgpackTime(b, v.Interface().(time.Time)), nil
+	}
+	if v.Type() == fixedType {
+		// Exact decimals travel as strings, e.g. "12.30"
+		return appendMsgpackString(b, v.Interface().(FixedPoint).String()), nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		return appendMsgpack(b, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(b, v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u > math.MaxInt64 {
+			return binary.BigEndian.AppendUint64(append(b, 0xcf), u), nil
+		}
+		return appendMsgpackInt(b, int64(v.Uint())), nil
+	case reflect.Float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(float32(v.Float()))), nil
+	case reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v.Float())), nil
+	case reflect.String:
+		return appendMsgpackString(b, v.String()), nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Slice && v.IsNil() {
+				return append(b, 0xc0), nil
+			}
+			return appendMsgpackBinary(b, v.Bytes()), nil
+		}
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		b = appendMsgpackHeader(b, v.Len(), 0x90, 0xdc)
+		for i := 0; i < v.Len(); i++ {
+			var err error
+			if b, err = appendMsgpack(b, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Map:
+		if v.IsNil() {
+			return append(b, 0xc0), nil
+		}
+		b = appendMsgpackHeader(b, v.Len(), 0x80, 0xde)
+		iter := v.MapRange()
+		for iter.Next() {
+			var err error
+			if b, err = appendMsgpack(b, iter.Key()); err != nil {
+				return nil, err
+			}
+			if b, err = appendMsgpack(b, iter.Value()); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Struct:
+		fields := structFields(v)
+		b = appendMsgpackHeader(b, len(fields), 0x80, 0xde)
+		for _, f := range fields {
+			b = appendMsgpackString(b, f.name)
+			var err error
+			if b, err = appendMsgpack(b, f.value); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("msgpack: cannot encode %s", v.Type())
+}
+
+func appendMsgpackInt(b []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(b, byte(n))
+	case n < 0 && n >= -32:
+		return append(b, byte(n))
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		return append(b, 0xd0, byte(n))
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(n))
+	case n >= math.MinInt32 && n <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(n))
+}
+
+func appendMsgpackString(b []byte, s string) []byte {
+	if len(s) < 32 {
+		b = append(b, 0xa0|byte(len(s)))
+	} else {
+		b = appendMsgpackLength(b, len(s), 0xd9)
+	}
+	return append(b, s...)
+}
+
+func appendMsgpackBinary(b, data []byte) []byte {
+	b = appendMsgpackLength(b, len(data), 0xc4)
+	return append(b, data...)
+}
+
+// appendMsgpackLength writes an 8, 16 or 32-bit length after the first of
+// three consecutive type bytes
+func appendMsgpackLength(b []byte, n int, code byte) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(b, code, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code+1), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code+2), uint32(n))
+}
+
+// appendMsgpackHeader writes an array or map header: fix form for up to
+// 15 elements, else a 16 or 32-bit count
+func appendMsgpackHeader(b []byte, n int, fix, code byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, code), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, code+1), uint32(n))
+}
+
+// appendMsgpackTime writes the timestamp extension (type -1)
+func appendMsgpackTime(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	if sec >= 0 && sec < 1<<34 {
+		if nsec == 0 && sec < 1<<32 {
+			return binary.BigEndian.AppendUint32(append(b, 0xd6, 0xff), uint32(sec))
+		}
+		return binary.BigEndian.AppendUint64(append(b, 0xd7, 0xff), uint64(nsec)<<34|uint64(sec))
+	}
+	b = binary.BigEndian.AppendUint32(append(b, 0xc7, 12, 0xff), nsec)
+	return binary.BigEndian.AppendUint64(b, uint64(sec))
+}
+
+// structField is an exported struct field with its MessagePack name
+type structField struct {
+	name  string
+	value reflect.Value
+}
+
+// structFields lists the fields of a struct to encode, flattening
+// embedded structs
+func structFields(v reflect.Value) []structField {
+	var fields []structField
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, omitEmpty, skip := msgpackTag(sf)
+		if skip {
+			continue
+		}
+		fv := v.Field(i)
+		if sf.Anonymous && sf.Tag.Get("msgpack") == "" && fv.Kind() == reflect.Struct {
+			fields = append(fields, structFields(fv)...)
+			continue
+		}
+		if omitEmpty && fv.IsZero() {
+			continue
+		}
+		fields = append(fields, structField{name: name, value: fv})
+	}
+	return fields
+}
+
+// msgpackTag parses a field's msgpack tag
+func msgpackTag(sf reflect.StructField) (name string, omitEmpty, skip bool) {
+	tag := sf.Tag.Get("msgpack")
+	if tag == "-" {
+		return "", false, true
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = sf.Name
+	}
+	return name, opts == "omitempty", false
+}
+
+// msgpackReader decodes MessagePack into generic values: nil, bool, int64
+// (uint64 beyond its range), float64, string, []byte, time.Time, []any and
+// map[string]any
+type msgpackReader struct {
+	b []byte
+}
+
+func (r *msgpackReader) next(n int) ([]byte, error) {
+	if n < 0 || n > len(r.b) {
+		return nil, errors.New("msgpack: truncated data")
+	}
+	b := r.b[:n]
+	r.b = r.b[n:]
+	return b, nil
+}
+
+// uint reads a big-endian unsigned integer of size bytes
+func (r *msgpackReader) uint(size int) (uint64, error) {
+	b, err := r.next(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (r *msgpackReader) value() (any, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return r.mapOf(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return r.array(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		return r.str(int(c & 0x1f))
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.next(int(n))
+		return append([]byte(nil), data...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := r.uint(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return r.ext(int(n))
+	case 0xca:
+		n, err := r.uint(4)
+		return float64(math.Float32frombits(uint32(n))), err
+	case 0xcb:
+		n, err := r.uint(8)
+		return math.Float64frombits(n), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n, err := r.uint(1 << (c - 0xcc))
+		if n > math.MaxInt64 {
+			return n, err
+		}
+		return int64(n), err
+	case 0xd0:
+		n, err := r.uint(1)
+		return int64(int8(n)), err
+	case 0xd1:
+		n, err := r.uint(2)
+		return int64(int16(n)), err
+	case 0xd2:
+		n, err := r.uint(4)
+		return int64(int32(n)), err
+	case 0xd3:
+		n, err := r.uint(8)
+		return int64(n), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return r.ext(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return r.str(int(n))
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.array(int(n))
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.mapOf(int(n))
+	}
+	return nil, fmt.Errorf("msgpack: invalid type byte %#x", c)
+}
+
+func (r *msgpackReader) str(n int) (any, error) {
+	b, err := r.next(n)
+	return string(b), err
+}
+
+func (r *msgpackReader) array(n int) (any, error) {
+	if n > len(r.b) {
+		return nil, errors.New("msgpack: truncated data")
+	}
+	items := make([]any, n)
+	for i := range items {
+		var err error
+		if items[i], err = r.value(); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (r *msgpackReader) mapOf(n int) (map[string]any, error) {
+	if n > len(r.b) {
+		return nil, errors.New("msgpack: truncated data")
+	}
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		k, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		v, err := r.value()
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+// ext decodes an extension of n data bytes; only timestamps are known
+func (r *msgpackReader) ext(n int) (any, error) {
+	t, err := r.next(1)
+	if err != nil {
+		return nil, err
+	}
+	data, err := r.next(n)
+	if err != nil {
+		return nil, err
+	}
+	if int8(t[0]) != -1 {
+		return nil, fmt.Errorf("msgpack: unknown extension type %d", int8(t[0]))
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		return time.Unix(int64(binary.BigEndian.Uint64(data[4:])), int64(nsec)).UTC(), nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid timestamp length %d", n)
+}
+
+// assignValue stores a generic value, as decoded by msgpackReader or
+// Schema.Decode, into dst, converting between compatible kinds
+func assignValue(dst reflect.Value, v any) error {
+	if v == nil {
+		dst.SetZero()
+		return nil
+	}
+	src := reflect.ValueOf(v)
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return assignValue(dst.Elem(), v)
+	}
+	if dst.Kind() == reflect.Interface && dst.NumMethod() == 0 {
+		dst.Set(src)
+		return nil
+	}
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	if d, ok := v.(time.Duration); ok && dst.Type() == timeOfDayType {
+		t, err := TimeOfDayFromDuration(d)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if s, ok := v.(string); ok && dst.Type() == fixedType {
+		x, err := ParseFixedPoint(s, -1)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(x))
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := toInt64(v); ok && !dst.OverflowInt(n) {
+			dst.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u, ok := v.(uint64); ok && !dst.OverflowUint(u) {
+			dst.SetUint(u)
+			return nil
+		}
+		if n, ok := toInt64(v); ok && n >= 0 && !dst.OverflowUint(uint64(n)) {
+			dst.SetUint(uint64(n))
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if x, ok := toFloat64(v); ok {
+			dst.SetFloat(x)
+			return nil
+		}
+	case reflect.String:
+		if b, ok := v.([]byte); ok {
+			dst.SetString(string(b))
+			return nil
+		}
+	case reflect.Slice:
+		if s, ok := v.(string); ok && dst.Type().Elem().Kind() == reflect.Uint8 {
+			dst.SetBytes([]byte(s))
+			return nil
+		}
+		items, ok := v.([]any)
+		if !ok {
+			break
+		}
+		slice := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := assignValue(slice.Index(i), item); err != nil {
+				return err
+			}
+		}
+		dst.Set(slice)
+		return nil
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok || dst.Type().Key().Kind() != reflect.String {
+			break
+		}
+		out := reflect.MakeMapWithSize(dst.Type(), len(m))
+		for k, item := range m {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assignValue(elem, item); err != nil {
+				return err
+			}
+			out.SetMapIndex(reflect.ValueOf(k).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(out)
+		return nil
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			break
+		}
+		return assignStruct(dst, m)
+	}
+	return fmt.Errorf("cannot assign %T to %s", v, dst.Type())
+}
+
+// assignStruct stores map entries into the struct fields of the same
+// MessagePack name
+func assignStruct(dst reflect.Value, m map[string]any) error {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, skip := msgpackTag(sf)
+		if skip {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("msgpack") == "" && sf.Type.Kind() == reflect.Struct {
+			if err := assignStruct(dst.Field(i), m); err != nil {
+				return err
+			}
+			continue
+		}
+		v, ok := m[name]
+		if !ok {
+			continue
+		}
+		if err := assignValue(dst.Field(i), v); err != nil {
+			return fmt.Errorf("field %s: %w", name, err)
+		}
+	}
+	return nil
+}
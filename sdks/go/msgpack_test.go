@@ -0,0 +1,158 @@
+package xtrieve
+
+import (
+	"encoding/hex"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type msgpackItem struct {
+	SKU   string   `msgpack:"sku"`
+	Qty   int      `msgpack:"qty,omitempty"`
+	Tags  []string `msgpack:"tags"`
+	Note  string   `msgpack:"-"`
+	Price FixedPoint
+	When  time.Time
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"true", true},
+		{"positive fixint", int64(127)},
+		{"negative fixint", int64(-32)},
+		{"int8", int64(-128)},
+		{"uint8", int64(255)},
+		{"int16", int64(-32768)},
+		{"uint16", int64(65535)},
+		{"int32", int64(math.MinInt32)},
+		{"uint32", int64(math.MaxUint32)},
+		{"int64", int64(math.MinInt64)},
+		{"uint64", uint64(math.MaxUint64)},
+		{"float32", float32(1.5)},
+		{"float64", -2.25},
+		{"fixstr", strings.Repeat("a", 31)},
+		{"str8", strings.Repeat("b", 32)},
+		{"str16", strings.Repeat("c", 256)},
+		{"str32", strings.Repeat("d", 65536)},
+		{"bin", []byte{0, 1, 2, 0xff}},
+		{"array", []int64{1, -1, 1 << 40}},
+		{"array16", make([]string, 16)},
+		{"map", map[string]int64{"a": 1, "b": -2}},
+		{"time seconds", time.Unix(1700000000, 0).UTC()},
+		{"time nanoseconds", time.Unix(1700000000, 123456789).UTC()},
+		{"time before 1970", time.Unix(-1, 5).UTC()},
+		{"time far future", time.Unix(1<<34, 0).UTC()},
+		{"struct", msgpackItem{SKU: "A-1", Qty: 3, Tags: []string{"x"}, Price: NewFixedPoint(1230, 2),
+			When: time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		data, err := MarshalMsgpack(tt.v)
+		if err != nil {
+			t.Errorf("%s: MarshalMsgpack: %v", tt.name, err)
+			continue
+		}
+		got := reflect.New(reflect.TypeOf(tt.v))
+		if err := UnmarshalMsgpack(data, got.Interface()); err != nil {
+			t.Errorf("%s: UnmarshalMsgpack: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Elem().Interface(), tt.v) {
+			t.Errorf("%s: round trip = %v, want %v", tt.name, got.Elem().Interface(), tt.v)
+		}
+	}
+}
+
+func TestMsgpackEncoding(t *testing.T) {
+	// Integers outside the fixint range use the signed formats
+	tests := []struct {
+		v    any
+		want string
+	}{
+		{nil, "c0"},
+		{false, "c2"},
+		{int64(5), "05"},
+		{int64(-1), "ff"},
+		{int64(-33), "d0df"},
+		{int64(128), "d10080"},
+		{int64(1 << 16), "d200010000"},
+		{uint64(math.MaxUint64), "cfffffffffffffffff"},
+		{"hi", "a26869"},
+		{[]byte{1}, "c40101"},
+		{[]int64{1, 2}, "920102"},
+		{map[string]bool{"a": true}, "81a161c3"},
+		{time.Unix(1, 0), "d6ff00000001"},
+		{struct {
+			A int `msgpack:"a,omitempty"`
+			B int `msgpack:"b"`
+		}{}, "81a16200"},
+	}
+	for _, tt := range tests {
+		data, err := MarshalMsgpack(tt.v)
+		if err != nil {
+			t.Errorf("MarshalMsgpack(%#v): %v", tt.v, err)
+			continue
+		}
+		if got := hex.EncodeToString(data); got != tt.want {
+			t.Errorf("MarshalMsgpack(%#v) = %s, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestMsgpackInvalid(t *testing.T) {
+	tests := map[string]string{
+		"empty":           "",
+		"truncated str":   "a368",
+		"truncated int":   "cd01",
+		"truncated map":   "82a161c3",
+		"trailing bytes":  "c0c0",
+		"reserved type":   "c1",
+		"bad timestamp":   "d5ff0000",
+		"truncated array": "dc0002",
+	}
+	for name, in := range tests {
+		data, _ := hex.DecodeString(in)
+		var v any
+		if err := UnmarshalMsgpack(data, &v); err == nil {
+			t.Errorf("%s: UnmarshalMsgpack(%s) = %v, want an error", name, in, v)
+		}
+	}
+}
+
+func TestDocumentRoundTrip(t *testing.T) {
+	s, err := NewSchema(
+		Field{Name: "id", Length: 4, Type: KeyTypeUnsignedBinary},
+		Field{Name: "name", Offset: 4, Length: 10, Type: KeyTypeString},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Document = true
+
+	tests := []map[string]any{
+		{"id": uint64(1), "name": "plain"},
+		{"id": uint64(2), "name": "doc", "tags": []any{"a", "b"}, "n": int64(-7)},
+		{"id": uint64(3), "name": "", "nested": map[string]any{"ok": true, "at": nil}},
+	}
+	for _, values := range tests {
+		record, err := s.Encode(values)
+		if err != nil {
+			t.Errorf("Encode(%v): %v", values, err)
+			continue
+		}
+		// Variable-length files may return the record padded
+		got, err := s.Decode(append(record, 0, 0, 0))
+		if err != nil {
+			t.Errorf("Decode(%v): %v", values, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, values) {
+			t.Errorf("round trip = %v, want %v", got, values)
+		}
+	}
+}
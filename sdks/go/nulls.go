@@ -0,0 +1,65 @@
+package xtrieve
+
+import "fmt"
+
+// checkNullable validates the null indicator of a nullable field
+func (f Field) checkNullable() error {
+	if !f.Nullable {
+		return nil
+	}
+	if f.Offset < 1 {
+		return fmt.Errorf("field %s: nullable fields need a null indicator byte before them", f.Name)
+	}
+	if f.Encrypted {
+		return fmt.Errorf("field %s: nullable fields cannot be encrypted", f.Name)
+	}
+	if f.Bits > 0 {
+		return fmt.Errorf("field %s: bit fields cannot be nullable", f.Name)
+	}
+	return nil
+}
+
+// indicator returns the null indicator byte of a nullable field
+func (f Field) indicator(record []byte) (*byte, error) {
+	if f.Offset < 1 || f.Offset > len(record) {
+		return nil, fmt.Errorf("field %s: no room for the null indicator at offset %d", f.Name, f.Offset-1)
+	}
+	return &record[f.Offset-1], nil
+}
+
+// KeySpecs returns the key segments indexing the field with flags: for a
+// nullable field a null indicator segment followed by the value, which
+// the engine keeps together as one column, else the value alone. Set
+// KeyFlagSegmented on the last segment to continue the key with another
+// field.
+func (f Field) KeySpecs(flags uint16) []KeySpec {
+	value := KeySpec{Position: uint16(f.Offset), Length: uint16(f.Length), Flags: flags, Type: f.Type}
+	if !f.Nullable {
+		return []KeySpec{value}
+	}
+	return []KeySpec{
+		{Position: uint16(f.Offset - 1), Length: 1, Flags: flags | KeyFlagSegmented | KeyFlagExtendedType, Type: KeyTypeNullIndicator},
+		value,
+	}
+}
+
+// SearchKey returns value as the field's part of a search key: its
+// encoded bytes, preceded by the null indicator for a nullable field. A
+// nil value searches for null.
+func (f Field) SearchKey(value any) ([]byte, error) {
+	g := f
+	g.Offset = 0
+	if f.Nullable {
+		g.Offset = 1
+	}
+	key := make([]byte, g.Offset+g.Length)
+	if err := g.Encode(key, value); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// isNull reports whether a null indicator segment's value marks null
+func isNull(b []byte) bool {
+	return len(b) > 0 && b[0] != 0
+}
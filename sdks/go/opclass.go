@@ -0,0 +1,44 @@
+package xtrieve
+
+import "fmt"
+
+// OpClass groups operations by how long they may take, so that each
+// class can have its own timeout (see DialOptions.ScanTimeout)
+type OpClass uint8
+
+const (
+	// ClassPoint covers single-record reads and writes and everything
+	// not in another class
+	ClassPoint OpClass = iota
+	// ClassScan covers the extended operations, which read or skip many
+	// records per request
+	ClassScan
+	// ClassBulk covers pipelined batches such as Batch and GetMany, timed
+	// as a whole
+	ClassBulk
+	// ClassCreate covers Create and Extend
+	ClassCreate
+
+	classCount
+)
+
+var opClassNames = [classCount]string{"point", "scan", "bulk", "create"}
+
+func (c OpClass) String() string {
+	if c < classCount {
+		return opClassNames[c]
+	}
+	return fmt.Sprintf("OpClass(%d)", int(c))
+}
+
+// OpClassOf returns the class of a single operation; pipelined batches
+// are ClassBulk whatever their operations
+func OpClassOf(op uint16) OpClass {
+	switch op {
+	case OpGetNextExtended, OpGetPrevExtended, OpStepNextExtended, OpStepPrevExtended:
+		return ClassScan
+	case OpCreate, OpExtend:
+		return ClassCreate
+	}
+	return ClassPoint
+}
@@ -0,0 +1,90 @@
+package xtrieve
+
+import "fmt"
+
+// Owner access modes for SetOwner. On a Btrieve engine with owner
+// support, the encrypted modes also have the engine encrypt the file's
+// data on disk with the owner name.
+//
+// Owner names need such an engine. xtrieved does not dispatch Set Owner
+// and Clear Owner, which fail with StatusInvalidOperation, and ignores the
+// owner name at Open, so its files are neither protected nor encrypted.
+const (
+	// OwnerRequired needs the owner name for any access
+	OwnerRequired = 0
+	// OwnerReadOnly allows reading without the owner name
+	OwnerReadOnly = 1
+	// OwnerEncrypted needs the owner name for any access and encrypts
+	OwnerEncrypted = 2
+	// OwnerReadOnlyEncrypted allows reading without the owner name and
+	// encrypts
+	OwnerReadOnlyEncrypted = 3
+)
+
+// OpenOwner opens a file protected by an owner name. An empty owner opens
+// the file as Open does.
+func (c *Client) OpenOwner(filePath string, mode int16, owner string) (*Response, error) {
+	return c.Execute(&Request{
+		Operation:  OpOpen,
+		FilePath:   filePath,
+		KeyNumber:  mode,
+		DataBuffer: ownerBuffer(owner),
+	})
+}
+
+// OpenFileOwner is like OpenFile for a file protected by an owner name.
+// The name is kept to reopen the file after a reconnect.
+func (c *Client) OpenFileOwner(filePath string, mode int16, owner string) (*File, error) {
+	return c.openFile(filePath, mode, owner)
+}
+
+// SetOwner protects the file with an owner name, required for the access
+// given by one of the Owner modes. The file must be open exclusively; with
+// an encrypted mode an engine with owner support encrypts every record
+// before returning. xtrieved answers StatusInvalidOperation.
+func (f *File) SetOwner(owner string, access int16) (*Response, error) {
+	if owner == "" {
+		return nil, fmt.Errorf("xtrieve: empty owner name")
+	}
+	buf := ownerBuffer(owner)
+	resp, err := f.exec(&Request{
+		Operation:  OpSetOwner,
+		DataBuffer: buf,
+		KeyBuffer:  buf,
+		KeyNumber:  access,
+	})
+	if err == nil && resp.StatusCode == StatusSuccess {
+		f.owner = owner
+	}
+	return resp, err
+}
+
+// ClearOwner removes the owner name, decrypting the file if it was
+// encrypted. The file must have been opened with its owner name.
+// xtrieved answers StatusInvalidOperation.
+func (f *File) ClearOwner() (*Response, error) {
+	resp, err := f.exec(&Request{Operation: OpClearOwner})
+	if err == nil && resp.StatusCode == StatusSuccess {
+		f.owner = ""
+	}
+	return resp, err
+}
+
+// ownerBuffer returns an owner name as the engine expects it, terminated
+// by a NUL, or nil for no owner
+func ownerBuffer(owner string) []byte {
+	if owner == "" {
+		return nil
+	}
+	return append([]byte(owner), 0)
+}
+
+// checkOpen checks an Open response, telling a missing owner name apart
+// from a wrong one
+func checkOpen(resp *Response, owner string) error {
+	err := checkStatus(OpOpen, resp)
+	if resp.StatusCode == StatusInvalidOwner && owner == "" {
+		return fmt.Errorf("%w: %w", ErrOwnerRequired, err)
+	}
+	return err
+}
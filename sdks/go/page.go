@@ -0,0 +1,119 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrInvalidPageToken is returned when a page token cannot be decoded or was
+// issued for a different key
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+const pageTokenVersion = 1
+
+// Page is one page of records returned by File.Page
+type Page struct {
+	Records [][]byte
+	Keys    [][]byte
+	// NextToken continues after the last record; empty on the last page
+	NextToken string
+}
+
+// pageToken is the decoded form of an opaque page token. Skip counts the
+// records sharing Key that were already returned, so duplicate keys
+// spanning a page boundary are neither repeated nor lost.
+type pageToken struct {
+	keyNumber int16
+	skip      uint32
+	key       []byte
+}
+
+// Page returns up to pageSize records in the order of keyNumber, starting
+// after the position encoded in token (or at the first record when the
+// token is empty). Tokens encode the last key rather than a position block,
+// so they stay valid across connections and server restarts.
+func (f *File) Page(keyNumber int16, token string, pageSize int) (*Page, error) {
+	if pageSize <= 0 {
+		return nil, errors.New("page size must be positive")
+	}
+
+	var (
+		resp *Response
+		err  error
+		skip uint32
+		last []byte
+	)
+	if token == "" {
+		resp, err = f.GetFirst(keyNumber)
+	} else {
+		var tok pageToken
+		if tok, err = decodePageToken(token); err != nil {
+			return nil, err
+		}
+		if tok.keyNumber != keyNumber {
+			return nil, ErrInvalidPageToken
+		}
+		skip, last = tok.skip, tok.key
+		resp, err = f.Get(OpGetGreaterOrEqual, tok.key, keyNumber)
+	}
+
+	page := &Page{}
+	for n := uint32(0); ; n++ {
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == StatusEndOfFile || resp.StatusCode == StatusKeyNotFound {
+			return page, nil
+		}
+		if err := checkStatus(OpGetNext, resp); err != nil {
+			return nil, err
+		}
+
+		// Skip duplicates of the previous page's last key
+		if n >= skip || !bytes.Equal(resp.KeyBuffer, last) {
+			if len(page.Records) == pageSize {
+				break
+			}
+			page.Records = append(page.Records, resp.DataBuffer)
+			page.Keys = append(page.Keys, resp.KeyBuffer)
+		}
+
+		resp, err = f.GetNext(keyNumber)
+	}
+
+	// More records follow: count trailing duplicates of the last key
+	lastKey := page.Keys[len(page.Keys)-1]
+	var dups uint32
+	for i := len(page.Keys) - 1; i >= 0 && bytes.Equal(page.Keys[i], lastKey); i-- {
+		dups++
+	}
+	if int(dups) == len(page.Keys) && bytes.Equal(lastKey, last) {
+		dups += skip
+	}
+
+	page.NextToken = encodePageToken(pageToken{keyNumber: keyNumber, skip: dups, key: lastKey})
+	return page, nil
+}
+
+func encodePageToken(tok pageToken) string {
+	buf := make([]byte, 7+len(tok.key))
+	buf[0] = pageTokenVersion
+	binary.LittleEndian.PutUint16(buf[1:], uint16(tok.keyNumber))
+	binary.LittleEndian.PutUint32(buf[3:], tok.skip)
+	copy(buf[7:], tok.key)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func decodePageToken(s string) (pageToken, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) < 7 || buf[0] != pageTokenVersion {
+		return pageToken{}, ErrInvalidPageToken
+	}
+	return pageToken{
+		keyNumber: int16(binary.LittleEndian.Uint16(buf[1:])),
+		skip:      binary.LittleEndian.Uint32(buf[3:]),
+		key:       buf[7:],
+	}, nil
+}
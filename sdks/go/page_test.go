@@ -0,0 +1,205 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// memFile answers the key-order Get operations for one key from records
+// held in memory, sorted by key and then by insertion like duplicates on
+// the server
+type memFile struct {
+	keys    [][]byte
+	records [][]byte
+	cursor  int
+}
+
+// newMemFile returns a File whose operations memFile answers through an
+// interceptor, without a connection
+func newMemFile(keys ...string) (*File, *memFile) {
+	m := &memFile{}
+	for i, k := range keys {
+		m.insert(k, fmt.Sprintf("%s#%d", k, i))
+	}
+	c := &Client{}
+	c.Use(m.intercept)
+	return &File{client: c, posBlock: make([]byte, PositionBlockSize), scratch: make([]byte, PositionBlockSize)}, m
+}
+
+func (m *memFile) insert(key, record string) {
+	i := sort.Search(len(m.keys), func(i int) bool { return string(m.keys[i]) > key })
+	m.keys = append(m.keys[:i], append([][]byte{[]byte(key)}, m.keys[i:]...)...)
+	m.records = append(m.records[:i], append([][]byte{[]byte(record)}, m.records[i:]...)...)
+}
+
+func (m *memFile) delete(key string) {
+	for i := 0; i < len(m.keys); {
+		if string(m.keys[i]) == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			m.records = append(m.records[:i], m.records[i+1:]...)
+		} else {
+			i++
+		}
+	}
+}
+
+func (m *memFile) intercept(_ context.Context, req *Request, resp *Response, _ Handler) error {
+	switch req.Operation {
+	case OpGetFirst:
+		m.cursor = 0
+	case OpGetGreaterOrEqual:
+		m.cursor = sort.Search(len(m.keys), func(i int) bool { return bytes.Compare(m.keys[i], req.KeyBuffer) >= 0 })
+	case OpGetNext:
+		m.cursor++
+	default:
+		return fmt.Errorf("memFile: %s", OpName(req.Operation))
+	}
+	if m.cursor >= len(m.keys) {
+		resp.StatusCode = StatusEndOfFile
+		return nil
+	}
+	resp.StatusCode = StatusSuccess
+	resp.KeyBuffer = m.keys[m.cursor]
+	resp.DataBuffer = m.records[m.cursor]
+	return nil
+}
+
+// allPages reads every page and returns the records in order
+func allPages(t *testing.T, f *File, pageSize int) []string {
+	t.Helper()
+	var got []string
+	token := ""
+	for n := 0; ; n++ {
+		if n > 100 {
+			t.Fatal("paging does not end")
+		}
+		page, err := f.Page(0, token, pageSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Records) > pageSize {
+			t.Fatalf("page of %d records, want at most %d", len(page.Records), pageSize)
+		}
+		for _, r := range page.Records {
+			got = append(got, string(r))
+		}
+		if page.NextToken == "" {
+			return got
+		}
+		token = page.NextToken
+	}
+}
+
+func TestPageTokenEncoding(t *testing.T) {
+	tests := []pageToken{
+		{keyNumber: 0, skip: 0, key: []byte{}},
+		{keyNumber: 3, skip: 1, key: []byte("b")},
+		{keyNumber: -1, skip: 1 << 31, key: []byte{0, 0xFF, 0}},
+	}
+	for _, tok := range tests {
+		s := encodePageToken(tok)
+		got, err := decodePageToken(s)
+		if err != nil || !reflect.DeepEqual(got, tok) {
+			t.Errorf("decodePageToken(encodePageToken(%+v)) = %+v, %v", tok, got, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"not base64":    "!!!",
+		"padded base64": base64.URLEncoding.EncodeToString([]byte{1, 0, 0, 0, 0, 0, 0, 'k'}),
+		"too short":     base64.RawURLEncoding.EncodeToString([]byte{1, 0, 0, 0, 0, 0}),
+		"other version": base64.RawURLEncoding.EncodeToString([]byte{2, 0, 0, 0, 0, 0, 0}),
+	}
+	for name, s := range invalid {
+		if tok, err := decodePageToken(s); !errors.Is(err, ErrInvalidPageToken) {
+			t.Errorf("%s: decodePageToken(%q) = %+v, %v, want ErrInvalidPageToken", name, s, tok, err)
+		}
+	}
+
+	f, _ := newMemFile("a", "b")
+	other := encodePageToken(pageToken{keyNumber: 1, key: []byte("a")})
+	if _, err := f.Page(0, other, 10); !errors.Is(err, ErrInvalidPageToken) {
+		t.Errorf("Page with a token of key 1 = %v, want ErrInvalidPageToken", err)
+	}
+	if _, err := f.Page(0, "", 0); err == nil {
+		t.Error("Page with page size 0 succeeded")
+	}
+}
+
+func TestPageDuplicates(t *testing.T) {
+	tests := [][]string{
+		{"a", "b", "c", "d", "e"},
+		{"a", "b", "b", "b", "b", "c"}, // duplicates straddle every boundary
+		{"b", "b", "b", "b", "b"},      // pages made only of duplicates
+		{"a", "a", "b", "b", "c", "c", "c"},
+		{},
+	}
+	for _, keys := range tests {
+		f, m := newMemFile(keys...)
+		var want []string
+		for _, r := range m.records {
+			want = append(want, string(r))
+		}
+		for size := 1; size <= len(keys)+1; size++ {
+			if got := allPages(t, f, size); !reflect.DeepEqual(got, want) {
+				t.Errorf("keys %v in pages of %d = %v, want %v", keys, size, got, want)
+			}
+		}
+	}
+}
+
+func TestPageStaleToken(t *testing.T) {
+	page := func(f *File, token string) ([]string, string) {
+		t.Helper()
+		p, err := f.Page(0, token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var records []string
+		for _, r := range p.Records {
+			records = append(records, string(r))
+		}
+		return records, p.NextToken
+	}
+
+	// The last key of the page is deleted: continue at the next key
+	f, m := newMemFile("a", "b", "c", "d")
+	_, token := page(f, "")
+	m.delete("b")
+	m.insert("ba", "ba#new")
+	if got, _ := page(f, token); !reflect.DeepEqual(got, []string{"ba#new", "c#2"}) {
+		t.Errorf("after deleting the last key: %v, want ba#new, c#2", got)
+	}
+
+	// A duplicate of the last key is deleted: the skip count may then pass
+	// over a remaining duplicate, but never over the next key
+	f, m = newMemFile("b", "b", "b", "c")
+	_, token = page(f, "")
+	m.records = m.records[1:]
+	m.keys = m.keys[1:]
+	if got, _ := page(f, token); !reflect.DeepEqual(got, []string{"c#3"}) {
+		t.Errorf("after deleting a duplicate: %v, want c#3", got)
+	}
+
+	// Duplicates added after the page are returned with the next one
+	f, m = newMemFile("a", "b", "c")
+	_, token = page(f, "")
+	m.insert("b", "b#new")
+	if got, _ := page(f, token); !reflect.DeepEqual(got, []string{"b#new", "c#2"}) {
+		t.Errorf("after adding a duplicate: %v, want b#new, c#2", got)
+	}
+
+	// Every record is gone: an empty last page
+	f, m = newMemFile("a", "b", "c")
+	_, token = page(f, "")
+	m.keys, m.records = nil, nil
+	if got, next := page(f, token); len(got) != 0 || next != "" {
+		t.Errorf("after deleting every record: %v, %q, want an empty last page", got, next)
+	}
+}
@@ -0,0 +1,125 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// PartialKeyBounds completes a partial key, such as the leading segments
+// of a composite key, into the lowest and highest full keys that start
+// with it. The remaining bytes are filled with the smallest or largest
+// value of each segment's type, taking descending segments into account.
+// A partial key should end on a segment boundary unless the segment it
+// ends in is a string.
+func PartialKeyBounds(segments []KeySpec, partial []byte) (low, high []byte) {
+	offset := 0
+	for _, seg := range segments {
+		end := offset + int(seg.Length)
+		switch {
+		case len(partial) >= end:
+			low = append(low, partial[offset:end]...)
+			high = append(high, partial[offset:end]...)
+		case len(partial) > offset:
+			// Partial string segment: pad with the lowest and highest bytes
+			given := partial[offset:]
+			low = append(low, given...)
+			high = append(high, given...)
+			fill := end - len(partial)
+			lo, hi := byte(0x00), byte(0xFF)
+			if seg.Flags&KeyFlagDescending != 0 {
+				lo, hi = hi, lo
+			}
+			low = appendFill(low, lo, fill)
+			high = appendFill(high, hi, fill)
+		default:
+			min, max := segmentBounds(seg)
+			if seg.Flags&KeyFlagDescending != 0 {
+				min, max = max, min
+			}
+			low = append(low, min...)
+			high = append(high, max...)
+		}
+		offset = end
+	}
+	return low, high
+}
+
+// segmentBounds returns the smallest and largest values of a segment
+func segmentBounds(seg KeySpec) (min, max []byte) {
+	n := int(seg.Length)
+	min = make([]byte, n)
+	max = appendFill(nil, 0xFF, n)
+
+	switch seg.Type {
+	case KeyTypeInteger:
+		if n > 0 {
+			min[n-1] = 0x80
+			max[n-1] = 0x7F
+		}
+	case KeyTypeFloat:
+		switch n {
+		case 4:
+			binary.LittleEndian.PutUint32(min, math.Float32bits(float32(math.Inf(-1))))
+			binary.LittleEndian.PutUint32(max, math.Float32bits(float32(math.Inf(1))))
+		case 8:
+			binary.LittleEndian.PutUint64(min, math.Float64bits(math.Inf(-1)))
+			binary.LittleEndian.PutUint64(max, math.Float64bits(math.Inf(1)))
+		}
+	}
+	return min, max
+}
+
+func appendFill(b []byte, v byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		b = append(b, v)
+	}
+	return b
+}
+
+// GetEqualPartial gets the first record whose key starts with partial.
+// The file is positioned with Get Greater or Equal on the padded key;
+// when the record found does not match, StatusKeyNotFound is reported
+// as GetEqual would, although the position has moved.
+func (f *File) GetEqualPartial(partial []byte, keyNumber int16) (*Response, error) {
+	segments := f.KeySegments(keyNumber)
+	low, high := PartialKeyBounds(segments, partial)
+
+	resp, err := f.Get(OpGetGreaterOrEqual, low, keyNumber)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case StatusSuccess:
+		// The high bound's 0xFF padding only sorts last bytewise; under a
+		// collation compare the record's key prefix instead
+		if coll := f.Collation(keyNumber); coll != nil {
+			if CompareKeyCollated(segments, coll, sliceRange(resp.KeyBuffer, 0, len(partial)), partial) != 0 {
+				resp.StatusCode = StatusKeyNotFound
+			}
+		} else if CompareKey(segments, resp.KeyBuffer, high) > 0 {
+			resp.StatusCode = StatusKeyNotFound
+		}
+	case StatusEndOfFile:
+		resp.StatusCode = StatusKeyNotFound
+	}
+	return resp, nil
+}
+
+// GetGreaterOrEqualPartial gets the first record whose key is greater
+// than or equal to partial completed with the lowest values
+func (f *File) GetGreaterOrEqualPartial(partial []byte, keyNumber int16) (*Response, error) {
+	low, _ := PartialKeyBounds(f.KeySegments(keyNumber), partial)
+	return f.Get(OpGetGreaterOrEqual, low, keyNumber)
+}
+
+// Prefix returns an iterator over the records whose key starts with
+// partial, e.g. every order of a customer on a (customer, date) key.
+// On a key with a collation the scan ends at the first key that does not
+// start with partial under the collation.
+func (f *File) Prefix(keyNumber int16, partial []byte) *Iterator {
+	low, high := PartialKeyBounds(f.KeySegments(keyNumber), partial)
+	if f.Collation(keyNumber) != nil {
+		return &Iterator{file: f, keyNumber: keyNumber, from: low, prefix: partial}
+	}
+	return f.Range(keyNumber, low, high)
+}
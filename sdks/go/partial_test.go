@@ -0,0 +1,73 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestPartialKeyBounds(t *testing.T) {
+	f32 := func(x float64) []byte {
+		return binary.LittleEndian.AppendUint32(nil, math.Float32bits(float32(x)))
+	}
+	customerDate := []KeySpec{
+		{Length: 4, Flags: KeyFlagSegmented, Type: KeyTypeInteger},
+		{Length: 4, Type: KeyTypeDate},
+	}
+	nameScore := []KeySpec{
+		{Length: 4, Flags: KeyFlagSegmented, Type: KeyTypeString},
+		{Length: 2, Flags: KeyFlagDescending, Type: KeyTypeInteger},
+	}
+	tests := []struct {
+		name      string
+		segments  []KeySpec
+		partial   []byte
+		low, high []byte
+	}{
+		{"leading segment", customerDate, le32(42),
+			cat(le32(42), []byte{0, 0, 0, 0}), cat(le32(42), []byte{0xFF, 0xFF, 0xFF, 0xFF})},
+		{"full key", customerDate, cat(le32(42), le32(7)), cat(le32(42), le32(7)), cat(le32(42), le32(7))},
+		{"empty", customerDate, nil,
+			cat([]byte{0, 0, 0, 0x80}, []byte{0, 0, 0, 0}), cat([]byte{0xFF, 0xFF, 0xFF, 0x7F}, []byte{0xFF, 0xFF, 0xFF, 0xFF})},
+		{"partial string", nameScore, []byte("ab"),
+			cat([]byte("ab\x00\x00"), le16(math.MaxInt16)), cat([]byte("ab\xFF\xFF"), le16(math.MinInt16))},
+		{"string then descending integer", nameScore, []byte("abcd"),
+			cat([]byte("abcd"), le16(math.MaxInt16)), cat([]byte("abcd"), le16(math.MinInt16))},
+		{"descending partial string", []KeySpec{{Length: 3, Flags: KeyFlagDescending, Type: KeyTypeString}}, []byte("a"),
+			[]byte("a\xFF\xFF"), []byte("a\x00\x00")},
+		{"float", []KeySpec{{Length: 4, Type: KeyTypeFloat}}, nil, f32(math.Inf(-1)), f32(math.Inf(1))},
+		{"descending float", []KeySpec{{Length: 4, Flags: KeyFlagDescending, Type: KeyTypeFloat}}, nil,
+			f32(math.Inf(1)), f32(math.Inf(-1))},
+		{"unsigned", []KeySpec{{Length: 2, Type: KeyTypeUnsignedBinary}}, nil, []byte{0, 0}, []byte{0xFF, 0xFF}},
+	}
+	for _, tt := range tests {
+		low, high := PartialKeyBounds(tt.segments, tt.partial)
+		if !bytes.Equal(low, tt.low) || !bytes.Equal(high, tt.high) {
+			t.Errorf("%s: PartialKeyBounds(%x) = %x, %x, want %x, %x", tt.name, tt.partial, low, high, tt.low, tt.high)
+		}
+		// Every full key starting with partial lies between the bounds
+		if CompareKey(tt.segments, low, high) > 0 {
+			t.Errorf("%s: low bound %x sorts after high bound %x", tt.name, low, high)
+		}
+	}
+}
+
+func TestPartialKeyBoundsOrder(t *testing.T) {
+	segments := []KeySpec{
+		{Length: 2, Flags: KeyFlagSegmented, Type: KeyTypeInteger},
+		{Length: 2, Flags: KeyFlagDescending, Type: KeyTypeInteger},
+	}
+	low, high := PartialKeyBounds(segments, le16(5))
+	for _, second := range []int16{math.MinInt16, -1, 0, 1, math.MaxInt16} {
+		key := cat(le16(5), le16(second))
+		if CompareKey(segments, low, key) > 0 || CompareKey(segments, key, high) > 0 {
+			t.Errorf("key (5, %d) lies outside [%x, %x]", second, low, high)
+		}
+	}
+	for _, key := range [][]byte{cat(le16(4), le16(math.MinInt16)), cat(le16(6), le16(math.MaxInt16))} {
+		if CompareKey(segments, low, key) <= 0 && CompareKey(segments, key, high) <= 0 {
+			t.Errorf("key %x lies inside [%x, %x]", key, low, high)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+// MaxPercentage is 100% in the hundredths of a percent used by percentage
+// positioning
+const MaxPercentage = 10000
+
+// GetByPercentage gets the record at pct hundredths of a percent (0 to
+// MaxPercentage) through the index of keyNumber, or through the file's
+// physical order with keyNumber -1.
+//
+// Servers without percentage positioning, such as xtrieved, answer
+// StatusInvalidOperation. The record is then found by stepping from the
+// nearer end of the index or file, reading up to half of it; the client
+// remembers the answer and steps straight away from then on.
+func (f *File) GetByPercentage(pct int, keyNumber int16) (*Response, error) {
+	resp, err := f.getByPercentage(pct, keyNumber)
+	if err != nil || resp.StatusCode != StatusInvalidOperation {
+		return resp, err
+	}
+	return f.stepToPercentage(pct, keyNumber)
+}
+
+// getByPercentage is GetByPercentage without the fallback, answering
+// StatusInvalidOperation without a round trip once the server did
+func (f *File) getByPercentage(pct int, keyNumber int16) (*Response, error) {
+	if pct < 0 || pct > MaxPercentage {
+		return nil, fmt.Errorf("xtrieve: percentage %d out of range", pct)
+	}
+	if f.client.noPercentage.Load() {
+		return &Response{StatusCode: StatusInvalidOperation}, nil
+	}
+	data := make([]byte, max(4, f.recordLength))
+	binary.LittleEndian.PutUint32(data, uint32(pct))
+	resp, err := f.exec(&Request{
+		Operation:  OpGetByPercentage,
+		DataBuffer: data,
+		KeyNumber:  keyNumber,
+	})
+	if err == nil && resp.StatusCode == StatusInvalidOperation {
+		f.client.noPercentage.Store(true)
+	}
+	return resp, err
+}
+
+// stepToPercentage finds the record at pct by stepping from the nearer end
+// of the index of keyNumber, or of the file with keyNumber -1
+func (f *File) stepToPercentage(pct int, keyNumber int16) (*Response, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	n := RecordAtPercentage(pct, stat.NumRecords)
+	first, next, steps := uint16(OpGetFirst), uint16(OpGetNext), n
+	if stat.NumRecords > 0 && n >= stat.NumRecords/2 {
+		first, next, steps = OpGetLast, OpGetPrevious, stat.NumRecords-1-min(n, stat.NumRecords-1)
+	}
+	resp, err := f.navigate(first, keyNumber)
+	for ; err == nil && resp.StatusCode == StatusSuccess && steps > 0; steps-- {
+		resp, err = f.navigate(next, keyNumber)
+	}
+	return resp, err
+}
+
+// navigate runs a key navigation operation, or its physical counterpart
+// with keyNumber -1
+func (f *File) navigate(op uint16, keyNumber int16) (*Response, error) {
+	if keyNumber >= 0 {
+		return f.Get(op, nil, keyNumber)
+	}
+	switch op {
+	case OpGetFirst:
+		op = OpStepFirst
+	case OpGetLast:
+		op = OpStepLast
+	case OpGetNext:
+		op = OpStepNext
+	case OpGetPrevious:
+		op = OpStepPrevious
+	}
+	return f.exec(&Request{Operation: op})
+}
+
+// FindPercentage returns how far through the index of keyNumber the
+// current record lies, in hundredths of a percent. Without percentage
+// positioning on the server, the records before it are counted, and the
+// position restored.
+func (f *File) FindPercentage(keyNumber int16) (int, error) {
+	pct, err := f.findPercentage(&Request{Operation: OpFindPercentage, KeyNumber: keyNumber})
+	if !IsStatus(err, StatusInvalidOperation) {
+		return pct, err
+	}
+	snapshot := f.SnapshotPosition()
+	defer f.RestorePosition(snapshot)
+	before := uint64(0)
+	for {
+		resp, err := f.GetPrevious(keyNumber)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode == StatusEndOfFile {
+			break
+		}
+		if err := checkStatus(OpGetPrevious, resp); err != nil {
+			return 0, err
+		}
+		before++
+	}
+	return f.percentageOfCount(before)
+}
+
+// FindPercentageAt returns how far through the file's physical order the
+// record at position lies, in hundredths of a percent. Without percentage
+// positioning on the server, the file is stepped through from its start
+// up to the record, and the position restored.
+func (f *File) FindPercentageAt(position uint64) (int, error) {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, position)
+	pct, err := f.findPercentage(&Request{Operation: OpFindPercentage, DataBuffer: data, KeyNumber: -1})
+	if !IsStatus(err, StatusInvalidOperation) {
+		return pct, err
+	}
+	snapshot := f.SnapshotPosition()
+	defer f.RestorePosition(snapshot)
+	before := uint64(0)
+	resp, err := f.StepFirst()
+	for ; err == nil && resp.StatusCode == StatusSuccess; resp, err = f.StepNext() {
+		at, err := f.GetPosition()
+		if err != nil {
+			return 0, err
+		}
+		if at == position {
+			return f.percentageOfCount(before)
+		}
+		before++
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, &StatusError{Operation: OpFindPercentage, Status: StatusInvalidPositioning}
+}
+
+// percentageOfCount returns the percentage of the record with before
+// records ahead of it
+func (f *File) percentageOfCount(before uint64) (int, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return PercentageOf(before, stat.NumRecords), nil
+}
+
+// findPercentage runs a Find Percentage request without the fallback,
+// failing with StatusInvalidOperation without a round trip once the
+// server did
+func (f *File) findPercentage(req *Request) (int, error) {
+	if f.client.noPercentage.Load() {
+		return 0, &StatusError{Operation: OpFindPercentage, Status: StatusInvalidOperation}
+	}
+	resp, err := f.exec(req)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode == StatusInvalidOperation {
+		f.client.noPercentage.Store(true)
+	}
+	if err := checkStatus(OpFindPercentage, resp); err != nil {
+		return 0, err
+	}
+	if len(resp.DataBuffer) < 4 {
+		return 0, &StatusError{Operation: OpFindPercentage, Status: StatusDataBufferTooShort}
+	}
+	return int(binary.LittleEndian.Uint32(resp.DataBuffer)), nil
+}
+
+// PercentageOf returns the percentage, in hundredths, of the nth of total
+// records. It is exact for any 64-bit count, where n*MaxPercentage would
+// overflow.
+func PercentageOf(n, total uint64) int {
+	if total == 0 {
+		return 0
+	}
+	n = min(n, total)
+	hi, lo := bits.Mul64(n, MaxPercentage)
+	q, _ := bits.Div64(hi, lo, total)
+	return int(q)
+}
+
+// RecordAtPercentage returns the index of the record at pct hundredths of
+// a percent of total records, the inverse of PercentageOf
+func RecordAtPercentage(pct int, total uint64) uint64 {
+	pct = max(0, min(pct, MaxPercentage))
+	hi, lo := bits.Mul64(uint64(pct), total)
+	q, _ := bits.Div64(hi, lo, MaxPercentage)
+	return q
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// dialPipe reports that named pipes need Windows
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	return nil, errors.New("named pipes are only supported on Windows")
+}
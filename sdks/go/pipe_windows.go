@@ -0,0 +1,52 @@
+//go:build windows
+
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// errorPipeBusy is ERROR_PIPE_BUSY: all instances of the pipe are in use
+const errorPipeBusy = syscall.Errno(231)
+
+// pipeBusyTimeout bounds how long dialPipe waits for a free pipe instance
+const pipeBusyTimeout = 5 * time.Second
+
+// dialPipe opens a named pipe such as \\.\pipe\xtrieve. The handle is
+// synchronous, so the connection's SetDeadline fails and operations on it
+// run without timeouts and cannot be cancelled.
+func dialPipe(ctx context.Context, path string) (net.Conn, error) {
+	deadline := time.Now().Add(pipeBusyTimeout)
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err == nil {
+			return &pipeConn{File: f, addr: pipeAddr(path)}, nil
+		}
+		if !errors.Is(err, errorPipeBusy) || time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// pipeConn adapts an open named pipe to net.Conn, without deadlines
+type pipeConn struct {
+	*os.File
+	addr pipeAddr
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.addr }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.addr }
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
@@ -0,0 +1,187 @@
+package xtrieve
+
+import (
+	"math"
+	"time"
+)
+
+// StatisticsMaxAge is how long statistics read with Stat are used before
+// the query planner reads them again
+const StatisticsMaxAge = 5 * time.Minute
+
+// KeyStatistics describes the values of one key for the query planner
+type KeyStatistics struct {
+	// Distinct is the number of distinct values of the whole key, 0 if
+	// unknown
+	Distinct uint64
+}
+
+// FileStatistics are the statistics the query planner chooses keys with
+type FileStatistics struct {
+	Records uint64
+	// Keys holds the statistics of each key, by key number
+	Keys []KeyStatistics
+	// Source is "stat" for statistics read with Stat, which are refreshed
+	// after StatisticsMaxAge; others are kept until replaced
+	Source string
+	Taken  time.Time
+}
+
+// Statistics returns the statistics the query planner uses for the file:
+// those set with SetStatistics, or the record count and unique key counts
+// of Stat, cached for StatisticsMaxAge
+func (f *File) Statistics() (*FileStatistics, error) {
+	if s := f.statistics; s != nil && (s.Source != "stat" || time.Since(s.Taken) < StatisticsMaxAge) {
+		return s, nil
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	s := &FileStatistics{Records: stat.NumRecords, Source: "stat", Taken: time.Now()}
+	specs := make([]KeySpec, len(stat.Keys))
+	for i, k := range stat.Keys {
+		specs[i] = k.KeySpec
+	}
+	first := 0
+	for n := int16(0); ; n++ {
+		segments := keySegments(specs, n)
+		if segments == nil {
+			break
+		}
+		s.Keys = append(s.Keys, KeyStatistics{Distinct: uint64(stat.Keys[first].UniqueCount)})
+		first += len(segments)
+	}
+	f.statistics = s
+	return s, nil
+}
+
+// SetStatistics replaces the statistics the query planner uses for the
+// file, e.g. with better ones from sampling; nil goes back to Stat
+func (f *File) SetStatistics(s *FileStatistics) {
+	f.statistics = s
+}
+
+// keyChoice is a key the planner can walk, the bounds the filter narrows
+// it to and the records expected between them
+type keyChoice struct {
+	keyNumber int16
+	from, to  []byte
+	estimate  float64
+}
+
+// Fractions of a key's records assumed to satisfy range predicates on its
+// first segment, with a bound on one side or both
+const (
+	oneSidedSelectivity = 1.0 / 3
+	twoSidedSelectivity = 1.0 / 10
+)
+
+// chooseKey picks the key whose range the filter narrows the most, going
+// by the file's statistics. It reports false when the filter narrows no
+// key, which includes filters joined with Or.
+func (q *Query) chooseKey() (keyChoice, bool, error) {
+	if q.filter == nil || len(q.filter.terms) == 0 {
+		return keyChoice{}, false, nil
+	}
+	for _, t := range q.filter.terms[:len(q.filter.terms)-1] {
+		if t.connector != connectorAnd {
+			return keyChoice{}, false, nil
+		}
+	}
+	stats, err := q.file.Statistics()
+	if err != nil {
+		return keyChoice{}, false, err
+	}
+
+	records := float64(stats.Records)
+	best := keyChoice{estimate: records}
+	found := false
+	for n := int16(0); ; n++ {
+		segments := q.file.KeySegments(n)
+		if segments == nil {
+			break
+		}
+		if q.file.Collation(n) != nil {
+			continue
+		}
+		var distinct uint64
+		if int(n) < len(stats.Keys) {
+			distinct = stats.Keys[n].Distinct
+		}
+		c, ok := q.narrow(segments, distinct, records)
+		if ok && (!found || c.estimate < best.estimate) {
+			c.keyNumber = n
+			best, found = c, true
+		}
+	}
+	return best, found, nil
+}
+
+// narrow works out the bounds of a key that the filter's terms imply:
+// equal values for its leading segments, or else a range of the first
+// segment
+func (q *Query) narrow(segments []KeySpec, distinct uint64, records float64) (keyChoice, bool) {
+	var prefix []byte
+	equal := 0
+	for _, seg := range segments {
+		t, ok := q.termOn(seg, CmpEqual)
+		if !ok {
+			break
+		}
+		prefix = append(prefix, t.value...)
+		equal++
+	}
+	if equal > 0 {
+		from, to := PartialKeyBounds(segments, prefix)
+		// Spread the key's distinct values evenly over its segments
+		sel := 0.1
+		if distinct > 0 {
+			sel = math.Pow(float64(distinct), -float64(equal)/float64(len(segments)))
+		} else {
+			sel = math.Pow(sel, float64(equal))
+		}
+		return keyChoice{from: from, to: to, estimate: records * sel}, true
+	}
+
+	// Ranges of a descending segment would need the bounds swapped
+	// segment by segment; leave those to the filter
+	first := segments[0]
+	if first.Flags&KeyFlagDescending != 0 {
+		return keyChoice{}, false
+	}
+	lower, hasLower := q.termOn(first, CmpGreater, CmpGreaterOrEqual)
+	upper, hasUpper := q.termOn(first, CmpLess, CmpLessOrEqual)
+	c := keyChoice{estimate: records * oneSidedSelectivity}
+	switch {
+	case hasLower && hasUpper:
+		c.estimate = records * twoSidedSelectivity
+	case !hasLower && !hasUpper:
+		return keyChoice{}, false
+	}
+	// The bounds are inclusive; the filter drops the bound itself where
+	// the comparison is strict
+	if hasLower {
+		c.from, _ = PartialKeyBounds(segments, lower.value)
+	}
+	if hasUpper {
+		_, c.to = PartialKeyBounds(segments, upper.value)
+	}
+	return c, true
+}
+
+// termOn returns the first filter term comparing the field a key segment
+// covers with one of the given operators
+func (q *Query) termOn(seg KeySpec, cmps ...uint8) (filterTerm, bool) {
+	for _, t := range q.filter.terms {
+		if t.field.Offset != int(seg.Position) || t.field.Length != int(seg.Length) || t.field.Type != seg.Type {
+			continue
+		}
+		for _, c := range cmps {
+			if t.cmp == c {
+				return t, true
+			}
+		}
+	}
+	return filterTerm{}, false
+}
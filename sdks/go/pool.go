@@ -0,0 +1,522 @@
+package xtrieve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PoolConfig configures a Pool
+type PoolConfig struct {
+	// Primary is the address of the server that takes writes (see Dial)
+	Primary string
+	// Replicas are the addresses of read-only replicas
+	Replicas []string
+	// ConnsPerServer is the number of connections kept to each server
+	// (default 2). Files opened through the pool share them.
+	ConnsPerServer int
+	// MinConns is the number of connections per server dialed and
+	// checked with a round trip up front, and kept dialed after
+	// maintenance retires them (at most ConnsPerServer)
+	MinConns int
+	// HotFiles are opened on every server that serves them when the pool
+	// starts, and kept open, so the first requests do not pay for
+	// opening files and loading their first pages
+	HotFiles []string
+	// Discover, if set, supplies the cluster members instead of Primary
+	// and Replicas and is polled every RefreshInterval (default 30s) so
+	// the pool follows failovers
+	Discover        Discoverer
+	RefreshInterval time.Duration
+	// MaxIdleTime retires connections unused for this long, before
+	// firewalls or load balancers drop them silently
+	MaxIdleTime time.Duration
+	// MaxConnAge retires connections older than this
+	MaxConnAge time.Duration
+	// HealthCheckInterval is how often idle connections are checked and
+	// pinged (default a quarter of the smaller limit, or one minute)
+	HealthCheckInterval time.Duration
+	// Dial configures TLS, timeouts and dial retries of every connection.
+	// Pool dials have no context, so Backoff only applies with MaxAttempts
+	// set.
+	Dial DialOptions
+	// Logger, if set, receives every operation of the pool's connections
+	// (see Client.SetLogger) while LogLevel is slog.LevelDebug or lower
+	Logger   *slog.Logger
+	LogLevel slog.Level
+	// Consistency selects which reads may go to a replica (default
+	// ConsistencyEventual)
+	Consistency Consistency
+	// PinFor is how long ConsistencyReadYourWrites keeps reads on the
+	// primary after a write, e.g. the replicas' usual lag; zero pins them
+	// for as long as the file or session is open
+	PinFor time.Duration
+	// Selection chooses among the replicas serving a file (default
+	// SelectRoundRobin). SelectLatency also starts the health checks, so
+	// idle replicas keep being measured.
+	Selection Selection
+}
+
+// Pool holds connections to a primary server and its read replicas and
+// splits the work of the files it opens between them: reads go to a
+// replica, writes to the primary.
+//
+//	pool, err := xtrieve.NewPool(xtrieve.PoolConfig{
+//	    Primary:  "db1:7419",
+//	    Replicas: []string{"db2:7419", "db3:7419"},
+//	})
+//	f, err := pool.OpenFile("customers.dat", 0)
+//
+// Replicas may lag the primary, so a record just written may not be
+// visible to the next read, unless a transaction or the Consistency of
+// the configuration pins reads to the primary.
+type Pool struct {
+	cfg  PoolConfig
+	next atomic.Uint32
+
+	mu       sync.RWMutex
+	primary  *poolServer
+	replicas []*poolServer
+	// servers holds every server ever used, by address, so connections
+	// survive topology changes and are closed with the pool
+	servers  map[string]*poolServer
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	level       slog.LevelVar
+	logger      *slog.Logger
+	refreshing  atomic.Bool
+	maintaining atomic.Bool
+}
+
+// poolServer is the set of connections to one server
+type poolServer struct {
+	addr   string
+	dial   DialOptions
+	logger *slog.Logger
+	// files lists the files the server serves; empty means all
+	files   []string
+	mu      sync.Mutex
+	clients []*Client
+	next    int
+	size    int
+	// hot holds the pool's HotFiles open on this server
+	hot []*File
+	// txIdle holds the idle connections of WithTransaction, which are
+	// never shared with files
+	txIdle []*Client
+	closed bool
+	// latency measures the server for SelectLatency
+	latency latencyTracker
+}
+
+// NewPool connects to the primary and every replica
+func NewPool(cfg PoolConfig) (*Pool, error) {
+	cfg = cfg.withDefaults()
+	p := &Pool{cfg: cfg, servers: make(map[string]*poolServer)}
+	p.level.Set(cfg.LogLevel)
+	p.logger = p.wrapLogger(cfg.Logger)
+
+	members, err := cfg.members()
+	if err != nil {
+		return nil, err
+	}
+	p.stop = make(chan struct{})
+	if err := p.apply(members); err != nil {
+		p.Close()
+		return nil, err
+	}
+	p.startLoops()
+	return p, nil
+}
+
+// withDefaults fills in the defaults of unset fields
+func (cfg PoolConfig) withDefaults() PoolConfig {
+	if cfg.ConnsPerServer <= 0 {
+		cfg.ConnsPerServer = 2
+	}
+	cfg.MinConns = min(max(cfg.MinConns, 1), cfg.ConnsPerServer)
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = 30 * time.Second
+	}
+	cfg.Dial = cfg.Dial.withoutContext()
+	return cfg
+}
+
+// members returns the configured topology, asking the Discoverer if set
+func (cfg PoolConfig) members() ([]Member, error) {
+	if cfg.Discover != nil {
+		members, err := cfg.Discover.Discover()
+		if err != nil {
+			return nil, fmt.Errorf("discover: %w", err)
+		}
+		return members, nil
+	}
+	members := []Member{{Addr: cfg.Primary, Role: RolePrimary}}
+	for _, addr := range cfg.Replicas {
+		members = append(members, Member{Addr: addr, Role: RoleReplica})
+	}
+	return members, nil
+}
+
+// config returns the current configuration
+func (p *Pool) config() PoolConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cfg
+}
+
+// startLoops starts the background loops the configuration needs that are
+// not running yet
+func (p *Pool) startLoops() {
+	cfg := p.config()
+	if cfg.Discover != nil && p.refreshing.CompareAndSwap(false, true) {
+		go p.refreshLoop()
+	}
+	if cfg.MaxIdleTime > 0 || cfg.MaxConnAge > 0 || cfg.HealthCheckInterval > 0 || cfg.Selection == SelectLatency {
+		if p.maintaining.CompareAndSwap(false, true) {
+			go p.maintainLoop()
+		}
+	}
+}
+
+// Refresh asks the Discoverer for the current members and switches the
+// pool to them. Files already open keep their connections.
+func (p *Pool) Refresh() error {
+	cfg := p.config()
+	if cfg.Discover == nil {
+		return nil
+	}
+	members, err := cfg.members()
+	if err != nil {
+		return err
+	}
+	return p.apply(members)
+}
+
+// Members returns the current topology
+func (p *Pool) Members() []Member {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	members := []Member{{Addr: p.primary.addr, Role: RolePrimary, Files: p.primary.files}}
+	for _, s := range p.replicas {
+		members = append(members, Member{Addr: s.addr, Role: RoleReplica, Files: s.files})
+	}
+	return members
+}
+
+func (p *Pool) refreshLoop() {
+	interval := p.config().RefreshInterval
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			// A failed refresh keeps the previous topology
+			p.Refresh()
+			if next := p.config().RefreshInterval; next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// apply switches the pool to a new set of members. Replicas that cannot
+// be reached are left out; an unreachable primary is an error.
+func (p *Pool) apply(members []Member) error {
+	var primary *poolServer
+	var replicas []*poolServer
+	for _, m := range members {
+		p.mu.Lock()
+		cfg := p.cfg
+		s, ok := p.servers[m.Addr]
+		if !ok {
+			s = &poolServer{addr: m.Addr, size: cfg.ConnsPerServer, dial: cfg.Dial, logger: p.logger}
+			p.servers[m.Addr] = s
+		}
+		s.files = m.Files
+		p.mu.Unlock()
+
+		err := s.warm(cfg.MinConns, cfg.HotFiles)
+		switch m.Role {
+		case RolePrimary:
+			if err != nil {
+				return err
+			}
+			primary = s
+		case RoleReplica:
+			if err == nil {
+				replicas = append(replicas, s)
+			}
+		}
+	}
+	if primary == nil {
+		return errors.New("xtrieve: topology has no primary")
+	}
+
+	p.mu.Lock()
+	p.primary, p.replicas = primary, replicas
+	p.mu.Unlock()
+	return nil
+}
+
+// Primary returns a connection to the primary server
+func (p *Pool) Primary() (*Client, error) {
+	p.mu.RLock()
+	s := p.primary
+	p.mu.RUnlock()
+	return s.client()
+}
+
+// Replica returns a connection to the next replica in turn, or to the
+// primary if there are no replicas
+func (p *Pool) Replica() (*Client, error) {
+	c, err := p.replicaFor("")
+	if c == nil && err == nil {
+		return p.Primary()
+	}
+	return c, err
+}
+
+// replicaFor picks a replica serving path by the configured Selection,
+// returning nil if there is none
+func (p *Pool) replicaFor(path string) (*Client, error) {
+	p.mu.RLock()
+	selection := p.cfg.Selection
+	var candidates []*poolServer
+	for _, s := range p.replicas {
+		if path == "" || s.serves(path) {
+			candidates = append(candidates, s)
+		}
+	}
+	p.mu.RUnlock()
+
+	switch {
+	case len(candidates) == 0:
+		return nil, nil
+	case selection == SelectLatency && len(candidates) > 1:
+		return pickTwo(candidates).client()
+	}
+	i := p.next.Add(1) % uint32(len(candidates))
+	return candidates[i].client()
+}
+
+// OpenFile opens a file on the primary and on one replica. Reads that
+// position the cursor (GetEqual, GetFirst, StepFirst, ...) and Stat go to
+// the replica; GetNext, StepNext and the like follow the cursor to the
+// server that positioned it. Writes go to the primary, which is first
+// positioned on the replica's current record when Update or Delete need
+// it. During a transaction every operation goes to the primary.
+func (p *Pool) OpenFile(path string, mode int16) (*File, error) {
+	return p.openFile(path, mode, "")
+}
+
+// OpenFileOwner is like OpenFile for a file protected by an owner name
+func (p *Pool) OpenFileOwner(path string, mode int16, owner string) (*File, error) {
+	return p.openFile(path, mode, owner)
+}
+
+func (p *Pool) openFile(path string, mode int16, owner string) (*File, error) {
+	primary, err := p.Primary()
+	if err != nil {
+		return nil, err
+	}
+	var pin *readPin
+	if cfg := p.config(); cfg.Consistency == ConsistencyReadYourWrites {
+		pin = &readPin{pinFor: cfg.PinFor}
+	}
+	return p.openOn(primary, pin, path, mode, owner)
+}
+
+// openOn opens a file on the given primary connection and on a replica,
+// unless the pool's Consistency keeps every read on the primary
+func (p *Pool) openOn(primary *Client, pin *readPin, path string, mode int16, owner string) (*File, error) {
+	f, err := primary.openFile(path, mode, owner)
+	if err != nil {
+		return nil, err
+	}
+	if p.config().Consistency == ConsistencyPrimary {
+		return f, nil
+	}
+	f.pin = pin
+
+	replica, err := p.replicaFor(path)
+	if replica == nil && err == nil {
+		return f, nil
+	}
+	if err == nil {
+		f.replica, err = replica.openFile(path, mode, owner)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("open %s on replica: %w", path, err)
+	}
+	return f, nil
+}
+
+// Close stops background work and closes every connection in the pool.
+// Closing a closed pool does nothing.
+func (p *Pool) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, s := range p.servers {
+		errs = append(errs, s.close())
+	}
+	return errors.Join(errs...)
+}
+
+// client returns the next connection to the server, dialing until the
+// server has its full set
+func (s *poolServer) client() (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.clients) < s.size {
+		c, err := s.dialClient()
+		if err != nil {
+			if len(s.clients) > 0 {
+				return s.roundRobin(), nil
+			}
+			return nil, err
+		}
+		s.clients = append(s.clients, c)
+		return c, nil
+	}
+	return s.roundRobin(), nil
+}
+
+// serves reports whether the server holds path
+func (s *poolServer) serves(path string) bool {
+	return len(s.files) == 0 || slices.Contains(s.files, path)
+}
+
+// roundRobin picks the next connection. Connections beyond a reduced size
+// stay open for the files bound to them but are not handed out again.
+func (s *poolServer) roundRobin() *Client {
+	c := s.clients[s.next%max(min(s.size, len(s.clients)), 1)]
+	s.next++
+	return c
+}
+
+func (s *poolServer) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	for _, f := range s.hot {
+		f.Close()
+	}
+	s.hot = nil
+	for _, c := range append(s.clients, s.txIdle...) {
+		errs = append(errs, c.Close())
+	}
+	s.clients, s.txIdle = nil, nil
+	s.closed = true
+	return errors.Join(errs...)
+}
+
+// IsReadOnly reports whether an operation only reads data
+func IsReadOnly(op uint16) bool {
+	switch op {
+	case OpGetEqual, OpGetNext, OpGetPrevious, OpGetGreater, OpGetGreaterOrEqual,
+		OpGetLess, OpGetLessOrEqual, OpGetFirst, OpGetLast, OpStat,
+		OpStepNext, OpStepFirst, OpStepLast, OpStepPrevious,
+		OpGetNextExtended, OpGetPrevExtended, OpStepNextExtended, OpStepPrevExtended:
+		return true
+	}
+	return false
+}
+
+// followsCursor reports whether a read continues from the current position
+// rather than establishing a new one
+func followsCursor(op uint16) bool {
+	switch op {
+	case OpGetNext, OpGetPrevious, OpStepNext, OpStepPrevious,
+		OpGetNextExtended, OpGetPrevExtended, OpStepNextExtended, OpStepPrevExtended:
+		return true
+	}
+	return false
+}
+
+// route sends a request of a pooled file to the replica or the primary
+func (f *File) route(req *Request) (*Response, error) {
+	op := req.Operation
+	switch {
+	case !f.inTx && IsReadOnly(op) && (f.onReplica || !followsCursor(op) && !f.pin.pinned()):
+		resp, err := f.replica.execLocal(req)
+		if err == nil && op != OpStat {
+			f.onReplica = true
+		}
+		return resp, err
+
+	case (op == OpUpdate || op == OpDelete) && f.onReplica:
+		if err := f.positionPrimary(req.KeyNumber); err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := f.execLocal(req)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case OpBeginTransaction:
+		f.inTx = resp.StatusCode == StatusSuccess
+	case OpEndTransaction, OpAbortTransaction:
+		f.inTx = false
+	}
+	if IsReadOnly(op) && op != OpStat || isWrite(op) {
+		f.onReplica = false
+	}
+	if isWrite(op) && resp.StatusCode == StatusSuccess && f.pin != nil {
+		f.pin.written()
+	}
+	return resp, nil
+}
+
+// positionPrimary moves the primary's cursor to the replica's current
+// record so it can be updated or deleted, walking duplicates of the key
+// until the exact record is found
+func (f *File) positionPrimary(keyNumber int16) error {
+	// Read the current record back from the replica's position
+	cur, err := f.replica.execLocal(&Request{Operation: OpGetPosition})
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpGetPosition, cur); err != nil {
+		return err
+	}
+	direct := make([]byte, max(len(cur.DataBuffer), f.recordLength))
+	copy(direct, cur.DataBuffer)
+	rec, err := f.replica.execLocal(&Request{Operation: OpGetDirect, DataBuffer: direct, KeyNumber: keyNumber})
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpGetDirect, rec); err != nil {
+		return err
+	}
+	record := rec.DataBuffer
+
+	key := ExtractKey(f.KeySegments(keyNumber), record)
+	resp, err := f.execLocal(&Request{Operation: OpGetEqual, KeyBuffer: key, KeyNumber: keyNumber})
+	for err == nil && resp.StatusCode == StatusSuccess && bytes.Equal(resp.KeyBuffer, key) {
+		if bytes.Equal(resp.DataBuffer, record) {
+			f.onReplica = false
+			return nil
+		}
+		resp, err = f.execLocal(&Request{Operation: OpGetNext, KeyNumber: keyNumber})
+	}
+	if err != nil {
+		return err
+	}
+	return ErrReplicaStale
+}
@@ -0,0 +1,172 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maintainLoop periodically retires and validates the pool's connections
+func (p *Pool) maintainLoop() {
+	interval := p.config().checkInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			p.maintain(interval)
+			if next := p.config().checkInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+// checkInterval is HealthCheckInterval, or derived from the limits
+func (cfg PoolConfig) checkInterval() time.Duration {
+	if cfg.HealthCheckInterval > 0 {
+		return cfg.HealthCheckInterval
+	}
+	interval := time.Minute
+	for _, limit := range []time.Duration{cfg.MaxIdleTime, cfg.MaxConnAge} {
+		if limit > 0 {
+			interval = min(interval, limit/4)
+		}
+	}
+	return max(interval, time.Second)
+}
+
+// maintain checks every connection once. Connections past MaxIdleTime or
+// MaxConnAge are retired: closed now and redialed on their next use, so
+// files bound to them carry on unaffected. Connections idle for a check
+// interval are pinged and retired if the ping fails.
+func (p *Pool) maintain(interval time.Duration) {
+	cfg := p.config()
+	p.mu.RLock()
+	servers := make([]*poolServer, 0, len(p.servers))
+	for _, s := range p.servers {
+		servers = append(servers, s)
+	}
+	p.mu.RUnlock()
+
+	for _, s := range servers {
+		s.mu.Lock()
+		clients := append([]*Client(nil), s.clients...)
+		s.mu.Unlock()
+
+		for _, c := range clients {
+			c.maintain(cfg.MaxIdleTime, cfg.MaxConnAge, interval)
+		}
+		// Redial retired connections up to MinConns; failures are retried
+		// at the next check
+		for _, c := range clients[:min(cfg.MinConns, len(clients))] {
+			if c.retired() {
+				c.warm()
+			}
+		}
+	}
+}
+
+// maintain retires or pings the connection if it is not in use
+func (c *Client) maintain(maxIdle, maxAge, pingAfter time.Duration) {
+	if !c.mu.TryLock() {
+		return // busy, so neither idle nor in need of a ping
+	}
+	defer c.mu.Unlock()
+	if c.conn == nil || c.broken {
+		return
+	}
+
+	now := time.Now()
+	idle := now.Sub(time.Unix(0, c.lastUsed.Load()))
+	switch {
+	case maxIdle > 0 && idle >= maxIdle, maxAge > 0 && now.Sub(c.connected) >= maxAge:
+		c.retire()
+	case idle >= pingAfter:
+		start := time.Now()
+		err := c.ping()
+		if c.latency != nil {
+			c.latency.observe(time.Since(start), err != nil)
+		}
+		if err != nil {
+			c.retire()
+		}
+	}
+}
+
+// retired reports whether the connection waits to be redialed
+func (c *Client) retired() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.broken
+}
+
+// retire closes the connection; the next operation dials a new one. The
+// caller holds c.mu.
+func (c *Client) retire() {
+	c.conn.Close()
+	c.broken = true
+}
+
+// ping checks the connection with a Version request without counting as
+// use. The caller holds c.mu.
+func (c *Client) ping() error {
+	c.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if err := c.send(&Request{Operation: OpVersion}); err != nil {
+		return err
+	}
+	var resp Response
+	return c.readResponse(&resp)
+}
+
+// warm dials the server's first n connections, checks each with a round
+// trip, and opens the hot files it serves if it has not yet
+func (s *poolServer) warm(n int, hotFiles []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.clients) < n {
+		c, err := s.dialClient()
+		if err != nil {
+			if len(s.clients) > 0 {
+				break
+			}
+			return err
+		}
+		s.clients = append(s.clients, c)
+	}
+	for _, c := range s.clients[:min(n, len(s.clients))] {
+		if err := c.warm(); err != nil && c == s.clients[0] {
+			return err
+		}
+	}
+
+	if s.hot == nil {
+		for _, path := range hotFiles {
+			if !s.serves(path) {
+				continue
+			}
+			f, err := s.clients[0].OpenFile(path, 0)
+			if err != nil {
+				return fmt.Errorf("open hot file %s: %w", path, err)
+			}
+			s.hot = append(s.hot, f)
+		}
+	}
+	return nil
+}
+
+// warm redials a retired connection and checks it with a round trip
+func (c *Client) warm() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.ready(context.Background()); err != nil {
+		return err
+	}
+	return c.ping()
+}
@@ -0,0 +1,150 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Tx is a transaction run by Pool.WithTransaction on a connection of its
+// own. Files opened through it are bound to that connection, so every
+// operation on them, reads included, is part of the transaction.
+type Tx struct {
+	ctx    context.Context
+	client *Client
+	files  []*File
+}
+
+// OpenFile opens a file on the transaction's connection. It is closed
+// when the transaction ends, and runs under the transaction's context,
+// see File.SetContext.
+func (tx *Tx) OpenFile(path string, mode int16) (*File, error) {
+	return tx.OpenFileOwner(path, mode, "")
+}
+
+// OpenFileOwner is like OpenFile for a file protected by an owner name
+func (tx *Tx) OpenFileOwner(path string, mode int16, owner string) (*File, error) {
+	f, err := tx.client.openFile(path, mode, owner)
+	if err != nil {
+		return nil, err
+	}
+	f.SetContext(tx.ctx)
+	tx.files = append(tx.files, f)
+	return f, nil
+}
+
+// close closes the transaction's files
+func (tx *Tx) close() error {
+	var errs []error
+	for _, f := range tx.files {
+		// Close even when the transaction's context is done
+		f.SetContext(nil)
+		if _, err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	tx.files = nil
+	return errors.Join(errs...)
+}
+
+// WithTransaction runs fn in a transaction on a connection to the primary
+// that no other file or transaction uses while fn runs. Btrieve
+// transactions belong to a connection, so files opened through the pool
+// share theirs and would mix their operations into each other's
+// transactions; fn opens the files it works on through tx instead.
+//
+// The transaction commits if fn returns nil and rolls back if fn returns
+// an error or panics, or ctx is done by then. Its files are then closed
+// and the connection goes back to the pool for later transactions. fn
+// must not begin or end transactions itself.
+//
+//	err := pool.WithTransaction(ctx, xtrieve.LockSingleWait, func(tx *xtrieve.Tx) error {
+//	    orders, err := tx.OpenFile("orders.dat", 0)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    lines, err := tx.OpenFile("lines.dat", 0)
+//	    ...
+//	})
+func (p *Pool) WithTransaction(ctx context.Context, lockMode uint16, fn func(tx *Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p.mu.RLock()
+	s := p.primary
+	p.mu.RUnlock()
+	cfg := p.config()
+	c, err := s.checkout(cfg.MaxIdleTime, cfg.MaxConnAge, cfg.checkInterval())
+	if err != nil {
+		return err
+	}
+	resp, err := c.BeginTransaction(nil, lockMode)
+	if err == nil {
+		err = checkStatus(OpBeginTransaction, resp)
+	}
+	if err != nil {
+		s.checkin(c, false)
+		return err
+	}
+
+	tx := &Tx{ctx: ctx, client: c}
+	ended := false
+	defer func() {
+		// Roll back on errors and panics; a connection whose transaction
+		// may still be open is not handed out again
+		if !ended {
+			resp, err := c.AbortTransaction(nil)
+			ended = err == nil && resp.StatusCode == StatusSuccess
+		}
+		tx.close()
+		s.checkin(c, ended)
+	}()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	resp, err = c.EndTransaction(nil)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpEndTransaction, resp); err != nil {
+		return err
+	}
+	ended = true
+	return nil
+}
+
+// checkout hands out a connection for a transaction, reusing an idle one
+// unless it is past maxIdle or maxAge. Idle connections are pinged after
+// pingAfter, like those the maintenance checks.
+func (s *poolServer) checkout(maxIdle, maxAge, pingAfter time.Duration) (*Client, error) {
+	s.mu.Lock()
+	if n := len(s.txIdle); n > 0 {
+		c := s.txIdle[n-1]
+		s.txIdle = s.txIdle[:n-1]
+		s.mu.Unlock()
+		// A retired connection redials on its first operation
+		c.maintain(maxIdle, maxAge, pingAfter)
+		return c, nil
+	}
+	s.mu.Unlock()
+	return s.dialClient()
+}
+
+// checkin takes back a connection handed out by checkout, keeping up to
+// the server's size idle. Connections that are not reusable, and those
+// checked in after the pool closed, are closed.
+func (s *poolServer) checkin(c *Client, reusable bool) {
+	s.mu.Lock()
+	if reusable && !s.closed && len(s.txIdle) < s.size {
+		s.txIdle = append(s.txIdle, c)
+		c = nil
+	}
+	s.mu.Unlock()
+	if c != nil {
+		c.Close()
+	}
+}
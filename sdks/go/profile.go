@@ -0,0 +1,127 @@
+package xtrieve
+
+import (
+	"context"
+	"expvar"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// opNames are the names used in profile labels and expvar counters
+var opNames = map[uint16]string{
+	OpOpen:              "open",
+	OpClose:             "close",
+	OpInsert:            "insert",
+	OpUpdate:            "update",
+	OpDelete:            "delete",
+	OpGetEqual:          "get_equal",
+	OpGetNext:           "get_next",
+	OpGetPrevious:       "get_previous",
+	OpGetGreater:        "get_greater",
+	OpGetGreaterOrEqual: "get_greater_or_equal",
+	OpGetLess:           "get_less",
+	OpGetLessOrEqual:    "get_less_or_equal",
+	OpGetFirst:          "get_first",
+	OpGetLast:           "get_last",
+	OpCreate:            "create",
+	OpStat:              "stat",
+	OpExtend:            "extend",
+	OpBeginTransaction:  "begin_transaction",
+	OpEndTransaction:    "end_transaction",
+	OpAbortTransaction:  "abort_transaction",
+	OpGetPosition:       "get_position",
+	OpGetDirect:         "get_direct",
+	OpStepNext:          "step_next",
+	OpVersion:           "version",
+	OpUnlock:            "unlock",
+	OpSetOwner:          "set_owner",
+	OpClearOwner:        "clear_owner",
+	OpStepFirst:         "step_first",
+	OpStepLast:          "step_last",
+	OpStepPrevious:      "step_previous",
+	OpGetNextExtended:   "get_next_extended",
+	OpGetPrevExtended:   "get_prev_extended",
+	OpStepNextExtended:  "step_next_extended",
+	OpStepPrevExtended:  "step_prev_extended",
+	OpGetByPercentage:   "get_by_percentage",
+	OpFindPercentage:    "find_percentage",
+}
+
+// OpName returns a short name for an operation code, e.g. "get_equal"
+func OpName(op uint16) string {
+	if name, ok := opNames[op]; ok {
+		return name
+	}
+	return "op_" + strconv.Itoa(int(op))
+}
+
+// opStats holds the counters published by PublishExpvar
+var opStats atomic.Pointer[expvar.Map]
+
+// EnableProfileLabels makes the client run every operation under pprof
+// labels "xtrieve_op" and "xtrieve_file", so CPU and blocking profiles
+// attribute time spent in the client to the operation and file. Call it
+// before the client is used.
+func (c *Client) EnableProfileLabels() {
+	c.profileLabels = true
+}
+
+// PublishExpvar publishes operation counters of all clients under name
+// with expvar: for each operation name "<op>.calls", "<op>.errors" (status
+// or transport failures) and "<op>.nanos" (total time spent). It returns
+// the published map.
+func PublishExpvar(name string) *expvar.Map {
+	m := expvar.NewMap(name)
+	opStats.Store(m)
+	return m
+}
+
+// profiled runs a request under profile labels and records its counters
+func (c *Client) profiled(ctx context.Context, req *Request, resp *Response) error {
+	var err error
+	start := time.Now()
+	if c.profileLabels {
+		labels := pprof.Labels("xtrieve_op", OpName(req.Operation), "xtrieve_file", requestFile(req))
+		pprof.Do(ctx, labels, func(ctx context.Context) {
+			err = c.roundTrip(ctx, req, resp)
+		})
+	} else {
+		err = c.roundTrip(ctx, req, resp)
+	}
+
+	if m := opStats.Load(); m != nil {
+		name := OpName(req.Operation)
+		m.Add(name+".calls", 1)
+		m.Add(name+".nanos", time.Since(start).Nanoseconds())
+		if err != nil || resp.StatusCode != StatusSuccess {
+			m.Add(name+".errors", 1)
+		}
+	}
+	return err
+}
+
+// requestFile returns the file a request refers to: its path for Open and
+// Create, otherwise the path the server stored in the position block
+func requestFile(req *Request) string {
+	if req.FilePath != "" {
+		return req.FilePath
+	}
+	return string(requestFileBytes(req.PositionBlock))
+}
+
+// requestFileBytes returns the path the server stored in a position block,
+// nil if there is none
+func requestFileBytes(posBlock []byte) []byte {
+	if !hasFileRef(posBlock) {
+		return nil
+	}
+	path := posBlock[positionBlockPathOffset:]
+	for i, b := range path {
+		if b == 0 {
+			return path[:i]
+		}
+	}
+	return path
+}
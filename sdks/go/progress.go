@@ -0,0 +1,83 @@
+package xtrieve
+
+import "time"
+
+// ProgressInfo is a snapshot of a long-running bulk operation
+type ProgressInfo struct {
+	// Records and Bytes processed so far
+	Records int64
+	Bytes   int64
+	// Total is the expected number of records, or 0 if unknown
+	Total   int64
+	Elapsed time.Duration
+	// ETA is the estimated time remaining, or 0 if Total is unknown
+	ETA time.Duration
+	// Done is set on the final report
+	Done bool
+}
+
+// Progress receives progress reports from bulk operations such as
+// SQLImport, SQLExport and File.DeleteRange. Reports arrive at most about
+// once per second, plus a final one with Done set.
+type Progress interface {
+	Update(ProgressInfo)
+}
+
+// ProgressFunc adapts a function to the Progress interface
+type ProgressFunc func(ProgressInfo)
+
+// Update calls fn(info)
+func (fn ProgressFunc) Update(info ProgressInfo) {
+	fn(info)
+}
+
+// progressInterval is the minimum time between progress reports
+const progressInterval = time.Second
+
+// progressTracker counts work and rate-limits reports to a Progress
+type progressTracker struct {
+	progress Progress
+	info     ProgressInfo
+	start    time.Time
+	last     time.Time
+}
+
+func newProgressTracker(progress Progress, total int64) *progressTracker {
+	now := time.Now()
+	return &progressTracker{
+		progress: progress,
+		info:     ProgressInfo{Total: total},
+		start:    now,
+		last:     now,
+	}
+}
+
+// add records processed work and reports if a report is due
+func (t *progressTracker) add(records, bytes int) {
+	t.info.Records += int64(records)
+	t.info.Bytes += int64(bytes)
+	if t.progress != nil && time.Since(t.last) >= progressInterval {
+		t.report()
+	}
+}
+
+// done sends the final report
+func (t *progressTracker) done() {
+	if t.progress == nil {
+		return
+	}
+	t.info.Done = true
+	t.report()
+}
+
+func (t *progressTracker) report() {
+	now := time.Now()
+	t.last = now
+	t.info.Elapsed = now.Sub(t.start)
+	t.info.ETA = 0
+	if t.info.Total > 0 && t.info.Records > 0 && t.info.Records < t.info.Total {
+		perRecord := t.info.Elapsed / time.Duration(t.info.Records)
+		t.info.ETA = perRecord * time.Duration(t.info.Total-t.info.Records)
+	}
+	t.progress.Update(t.info)
+}
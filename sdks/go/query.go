@@ -0,0 +1,147 @@
+package xtrieve
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Query describes a scan of a file in terms of a schema: the key to walk,
+// an optional key range, a filter and the fields to return.
+//
+// Unless Key or Range is given, a planner picks the key: of the keys whose
+// leading segments the filter compares with equal values, or whose first
+// segment it bounds, it walks the one expected to read the fewest records
+// according to File.Statistics, within the range the filter implies.
+// Otherwise it scans key 0.
+//
+//	it, rowSchema, err := f.Query(schema).
+//	    Where(filter).
+//	    Select("id", "status").
+//	    Iter()
+type Query struct {
+	file      *File
+	schema    *Schema
+	keyNumber int16
+	// keySet is set by Key, which overrides the planner; chosen reports
+	// that the planner picked the key of the last Iter
+	keySet   bool
+	chosen   bool
+	from, to []byte
+	filter   *Filter
+	matchers []*Matcher
+	fields   []string
+}
+
+// Query starts a query over f whose records follow schema
+func (f *File) Query(schema *Schema) *Query {
+	return &Query{file: f, schema: schema}
+}
+
+// Key selects the key the query walks instead of leaving it to the
+// planner
+func (q *Query) Key(keyNumber int16) *Query {
+	q.keyNumber, q.keySet = keyNumber, true
+	return q
+}
+
+// Range limits the query to keys between from and to, both inclusive, of
+// the key given by Key (default 0)
+func (q *Query) Range(from, to []byte) *Query {
+	q.from, q.to = from, to
+	return q
+}
+
+// Where restricts the query to records matching filter
+func (q *Query) Where(filter *Filter) *Query {
+	q.filter = filter
+	return q
+}
+
+// Match restricts the query to records whose field matches re. Unlike
+// Where, it is evaluated client-side, except that a pattern anchored with
+// a literal prefix also narrows the scan on the server (see Regexp).
+// Several Match calls must all match.
+func (q *Query) Match(field string, re *regexp.Regexp) *Query {
+	q.matchers = append(q.matchers, Regexp(q.schema, re, field))
+	return q
+}
+
+// Select returns only the named fields of each record instead of the whole
+// record. The fields are extracted server-side where supported.
+func (q *Query) Select(fields ...string) *Query {
+	q.fields = fields
+	return q
+}
+
+// Iter runs the query. It returns the iterator and the schema of the records
+// it yields: the original schema, or for Select a schema of the selected
+// fields packed in order.
+func (q *Query) Iter() (*Iterator, *Schema, error) {
+	if q.filter != nil {
+		if err := q.filter.Err(); err != nil {
+			return nil, nil, err
+		}
+	}
+	keyNumber, from, to := q.keyNumber, q.from, q.to
+	q.chosen = false
+	if !q.keySet && from == nil && to == nil {
+		c, ok, err := q.chooseKey()
+		if err != nil {
+			return nil, nil, err
+		}
+		if ok {
+			keyNumber, from, to, q.chosen = c.keyNumber, c.from, c.to, true
+		}
+	}
+	it := q.file.Range(keyNumber, from, to)
+	if q.filter != nil {
+		it.Where(q.filter)
+	}
+	for _, m := range q.matchers {
+		if err := m.Err(); err != nil {
+			return nil, nil, err
+		}
+		it.Match(m)
+	}
+	if len(q.fields) == 0 {
+		return it, q.schema, nil
+	}
+
+	extract := make([]Extractor, 0, len(q.fields))
+	packed := make([]Field, 0, len(q.fields))
+	offset := 0
+	for _, name := range q.fields {
+		field, ok := q.schema.Field(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("select: unknown field %s", name)
+		}
+		extract = append(extract, Extractor{Offset: uint16(field.Offset), Length: uint16(field.Length)})
+		field.Offset = offset
+		packed = append(packed, field)
+		offset += field.Length
+	}
+	result, err := NewSchema(packed...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return it.Select(extract...), result, nil
+}
+
+// Each runs the query and calls fn with the decoded fields of each record
+func (q *Query) Each(fn func(values map[string]any) error) error {
+	it, schema, err := q.Iter()
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for it.Next() {
+		values, err := schema.Decode(it.Record())
+		if err != nil {
+			return err
+		}
+		if err := fn(values); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
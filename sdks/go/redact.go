@@ -0,0 +1,119 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// redacted replaces the value of sensitive fields in logs
+const redacted = "[REDACTED]"
+
+// Redact formats a record for logs as name=value pairs in schema order,
+// with Sensitive and Encrypted fields replaced by [REDACTED]. Encrypted
+// fields are never decrypted.
+func (s *Schema) Redact(record []byte) string {
+	var b strings.Builder
+	for i, f := range s.Fields {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(f.Name)
+		b.WriteByte('=')
+		if f.Sensitive || f.Encrypted {
+			b.WriteString(redacted)
+			continue
+		}
+		v, err := f.Decode(record)
+		switch v := v.(type) {
+		case nil:
+			fmt.Fprintf(&b, "<%v>", err)
+		case string:
+			fmt.Fprintf(&b, "%q", v)
+		case []byte:
+			fmt.Fprintf(&b, "%x", v)
+		case time.Time:
+			b.WriteString(v.Format(time.DateOnly))
+		default:
+			fmt.Fprint(&b, v)
+		}
+	}
+	return b.String()
+}
+
+// SetLogger makes the client log every operation to logger at debug
+// level: operation, file, status, elapsed time and the record. Records of
+// files registered with LogSchema are logged with Schema.Redact; others
+// only by length, so payloads never reach the log as raw bytes. Entries
+// are logged with the operation's context, so a handler can add its trace
+// span. Passing nil turns logging off.
+func (c *Client) SetLogger(logger *slog.Logger) {
+	c.logger.Store(logger)
+}
+
+// LogSchema registers the schema used to log records of a file. path is
+// matched against the end of the path the server reports.
+func (c *Client) LogSchema(path string, schema *Schema) {
+	if c.logSchemas == nil {
+		c.logSchemas = make(map[string]*Schema)
+	}
+	c.logSchemas[path] = schema
+}
+
+// logged runs a request and logs it
+func (c *Client) logged(ctx context.Context, logger *slog.Logger, req *Request, resp *Response) error {
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return c.instrumented(ctx, req, resp)
+	}
+
+	start := time.Now()
+	err := c.instrumented(ctx, req, resp)
+	file := requestFile(req)
+	if file == "" {
+		file = requestFile(&Request{PositionBlock: resp.PositionBlock})
+	}
+	attrs := []slog.Attr{
+		slog.String("op", OpName(req.Operation)),
+		slog.String("file", file),
+		slog.Duration("elapsed", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+	} else {
+		attrs = append(attrs, slog.Int("status", int(resp.StatusCode)))
+		// Writes carry the record in the request, reads in the response
+		data := resp.DataBuffer
+		if req.Operation == OpInsert || req.Operation == OpUpdate {
+			data = req.DataBuffer
+		}
+		if len(data) > 0 && carriesRecord(req.Operation) {
+			attrs = append(attrs, slog.String("record", c.formatRecord(file, data)))
+		}
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "xtrieve", attrs...)
+	return err
+}
+
+// formatRecord renders a record with the file's log schema, if any
+func (c *Client) formatRecord(file string, record []byte) string {
+	for path, schema := range c.logSchemas {
+		if strings.HasSuffix(file, path) {
+			return schema.Redact(record)
+		}
+	}
+	return fmt.Sprintf("<%d bytes>", len(record))
+}
+
+// carriesRecord reports whether an operation's data buffer is a record,
+// as opposed to a descriptor, file spec or position
+func carriesRecord(op uint16) bool {
+	switch op {
+	case OpInsert, OpUpdate, OpGetEqual, OpGetNext, OpGetPrevious, OpGetGreater,
+		OpGetGreaterOrEqual, OpGetLess, OpGetLessOrEqual, OpGetFirst, OpGetLast,
+		OpGetDirect, OpStepFirst, OpStepLast, OpStepNext, OpStepPrevious:
+		return true
+	}
+	return false
+}
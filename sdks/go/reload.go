@@ -0,0 +1,105 @@
+package xtrieve
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Reconfigure switches a running pool to cfg without dropping its
+// connections. Sizes, dial options, maintenance limits, intervals and
+// logging take effect right away; operation timeouts are applied to the
+// existing connections, while TLS and dial settings apply to the
+// connections dialed from now on. The topology is refreshed: new servers
+// are dialed and warmed, and removed ones stop receiving new files but
+// keep serving the files already open on them. After ConnsPerServer is
+// lowered, the extra connections are no longer handed out.
+func (p *Pool) Reconfigure(cfg PoolConfig) error {
+	cfg = cfg.withDefaults()
+	p.mu.Lock()
+	p.cfg = cfg
+	p.logger = p.wrapLogger(cfg.Logger)
+	logger := p.logger
+	servers := make([]*poolServer, 0, len(p.servers))
+	for _, s := range p.servers {
+		servers = append(servers, s)
+	}
+	p.mu.Unlock()
+	p.level.Set(cfg.LogLevel)
+
+	for _, s := range servers {
+		s.mu.Lock()
+		s.size = cfg.ConnsPerServer
+		s.dial = cfg.Dial
+		s.logger = logger
+		clients := append([]*Client(nil), s.clients...)
+		s.mu.Unlock()
+
+		for _, c := range clients {
+			c.SetTimeout(cfg.Dial.Timeout)
+			c.SetClassTimeout(ClassScan, cfg.Dial.ScanTimeout)
+			c.SetClassTimeout(ClassBulk, cfg.Dial.BulkTimeout)
+			c.SetClassTimeout(ClassCreate, cfg.Dial.CreateTimeout)
+			c.SetBudget(cfg.Dial.Budget)
+			c.SetLogger(logger)
+		}
+	}
+
+	members, err := cfg.members()
+	if err != nil {
+		return err
+	}
+	if err := p.apply(members); err != nil {
+		return err
+	}
+	p.startLoops()
+	return nil
+}
+
+// SetLogLevel changes the level below which the pool's connections stop
+// logging; operations are logged at slog.LevelDebug
+func (p *Pool) SetLogLevel(level slog.Level) {
+	p.mu.Lock()
+	p.cfg.LogLevel = level
+	p.mu.Unlock()
+	p.level.Set(level)
+}
+
+// wrapLogger filters logger by the pool's log level
+func (p *Pool) wrapLogger(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return nil
+	}
+	return slog.New(&levelHandler{Handler: logger.Handler(), level: &p.level})
+}
+
+// dialClient dials a new connection with the server's settings. The
+// caller holds s.mu.
+func (s *poolServer) dialClient() (*Client, error) {
+	c, err := DialWithOptions(context.Background(), s.addr, s.dial)
+	if err != nil {
+		return nil, err
+	}
+	if s.logger != nil {
+		c.SetLogger(s.logger)
+	}
+	c.latency = &s.latency
+	return c, nil
+}
+
+// levelHandler drops records below a level that can change at runtime
+type levelHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *levelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
@@ -0,0 +1,176 @@
+package replicate
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+// Resolver decides which version of a record wins when the two sides hold
+// different records under the same match key. It returns the record to
+// store on both sides; returning a or b unchanged is the common case.
+type Resolver interface {
+	Resolve(key, a, b []byte) ([]byte, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(key, a, b []byte) ([]byte, error)
+
+// Resolve calls fn(key, a, b)
+func (fn ResolverFunc) Resolve(key, a, b []byte) ([]byte, error) {
+	return fn(key, a, b)
+}
+
+// LastWriterWins returns a resolver that keeps the record with the greater
+// value in a timestamp field, such as a last-modified date, time or
+// counter. Ties keep a.
+func LastWriterWins(field xtrieve.Field) Resolver {
+	return ResolverFunc(func(key, a, b []byte) ([]byte, error) {
+		va, err := field.Decode(a)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := field.Decode(b)
+		if err != nil {
+			return nil, err
+		}
+		c, err := compare(va, vb)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		if c < 0 {
+			return b, nil
+		}
+		return a, nil
+	})
+}
+
+// PreferA returns a resolver under which the first side always wins
+func PreferA() Resolver {
+	return ResolverFunc(func(key, a, b []byte) ([]byte, error) { return a, nil })
+}
+
+// compare orders two decoded field values of the same type
+func compare(a, b any) (int, error) {
+	switch a := a.(type) {
+	case time.Time:
+		return a.Compare(b.(time.Time)), nil
+	case time.Duration:
+		return cmpOrdered(a, b.(time.Duration)), nil
+	case int64:
+		return cmpOrdered(a, b.(int64)), nil
+	case uint64:
+		return cmpOrdered(a, b.(uint64)), nil
+	case float64:
+		return cmpOrdered(a, b.(float64)), nil
+	case string:
+		return strings.Compare(a, b.(string)), nil
+	case []byte:
+		return bytes.Compare(a, b.([]byte)), nil
+	}
+	return 0, fmt.Errorf("cannot order values of type %T", a)
+}
+
+func cmpOrdered[T int64 | uint64 | float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// MergeResult counts what Merge changed
+type MergeResult struct {
+	// ToA and ToB are the records copied to each side because the other
+	// side did not have them
+	ToA, ToB int
+	// Conflicts is the number of records that differed on both sides
+	Conflicts int
+}
+
+// Merge reconciles Source and Target in both directions. Both files are
+// walked in MatchKey order: records found on only one side are copied to
+// the other, and records that differ are passed to Config.Resolver and
+// the winner is written to both sides.
+//
+// Without change tracking a record missing on one side cannot be told
+// apart from one deleted there, so deletes are undone by Merge; sites that
+// merge should delete by marking records instead.
+func (r *Replicator) Merge() (MergeResult, error) {
+	var res MergeResult
+	if r.cfg.Resolver == nil {
+		return res, fmt.Errorf("replicate: Merge needs a Resolver")
+	}
+	a, b := r.cfg.Source, r.cfg.Target
+	segments := a.KeySegments(r.cfg.MatchKey)
+
+	// Collect the records to write first: writing while scanning would
+	// move the scans' cursors
+	var toA, toB [][]byte
+	ia, ib := a.Scan(r.cfg.MatchKey), b.Scan(r.cfg.MatchKey)
+	okA, okB := ia.Next(), ib.Next()
+	for okA || okB {
+		c := 0
+		switch {
+		case !okA:
+			c = 1
+		case !okB:
+			c = -1
+		default:
+			c = xtrieve.CompareKey(segments, ia.Key(), ib.Key())
+		}
+
+		switch {
+		case c < 0:
+			toB = append(toB, clone(ia.Record()))
+			res.ToB++
+			okA = ia.Next()
+		case c > 0:
+			toA = append(toA, clone(ib.Record()))
+			res.ToA++
+			okB = ib.Next()
+		default:
+			if !bytes.Equal(ia.Record(), ib.Record()) {
+				winner, err := r.cfg.Resolver.Resolve(ia.Key(), ia.Record(), ib.Record())
+				if err != nil {
+					return res, err
+				}
+				res.Conflicts++
+				if !bytes.Equal(winner, ia.Record()) {
+					toA = append(toA, clone(winner))
+				}
+				if !bytes.Equal(winner, ib.Record()) {
+					toB = append(toB, clone(winner))
+				}
+			}
+			okA, okB = ia.Next(), ib.Next()
+		}
+	}
+	if err := ia.Err(); err != nil {
+		return res, err
+	}
+	if err := ib.Err(); err != nil {
+		return res, err
+	}
+
+	for _, rec := range toA {
+		if err := r.write(a, rec); err != nil {
+			return res, err
+		}
+	}
+	for _, rec := range toB {
+		if err := r.write(b, rec); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
+
+func clone(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -0,0 +1,348 @@
+// Package replicate copies records from a file on one Xtrieve server to a
+// file on another, keeping the target as a warm standby.
+//
+//	r := replicate.New(replicate.Config{
+//	    Source:    primaryFile,
+//	    Target:    standbyFile,
+//	    KeyNumber: 1, // autoincrement or timestamp key
+//	})
+//	err := r.Run(ctx)
+//
+// Replication starts with a snapshot of every record and then syncs
+// incrementally by key: each pass copies the records whose sync key is
+// greater than the last one copied, and those that share the last key but
+// were not copied yet, told apart by their match key. The server has no
+// change feed, so the sync key must grow with every insert or update (an
+// autoincrement or a last-modified timestamp); changes that do not move a
+// record's sync key, and deletes, are only picked up by the next snapshot.
+package replicate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	xtrieve "github.com/eduardostern/xtrieve-go"
+)
+
+// Config configures a Replicator
+type Config struct {
+	Source *xtrieve.File
+	Target *xtrieve.File
+	// KeyNumber is the sync key, used in both files
+	KeyNumber int16
+	// MatchKey identifies the same record on both sides when copying
+	// (default 0). It must be a unique key.
+	MatchKey int16
+	// Interval is the pause between incremental passes (default 1s)
+	Interval time.Duration
+	// SnapshotEvery repeats the full snapshot periodically to pick up
+	// deletes; zero means only the initial snapshot
+	SnapshotEvery time.Duration
+	// Resolver settles records that differ on both sides. Merge requires
+	// it; one-way replication consults it before overwriting a target
+	// record and otherwise lets the source win.
+	Resolver Resolver
+	// OnProgress, if set, is called after every pass
+	OnProgress func(Metrics)
+}
+
+// Metrics reports replication progress
+type Metrics struct {
+	// Copied is the number of records written to the target
+	Copied uint64
+	// Passes is the number of completed snapshot and incremental passes
+	Passes uint64
+	// LastKey is the greatest sync key copied so far
+	LastKey []byte
+	// CaughtUp is when a pass last reached the end of the source
+	CaughtUp time.Time
+	// Lag is the time since the target was last known to be caught up
+	Lag time.Duration
+	// Behind is the difference in record counts between source and
+	// target at the last pass
+	Behind int64
+}
+
+// Replicator copies records from a source file to a target file
+type Replicator struct {
+	cfg Config
+
+	mu       sync.Mutex
+	copied   uint64
+	passes   uint64
+	lastKey  []byte
+	caughtUp time.Time
+	behind   int64
+	// atLast holds the match keys of the records copied with lastKey
+	atLast map[string]struct{}
+}
+
+// New returns a Replicator for cfg
+func New(cfg Config) *Replicator {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Second
+	}
+	return &Replicator{cfg: cfg}
+}
+
+// Resume sets the sync key to continue from, e.g. one saved from
+// Metrics.LastKey, so Run skips the initial snapshot
+func (r *Replicator) Resume(lastKey []byte) {
+	r.mu.Lock()
+	r.lastKey = append([]byte(nil), lastKey...)
+	r.atLast = nil
+	r.mu.Unlock()
+}
+
+// Run takes a snapshot unless resumed, then syncs incrementally until ctx
+// is cancelled. It returns ctx.Err() on cancellation or the first error.
+func (r *Replicator) Run(ctx context.Context) error {
+	if r.Metrics().LastKey == nil {
+		if err := r.Snapshot(); err != nil {
+			return err
+		}
+	}
+	lastSnapshot := time.Now()
+
+	ticker := time.NewTicker(r.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		var err error
+		if r.cfg.SnapshotEvery > 0 && time.Since(lastSnapshot) >= r.cfg.SnapshotEvery {
+			err = r.Snapshot()
+			lastSnapshot = time.Now()
+		} else {
+			_, err = r.Sync()
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Snapshot copies every source record to the target and deletes target
+// records that no longer exist in the source
+func (r *Replicator) Snapshot() error {
+	seen := make(map[string]struct{})
+	matchSegments := r.cfg.Source.KeySegments(r.cfg.MatchKey)
+	if matchSegments == nil {
+		return errors.New("replicate: source has no match key")
+	}
+
+	it := r.cfg.Source.Scan(r.cfg.KeyNumber)
+	var last []byte
+	var atLast map[string]struct{}
+	for it.Next() {
+		if err := r.copy(it.Record()); err != nil {
+			return err
+		}
+		match := string(xtrieve.ExtractKey(matchSegments, it.Record()))
+		seen[match] = struct{}{}
+		if last == nil || !bytes.Equal(it.Key(), last) {
+			last = append(last[:0], it.Key()...)
+			atLast = make(map[string]struct{})
+		}
+		atLast[match] = struct{}{}
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	// Remove records deleted from the source
+	target := r.cfg.Target.Scan(r.cfg.MatchKey)
+	var stale [][]byte
+	for target.Next() {
+		if _, ok := seen[string(target.Key())]; !ok {
+			stale = append(stale, append([]byte(nil), target.Key()...))
+		}
+	}
+	if err := target.Err(); err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := r.delete(key); err != nil {
+			return err
+		}
+	}
+
+	r.finishPass(last, atLast)
+	return nil
+}
+
+// Sync copies the records whose sync key is greater than the last one
+// copied, or equal to it but not copied yet, and returns how many were
+// copied. Sync keys may repeat: the records at the last key are told
+// apart by their match key.
+func (r *Replicator) Sync() (int, error) {
+	matchSegments := r.cfg.Source.KeySegments(r.cfg.MatchKey)
+	if matchSegments == nil {
+		return 0, errors.New("replicate: source has no match key")
+	}
+	r.mu.Lock()
+	from := append([]byte(nil), r.lastKey...)
+	atLast := make(map[string]struct{}, len(r.atLast))
+	for match := range r.atLast {
+		atLast[match] = struct{}{}
+	}
+	r.mu.Unlock()
+	if len(from) == 0 {
+		from = nil
+	}
+	it := r.cfg.Source.Range(r.cfg.KeyNumber, from, nil)
+
+	n := 0
+	last := from
+	for it.Next() {
+		match := string(xtrieve.ExtractKey(matchSegments, it.Record()))
+		if last == nil || !bytes.Equal(it.Key(), last) {
+			last = append([]byte(nil), it.Key()...)
+			atLast = make(map[string]struct{})
+		} else if _, copied := atLast[match]; copied {
+			continue
+		}
+		if err := r.copy(it.Record()); err != nil {
+			return n, err
+		}
+		atLast[match] = struct{}{}
+		n++
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+
+	r.finishPass(last, atLast)
+	return n, nil
+}
+
+// Metrics returns a snapshot of the replication progress
+func (r *Replicator) Metrics() Metrics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.metricsLocked()
+}
+
+func (r *Replicator) metricsLocked() Metrics {
+	m := Metrics{
+		Copied:   r.copied,
+		Passes:   r.passes,
+		CaughtUp: r.caughtUp,
+		Behind:   r.behind,
+	}
+	if r.lastKey != nil {
+		m.LastKey = append([]byte(nil), r.lastKey...)
+	}
+	if !r.caughtUp.IsZero() {
+		m.Lag = time.Since(r.caughtUp)
+	}
+	return m
+}
+
+// copy writes a source record to the target. If the target holds a
+// different record under the same match key, the resolver picks the
+// version to keep.
+func (r *Replicator) copy(record []byte) error {
+	if r.cfg.Resolver != nil {
+		target := r.cfg.Target
+		key := xtrieve.ExtractKey(target.KeySegments(r.cfg.MatchKey), record)
+		resp, err := target.GetEqual(key, r.cfg.MatchKey)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode == xtrieve.StatusSuccess {
+			winner, err := r.cfg.Resolver.Resolve(key, record, resp.DataBuffer)
+			if err != nil {
+				return err
+			}
+			record = winner
+		}
+	}
+	return r.write(r.cfg.Target, record)
+}
+
+// write stores a record in f, updating the record with the same match key
+// if there is one
+func (r *Replicator) write(f *xtrieve.File, record []byte) error {
+	resp, err := f.Insert(record)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == xtrieve.StatusDuplicateKey {
+		key := xtrieve.ExtractKey(f.KeySegments(r.cfg.MatchKey), record)
+		if resp, err = f.GetEqual(key, r.cfg.MatchKey); err != nil {
+			return err
+		}
+		if resp.StatusCode == xtrieve.StatusSuccess {
+			if bytes.Equal(resp.DataBuffer, record) {
+				return nil
+			}
+			resp, err = f.Update(record, r.cfg.MatchKey)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if resp.StatusCode != xtrieve.StatusSuccess {
+		return &xtrieve.StatusError{Operation: xtrieve.OpInsert, Status: resp.StatusCode}
+	}
+
+	r.mu.Lock()
+	r.copied++
+	r.mu.Unlock()
+	return nil
+}
+
+// delete removes the target record with the given match key
+func (r *Replicator) delete(key []byte) error {
+	target := r.cfg.Target
+	resp, err := target.GetEqual(key, r.cfg.MatchKey)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == xtrieve.StatusKeyNotFound {
+		return nil
+	}
+	if resp.StatusCode == xtrieve.StatusSuccess {
+		if resp, err = target.Delete(r.cfg.MatchKey); err != nil {
+			return err
+		}
+	}
+	if resp.StatusCode != xtrieve.StatusSuccess {
+		return &xtrieve.StatusError{Operation: xtrieve.OpDelete, Status: resp.StatusCode}
+	}
+	return nil
+}
+
+// finishPass records the end of a pass that reached the end of the source,
+// with the match keys of the records copied at its last sync key
+func (r *Replicator) finishPass(last []byte, atLast map[string]struct{}) {
+	behind := int64(0)
+	src, err1 := r.cfg.Source.Stat()
+	dst, err2 := r.cfg.Target.Stat()
+	if err1 == nil && err2 == nil {
+		behind = int64(src.NumRecords) - int64(dst.NumRecords)
+	}
+
+	r.mu.Lock()
+	if last != nil {
+		r.lastKey = append(r.lastKey[:0], last...)
+		r.atLast = atLast
+	}
+	r.passes++
+	r.caughtUp = time.Now()
+	r.behind = behind
+	m := r.metricsLocked()
+	r.mu.Unlock()
+
+	if r.cfg.OnProgress != nil {
+		r.cfg.OnProgress(m)
+	}
+}
@@ -0,0 +1,365 @@
+package xtrieve
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrRestoreConflict is returned by Restore when archived records violate
+// a unique key of the restored file, even when inserted one at a time in
+// archive order, e.g. because the archive was written while the file
+// changed
+var ErrRestoreConflict = errors.New("restored records conflict on a unique key")
+
+// ErrRestoreVerify is returned by Restore when a restored file's record
+// count or checksum differs from the archive's manifest, or the server did
+// not create it with the archived spec
+var ErrRestoreVerify = errors.New("restored file does not match the archive")
+
+// Restore loads an archive written by WriteArchive into new files. Several
+// files are restored at once, and within a file Workers insert in
+// parallel, in transactions of BatchSize records. Records are sharded by
+// the file's first unique key, so records sharing its value are inserted
+// in archive order by one worker. A record that conflicts with another
+// on a unique key is set aside and retried after the parallel pass, one
+// at a time in archive order. Every restored file is then checked
+// against the record count and checksum of the manifest.
+//
+//	r := &xtrieve.Restore{
+//	    Client:  client,
+//	    Open:    func(path string) (*xtrieve.File, error) { return pool.OpenFile(path, 0) },
+//	    Files:   2,
+//	    Workers: 4, // the pool needs ConnsPerServer >= Files*Workers
+//	}
+//	n, err := r.Run(ctx, archive, size)
+type Restore struct {
+	// Client creates the files
+	Client *Client
+	// Open opens a restored file for one worker. Transactions belong to a
+	// connection, so every call must return a file on a connection of its
+	// own, e.g. through a pool.
+	Open func(path string) (*File, error)
+	// Path, if set, maps an archived path to the path to restore it to
+	Path func(archived string) string
+	// Files is the number of files restored at once (default 2)
+	Files int
+	// Workers is the number of parallel inserters per file (default 4)
+	Workers int
+	// BatchSize is the number of records per transaction (default 100)
+	BatchSize int
+	// Progress, if set, receives progress reports as batches commit
+	Progress Progress
+}
+
+// restoreConflict is a record set aside after a duplicate-key conflict,
+// with its position in the archive
+type restoreConflict struct {
+	seq    int
+	record []byte
+}
+
+// restoreFile is the state of one file being restored
+type restoreFile struct {
+	mu        sync.Mutex
+	batches   map[*File]*importBatch
+	conflicts []restoreConflict
+	committed int
+}
+
+// Run restores every file of the archive and returns the number of
+// records restored. The files must not exist. A failure stops the files
+// in progress; files already restored and verified stay in place.
+func (r *Restore) Run(ctx context.Context, archive io.ReaderAt, size int64) (int64, error) {
+	if r.Client == nil || r.Open == nil {
+		return 0, errors.New("xtrieve: Restore needs a Client and Open")
+	}
+	zr, err := zip.NewReader(archive, size)
+	if err != nil {
+		return 0, err
+	}
+	manifest, err := readManifest(zr)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for _, af := range manifest {
+		total += int64(af.Records)
+	}
+	var mu sync.Mutex
+	tracker := newProgressTracker(r.Progress, total)
+	progress := func(records, bytes int) {
+		mu.Lock()
+		tracker.add(records, bytes)
+		mu.Unlock()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	files := r.Files
+	if files <= 0 {
+		files = 2
+	}
+	sem := make(chan struct{}, files)
+	var wg sync.WaitGroup
+	var errs []error
+	var restored int64
+	for _, af := range manifest {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(af ArchiveFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			n, err := r.restoreFile(ctx, zr, af, progress)
+			mu.Lock()
+			defer mu.Unlock()
+			restored += int64(n)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("restore %s: %w", af.Path, err))
+				cancel()
+			}
+		}(af)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	tracker.done()
+	if len(errs) > 0 {
+		return restored, errors.Join(errs...)
+	}
+	return restored, ctx.Err()
+}
+
+// path returns the path to restore an archived file to
+func (r *Restore) path(af ArchiveFile) string {
+	if r.Path != nil {
+		return r.Path(af.Path)
+	}
+	return af.Path
+}
+
+// restoreFile creates one file, loads its records in parallel, retries
+// the conflicts and verifies the result
+func (r *Restore) restoreFile(ctx context.Context, zr *zip.Reader, af ArchiveFile, progress func(records, bytes int)) (int, error) {
+	path := r.path(af)
+	resp, err := r.Client.Create(path, &af.Spec)
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStatus(OpCreate, resp); err != nil {
+		return 0, err
+	}
+	entry, err := zr.Open(af.Entry)
+	if err != nil {
+		return 0, err
+	}
+	defer entry.Close()
+
+	st := &restoreFile{batches: make(map[*File]*importBatch)}
+	if err := r.load(ctx, path, &af.Spec, &archiveReader{r: bufio.NewReader(entry)}, st, progress); err != nil {
+		return st.committed, err
+	}
+	n, err := r.retry(path, st.conflicts, progress)
+	st.committed += n
+	if err != nil {
+		return st.committed, err
+	}
+	return st.committed, r.verify(path, af)
+}
+
+// load inserts the records of ar with the file's workers, setting aside
+// the ones that conflict
+func (r *Restore) load(ctx context.Context, path string, spec *FileSpec, ar *archiveReader, st *restoreFile, progress func(records, bytes int)) error {
+	batchSize := r.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+	workers := r.Workers
+	if workers <= 0 {
+		workers = 4
+	}
+	segments := uniqueSegments(spec.Keys)
+
+	// commit ends a worker's transaction, or rolls it back if failed
+	commit := func(f *File, failed bool) error {
+		st.mu.Lock()
+		b := st.batches[f]
+		delete(st.batches, f)
+		st.mu.Unlock()
+		if b == nil {
+			return nil
+		}
+		if failed {
+			f.AbortTransaction()
+			return nil
+		}
+		resp, err := f.EndTransaction()
+		if err != nil {
+			return err
+		}
+		if err := checkStatus(OpEndTransaction, resp); err != nil {
+			return err
+		}
+		st.mu.Lock()
+		st.committed += b.records
+		st.mu.Unlock()
+		progress(b.records, b.bytes)
+		return nil
+	}
+
+	g := newWorkGroup(ctx, workers, func() (*File, error) { return r.Open(path) }, commit)
+	for seq := 0; ; seq++ {
+		record, err := ar.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			g.fail(err)
+			break
+		}
+		record, seq := bytes.Clone(record), seq
+		job := func(f *File) error {
+			st.mu.Lock()
+			b := st.batches[f]
+			st.mu.Unlock()
+			if b == nil {
+				resp, err := f.BeginTransaction(LockNone)
+				if err != nil {
+					return err
+				}
+				if err := checkStatus(OpBeginTransaction, resp); err != nil {
+					return err
+				}
+				b = &importBatch{}
+				st.mu.Lock()
+				st.batches[f] = b
+				st.mu.Unlock()
+			}
+			resp, err := f.Insert(record)
+			if err != nil {
+				return err
+			}
+			if resp.StatusCode == StatusDuplicateKey {
+				st.mu.Lock()
+				st.conflicts = append(st.conflicts, restoreConflict{seq: seq, record: record})
+				st.mu.Unlock()
+				return nil
+			}
+			if err := checkStatus(OpInsert, resp); err != nil {
+				return err
+			}
+			b.records++
+			b.bytes += len(record)
+			if b.records >= batchSize {
+				return commit(f, false)
+			}
+			return nil
+		}
+		if segments == nil {
+			err = g.Go(job)
+		} else {
+			err = g.GoOrdered(FoldKey(segments, ExtractKey(segments, record)), job)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return g.Wait()
+}
+
+// retry inserts the records set aside by load one at a time in archive
+// order, now that every other record is in place
+func (r *Restore) retry(path string, conflicts []restoreConflict, progress func(records, bytes int)) (int, error) {
+	if len(conflicts) == 0 {
+		return 0, nil
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].seq < conflicts[j].seq })
+	f, err := r.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+	n, failed := 0, 0
+	for _, c := range conflicts {
+		resp, err := f.Insert(c.record)
+		if err != nil {
+			return n, err
+		}
+		if resp.StatusCode == StatusDuplicateKey {
+			failed++
+			continue
+		}
+		if err := checkStatus(OpInsert, resp); err != nil {
+			return n, err
+		}
+		n++
+		progress(1, len(c.record))
+	}
+	if failed > 0 {
+		return n, fmt.Errorf("%w: %d records", ErrRestoreConflict, failed)
+	}
+	return n, nil
+}
+
+// verify compares the restored file's record count and checksum with the
+// archive's
+func (r *Restore) verify(path string, af ArchiveFile) error {
+	f, err := r.Open(path)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if diffs := stat.Diff(&af.Spec); diffs != nil {
+		return fmt.Errorf("%w: %s", ErrRestoreVerify, strings.Join(diffs, "; "))
+	}
+	var sum RecordChecksum
+	var count uint64
+	it := f.ScanPhysical()
+	for it.Next() {
+		sum.Add(it.Record())
+		count++
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	if count != af.Records {
+		return fmt.Errorf("%w: %d records, archive has %d", ErrRestoreVerify, count, af.Records)
+	}
+	if sum.String() != af.Checksum {
+		return fmt.Errorf("%w: checksum %s, archive has %s", ErrRestoreVerify, sum, af.Checksum)
+	}
+	return nil
+}
+
+// uniqueSegments returns the segments of the first key that does not allow
+// duplicates, or nil if every key does
+func uniqueSegments(keys []KeySpec) []KeySpec {
+	for n := int16(0); ; n++ {
+		segments := keySegments(keys, n)
+		if segments == nil {
+			return nil
+		}
+		if segments[0].Flags&KeyFlagDuplicates == 0 {
+			return segments
+		}
+	}
+}
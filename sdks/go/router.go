@@ -0,0 +1,228 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// Shard is one backend of a Router. With range sharding a shard holds the
+// keys from its From bound (inclusive) up to the next shard's From bound;
+// the first shard's From is ignored.
+type Shard struct {
+	Addr string
+	From []byte
+}
+
+// RouterConfig configures a Router
+type RouterConfig struct {
+	// Shards lists the backends. With range sharding they must be ordered
+	// by From.
+	Shards []Shard
+	// KeyNumber is the shard key: the key whose value decides which shard
+	// a record lives on
+	KeyNumber int16
+	// Hash distributes records by a hash of the shard key instead of by
+	// key range
+	Hash bool
+	// Dial configures TLS, timeouts and dial retries of every shard's
+	// connection, as for a Pool
+	Dial DialOptions
+}
+
+// Router spreads a file over several servers by shard key. Operations on
+// the shard key go to the one shard holding the key; other lookups and
+// scans fan out to every shard and are merged back into key order.
+//
+//	r, err := xtrieve.NewRouter(xtrieve.RouterConfig{
+//	    Shards: []xtrieve.Shard{
+//	        {Addr: "db1:7419"},
+//	        {Addr: "db2:7419", From: []byte("M")},
+//	    },
+//	})
+//	f, err := r.OpenFile("customers.dat", 0)
+type Router struct {
+	cfg     RouterConfig
+	clients []*Client
+}
+
+// NewRouter connects to every shard
+func NewRouter(cfg RouterConfig) (*Router, error) {
+	if len(cfg.Shards) == 0 {
+		return nil, errors.New("xtrieve: router needs at least one shard")
+	}
+	r := &Router{cfg: cfg}
+	opts := cfg.Dial.withoutContext()
+	for _, s := range cfg.Shards {
+		c, err := DialWithOptions(context.Background(), s.Addr, opts)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.clients = append(r.clients, c)
+	}
+	return r, nil
+}
+
+// Close closes the connections to all shards
+func (r *Router) Close() error {
+	var errs []error
+	for _, c := range r.clients {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// OpenFile opens the file on every shard
+func (r *Router) OpenFile(path string, mode int16) (*ShardedFile, error) {
+	sf := &ShardedFile{router: r, current: -1}
+	for i, c := range r.clients {
+		f, err := c.OpenFile(path, mode)
+		if err != nil {
+			sf.Close()
+			return nil, fmt.Errorf("shard %s: %w", r.cfg.Shards[i].Addr, err)
+		}
+		sf.files = append(sf.files, f)
+	}
+	return sf, nil
+}
+
+// ShardedFile is a file opened on every shard of a Router. Like File it is
+// not safe for concurrent use.
+type ShardedFile struct {
+	router *Router
+	files  []*File
+	// current is the shard the last retrieval positioned on
+	current int
+}
+
+// Shard returns the index of the shard that holds a shard key value
+func (sf *ShardedFile) Shard(key []byte) int {
+	cfg := sf.router.cfg
+	if cfg.Hash {
+		h := fnv.New32a()
+		h.Write(key)
+		return int(h.Sum32() % uint32(len(cfg.Shards)))
+	}
+	segments := sf.files[0].KeySegments(cfg.KeyNumber)
+	shard := 0
+	for i := 1; i < len(cfg.Shards); i++ {
+		if CompareKey(segments, key, cfg.Shards[i].From) < 0 {
+			break
+		}
+		shard = i
+	}
+	return shard
+}
+
+// Close closes the file on every shard
+func (sf *ShardedFile) Close() error {
+	var errs []error
+	for _, f := range sf.files {
+		if _, err := f.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Insert inserts a record on the shard its shard key maps to
+func (sf *ShardedFile) Insert(data []byte) (*Response, error) {
+	segments := sf.files[0].KeySegments(sf.router.cfg.KeyNumber)
+	i := sf.Shard(ExtractKey(segments, data))
+	resp, err := sf.files[i].Insert(data)
+	if err == nil && resp.StatusCode == StatusSuccess {
+		sf.current = i
+	}
+	return resp, err
+}
+
+// GetEqual finds a record by key. Lookups on the shard key go to one
+// shard; lookups on other keys try every shard until one has the key.
+func (sf *ShardedFile) GetEqual(key []byte, keyNumber int16) (*Response, error) {
+	if keyNumber == sf.router.cfg.KeyNumber {
+		i := sf.Shard(key)
+		return sf.positioned(i)(sf.files[i].GetEqual(key, keyNumber))
+	}
+
+	var last *Response
+	for i, f := range sf.files {
+		resp, err := f.GetEqual(key, keyNumber)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != StatusKeyNotFound {
+			return sf.positioned(i)(resp, nil)
+		}
+		last = resp
+	}
+	sf.current = -1
+	return last, nil
+}
+
+// Update updates the record the last retrieval, or the last record of a
+// Scan or Range, positioned on. A change of
+// shard key that moves the record to another shard is refused with
+// ErrShardKeyChanged.
+func (sf *ShardedFile) Update(data []byte, keyNumber int16) (*Response, error) {
+	if sf.current < 0 {
+		return nil, ErrNoCurrentShard
+	}
+	segments := sf.files[0].KeySegments(sf.router.cfg.KeyNumber)
+	if sf.Shard(ExtractKey(segments, data)) != sf.current {
+		return nil, ErrShardKeyChanged
+	}
+	return sf.files[sf.current].Update(data, keyNumber)
+}
+
+// Delete deletes the record the last retrieval, or the last record of a
+// Scan or Range, positioned on
+func (sf *ShardedFile) Delete(keyNumber int16) (*Response, error) {
+	if sf.current < 0 {
+		return nil, ErrNoCurrentShard
+	}
+	return sf.files[sf.current].Delete(keyNumber)
+}
+
+// Scan returns all records of all shards merged in the order of keyNumber
+func (sf *ShardedFile) Scan(keyNumber int16) *MergeIterator {
+	return sf.Range(keyNumber, nil, nil)
+}
+
+// Range returns the records whose key lies between from and to, both
+// inclusive, merged across shards in key order. Range scans of the shard
+// key skip shards that cannot hold keys in the range. Each record makes
+// its shard the current one for Update and Delete; a server that batches
+// scans with extended operations leaves the shard positioned at the end
+// of the batch instead, so reposition with GetEqual before writing.
+func (sf *ShardedFile) Range(keyNumber int16, from, to []byte) *MergeIterator {
+	cfg := sf.router.cfg
+	first, last := 0, len(sf.files)-1
+	if keyNumber == cfg.KeyNumber && !cfg.Hash {
+		if from != nil {
+			first = sf.Shard(from)
+		}
+		if to != nil {
+			last = sf.Shard(to)
+		}
+	}
+
+	var sources []RecordIterator
+	for i := first; i <= last; i++ {
+		sources = append(sources, sf.files[i].Range(keyNumber, from, to))
+	}
+	m := MergeScan(sf.files[0].KeyOrder(keyNumber), sources...)
+	m.moved = func(source int) { sf.current = first + source }
+	return m
+}
+
+// positioned records the shard a successful retrieval positioned on
+func (sf *ShardedFile) positioned(i int) func(*Response, error) (*Response, error) {
+	return func(resp *Response, err error) (*Response, error) {
+		if err == nil && resp.StatusCode == StatusSuccess {
+			sf.current = i
+		}
+		return resp, err
+	}
+}
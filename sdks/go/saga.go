@@ -0,0 +1,151 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// SagaRetry is how a Saga retries failed compensations when its Retry is
+// zero
+var SagaRetry = Backoff{
+	Initial:     200 * time.Millisecond,
+	Max:         10 * time.Second,
+	Multiplier:  2,
+	Jitter:      0.2,
+	MaxAttempts: 8,
+}
+
+// Saga runs a workflow as a series of steps, each committed on its own,
+// with a compensation that undoes it: if a step fails, the steps already
+// done are compensated in reverse order. It suits business workflows over
+// many files that would otherwise hold one transaction, and its locks,
+// open for minutes. Other sessions can see the results of completed steps
+// until they are compensated, so compensations must cope with records
+// changed since.
+//
+//	saga := xtrieve.NewSaga("order 1001")
+//	saga.Step("reserve stock", reserve, release)
+//	saga.Step("charge customer", charge, refund)
+//	saga.Step("create shipment", ship, nil) // last step: nothing to undo
+//	err := saga.Run(ctx)
+type Saga struct {
+	Name string
+	// Retry is how failed compensations are retried; zero uses SagaRetry
+	Retry Backoff
+	// Logger receives a record for each step and compensation; nil logs
+	// nothing
+	Logger *slog.Logger
+
+	steps []sagaStep
+}
+
+type sagaStep struct {
+	name       string
+	action     func(ctx context.Context) error
+	compensate func(ctx context.Context) error
+}
+
+// SagaError reports a failed Saga: the step that failed and its error,
+// and the completed steps whose compensation failed too, which need
+// repairing by hand
+type SagaError struct {
+	Saga string
+	Step string
+	Err  error
+	// Uncompensated are the steps left done, with the last error of each
+	Uncompensated map[string]error
+}
+
+func (e *SagaError) Error() string {
+	msg := fmt.Sprintf("saga %s: step %s: %v", e.Saga, e.Step, e.Err)
+	if len(e.Uncompensated) > 0 {
+		msg += fmt.Sprintf(" (%d steps not compensated)", len(e.Uncompensated))
+	}
+	return msg
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// NewSaga returns an empty saga
+func NewSaga(name string) *Saga {
+	return &Saga{Name: name}
+}
+
+// Step adds a step. compensate undoes action once it has succeeded; nil
+// means the step needs no undoing. Compensations should be idempotent:
+// one whose outcome was lost with the connection is retried.
+func (s *Saga) Step(name string, action, compensate func(ctx context.Context) error) *Saga {
+	s.steps = append(s.steps, sagaStep{name: name, action: action, compensate: compensate})
+	return s
+}
+
+// Run runs the steps in order. When one fails, or ctx is done before the
+// next, the completed steps are compensated in reverse order and a
+// *SagaError is returned. Compensations run even when ctx is done.
+func (s *Saga) Run(ctx context.Context) error {
+	for i, step := range s.steps {
+		err := ctx.Err()
+		if err == nil {
+			err = step.action(ctx)
+		}
+		if err == nil {
+			s.log(ctx, slog.LevelDebug, "saga step done", step.name, nil)
+			continue
+		}
+		s.log(ctx, slog.LevelWarn, "saga step failed", step.name, err)
+		return &SagaError{Saga: s.Name, Step: step.name, Err: err, Uncompensated: s.compensate(ctx, s.steps[:i])}
+	}
+	return nil
+}
+
+// compensate undoes steps in reverse order, returning those it could not
+func (s *Saga) compensate(ctx context.Context, steps []sagaStep) map[string]error {
+	ctx = context.WithoutCancel(ctx)
+	retry := s.Retry
+	if retry == (Backoff{}) {
+		retry = SagaRetry
+	}
+	var failed map[string]error
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		if step.compensate == nil {
+			continue
+		}
+		var err error
+		for attempt := 1; ; attempt++ {
+			if err = step.compensate(ctx); err == nil {
+				break
+			}
+			s.log(ctx, slog.LevelWarn, "saga compensation failed", step.name, err, "attempt", attempt)
+			if retry.Initial <= 0 || (retry.MaxAttempts > 0 && attempt >= retry.MaxAttempts) {
+				break
+			}
+			time.Sleep(retry.Delay(attempt))
+		}
+		if err != nil {
+			s.log(ctx, slog.LevelError, "saga step not compensated", step.name, err)
+			if failed == nil {
+				failed = make(map[string]error)
+			}
+			failed[step.name] = err
+			continue
+		}
+		s.log(ctx, slog.LevelInfo, "saga step compensated", step.name, nil)
+	}
+	return failed
+}
+
+func (s *Saga) log(ctx context.Context, level slog.Level, msg, step string, err error, args ...any) {
+	if s.Logger == nil {
+		return
+	}
+	args = append(args, "saga", s.Name, "step", step)
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	s.Logger.Log(ctx, level, msg, args...)
+}
@@ -0,0 +1,110 @@
+package xtrieve
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"sort"
+)
+
+// Sample returns about n records drawn uniformly from the whole file, in
+// physical order, e.g. for data-quality checks or test fixtures, without
+// reading the file. It positions with GetByPercentage in physical order
+// at n distinct percentages chosen at random, each the middle of a slice
+// of the file: exact for files of up to MaxPercentage records, and one
+// record per slice of about records/MaxPercentage for larger ones. n
+// larger than MaxPercentage, and servers without percentage positioning,
+// draw from a scan of the whole file instead; files of no more than n
+// records are returned whole. Sample moves the file's position.
+func (f *File) Sample(ctx context.Context, n int) ([][]byte, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if stat.NumRecords == 0 {
+		return nil, nil
+	}
+	if stat.NumRecords > uint64(n) && n <= MaxPercentage {
+		records, err := samplePercentages(ctx, f, n, stat.NumRecords)
+		if !IsStatus(err, StatusInvalidOperation) {
+			return records, err
+		}
+	}
+	return sampleScan(ctx, f, n)
+}
+
+// samplePercentages reads the records at n random percentages
+func samplePercentages(ctx context.Context, f *File, n int, records uint64) ([][]byte, error) {
+	slices := int(min(records, MaxPercentage))
+	var sample [][]byte
+	for _, slice := range chooseDistinct(slices, n) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		resp, err := f.getByPercentage(PercentageOf(uint64(2*slice+1), uint64(2*slices)), -1)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(OpGetByPercentage, resp); err != nil {
+			return nil, err
+		}
+		sample = append(sample, resp.DataBuffer)
+	}
+	return sample, nil
+}
+
+// sampleScan draws n records from a scan of the whole file by reservoir
+// sampling, which keeps each record with equal probability
+func sampleScan(ctx context.Context, f *File, n int) ([][]byte, error) {
+	type kept struct {
+		seq    int
+		record []byte
+	}
+	var reservoir []kept
+	seen := 0
+	it := f.ScanPhysical()
+	defer it.Close()
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		seen++
+		if len(reservoir) < n {
+			reservoir = append(reservoir, kept{seen, bytes.Clone(it.Record())})
+		} else if i := rand.Intn(seen); i < n {
+			reservoir[i] = kept{seen, bytes.Clone(it.Record())}
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	// Back to physical order
+	sort.Slice(reservoir, func(i, j int) bool { return reservoir[i].seq < reservoir[j].seq })
+	sample := make([][]byte, len(reservoir))
+	for i, k := range reservoir {
+		sample[i] = k.record
+	}
+	return sample, nil
+}
+
+// chooseDistinct returns k distinct integers drawn uniformly from [0, n),
+// in ascending order (Floyd's algorithm)
+func chooseDistinct(n, k int) []int {
+	chosen := make(map[int]bool, k)
+	for j := n - k; j < n; j++ {
+		if t := rand.Intn(j + 1); chosen[t] {
+			chosen[j] = true
+		} else {
+			chosen[t] = true
+		}
+	}
+	picks := make([]int, 0, k)
+	for v := range chosen {
+		picks = append(picks, v)
+	}
+	sort.Ints(picks)
+	return picks
+}
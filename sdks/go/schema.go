@@ -0,0 +1,891 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field describes a field at a fixed offset within a record. Type is one of
+// the KeyType constants and decides how the bytes are decoded:
+//
+//	KeyTypeString, KeyTypeZstring, KeyTypeLstring  string
+//	KeyTypeWString, KeyTypeWZstring (UTF-16LE)     string
+//	KeyTypeInteger, KeyTypeAutoincrement           int64
+//	KeyTypeUnsignedBinary                          uint64
+//	KeyTypeFloat (IEEE)                            float64
+//	KeyTypeBfloat (Microsoft Binary Format)        float64
+//	KeyTypeNumeric, KeyTypeNumericSA/STS           int64, FixedPoint with a Scale
+//	KeyTypeDecimal (packed, COBOL COMP-3)          int64, FixedPoint with a Scale
+//	KeyTypeMoney (packed, 2 decimal places)        FixedPoint
+//	KeyTypeLogical                                 bool
+//	KeyTypeDate                                    time.Time (UTC)
+//	KeyTypeTime                                    time.Duration since midnight (or TimeOfDay)
+//	others                                         []byte
+//
+// Charset names the character set (see CharsetByName) of string and
+// NUMERIC fields, e.g. "ebcdic" for mainframe extracts: strings are
+// converted to UTF-8, and NUMERIC fields become EBCDIC zoned decimals.
+//
+// Scale is the number of implied decimal places of a zoned (NUMERIC,
+// NUMERICSA, NUMERICSTS) or packed (DECIMAL, MONEY) field; MONEY defaults
+// to 2. Scaled fields decode to FixedPoint and accept FixedPoint values
+// with no more decimal places, or integers as whole numbers; float64 is
+// refused so amounts are never rounded through binary fractions.
+//
+// A bit field sets Bits to use only Bits bits of its bytes, starting at
+// bit Bit of the little-endian value (0 is the lowest bit of the first
+// byte), e.g. eight LOGICAL flags packed in one status byte. Its type is
+// LOGICAL (bool), UNSIGNED BINARY (uint64) or INTEGER (int64, sign
+// extended), and encoding leaves the other bits alone, so several bit
+// fields may share bytes.
+//
+// A Nullable field follows the 6.x null indicator convention: the byte
+// before Offset is nonzero when the value is null. It decodes to nil when
+// null, and encoding nil sets the indicator and zeroes the value. Index
+// it with the segments from KeySpecs.
+//
+// An Encrypted field is stored AES-GCM encrypted with a key from the
+// schema's KeyProvider; its Length includes EncryptionOverhead. Schema
+// methods encrypt and decrypt it, while Field.Encode and Decode see the
+// raw ciphertext.
+type Field struct {
+	Name      string
+	Offset    int
+	Length    int
+	Type      uint8
+	Encrypted bool
+	// Sensitive fields are replaced by [REDACTED] in logs
+	Sensitive bool
+	Charset   string
+	Scale     int
+	Bit       int
+	Bits      int
+	Nullable  bool
+}
+
+// keyTypeNames maps type names used in schema files to key types
+var keyTypeNames = map[string]uint8{
+	"string":        KeyTypeString,
+	"integer":       KeyTypeInteger,
+	"float":         KeyTypeFloat,
+	"date":          KeyTypeDate,
+	"time":          KeyTypeTime,
+	"decimal":       KeyTypeDecimal,
+	"money":         KeyTypeMoney,
+	"logical":       KeyTypeLogical,
+	"numeric":       KeyTypeNumeric,
+	"numericsa":     KeyTypeNumericSA,
+	"numericsts":    KeyTypeNumericSTS,
+	"bfloat":        KeyTypeBfloat,
+	"lstring":       KeyTypeLstring,
+	"zstring":       KeyTypeZstring,
+	"unsigned":      KeyTypeUnsignedBinary,
+	"autoincrement": KeyTypeAutoincrement,
+	"wstring":       KeyTypeWString,
+	"wzstring":      KeyTypeWZstring,
+}
+
+// KeyTypeByName returns the key type for a name such as "string",
+// "integer" or "unsigned"
+func KeyTypeByName(name string) (uint8, bool) {
+	t, ok := keyTypeNames[strings.ToLower(name)]
+	return t, ok
+}
+
+// ParseValue converts text, e.g. typed by a user, to a value that
+// Field.Encode accepts for the given key type. Text starting with 0x is
+// taken as raw hex bytes.
+func ParseValue(keyType uint8, text string) (any, error) {
+	if raw, ok := strings.CutPrefix(text, "0x"); ok {
+		return hex.DecodeString(raw)
+	}
+	switch keyType {
+	case KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS, KeyTypeDecimal, KeyTypeMoney:
+		if strings.Contains(text, ".") {
+			return ParseFixedPoint(text, -1)
+		}
+		return strconv.ParseInt(text, 10, 64)
+	case KeyTypeInteger, KeyTypeAutoincrement:
+		return strconv.ParseInt(text, 10, 64)
+	case KeyTypeUnsignedBinary:
+		return strconv.ParseUint(text, 10, 64)
+	case KeyTypeFloat, KeyTypeBfloat:
+		return strconv.ParseFloat(text, 64)
+	case KeyTypeLogical:
+		return strconv.ParseBool(text)
+	case KeyTypeDate:
+		return time.Parse(time.DateOnly, text)
+	case KeyTypeTime:
+		t, err := ParseTimeOfDay(text)
+		if err != nil {
+			return nil, err
+		}
+		return t.Duration(), nil
+	}
+	return text, nil
+}
+
+// Schema is the layout of a record: a set of named fields
+type Schema struct {
+	Fields []Field
+	// Version names an integer field that Table uses for optimistic
+	// locking: it is incremented on every update and checked on writes
+	Version string
+	// SoftDelete names a logical, date or integer field that Table.Delete
+	// sets instead of deleting the record; Table scans skip such records
+	SoftDelete string
+	// Created and Modified name date, time, integer or string fields that
+	// Table sets to the UTC time a record was inserted and last written
+	Created  string
+	Modified string
+	// TimestampLayout is the time layout of string Created and Modified
+	// fields, time.RFC3339 by default
+	TimestampLayout string
+	// ValidFrom and ValidTo name date, integer or string fields bounding
+	// the time a version of a record was current: Table sets ValidFrom on
+	// every write, and ValidTo on the copies it keeps in a history file
+	// (see Table.History)
+	ValidFrom string
+	ValidTo   string
+	// StrictTimestamps makes Table refuse Created and Modified values the
+	// caller sets with ErrTimestampSupplied, so they cannot be forged
+	StrictTimestamps bool
+	// Keys provides the keys for Encrypted fields
+	Keys KeyProvider
+	// RecordKey names the fields identifying a record, such as those of
+	// its unique key, and Scope the file, e.g. by its path. Encrypted
+	// fields are bound to both, so a value copied to another record or
+	// file fails with ErrDecrypt. Setting a RecordKey field re-encrypts
+	// the record's encrypted fields. Without either, values are bound to
+	// their field name only, as in files written before.
+	RecordKey []string
+	Scope     string
+	// Charset is the character set of fields that do not name their own,
+	// e.g. "cp850" for a DOS application's files
+	Charset string
+	// Document stores values that are not fields as a MessagePack map
+	// after the fixed fields, for variable-length files used as document
+	// stores. The fields must cover the file's fixed record length. Tables
+	// and imports fail with ErrFixedLength unless Stat reports the file as
+	// variable-length; xtrieved creates every file fixed-length.
+	Document bool
+	index    map[string]int
+}
+
+// NewSchema builds a schema from field definitions
+func NewSchema(fields ...Field) (*Schema, error) {
+	s := &Schema{Fields: fields, index: make(map[string]int, len(fields))}
+	for i, f := range fields {
+		if f.Offset < 0 || f.Length <= 0 {
+			return nil, fmt.Errorf("field %s: invalid offset or length", f.Name)
+		}
+		if f.Encrypted && f.Length <= EncryptionOverhead {
+			return nil, fmt.Errorf("field %s: encrypted fields need more than %d bytes", f.Name, EncryptionOverhead)
+		}
+		if _, ok := CharsetByName(f.Charset); f.Charset != "" && !ok {
+			return nil, fmt.Errorf("field %s: unknown charset %q", f.Name, f.Charset)
+		}
+		if err := f.checkScale(); err != nil {
+			return nil, err
+		}
+		if err := f.checkBits(); err != nil {
+			return nil, err
+		}
+		if err := f.checkNullable(); err != nil {
+			return nil, err
+		}
+		if _, dup := s.index[f.Name]; dup {
+			return nil, fmt.Errorf("field %s: defined twice", f.Name)
+		}
+		s.index[f.Name] = i
+	}
+	return s, nil
+}
+
+// schemaFieldJSON is a field of a schema file
+type schemaFieldJSON struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Type   string `json:"type"`
+	// Encrypted marks a field stored encrypted
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Sensitive marks a field redacted in logs
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Charset names the field's character set
+	Charset string `json:"charset,omitempty"`
+	// Scale is the implied decimal places of a zoned or packed field
+	Scale int `json:"scale,omitempty"`
+	// Bit and Bits select the bits of a bit field
+	Bit  int `json:"bit,omitempty"`
+	Bits int `json:"bits,omitempty"`
+	// Nullable marks a field preceded by a null indicator byte
+	Nullable bool `json:"nullable,omitempty"`
+	// Version marks the optimistic-locking version field
+	Version bool `json:"version,omitempty"`
+	// SoftDelete marks the soft-delete field
+	SoftDelete bool `json:"softDelete,omitempty"`
+	// Created and Modified mark the automatic timestamp fields
+	Created  bool `json:"created,omitempty"`
+	Modified bool `json:"modified,omitempty"`
+	// ValidFrom and ValidTo mark the fields bounding a record's versions
+	ValidFrom bool `json:"validFrom,omitempty"`
+	ValidTo   bool `json:"validTo,omitempty"`
+}
+
+// ParseSchemaJSON builds a schema from a JSON array of fields, with types
+// given by name:
+//
+//	[{"name": "id", "offset": 0, "length": 8, "type": "unsigned"}, ...]
+//
+// A field with "version": true becomes the schema's Version field, one
+// with "softDelete": true its SoftDelete field, and ones with
+// "created": true or "modified": true its Created and Modified fields,
+// and ones with "validFrom": true or "validTo": true its ValidFrom and
+// ValidTo fields.
+func ParseSchemaJSON(data []byte) (*Schema, error) {
+	var defs []schemaFieldJSON
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, err
+	}
+
+	fields := make([]Field, 0, len(defs))
+	version, softDelete, created, modified, validFrom, validTo := "", "", "", "", "", ""
+	for _, d := range defs {
+		t, ok := KeyTypeByName(d.Type)
+		if !ok {
+			return nil, fmt.Errorf("field %s: unknown type %q", d.Name, d.Type)
+		}
+		fields = append(fields, Field{Name: d.Name, Offset: d.Offset, Length: d.Length, Type: t, Encrypted: d.Encrypted, Sensitive: d.Sensitive, Charset: d.Charset, Scale: d.Scale, Bit: d.Bit, Bits: d.Bits, Nullable: d.Nullable})
+		if d.Version {
+			version = d.Name
+		}
+		if d.SoftDelete {
+			softDelete = d.Name
+		}
+		if d.Created {
+			created = d.Name
+		}
+		if d.Modified {
+			modified = d.Name
+		}
+		if d.ValidFrom {
+			validFrom = d.Name
+		}
+		if d.ValidTo {
+			validTo = d.Name
+		}
+	}
+	s, err := NewSchema(fields...)
+	if err != nil {
+		return nil, err
+	}
+	s.Version, s.SoftDelete = version, softDelete
+	s.Created, s.Modified = created, modified
+	s.ValidFrom, s.ValidTo = validFrom, validTo
+	return s, nil
+}
+
+// JSON returns the schema in the format ParseSchemaJSON reads, e.g. to
+// save a schema generated from a copybook
+func (s *Schema) JSON() ([]byte, error) {
+	defs := make([]schemaFieldJSON, len(s.Fields))
+	for i, f := range s.Fields {
+		name := ""
+		for n, t := range keyTypeNames {
+			if t == f.Type && (name == "" || n < name) {
+				name = n
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("field %s: key type %d has no name", f.Name, f.Type)
+		}
+		defs[i] = schemaFieldJSON{
+			Name: f.Name, Offset: f.Offset, Length: f.Length, Type: name,
+			Encrypted: f.Encrypted, Sensitive: f.Sensitive, Charset: f.Charset,
+			Scale: f.Scale, Bit: f.Bit, Bits: f.Bits, Nullable: f.Nullable,
+			Version: f.Name == s.Version, SoftDelete: f.Name == s.SoftDelete,
+			Created: f.Name == s.Created, Modified: f.Name == s.Modified,
+			ValidFrom: f.Name == s.ValidFrom, ValidTo: f.Name == s.ValidTo,
+		}
+	}
+	return json.MarshalIndent(defs, "", "  ")
+}
+
+// RecordLength returns the minimum record length covering every field
+func (s *Schema) RecordLength() int {
+	n := 0
+	for _, f := range s.Fields {
+		if end := f.Offset + f.Length; end > n {
+			n = end
+		}
+	}
+	return n
+}
+
+// Field looks up a field by name
+func (s *Schema) Field(name string) (Field, bool) {
+	i, ok := s.index[name]
+	if !ok {
+		return Field{}, false
+	}
+	return s.Fields[i], true
+}
+
+// Get decodes a single field of a record, decrypting encrypted fields
+func (s *Schema) Get(record []byte, name string) (any, error) {
+	f, ok := s.Field(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s", name)
+	}
+	return s.decode(f, record)
+}
+
+// Set encodes a value into a field of a record, encrypting encrypted fields
+func (s *Schema) Set(record []byte, name string, value any) error {
+	f, ok := s.Field(name)
+	if !ok {
+		return fmt.Errorf("unknown field %s", name)
+	}
+	f, err := s.withCharset(f)
+	if err != nil {
+		return err
+	}
+	if f.Encrypted {
+		return s.encrypt(f, record, value)
+	}
+	if slices.Contains(s.RecordKey, name) {
+		return s.rebind(record, func() error { return f.Encode(record, value) })
+	}
+	return f.Encode(record, value)
+}
+
+func (s *Schema) decode(f Field, record []byte) (any, error) {
+	f, err := s.withCharset(f)
+	if err != nil {
+		return nil, err
+	}
+	if f.Encrypted {
+		return s.decrypt(f, record)
+	}
+	return f.Decode(record)
+}
+
+// Decode decodes every field of a record into a map keyed by field name.
+// For a Document schema, the document's values are added to the map.
+func (s *Schema) Decode(record []byte) (map[string]any, error) {
+	values := make(map[string]any, len(s.Fields))
+	for _, f := range s.Fields {
+		v, err := s.decode(f, record)
+		if err != nil {
+			return nil, err
+		}
+		values[f.Name] = v
+	}
+	if n := s.RecordLength(); s.Document && len(record) > n && !allZero(record[n:]) {
+		// Trailing bytes after the map are padding
+		r := &msgpackReader{b: record[n:]}
+		doc, err := r.value()
+		if err != nil {
+			return nil, fmt.Errorf("document: %w", err)
+		}
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("document: %T is not a map", doc)
+		}
+		for name, v := range m {
+			if _, isField := s.index[name]; !isField {
+				values[name] = v
+			}
+		}
+	}
+	return values, nil
+}
+
+// Encode builds a record of RecordLength bytes from field values. Fields
+// missing from values are left zeroed. For a Document schema, values that
+// are not fields are appended as a MessagePack map.
+func (s *Schema) Encode(values map[string]any) ([]byte, error) {
+	record := make([]byte, s.RecordLength())
+	doc := make(map[string]any)
+	for name, v := range values {
+		if _, isField := s.index[name]; !isField && s.Document {
+			doc[name] = v
+			continue
+		}
+		if err := s.Set(record, name, v); err != nil {
+			return nil, err
+		}
+	}
+	if len(doc) > 0 {
+		return appendMsgpack(record, reflect.ValueOf(doc))
+	}
+	return record, nil
+}
+
+// bytes returns the slice of the record holding the field
+func (f Field) bytes(record []byte) ([]byte, error) {
+	end := f.Offset + f.Length
+	if end > len(record) {
+		return nil, fmt.Errorf("field %s: record too short (%d bytes, field ends at %d)", f.Name, len(record), end)
+	}
+	return record[f.Offset:end], nil
+}
+
+// Decode decodes the field from a record
+func (f Field) Decode(record []byte) (any, error) {
+	b, err := f.bytes(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.Nullable {
+		ind, err := f.indicator(record)
+		if err != nil {
+			return nil, err
+		}
+		if *ind != 0 {
+			return nil, nil
+		}
+	}
+	if f.Bits > 0 {
+		return f.decodeBits(b), nil
+	}
+
+	cs := f.charset()
+	switch f.Type {
+	case KeyTypeString:
+		space := " "
+		if cs != nil {
+			space = string(cs.Space())
+		}
+		return cs.string(bytes.TrimRight(b, space+"\x00")), nil
+	case KeyTypeZstring:
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return cs.string(b), nil
+	case KeyTypeLstring:
+		return cs.string(lstringData(b)), nil
+	case KeyTypeWString:
+		return DecodeUTF16LE(trimUTF16(b, ' ')), nil
+	case KeyTypeWZstring:
+		return DecodeUTF16LE(trimUTF16(b, 0)), nil
+	case KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS:
+		unpack, _ := zonedCodec(f.Type)
+		n, err := unpack(cs.ascii(b))
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return f.numericValue(n), nil
+	case KeyTypeDecimal, KeyTypeMoney:
+		n, err := unpackDecimal(b)
+		if err == nil && !n.IsInt64() {
+			err = ErrFixedPointOverflow
+		}
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return f.numericValue(n.Int64()), nil
+	case KeyTypeInteger, KeyTypeAutoincrement:
+		return decodeInt(b), nil
+	case KeyTypeUnsignedBinary:
+		return decodeUint(b), nil
+	case KeyTypeFloat:
+		return decodeFloat(b), nil
+	case KeyTypeBfloat:
+		if f.Length != 4 && f.Length != 8 {
+			break
+		}
+		return decodeMBF(b), nil
+	case KeyTypeLogical:
+		return b[0] != 0, nil
+	case KeyTypeDate:
+		if f.Length != 4 {
+			break
+		}
+		t, err := DecodeDate(b)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return t, nil
+	case KeyTypeTime:
+		if f.Length != 4 {
+			break
+		}
+		t, err := DecodeTime(b)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return t.Duration(), nil
+	}
+
+	raw := make([]byte, len(b))
+	copy(raw, b)
+	return raw, nil
+}
+
+// Encode encodes a value into the field of a record
+func (f Field) Encode(record []byte, value any) error {
+	b, err := f.bytes(record)
+	if err != nil {
+		return err
+	}
+
+	if f.Nullable {
+		ind, err := f.indicator(record)
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			*ind = 1
+			clear(b)
+			return nil
+		}
+		*ind = 0
+	}
+	if f.Bits > 0 {
+		return f.encodeBits(b, value)
+	}
+
+	cs := f.charset()
+	switch f.Type {
+	case KeyTypeString, KeyTypeZstring:
+		str, ok := value.(string)
+		if !ok {
+			break
+		}
+		s, err := cs.bytes(str)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		limit := len(b)
+		if f.Type == KeyTypeZstring {
+			limit-- // keep room for the terminator
+		}
+		if len(s) > limit {
+			return fmt.Errorf("field %s: value longer than %d bytes", f.Name, limit)
+		}
+		pad := byte(' ')
+		if cs != nil {
+			pad = cs.Space()
+		}
+		if f.Type == KeyTypeZstring {
+			pad = 0
+		}
+		n := copy(b, s)
+		for i := n; i < len(b); i++ {
+			b[i] = pad
+		}
+		return nil
+	case KeyTypeLstring:
+		str, ok := value.(string)
+		if !ok {
+			break
+		}
+		s, err := cs.bytes(str)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if len(s) > len(b)-1 || len(s) > 255 {
+			return fmt.Errorf("field %s: value too long", f.Name)
+		}
+		clear(b)
+		b[0] = byte(len(s))
+		copy(b[1:], s)
+		return nil
+	case KeyTypeInteger, KeyTypeAutoincrement:
+		n, ok := toInt64(value)
+		if !ok {
+			break
+		}
+		return f.putInt(b, uint64(n), true)
+	case KeyTypeWString, KeyTypeWZstring:
+		s, ok := value.(string)
+		if !ok {
+			break
+		}
+		pad := rune(' ')
+		if f.Type == KeyTypeWZstring {
+			pad = 0
+		}
+		if err := putUTF16(b, s, pad); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return nil
+	case KeyTypeDecimal, KeyTypeMoney:
+		n, ok, err := f.numericUnits(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if !ok {
+			break
+		}
+		if err := packDecimal(b, big.NewInt(n)); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		return nil
+	case KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS:
+		n, ok, err := f.numericUnits(value)
+		if err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if !ok {
+			break
+		}
+		_, pack := zonedCodec(f.Type)
+		if err := pack(b, n); err != nil {
+			return fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		if cs != nil {
+			encoded, err := cs.Encode(string(b))
+			if err != nil {
+				return err
+			}
+			copy(b, encoded)
+		}
+		return nil
+	case KeyTypeUnsignedBinary:
+		if u, ok := value.(uint64); ok {
+			return f.putInt(b, u, false)
+		}
+		n, ok := toInt64(value)
+		if !ok || n < 0 {
+			break
+		}
+		return f.putInt(b, uint64(n), false)
+	case KeyTypeFloat, KeyTypeBfloat:
+		x, ok := toFloat64(value)
+		if !ok {
+			break
+		}
+		if f.Type == KeyTypeBfloat && (f.Length == 4 || f.Length == 8) {
+			if err := encodeMBF(b, x); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			return nil
+		}
+		switch f.Length {
+		case 4:
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(x)))
+			return nil
+		case 8:
+			binary.LittleEndian.PutUint64(b, math.Float64bits(x))
+			return nil
+		}
+	case KeyTypeLogical:
+		v, ok := value.(bool)
+		if !ok {
+			break
+		}
+		clear(b)
+		if v {
+			b[0] = 1
+		}
+		return nil
+	case KeyTypeDate:
+		t, ok := value.(time.Time)
+		if !ok || f.Length != 4 {
+			break
+		}
+		putDate(b, t)
+		return nil
+	case KeyTypeTime:
+		if f.Length != 4 {
+			break
+		}
+		t, ok := value.(TimeOfDay)
+		if d, isDuration := value.(time.Duration); isDuration {
+			var err error
+			if t, err = TimeOfDayFromDuration(d); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+			ok = true
+		}
+		if !ok {
+			break
+		}
+		if !t.IsValid() {
+			return fmt.Errorf("field %s: invalid time of day %s", f.Name, t)
+		}
+		copy(b, t.Bytes())
+		return nil
+	}
+
+	if raw, ok := value.([]byte); ok {
+		if len(raw) > len(b) {
+			return fmt.Errorf("field %s: value longer than %d bytes", f.Name, len(b))
+		}
+		clear(b)
+		copy(b, raw)
+		return nil
+	}
+	return fmt.Errorf("field %s: cannot encode %T as key type %d", f.Name, value, f.Type)
+}
+
+// zonedCodec returns the functions reading and writing a zoned decimal type
+func zonedCodec(keyType uint8) (func([]byte) (int64, error), func([]byte, int64) error) {
+	switch keyType {
+	case KeyTypeNumericSA:
+		return unpackSA, packSA
+	case KeyTypeNumericSTS:
+		return unpackSTS, packSTS
+	}
+	return unpackZoned, packZoned
+}
+
+// scale returns the field's decimal places, 2 for a MONEY field without one
+func (f Field) scale() int {
+	if f.Type == KeyTypeMoney && f.Scale == 0 {
+		return 2
+	}
+	return f.Scale
+}
+
+// numericValue returns the decoded value of a decimal field holding n units
+func (f Field) numericValue(n int64) any {
+	if scale := f.scale(); scale > 0 {
+		return NewFixedPoint(n, scale)
+	}
+	return n
+}
+
+// digits returns the number of decimal digits a zoned or packed field
+// holds, 0 for other types
+func (f Field) digits() int {
+	n := f.Length
+	if f.Encrypted {
+		n -= EncryptionOverhead
+	}
+	switch f.Type {
+	case KeyTypeNumeric, KeyTypeNumericSA:
+		return n
+	case KeyTypeNumericSTS:
+		return n - 1
+	case KeyTypeDecimal, KeyTypeMoney:
+		return 2*n - 1
+	}
+	return 0
+}
+
+// checkScale validates a field's Scale against its type and digits
+func (f Field) checkScale() error {
+	if f.Scale == 0 {
+		return nil
+	}
+	digits := f.digits()
+	if digits == 0 {
+		return fmt.Errorf("field %s: scale needs a zoned or packed decimal field", f.Name)
+	}
+	if f.Scale < 0 || f.Scale > MaxFixedPointScale || f.Scale > digits {
+		return fmt.Errorf("field %s: invalid scale %d for %d digits", f.Name, f.Scale, digits)
+	}
+	return nil
+}
+
+// numericUnits converts a value for a decimal field to units of the
+// field's scale. ok is false for types the field does not accept.
+func (f Field) numericUnits(value any) (n int64, ok bool, err error) {
+	scale := f.scale()
+	if x, isFixed := value.(FixedPoint); isFixed {
+		x, err := x.Rescale(scale)
+		return x.units, true, err
+	}
+	if _, isFloat := toFloat64(value); isFloat && scale > 0 {
+		if _, isInt := toInt64(value); !isInt {
+			return 0, false, fmt.Errorf("%T cannot hold a scaled decimal exactly; use FixedPoint", value)
+		}
+	}
+	n, ok = toInt64(value)
+	if !ok || scale == 0 {
+		return n, ok, nil
+	}
+	x, err := FixedPointFromInt(n, scale)
+	return x.units, true, err
+}
+
+// putInt stores n little-endian, as a two's complement value if signed,
+// failing if it does not fit in the field
+func (f Field) putInt(b []byte, n uint64, signed bool) error {
+	if bits := 8 * len(b); bits < 64 {
+		fits := n < 1<<bits
+		if signed {
+			limit := int64(1) << (bits - 1)
+			fits = int64(n) >= -limit && int64(n) < limit
+		}
+		if !fits {
+			value := any(n)
+			if signed {
+				value = int64(n)
+			}
+			return fmt.Errorf("field %s: %d does not fit in %d bytes", f.Name, value, len(b))
+		}
+	}
+	switch len(b) {
+	case 1:
+		b[0] = byte(n)
+	case 2:
+		binary.LittleEndian.PutUint16(b, uint16(n))
+	case 4:
+		binary.LittleEndian.PutUint32(b, uint32(n))
+	case 8:
+		binary.LittleEndian.PutUint64(b, n)
+	default:
+		return fmt.Errorf("field %s: unsupported integer length %d", f.Name, len(b))
+	}
+	return nil
+}
+
+// toInt64 converts any Go integer to int64
+func toInt64(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), true
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// toFloat64 converts any Go number to float64
+func toFloat64(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	if u, ok := v.(uint64); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
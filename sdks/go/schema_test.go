@@ -0,0 +1,62 @@
+package xtrieve
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEncodeIntegerRange(t *testing.T) {
+	tests := []struct {
+		typ    uint8
+		length int
+		value  any
+		ok     bool
+	}{
+		{KeyTypeInteger, 1, int64(127), true},
+		{KeyTypeInteger, 1, int64(-128), true},
+		{KeyTypeInteger, 1, int64(128), false},
+		{KeyTypeInteger, 1, int64(-129), false},
+		{KeyTypeInteger, 1, 300, false},
+		{KeyTypeInteger, 2, int64(math.MaxInt16), true},
+		{KeyTypeInteger, 2, int64(math.MinInt16), true},
+		{KeyTypeInteger, 2, int64(math.MaxInt16 + 1), false},
+		{KeyTypeInteger, 2, int64(math.MinInt16 - 1), false},
+		{KeyTypeInteger, 4, int64(math.MaxInt32), true},
+		{KeyTypeInteger, 4, int64(math.MinInt32), true},
+		{KeyTypeInteger, 4, int64(math.MaxInt32 + 1), false},
+		{KeyTypeInteger, 4, int64(math.MinInt32 - 1), false},
+		{KeyTypeInteger, 8, int64(math.MaxInt64), true},
+		{KeyTypeInteger, 8, int64(math.MinInt64), true},
+		{KeyTypeAutoincrement, 2, int64(40000), false},
+		{KeyTypeUnsignedBinary, 1, uint64(255), true},
+		{KeyTypeUnsignedBinary, 1, uint64(256), false},
+		{KeyTypeUnsignedBinary, 2, 65535, true},
+		{KeyTypeUnsignedBinary, 2, 65536, false},
+		{KeyTypeUnsignedBinary, 4, uint64(math.MaxUint32), true},
+		{KeyTypeUnsignedBinary, 4, uint64(math.MaxUint32 + 1), false},
+		{KeyTypeUnsignedBinary, 8, uint64(math.MaxUint64), true},
+		{KeyTypeUnsignedBinary, 4, -1, false},
+	}
+	for _, tt := range tests {
+		f := Field{Name: "n", Length: tt.length, Type: tt.typ}
+		record := make([]byte, tt.length)
+		err := f.Encode(record, tt.value)
+		if (err == nil) != tt.ok {
+			t.Errorf("type %d, %d bytes: Encode(%v) = %v, want ok %v", tt.typ, tt.length, tt.value, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		got, err := f.Decode(record)
+		want := any(tt.value)
+		if n, ok := toInt64(tt.value); ok && tt.typ == KeyTypeUnsignedBinary {
+			want = uint64(n)
+		} else if ok {
+			want = n
+		}
+		if err != nil || got != want {
+			t.Errorf("type %d, %d bytes: Decode = %v, %v, want %v", tt.typ, tt.length, got, err, want)
+		}
+	}
+}
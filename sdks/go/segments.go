@@ -0,0 +1,101 @@
+package xtrieve
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxSegments bounds the continuation segments of an extended file
+const maxSegments = 255
+
+// Extend turns the file into an extended file by adding a continuation
+// segment at extensionPath, for a file that outgrows its volume or the
+// size limit of a single file. Segments are conventionally named by
+// SegmentPath, e.g. CUSTOMER.^01 next to CUSTOMER.DAT. With now set the
+// engine stores new pages in the segment at once, else only when the
+// first one is full.
+func (f *File) Extend(extensionPath string, now bool) (*Response, error) {
+	var keyNumber int16
+	if now {
+		keyNumber = -1
+	}
+	return f.exec(&Request{
+		Operation: OpExtend,
+		KeyBuffer: append([]byte(extensionPath), 0),
+		KeyNumber: keyNumber,
+	})
+}
+
+// SegmentPath returns the path of the nth continuation segment (from 1)
+// of an extended file: the file's name with the extension .^01, .^02 and
+// so on
+func SegmentPath(path string, n int) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + fmt.Sprintf(".^%02d", n)
+}
+
+// Segments returns the physical files making up the file at path, as seen
+// on the server's disk or a share of it: path itself followed by every
+// continuation segment, in order. Copying only path misses the data in
+// the segments.
+func Segments(path string) ([]string, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	segments := []string{path}
+	for n := 1; n <= maxSegments; n++ {
+		seg := SegmentPath(path, n)
+		if _, err := os.Stat(seg); errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+// BackupFile copies the file at path and all its continuation segments
+// into dir, keeping their names, and returns the paths written. The file
+// must not change during the copy: close it everywhere or take the backup
+// from a snapshot of the volume.
+func BackupFile(path, dir string) ([]string, error) {
+	segments, err := Segments(path)
+	if err != nil {
+		return nil, err
+	}
+	written := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		dst := filepath.Join(dir, filepath.Base(seg))
+		if err := copyFile(seg, dst); err != nil {
+			return written, fmt.Errorf("backup %s: %w", seg, err)
+		}
+		written = append(written, dst)
+	}
+	return written, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
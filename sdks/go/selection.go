@@ -0,0 +1,104 @@
+package xtrieve
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Selection chooses the replica that serves the reads of a pooled file
+type Selection int
+
+const (
+	// SelectRoundRobin takes the replicas in turn
+	SelectRoundRobin Selection = iota
+	// SelectLatency takes the faster of two replicas drawn at random
+	// (power of two choices), comparing moving averages of their latency
+	// weighted by their rate of transport errors. Files spread over the
+	// nearest healthy replicas instead of piling onto the single fastest,
+	// and health checks keep measuring the replicas left idle.
+	SelectLatency
+)
+
+var selectionNames = map[Selection]string{
+	SelectRoundRobin: "round-robin",
+	SelectLatency:    "latency",
+}
+
+func (s Selection) String() string {
+	if name, ok := selectionNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Selection(%d)", int(s))
+}
+
+// UnmarshalText parses "round-robin" or "latency"
+func (s *Selection) UnmarshalText(text []byte) error {
+	for value, name := range selectionNames {
+		if string(text) == name {
+			*s = value
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown selection %q", text)
+}
+
+// MarshalText returns the selection's name
+func (s Selection) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+const (
+	// latencyWeight is the weight of a new sample in the moving averages
+	latencyWeight = 0.1
+	// errorPenalty is how many times slower a server failing every
+	// operation looks
+	errorPenalty = 10
+)
+
+// latencyTracker keeps moving averages of a server's latency and transport
+// error rate, fed by every operation and health check of its connections
+type latencyTracker struct {
+	mu       sync.Mutex
+	latency  float64
+	errors   float64
+	measured bool
+}
+
+func (t *latencyTracker) observe(elapsed time.Duration, failed bool) {
+	e := 0.0
+	if failed {
+		e = 1
+	}
+	t.mu.Lock()
+	if !t.measured {
+		t.latency, t.errors, t.measured = float64(elapsed), e, true
+	} else {
+		t.latency += latencyWeight * (float64(elapsed) - t.latency)
+		t.errors += latencyWeight * (e - t.errors)
+	}
+	t.mu.Unlock()
+}
+
+// score ranks the server, lower being better. Servers not measured yet
+// score 0 so that they get measured.
+func (t *latencyTracker) score() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.latency * (1 + (errorPenalty-1)*t.errors)
+}
+
+// pickTwo returns the better scoring of two distinct random candidates
+func pickTwo(candidates []*poolServer) *poolServer {
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if b.latency.score() < a.latency.score() {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,90 @@
+package xtrieve
+
+import "bytes"
+
+// Divergence is a read the shadow answered differently from the file
+type Divergence struct {
+	Operation uint16
+	File      string
+	KeyNumber int16
+	// SearchKey is the key buffer of the request
+	SearchKey []byte
+
+	Status, ShadowStatus uint16
+	Data, ShadowData     []byte
+	Key, ShadowKey       []byte
+	// Err is set when the shadow failed to answer at all
+	Err error
+}
+
+// Shadow repeats every read made through f on shadow, the same file open
+// on another server, and calls report for each read whose status, record
+// or key differs, e.g. to check a new server or a replica against the
+// current one before switching. Reads cost a round trip to each server;
+// report is called from the reading goroutine. A nil shadow stops it.
+//
+// Writes go to f alone, so the shadow is expected to receive them some
+// other way, such as replication. Reads that continue from the cursor are
+// compared only after the shadow was positioned by a read of its own, and
+// Stat, whose page counts legitimately differ, is not compared.
+func (f *File) Shadow(shadow *File, report func(Divergence)) {
+	if shadow == nil {
+		f.shadow = nil
+		return
+	}
+	f.shadow = &shadowReads{file: shadow, report: report}
+}
+
+// shadowReads is the state of File.Shadow
+type shadowReads struct {
+	file   *File
+	report func(Divergence)
+	// synced is set while the shadow's cursor is where the file's is
+	synced bool
+}
+
+// exec runs a request on f and, for reads, on the shadow
+func (s *shadowReads) exec(f *File, req *Request) (*Response, error) {
+	op := req.Operation
+	if !IsReadOnly(op) || op == OpStat || followsCursor(op) && !s.synced {
+		if op != OpStat && op != OpGetPosition {
+			s.synced = false
+		}
+		return f.execPrimary(req)
+	}
+
+	mirror := &Request{
+		Operation:  op,
+		DataBuffer: bytes.Clone(req.DataBuffer),
+		KeyBuffer:  bytes.Clone(req.KeyBuffer),
+		KeyNumber:  req.KeyNumber,
+	}
+	resp, err := f.execPrimary(req)
+	if err != nil {
+		s.synced = false
+		return nil, err
+	}
+	got, err := s.file.exec(mirror)
+
+	d := Divergence{
+		Operation: op,
+		File:      f.path,
+		KeyNumber: mirror.KeyNumber,
+		SearchKey: mirror.KeyBuffer,
+		Status:    resp.StatusCode,
+		Data:      resp.DataBuffer,
+		Key:       resp.KeyBuffer,
+		Err:       err,
+	}
+	if err == nil {
+		d.ShadowStatus, d.ShadowData, d.ShadowKey = got.StatusCode, got.DataBuffer, got.KeyBuffer
+		s.synced = d.ShadowStatus == d.Status &&
+			(d.Status != StatusSuccess || bytes.Equal(d.ShadowData, d.Data) && bytes.Equal(d.ShadowKey, d.Key))
+	} else {
+		s.synced = false
+	}
+	if !s.synced && s.report != nil {
+		s.report(d)
+	}
+	return resp, nil
+}
@@ -0,0 +1,137 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Scan returns an iterator over the table's records in the order of
+// keyNumber. Soft-deleted records are skipped unless IncludeDeleted is
+// called on the iterator.
+func (t *Table) Scan(keyNumber int16) *Iterator {
+	return t.hideDeleted(t.File.Scan(keyNumber))
+}
+
+// Range is like File.Range, skipping soft-deleted records like Scan
+func (t *Table) Range(keyNumber int16, from, to []byte) *Iterator {
+	return t.hideDeleted(t.File.Range(keyNumber, from, to))
+}
+
+func (t *Table) hideDeleted(it *Iterator) *Iterator {
+	if field, ok := t.softDeleteField(); ok {
+		it.deleted = &field
+		it.compileFilter()
+	}
+	return it
+}
+
+// softDeleteField returns the schema's soft-delete field, if it has one
+func (t *Table) softDeleteField() (Field, bool) {
+	if t.Schema.SoftDelete == "" {
+		return Field{}, false
+	}
+	return t.Schema.Field(t.Schema.SoftDelete)
+}
+
+// isDeleted reports whether a record is soft-deleted
+func isDeleted(field Field, record []byte) bool {
+	b, err := field.bytes(record)
+	if err != nil {
+		return false
+	}
+	return !allZero(b)
+}
+
+// deletedValue is the value marking a record deleted at now: true for a
+// logical field, the date for a date field and Unix seconds for integers
+func deletedValue(field Field, now time.Time) (any, error) {
+	switch field.Type {
+	case KeyTypeLogical:
+		return true, nil
+	case KeyTypeDate:
+		return now.UTC(), nil
+	case KeyTypeInteger, KeyTypeUnsignedBinary:
+		return now.Unix(), nil
+	}
+	return nil, fmt.Errorf("xtrieve: soft-delete field %s must be logical, date or integer", field.Name)
+}
+
+// deletedBefore reports whether a soft-deleted record was deleted before
+// cutoff. Logical fields carry no time and always qualify.
+func deletedBefore(field Field, record []byte, cutoff time.Time) bool {
+	v, err := field.Decode(record)
+	if err != nil {
+		return false
+	}
+	switch v := v.(type) {
+	case time.Time:
+		return v.Before(cutoff)
+	case int64:
+		return v < cutoff.Unix()
+	case uint64:
+		return int64(v) < cutoff.Unix()
+	}
+	return true
+}
+
+// softDelete marks the record matching values deleted, checking and
+// incrementing the version field like Update
+func (t *Table) softDelete(field Field, values map[string]any) error {
+	v, err := deletedValue(field, time.Now())
+	if err != nil {
+		return err
+	}
+	values[field.Name] = v
+	return t.update(values)
+}
+
+// Purge permanently deletes the soft-deleted records that were deleted
+// before cutoff, or all of them if cutoff is zero or the soft-delete field
+// is a logical flag, and returns how many were removed
+func (t *Table) Purge(ctx context.Context, cutoff time.Time, progress Progress) (int, error) {
+	field, ok := t.softDeleteField()
+	if !ok {
+		return 0, fmt.Errorf("xtrieve: schema has no soft-delete field")
+	}
+	tracker := newProgressTracker(progress, 0)
+
+	n := 0
+	resp, err := t.File.GetFirst(t.KeyNumber)
+	for {
+		if err != nil {
+			return n, err
+		}
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		switch resp.StatusCode {
+		case StatusSuccess:
+		case StatusEndOfFile:
+			tracker.done()
+			return n, nil
+		default:
+			return n, &StatusError{Operation: OpGetNext, Status: resp.StatusCode}
+		}
+
+		record := resp.DataBuffer
+		if !isDeleted(field, record) || (!cutoff.IsZero() && !deletedBefore(field, record, cutoff)) {
+			resp, err = t.File.GetNext(t.KeyNumber)
+			continue
+		}
+
+		key := resp.KeyBuffer
+		del, derr := t.File.Delete(t.KeyNumber)
+		if derr != nil {
+			return n, derr
+		}
+		if err := checkStatus(OpDelete, del); err != nil {
+			return n, err
+		}
+		n++
+		tracker.add(1, len(record))
+
+		// Deleting drops the cursor; continue after the deleted key
+		resp, err = t.File.Get(OpGetGreater, key, t.KeyNumber)
+	}
+}
@@ -0,0 +1,366 @@
+package xtrieve
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// SQLExport mirrors a file into a table of a SQLite database opened with
+// database/sql. The table and its indexes are derived from the schema and
+// the file's keys: every key whose segments all line up with schema fields
+// becomes an index, and the first such unique key the primary key, which
+// rows exported again replace.
+//
+//	export := &xtrieve.SQLExport{File: f, Schema: schema, Table: "customers"}
+//	n, err := export.Run(db)
+type SQLExport struct {
+	File   *File
+	Schema *Schema
+	// Table defaults to the file name without directory and extension
+	Table string
+	// KeyNumber is the key the file is read in
+	KeyNumber int16
+	// Incremental names a field that only grows, such as an autoincrement
+	// or timestamp field. When set, only records whose value is greater
+	// than the largest value already in the table are exported, which
+	// needs a primary key; otherwise the table is emptied and reloaded in
+	// a single SQL transaction.
+	Incremental string
+	// BatchSize is the number of rows inserted per SQL transaction of an
+	// incremental export (default 1000)
+	BatchSize int
+	// Progress, if set, receives progress reports
+	Progress Progress
+}
+
+// Run creates the table and indexes if needed and copies the records,
+// returning the number of rows written
+func (e *SQLExport) Run(db *sql.DB) (int, error) {
+	return e.RunContext(context.Background(), db)
+}
+
+// RunContext is like Run but stops when ctx is cancelled. A reload is
+// rolled back as a whole, leaving the table as it was; an incremental
+// export rolls back the rows of the current batch, and earlier batches
+// stay exported.
+func (e *SQLExport) RunContext(ctx context.Context, db *sql.DB) (int, error) {
+	if e.File == nil || e.Schema == nil {
+		return 0, errors.New("xtrieve: SQLExport needs a File and a Schema")
+	}
+	table := e.Table
+	if table == "" {
+		table = tableName(e.File.Path())
+	}
+	if e.Incremental != "" && e.primaryKey() == nil {
+		return 0, errors.New("xtrieve: an incremental SQLExport needs a unique key on schema fields")
+	}
+
+	for _, stmt := range e.ddl(table) {
+		if _, err := db.Exec(stmt); err != nil {
+			return 0, fmt.Errorf("create %s: %w", table, err)
+		}
+	}
+
+	it := e.File.Scan(e.KeyNumber)
+	defer it.Close()
+	if e.Incremental != "" {
+		field, ok := e.Schema.Field(e.Incremental)
+		if !ok {
+			return 0, fmt.Errorf("xtrieve: unknown field %q", e.Incremental)
+		}
+		last, err := lastValue(db, table, field)
+		if err != nil {
+			return 0, err
+		}
+		if last != nil {
+			filter := NewFilter(e.Schema).Where(field.Name, CmpGreater, last)
+			if err := filter.Err(); err != nil {
+				return 0, err
+			}
+			it.Where(filter)
+		}
+	}
+
+	var total int64
+	if e.Progress != nil {
+		if stat, err := e.File.Stat(); err == nil {
+			total = int64(stat.NumRecords)
+		}
+	}
+	return e.copy(ctx, db, table, it, newProgressTracker(e.Progress, total))
+}
+
+// copy inserts the iterator's records in batches. A reload empties the
+// table first and runs as one batch.
+func (e *SQLExport) copy(ctx context.Context, db *sql.DB, table string, it *Iterator, progress *progressTracker) (int, error) {
+	reload := e.Incremental == ""
+	batchSize := e.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1000
+	}
+	if reload {
+		batchSize = math.MaxInt
+	}
+
+	columns := make([]string, len(e.Schema.Fields))
+	marks := make([]string, len(e.Schema.Fields))
+	for i, field := range e.Schema.Fields {
+		columns[i] = quoteIdent(field.Name)
+		marks[i] = "?"
+	}
+	insert := fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s)",
+		quoteIdent(table), strings.Join(columns, ", "), strings.Join(marks, ", "))
+
+	var (
+		tx    *sql.Tx
+		stmt  *sql.Stmt
+		count int
+	)
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		stmt.Close()
+		err := tx.Commit()
+		tx, stmt = nil, nil
+		return err
+	}
+
+	args := make([]any, len(e.Schema.Fields))
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			if tx != nil {
+				tx.Rollback()
+			}
+			return count - count%batchSize, err
+		}
+		if tx == nil {
+			var err error
+			if tx, stmt, err = e.begin(ctx, db, table, insert, reload); err != nil {
+				return count, err
+			}
+		}
+
+		for i, field := range e.Schema.Fields {
+			v, err := e.Schema.decode(field, it.Record())
+			if err != nil {
+				tx.Rollback()
+				return count - count%batchSize, err
+			}
+			args[i] = sqlValue(v)
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			tx.Rollback()
+			return count - count%batchSize, fmt.Errorf("insert into %s: %w", table, err)
+		}
+
+		count++
+		progress.add(1, len(it.Record()))
+		if count%batchSize == 0 {
+			if err := commit(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := it.Err(); err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		return count - count%batchSize, err
+	}
+	if reload && tx == nil {
+		// No records: the table is still emptied
+		var err error
+		if tx, stmt, err = e.begin(ctx, db, table, insert, reload); err != nil {
+			return count, err
+		}
+	}
+	if err := commit(); err != nil {
+		return count, err
+	}
+	progress.done()
+	return count, nil
+}
+
+// begin starts a batch's SQL transaction, emptying the table for a reload
+func (e *SQLExport) begin(ctx context.Context, db *sql.DB, table, insert string, reload bool) (*sql.Tx, *sql.Stmt, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reload {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM "+quoteIdent(table)); err != nil {
+			tx.Rollback()
+			return nil, nil, fmt.Errorf("empty %s: %w", table, err)
+		}
+	}
+	stmt, err := tx.Prepare(insert)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+	return tx, stmt, nil
+}
+
+// primaryKey returns the quoted columns of the first unique key whose
+// segments line up with schema fields, or nil if there is none
+func (e *SQLExport) primaryKey() []string {
+	for keyNumber := int16(0); ; keyNumber++ {
+		segments := e.File.KeySegments(keyNumber)
+		if segments == nil {
+			return nil
+		}
+		if segments[0].Flags&KeyFlagDuplicates != 0 {
+			continue
+		}
+		if names, ok := e.keyFields(segments); ok {
+			return names
+		}
+	}
+}
+
+// ddl returns the statements creating the table and its indexes
+func (e *SQLExport) ddl(table string) []string {
+	columns := make([]string, len(e.Schema.Fields))
+	for i, field := range e.Schema.Fields {
+		typ := sqlType(field.Type)
+		if field.scale() > 0 {
+			// Exact decimals as text; REAL would round the cents
+			typ = "TEXT"
+		}
+		columns[i] = quoteIdent(field.Name) + " " + typ
+	}
+
+	if pk := e.primaryKey(); pk != nil {
+		columns = append(columns, "PRIMARY KEY ("+strings.Join(pk, ", ")+")")
+	}
+	stmts := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		quoteIdent(table), strings.Join(columns, ", "))}
+
+	for keyNumber := int16(0); ; keyNumber++ {
+		segments := e.File.KeySegments(keyNumber)
+		if segments == nil {
+			break
+		}
+		names, ok := e.keyFields(segments)
+		if !ok {
+			continue
+		}
+		unique := ""
+		if segments[0].Flags&KeyFlagDuplicates == 0 {
+			unique = "UNIQUE "
+		}
+		stmts = append(stmts, fmt.Sprintf("CREATE %sINDEX IF NOT EXISTS %s ON %s (%s)",
+			unique, quoteIdent(fmt.Sprintf("%s_key%d", table, keyNumber)),
+			quoteIdent(table), strings.Join(names, ", ")))
+	}
+	return stmts
+}
+
+// keyFields maps key segments to quoted column names, failing if a
+// segment does not cover exactly one schema field
+func (e *SQLExport) keyFields(segments []KeySpec) ([]string, bool) {
+	names := make([]string, 0, len(segments))
+	for _, seg := range segments {
+		found := false
+		for _, field := range e.Schema.Fields {
+			if field.Offset == int(seg.Position) && field.Length == int(seg.Length) {
+				col := quoteIdent(field.Name)
+				if seg.Flags&KeyFlagDescending != 0 {
+					col += " DESC"
+				}
+				names = append(names, col)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, false
+		}
+	}
+	return names, true
+}
+
+// lastValue returns the largest value of a field already exported, or nil
+// if the table is empty
+func lastValue(db *sql.DB, table string, field Field) (any, error) {
+	column := quoteIdent(field.Name)
+	order := column
+	if field.scale() > 0 {
+		// Decimals are stored as text, which does not sort numerically
+		order = "CAST(" + column + " AS REAL)"
+	}
+	var last any
+	err := db.QueryRow(fmt.Sprintf("SELECT %s FROM %s WHERE %s IS NOT NULL ORDER BY %s DESC LIMIT 1",
+		column, quoteIdent(table), column, order)).Scan(&last)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil || last == nil {
+		return nil, err
+	}
+
+	// Convert back to what Field.Encode accepts
+	switch field.Type {
+	case KeyTypeDate:
+		s, _ := last.(string)
+		return time.Parse(time.DateOnly, s)
+	case KeyTypeTime:
+		s, _ := last.(string)
+		return ParseValue(KeyTypeTime, s)
+	}
+	if b, ok := last.([]byte); ok {
+		return ParseValue(field.Type, string(b))
+	}
+	return last, nil
+}
+
+// sqlType returns the SQLite column type for a key type
+func sqlType(keyType uint8) string {
+	switch keyType {
+	case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring, KeyTypeDate, KeyTypeTime:
+		return "TEXT"
+	case KeyTypeInteger, KeyTypeUnsignedBinary, KeyTypeAutoincrement, KeyTypeLogical,
+		KeyTypeNumeric, KeyTypeNumericSA, KeyTypeNumericSTS, KeyTypeDecimal:
+		return "INTEGER"
+	case KeyTypeFloat, KeyTypeBfloat:
+		return "REAL"
+	}
+	return "BLOB"
+}
+
+// sqlValue converts a decoded field value to a SQLite parameter. Dates
+// and times are stored as ISO text so they sort and compare correctly.
+func sqlValue(v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format(time.DateOnly)
+	case time.Duration:
+		return time.Time{}.Add(v).Format("15:04:05.99")
+	case uint64:
+		return int64(v)
+	case FixedPoint:
+		return v.String()
+	}
+	return v
+}
+
+// tableName derives a table name from a file path
+func tableName(path string) string {
+	if i := strings.LastIndexAny(path, `/\`); i >= 0 {
+		path = path[i+1:]
+	}
+	if i := strings.IndexByte(path, '.'); i > 0 {
+		path = path[:i]
+	}
+	return path
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,291 @@
+package xtrieve
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// SQLImport bulk-loads rows from any database/sql source into a file.
+// Each result column is mapped to a schema field; the file is created from
+// the schema and Keys if it does not exist.
+//
+//	im := &xtrieve.SQLImport{
+//	    Client:  client,
+//	    Path:    "customers.dat",
+//	    Schema:  schema,
+//	    Columns: map[string]string{"customer_id": "id", "full_name": "name"},
+//	}
+//	n, err := im.Run(db, "SELECT customer_id, full_name FROM customers")
+type SQLImport struct {
+	Client *Client
+	Path   string
+	Schema *Schema
+	// Columns maps result column names to field names. Columns missing
+	// from the map are matched to the field of the same name and ignored
+	// if there is none.
+	Columns map[string]string
+	// Keys are used when the file has to be created. The default is a
+	// unique key on the first schema field.
+	Keys []KeySpec
+	// PageSize is used when the file has to be created (default 4096)
+	PageSize uint16
+	// Progress, if set, receives progress reports. Total, if known, is
+	// the expected row count used to estimate the time remaining.
+	Progress Progress
+	Total    int64
+	// DryRun, if set, makes Run encode every row and count it in the
+	// report, with sample values of the file's first key, instead of
+	// creating the file and inserting
+	DryRun *DryRunReport
+}
+
+// Run executes the query and inserts one record per row, returning the
+// number of records inserted. Inserts are pipelined, 32 at a time: a
+// failed insert stops the import with a *StatusError once its batch is
+// done, and the inserts after it in the batch may have succeeded too. The
+// count includes every successful insert.
+func (im *SQLImport) Run(db *sql.DB, query string, args ...any) (int, error) {
+	return im.RunContext(context.Background(), db, query, args...)
+}
+
+// RunContext is like Run but stops when ctx is cancelled. Records already
+// inserted stay in the file.
+func (im *SQLImport) RunContext(ctx context.Context, db *sql.DB, query string, args ...any) (int, error) {
+	if im.Client == nil && im.DryRun == nil || im.Schema == nil {
+		return 0, errors.New("xtrieve: SQLImport needs a Client and a Schema")
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	fields := make([]*Field, len(columns))
+	for i, col := range columns {
+		name := col
+		if mapped, ok := im.Columns[col]; ok {
+			name = mapped
+		}
+		if field, ok := im.Schema.Field(name); ok {
+			fields[i] = &field
+		} else if _, ok := im.Columns[col]; ok {
+			return 0, fmt.Errorf("xtrieve: column %s maps to unknown field %q", col, name)
+		}
+	}
+
+	var posBlock []byte
+	var segments []KeySpec
+	if im.DryRun != nil {
+		segments = keySegments(schemaFileSpec(im.Schema, im.Keys, im.PageSize).Keys, 0)
+	} else {
+		if posBlock, err = im.open(); err != nil {
+			return 0, err
+		}
+		defer im.Client.CloseFile(posBlock)
+	}
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	count := 0
+	progress := newProgressTracker(im.Progress, im.Total)
+	batch := im.Client.Batch()
+	flush := func() error {
+		n, err := sendInserts(batch, progress)
+		count += n
+		return err
+	}
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return count, err
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return count, err
+		}
+		record := make([]byte, im.Schema.RecordLength())
+		for i, field := range fields {
+			if field == nil || values[i] == nil && !field.Nullable {
+				continue
+			}
+			if err := im.Schema.Set(record, field.Name, columnValue(field.Type, values[i])); err != nil {
+				return count, fmt.Errorf("row %d: %w", count+batch.Len()+1, err)
+			}
+		}
+
+		if im.DryRun != nil {
+			im.DryRun.add(ExtractKey(segments, record), len(record))
+			count++
+			continue
+		}
+		batch.Add(&Request{
+			Operation:     OpInsert,
+			PositionBlock: posBlock,
+			DataBuffer:    record,
+		})
+		if batch.Len() == pipelineDepth {
+			if err := flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if err := flush(); err != nil {
+		return count, err
+	}
+	progress.done()
+	return count, nil
+}
+
+// sendInserts sends a batch of inserts and returns how many succeeded. The
+// batch is pipelined, so inserts after a failed one may succeed as well;
+// all of them are counted, and the first failure is returned.
+func sendInserts(batch *Batch, progress *progressTracker) (int, error) {
+	reqs := batch.reqs
+	resps, err := batch.Send()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	var failed error
+	for i, resp := range resps {
+		if err := checkStatus(OpInsert, resp); err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		n++
+		progress.add(1, len(reqs[i].DataBuffer))
+	}
+	return n, failed
+}
+
+// open opens the target file, creating it first if it does not exist
+func (im *SQLImport) open() ([]byte, error) {
+	return openOrCreate(im.Client, im.Path, im.Schema.Document, func() *FileSpec {
+		return schemaFileSpec(im.Schema, im.Keys, im.PageSize)
+	})
+}
+
+// openOrCreate opens a file, creating it from spec() if it does not exist.
+// With variable, a file that Stat does not report as variable-length is
+// closed again and ErrFixedLength returned.
+func openOrCreate(client *Client, path string, variable bool, spec func() *FileSpec) ([]byte, error) {
+	resp, err := client.Open(path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == StatusFileNotFound {
+		resp, err = client.Create(path, spec())
+		if err != nil {
+			return nil, err
+		}
+		if err := checkStatus(OpCreate, resp); err != nil {
+			return nil, err
+		}
+		resp, err = client.Open(path, 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := checkStatus(OpOpen, resp); err != nil {
+		return nil, err
+	}
+	posBlock := resp.PositionBlock
+	if variable {
+		if err := checkVariableLength(client, path, posBlock); err != nil {
+			client.CloseFile(posBlock)
+			return nil, err
+		}
+	}
+	return posBlock, nil
+}
+
+// checkVariableLength fails with ErrFixedLength unless the open file
+// reports variable-length records
+func checkVariableLength(client *Client, path string, posBlock []byte) error {
+	resp, err := client.Stat(posBlock)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpStat, resp); err != nil {
+		return err
+	}
+	stat, err := ParseStat(resp.DataBuffer)
+	if err != nil {
+		return err
+	}
+	if !stat.VariableLength() {
+		return fmt.Errorf("xtrieve: %s: %w", path, ErrFixedLength)
+	}
+	return nil
+}
+
+// schemaFileSpec describes a file for a schema's records. Without keys it
+// has a unique key on the first field; pageSize defaults to 4096. A
+// Document schema's file asks for variable-length records, which servers
+// that ignore file flags at Create do not provide.
+func schemaFileSpec(schema *Schema, keys []KeySpec, pageSize uint16) *FileSpec {
+	if keys == nil && len(schema.Fields) > 0 {
+		first := schema.Fields[0]
+		keys = []KeySpec{{
+			Position: uint16(first.Offset),
+			Length:   uint16(first.Length),
+			Type:     first.Type,
+		}}
+	}
+	if pageSize == 0 {
+		pageSize = 4096
+	}
+	spec := &FileSpec{
+		RecordLength: uint16(schema.RecordLength()),
+		PageSize:     pageSize,
+		Keys:         keys,
+	}
+	if schema.Document {
+		spec.Flags |= FileFlagVariableLength
+	}
+	return spec
+}
+
+// columnValue converts a scanned column value to what Field.Encode
+// accepts. Drivers commonly return text as []byte, and dates or times
+// stored as text are parsed.
+func columnValue(keyType uint8, v any) any {
+	var text string
+	switch v := v.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case int64:
+		if keyType == KeyTypeLogical {
+			return v != 0
+		}
+		return v
+	default:
+		return v
+	}
+
+	switch keyType {
+	case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+		return text
+	}
+	if parsed, err := ParseValue(keyType, text); err == nil {
+		return parsed
+	}
+	return v
+}
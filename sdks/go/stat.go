@@ -0,0 +1,169 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// File flags used by Create and reported by Stat. Flags from
+// FileFlagBalancedIndex on were introduced by Btrieve 6.x.
+const (
+	FileFlagVariableLength  = 0x0001
+	FileFlagBlankTruncation = 0x0002
+	FileFlagPreImage        = 0x0004
+	FileFlagCompressed      = 0x0008
+	FileFlagKeyOnly         = 0x0010
+	FileFlagBalancedIndex   = 0x0020
+	FileFlagFreeSpace10     = 0x0040
+	FileFlagFreeSpace20     = 0x0080
+	FileFlagFreeSpace30     = 0x00C0
+	FileFlagDupPointers     = 0x0100
+	FileFlagSystemData      = 0x0200
+	FileFlagKeyNumbers      = 0x0400
+	FileFlagVAT             = 0x0800
+	// FileFlagNoSystemData overrides an engine configured to add system
+	// data to every new file
+	FileFlagNoSystemData = 0x1200
+
+	// FileFlagPreallocate shares its bit with FileFlagPreImage: on Create
+	// it asks for FileSpec.Preallocation pages up front
+	FileFlagPreallocate = FileFlagPreImage
+)
+
+const (
+	statHeaderSize  = 14
+	statKeySpecSize = 16
+)
+
+// KeyStat describes a key as reported by Stat
+type KeyStat struct {
+	KeySpec
+	UniqueCount uint32
+	ACS         uint8
+}
+
+// FileStat holds the file attributes returned by the Stat operation
+type FileStat struct {
+	RecordLength uint16
+	PageSize     uint16
+	NumKeys      uint16
+	// NumRecords is the 32-bit count of the Stat buffer, widened so it
+	// mixes with 64-bit positions and percentages
+	NumRecords  uint64
+	Flags       uint16
+	UnusedPages uint16
+	Keys        []KeyStat
+	// Extension is the path of the file's first extension segment if it
+	// is an extended file (see File.Extend); File.Stat fills it in
+	Extension string
+}
+
+// VariableLength reports whether the file holds variable-length records
+func (s *FileStat) VariableLength() bool {
+	return s.Flags&FileFlagVariableLength != 0
+}
+
+// Extended reports whether the file spans more than one physical segment
+func (s *FileStat) Extended() bool {
+	return s.Extension != ""
+}
+
+// SystemData reports whether the file carries system data, the hidden
+// 8-byte log key that Btrieve 6.x adds to each record
+func (s *FileStat) SystemData() bool {
+	return s.Flags&FileFlagNoSystemData == FileFlagSystemData
+}
+
+// VAT reports whether the file uses variable-tail allocation tables for
+// its variable-length parts
+func (s *FileStat) VAT() bool {
+	return s.Flags&FileFlagVAT != 0
+}
+
+// BalancedIndex reports whether index pages are balanced on insert
+func (s *FileStat) BalancedIndex() bool {
+	return s.Flags&FileFlagBalancedIndex != 0
+}
+
+// FreeSpaceThreshold returns the free space threshold of variable-length
+// pages in percent (10, 20 or 30), or 0 if none is set
+func (s *FileStat) FreeSpaceThreshold() int {
+	return int(s.Flags&FileFlagFreeSpace30>>6) * 10
+}
+
+// Spec returns a FileSpec that asks for a file with the same record
+// layout, keys and flags. Whether the server keeps them is up to it; see
+// Diff.
+func (s *FileStat) Spec() *FileSpec {
+	spec := &FileSpec{
+		RecordLength: s.RecordLength,
+		PageSize:     s.PageSize,
+		Flags:        s.Flags,
+	}
+	for _, k := range s.Keys {
+		spec.Keys = append(spec.Keys, k.KeySpec)
+	}
+	return spec
+}
+
+// Diff lists how a file differs from the spec it was created with, one
+// difference per entry, or returns nil if it matches. Servers may create a
+// file other than asked: xtrieved ignores Flags and Preallocation and drops
+// key flags it does not know, such as KeyFlagNoCase. Preallocation itself
+// is not reported by Stat and is not compared.
+func (s *FileStat) Diff(spec *FileSpec) []string {
+	var diffs []string
+	if s.RecordLength != spec.RecordLength {
+		diffs = append(diffs, fmt.Sprintf("record length %d, spec has %d", s.RecordLength, spec.RecordLength))
+	}
+	if spec.PageSize != 0 && s.PageSize != spec.PageSize {
+		diffs = append(diffs, fmt.Sprintf("page size %d, spec has %d", s.PageSize, spec.PageSize))
+	}
+	if s.Flags != spec.Flags {
+		diffs = append(diffs, fmt.Sprintf("file flags %#04x, spec has %#04x", s.Flags, spec.Flags))
+	}
+	if len(s.Keys) != len(spec.Keys) {
+		return append(diffs, fmt.Sprintf("%d key segments, spec has %d", len(s.Keys), len(spec.Keys)))
+	}
+	for i, k := range s.Keys {
+		if want := spec.Keys[i]; k.KeySpec != want {
+			diffs = append(diffs, fmt.Sprintf("key segment %d is %+v, spec has %+v", i, k.KeySpec, want))
+		}
+	}
+	return diffs
+}
+
+// ParseStat decodes the data buffer returned by the Stat operation
+func ParseStat(buf []byte) (*FileStat, error) {
+	if len(buf) < statHeaderSize {
+		return nil, errors.New("stat buffer too short")
+	}
+
+	stat := &FileStat{
+		RecordLength: binary.LittleEndian.Uint16(buf[0:]),
+		PageSize:     binary.LittleEndian.Uint16(buf[2:]),
+		NumKeys:      binary.LittleEndian.Uint16(buf[4:]),
+		NumRecords:   uint64(binary.LittleEndian.Uint32(buf[6:])),
+		Flags:        binary.LittleEndian.Uint16(buf[10:]),
+		UnusedPages:  binary.LittleEndian.Uint16(buf[12:]),
+	}
+
+	// Key specs follow the header, 16 bytes each
+	for offset := statHeaderSize; offset+statKeySpecSize <= len(buf); offset += statKeySpecSize {
+		k := buf[offset : offset+statKeySpecSize]
+		stat.Keys = append(stat.Keys, KeyStat{
+			KeySpec: KeySpec{
+				Position:  binary.LittleEndian.Uint16(k[0:]),
+				Length:    binary.LittleEndian.Uint16(k[2:]),
+				Flags:     binary.LittleEndian.Uint16(k[4:]),
+				Type:      k[10],
+				NullValue: k[11],
+			},
+			UniqueCount: binary.LittleEndian.Uint32(k[6:]),
+			ACS:         k[12],
+		})
+	}
+
+	return stat, nil
+}
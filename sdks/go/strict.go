@@ -0,0 +1,126 @@
+package xtrieve
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// Limits of a Btrieve response, checked in strict mode: the data and key
+// buffers of the Btrieve API have 16-bit and 8-bit lengths
+const (
+	maxDataLength = 0xFFFF
+	maxKeyLength  = 0xFF
+)
+
+// Violations of the protocol reported in strict mode, wrapped in a
+// *ProtocolError
+var (
+	ErrUnknownStatus      = errors.New("unknown status code")
+	ErrTrailingBytes      = errors.New("unexpected bytes after response")
+	ErrInconsistentLength = errors.New("inconsistent length")
+)
+
+// ProtocolError reports a response that strict mode rejected
+type ProtocolError struct {
+	Operation uint16
+	Status    uint16
+	Err       error
+	Detail    string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("xtrieve: %s response (status %d): %v: %s", OpName(e.Operation), e.Status, e.Err, e.Detail)
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
+
+// knownStatuses are the status codes the server defines
+var knownStatuses = func() map[uint16]bool {
+	known := make(map[uint16]bool)
+	for code := uint16(0); code <= 100; code++ {
+		if code != 53 && (code < 71 || code > 77) && code != 98 {
+			known[code] = true
+		}
+	}
+	return known
+}()
+
+// SetStrict turns strict mode on or off. In strict mode responses the
+// client would otherwise take as they come are rejected with a
+// *ProtocolError: unknown status codes, data or key buffers longer than
+// Btrieve allows, records missing from successful reads, and bytes left
+// over after a response, after which the connection is redialed. With a
+// logger set (see SetLogger), each rejected response is logged with a hex
+// dump; dumps include record contents, unredacted.
+func (c *Client) SetStrict(strict bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.strict = strict
+}
+
+// checkResponse applies the strict mode checks to a response read for
+// req, and to err, the error reading it. last is set when no other
+// response is expected on the connection. The caller holds c.mu.
+func (c *Client) checkResponse(req *Request, resp *Response, err error, last bool) error {
+	var perr *ProtocolError
+	if errors.As(err, &perr) {
+		// Rejected by readResponse before reading the data
+		perr.Operation = req.Operation
+		return c.protocolError(perr, resp, nil)
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case !knownStatuses[resp.StatusCode]:
+		perr = &ProtocolError{Err: ErrUnknownStatus, Detail: fmt.Sprintf("status %d", resp.StatusCode)}
+	case len(resp.KeyBuffer) > maxKeyLength:
+		perr = &ProtocolError{Err: ErrInconsistentLength, Detail: fmt.Sprintf("%d byte key buffer", len(resp.KeyBuffer))}
+	case resp.StatusCode == StatusSuccess && len(resp.DataBuffer) == 0 && carriesRecord(req.Operation) &&
+		req.Operation != OpInsert && req.Operation != OpUpdate:
+		perr = &ProtocolError{Err: ErrInconsistentLength, Detail: "no record in a successful read"}
+	}
+	if perr != nil {
+		perr.Operation, perr.Status = req.Operation, resp.StatusCode
+		return c.protocolError(perr, resp, nil)
+	}
+	if n := c.r.Buffered(); last && n > 0 {
+		extra, _ := c.r.Peek(n)
+		// The stream is out of step with the requests; start over
+		c.broken = true
+		perr = &ProtocolError{Operation: req.Operation, Status: resp.StatusCode, Err: ErrTrailingBytes, Detail: fmt.Sprintf("%d bytes", n)}
+		return c.protocolError(perr, resp, extra)
+	}
+	return nil
+}
+
+// protocolError returns perr, logging it with hex dumps of the response
+// and of any bytes read after it
+func (c *Client) protocolError(perr *ProtocolError, resp *Response, extra []byte) error {
+	logger := c.logger.Load()
+	if logger == nil {
+		return perr
+	}
+	raw := binary.LittleEndian.AppendUint16(nil, resp.StatusCode)
+	raw = append(raw, resp.PositionBlock...)
+	raw = binary.LittleEndian.AppendUint32(raw, uint32(len(resp.DataBuffer)))
+	raw = append(raw, resp.DataBuffer...)
+	raw = binary.LittleEndian.AppendUint16(raw, uint16(len(resp.KeyBuffer)))
+	raw = append(raw, resp.KeyBuffer...)
+	attrs := []slog.Attr{
+		slog.String("op", OpName(perr.Operation)),
+		slog.Any("error", perr),
+		slog.String("response", hex.Dump(raw)),
+	}
+	if extra != nil {
+		attrs = append(attrs, slog.String("extra", hex.Dump(extra)))
+	}
+	logger.LogAttrs(context.Background(), slog.LevelError, "xtrieve protocol error", attrs...)
+	return perr
+}
@@ -0,0 +1,249 @@
+package xtrieve
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SpecPageSize is the page size of the FileSpecs StructSpec derives
+const SpecPageSize = 4096
+
+// SpecField describes a field of a record struct for SpecFromFields: its
+// schema name, its Go type as written in source, e.g. int32, string,
+// []byte, time.Time, time.Duration or xtrieve.FixedPoint, and its xtrieve
+// struct tag
+type SpecField struct {
+	Name   string
+	GoType string
+	Tag    string
+}
+
+// goTypeLayouts are the key type and length of record fields of each Go
+// type; a length of 0 must be given with len=
+var goTypeLayouts = map[string]struct {
+	keyType uint8
+	length  int
+}{
+	"int8":               {KeyTypeInteger, 1},
+	"int16":              {KeyTypeInteger, 2},
+	"int32":              {KeyTypeInteger, 4},
+	"int64":              {KeyTypeInteger, 8},
+	"int":                {KeyTypeInteger, 8},
+	"uint8":              {KeyTypeUnsignedBinary, 1},
+	"byte":               {KeyTypeUnsignedBinary, 1},
+	"uint16":             {KeyTypeUnsignedBinary, 2},
+	"uint32":             {KeyTypeUnsignedBinary, 4},
+	"uint64":             {KeyTypeUnsignedBinary, 8},
+	"uint":               {KeyTypeUnsignedBinary, 8},
+	"float32":            {KeyTypeFloat, 4},
+	"float64":            {KeyTypeFloat, 8},
+	"bool":               {KeyTypeLogical, 1},
+	"time.Time":          {KeyTypeDate, 4},
+	"time.Duration":      {KeyTypeTime, 4},
+	"string":             {KeyTypeString, 0},
+	"[]byte":             {KeyTypeString, 0},
+	"xtrieve.FixedPoint": {KeyTypeDecimal, 0},
+}
+
+// StructSpec derives the FileSpec and Schema of records stored as the
+// struct v or *v from its xtrieve tags, so the file created and the
+// fields TypedTable encodes cannot drift apart. Fields with an xtrieve
+// tag are laid out one after the other in declaration order, named like
+// TypedTable names them; other fields are left out of the record. Tag
+// options, separated by commas:
+//
+//	type=<name>    key type, e.g. zstring or numeric (default from the Go type)
+//	len=<n>        length in bytes, required for strings, []byte and FixedPoint
+//	offset=<n>     explicit offset; later fields follow on from it
+//	scale=<n>      decimal places of numeric types
+//	charset=<name> character set of a string field
+//	key=<n>        the field is a segment of key n, in declaration order
+//	dup, mod       key n allows duplicates / modification
+//	desc, nocase   the segment sorts descending / ignoring case
+//	sensitive      the field is redacted in logs
+//
+// For example:
+//
+//	type Customer struct {
+//	    ID      int64              `msgpack:"id" xtrieve:"key=0"`
+//	    Name    string             `msgpack:"name" xtrieve:"len=40,key=1,dup,mod,nocase"`
+//	    Balance xtrieve.FixedPoint `msgpack:"balance" xtrieve:"type=numeric,len=10,scale=2"`
+//	    Since   time.Time          `msgpack:"since" xtrieve:"key=1"`
+//	    Notes   []string           `msgpack:"notes"` // in the document, if any
+//	}
+//
+// The xtrieve-specgen command generates the same spec as Go code.
+func StructSpec(v any) (*FileSpec, *Schema, error) {
+	t := reflect.TypeOf(v)
+	if t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, nil, fmt.Errorf("xtrieve: StructSpec needs a struct, not %v", t)
+	}
+	return SpecFromFields(specFields(t))
+}
+
+// specFields lists the tagged fields of a struct type, flattening embedded
+// structs like structFields
+func specFields(t reflect.Type) []SpecField {
+	var fields []SpecField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name, _, skip := msgpackTag(sf)
+		if skip {
+			continue
+		}
+		if sf.Anonymous && sf.Tag.Get("msgpack") == "" && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, specFields(sf.Type)...)
+			continue
+		}
+		tag, ok := sf.Tag.Lookup("xtrieve")
+		if !ok || tag == "-" {
+			continue
+		}
+		fields = append(fields, SpecField{Name: name, GoType: goTypeName(sf.Type), Tag: tag})
+	}
+	return fields
+}
+
+// goTypeName returns the name of a Go type as SpecField expects it
+func goTypeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time.Time"
+	case t == durationType:
+		return "time.Duration"
+	case t == fixedType:
+		return "xtrieve.FixedPoint"
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return "[]byte"
+	case t.Kind() <= reflect.Float64 || t.Kind() == reflect.String:
+		// Named types such as `type Status int8` are stored as their kind
+		return t.Kind().String()
+	}
+	return t.String()
+}
+
+// specKey is a key being assembled from tagged fields
+type specKey struct {
+	segments []KeySpec
+	flags    uint16
+}
+
+// SpecFromFields derives a FileSpec and Schema from field descriptions,
+// as StructSpec does from a struct type. It is what the xtrieve-specgen
+// command generates code with.
+func SpecFromFields(fields []SpecField) (*FileSpec, *Schema, error) {
+	var schemaFields []Field
+	keys := make(map[int]*specKey)
+	offset, end := 0, 0
+	for _, sf := range fields {
+		f := Field{Name: sf.Name, Offset: offset}
+		if layout, ok := goTypeLayouts[sf.GoType]; ok {
+			f.Type, f.Length = layout.keyType, layout.length
+		}
+		var segFlags, keyFlags uint16
+		var keyNumbers []int
+		typed := false
+		for _, opt := range strings.Split(sf.Tag, ",") {
+			name, value, _ := strings.Cut(strings.TrimSpace(opt), "=")
+			var err error
+			switch name {
+			case "":
+			case "type":
+				var ok bool
+				if f.Type, ok = KeyTypeByName(value); !ok {
+					err = fmt.Errorf("unknown type %q", value)
+				}
+				typed = true
+			case "len":
+				f.Length, err = strconv.Atoi(value)
+			case "offset":
+				f.Offset, err = strconv.Atoi(value)
+			case "scale":
+				f.Scale, err = strconv.Atoi(value)
+			case "charset":
+				f.Charset = value
+			case "key":
+				var n int
+				if n, err = strconv.Atoi(value); err == nil {
+					keyNumbers = append(keyNumbers, n)
+				}
+			case "dup":
+				keyFlags |= KeyFlagDuplicates
+			case "mod":
+				keyFlags |= KeyFlagModifiable
+			case "desc":
+				segFlags |= KeyFlagDescending
+			case "nocase":
+				segFlags |= KeyFlagNoCase
+			case "sensitive":
+				f.Sensitive = true
+			default:
+				err = fmt.Errorf("unknown option %q", name)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("field %s: %w", sf.Name, err)
+			}
+		}
+		if f.Length <= 0 {
+			return nil, nil, fmt.Errorf("field %s: %s needs len=", sf.Name, sf.GoType)
+		}
+		if _, known := goTypeLayouts[sf.GoType]; !known && !typed {
+			return nil, nil, fmt.Errorf("field %s: %s needs type=", sf.Name, sf.GoType)
+		}
+		schemaFields = append(schemaFields, f)
+		offset = f.Offset + f.Length
+		end = max(end, offset)
+
+		for _, n := range keyNumbers {
+			k := keys[n]
+			if k == nil {
+				k = &specKey{}
+				keys[n] = k
+			}
+			k.flags |= keyFlags
+			k.segments = append(k.segments, KeySpec{
+				Position: uint16(f.Offset),
+				Length:   uint16(f.Length),
+				Flags:    segFlags,
+				Type:     f.Type,
+			})
+		}
+	}
+
+	schema, err := NewSchema(schemaFields...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if end > 0xFFFF {
+		return nil, nil, fmt.Errorf("xtrieve: record length %d too large", end)
+	}
+	spec := &FileSpec{RecordLength: uint16(end), PageSize: SpecPageSize}
+	numbers := make([]int, 0, len(keys))
+	for n := range keys {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	for i, n := range numbers {
+		if n != i {
+			return nil, nil, fmt.Errorf("xtrieve: key %d has no fields", i)
+		}
+		k := keys[n]
+		for j, seg := range k.segments {
+			seg.Flags |= k.flags
+			if j < len(k.segments)-1 {
+				seg.Flags |= KeyFlagSegmented
+			}
+			spec.Keys = append(spec.Keys, seg)
+		}
+	}
+	return spec, schema, nil
+}
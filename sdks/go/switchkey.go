@@ -0,0 +1,86 @@
+package xtrieve
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// GetPosition returns the physical position of the current record, which
+// stays valid until the record is deleted. Positions are 4 bytes, or 8 on
+// servers that address files beyond 4GB.
+func (f *File) GetPosition() (uint64, error) {
+	resp, err := f.exec(&Request{Operation: OpGetPosition})
+	if err != nil {
+		return 0, err
+	}
+	if err := checkStatus(OpGetPosition, resp); err != nil {
+		return 0, err
+	}
+	switch {
+	case len(resp.DataBuffer) == 8:
+		return binary.LittleEndian.Uint64(resp.DataBuffer), nil
+	case len(resp.DataBuffer) < 4:
+		return 0, &StatusError{Operation: OpGetPosition, Status: StatusDataBufferTooShort}
+	}
+	return uint64(binary.LittleEndian.Uint32(resp.DataBuffer)), nil
+}
+
+// GetDirect gets the record at a physical position returned by
+// GetPosition and makes keyNumber the current key. The position is sent
+// as 8 bytes, of which servers with 4-byte positions read the low half.
+func (f *File) GetDirect(position uint64, keyNumber int16) (*Response, error) {
+	data := make([]byte, max(8, f.recordLength))
+	binary.LittleEndian.PutUint64(data, position)
+	return f.exec(&Request{
+		Operation:  OpGetDirect,
+		DataBuffer: data,
+		KeyNumber:  keyNumber,
+	})
+}
+
+// SwitchKey re-establishes the current position under another key, so
+// that GetNext and GetPrevious continue in the order of newKeyNumber from
+// the current record instead of failing with StatusDifferentKeyNumber:
+//
+//	f.GetEqual(idKey, 0)   // find by ID
+//	f.SwitchKey(2)         // then walk by date
+//	f.GetNext(2)
+//
+// The record is read back with Get Direct, then located in the new index
+// with Get Equal, stepping through duplicates of its key until the same
+// physical record is found, since not every server leaves an index
+// position behind after Get Direct.
+func (f *File) SwitchKey(newKeyNumber int16) (*Response, error) {
+	position, err := f.GetPosition()
+	if err != nil {
+		return nil, err
+	}
+	direct, err := f.GetDirect(position, newKeyNumber)
+	if err != nil || direct.StatusCode != StatusSuccess {
+		return direct, err
+	}
+	record := bytes.Clone(direct.DataBuffer)
+
+	key := ExtractKey(f.KeySegments(newKeyNumber), record)
+	resp, err := f.GetEqual(key, newKeyNumber)
+	for err == nil && resp.StatusCode == StatusSuccess &&
+		CompareKey(f.KeySegments(newKeyNumber), resp.KeyBuffer, key) == 0 {
+		if bytes.Equal(resp.DataBuffer, record) {
+			// Identical records may share the key; confirm by position
+			at, err := f.GetPosition()
+			if err != nil {
+				return nil, err
+			}
+			if at == position {
+				return resp, nil
+			}
+		}
+		resp, err = f.GetNext(newKeyNumber)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The record disappeared from the index in the meantime
+	resp.StatusCode = StatusKeyNotFound
+	return resp, nil
+}
@@ -0,0 +1,289 @@
+package xtrieve
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Table reads and writes the records of a File as field maps, using a
+// Schema to encode them and to apply the schema's conventions, such as an
+// optimistic-locking version field.
+//
+//	t := xtrieve.NewTable(f, schema, 0)
+//	row, err := t.Get(key)
+//	row["balance"] = 100.0
+//	err = t.Update(row) // ErrStaleVersion if someone else updated it
+type Table struct {
+	File   *File
+	Schema *Schema
+	// KeyNumber is a unique key identifying records for Update and Delete
+	KeyNumber int16
+	// History, if set, keeps the versions of records that Update and
+	// Delete replace, for AsOf. It has the table's record layout and its
+	// key HistoryKey, which allows duplicates, starts with the fields of
+	// the table's key.
+	History    *File
+	HistoryKey int16
+
+	// before and after are the write hooks, see TableHook
+	before []TableHook
+	after  []TableHook
+}
+
+// NewTable returns a table over f identified by the unique key keyNumber
+func NewTable(f *File, schema *Schema, keyNumber int16) *Table {
+	return &Table{File: f, Schema: schema, KeyNumber: keyNumber}
+}
+
+// Get reads the record with the given key. Soft-deleted records are
+// reported as not found.
+func (t *Table) Get(key []byte) (map[string]any, error) {
+	resp, err := t.File.GetEqual(key, t.KeyNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(OpGetEqual, resp); err != nil {
+		return nil, err
+	}
+	if field, ok := t.softDeleteField(); ok && isDeleted(field, resp.DataBuffer) {
+		return nil, &StatusError{Operation: OpGetEqual, Status: StatusKeyNotFound}
+	}
+	return t.Schema.Decode(resp.DataBuffer)
+}
+
+// Insert inserts a record. If the schema has a version field, it is set
+// to 1 in values as well as in the record, and so are the Created,
+// Modified and ValidFrom timestamps to the current time.
+func (t *Table) Insert(values map[string]any) error {
+	return t.withHooks(OpInsert, values, func() error { return t.insert(values) })
+}
+
+func (t *Table) insert(values map[string]any) error {
+	if err := t.checkDocument(); err != nil {
+		return err
+	}
+	if t.Schema.Version != "" {
+		values[t.Schema.Version] = int64(1)
+	}
+	now := time.Now()
+	if err := t.stampInsert(values, now); err != nil {
+		return err
+	}
+	if err := t.stampValidFrom(values, nil, now); err != nil {
+		return err
+	}
+	record, err := t.Schema.Encode(values)
+	if err != nil {
+		return err
+	}
+	resp, err := t.File.Insert(record)
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpInsert, resp)
+}
+
+// Update writes values to the record whose key matches them; fields
+// missing from values keep their stored contents. If the schema has
+// a version field, the stored version must equal the one in values or
+// ErrStaleVersion is returned; on success the version is incremented in
+// values as well as in the record. The Modified and ValidFrom timestamps
+// are set to the current time, and with a History the replaced version is
+// kept there.
+func (t *Table) Update(values map[string]any) error {
+	return t.withHooks(OpUpdate, values, func() error {
+		return t.locked(func() error { return t.update(values) })
+	})
+}
+
+func (t *Table) update(values map[string]any) error {
+	if err := t.checkDocument(); err != nil {
+		return err
+	}
+	record, err := t.Schema.Encode(values)
+	if err != nil {
+		return err
+	}
+	current, err := t.lockCurrent(record)
+	if err != nil {
+		return err
+	}
+	if t.Schema.Document {
+		// Merge into the stored document, which is re-encoded as a whole
+		merged, err := t.Schema.Decode(current)
+		if err != nil {
+			return err
+		}
+		for name, v := range values {
+			merged[name] = v
+		}
+		if record, err = t.Schema.Encode(merged); err != nil {
+			return err
+		}
+	} else {
+		// Start from the stored record to keep bytes the schema does not cover
+		record = append([]byte(nil), current...)
+		for name, v := range values {
+			if err := t.Schema.Set(record, name, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	now := time.Now()
+	if err := t.stampUpdate(values, current, record, now); err != nil {
+		return err
+	}
+	if err := t.stampValidFrom(values, record, now); err != nil {
+		return err
+	}
+	version, err := t.pastVersion(current, now)
+	if err != nil {
+		return err
+	}
+
+	next := int64(0)
+	if t.Schema.Version != "" {
+		if next, err = t.checkVersion(current, values); err != nil {
+			return err
+		}
+		if err := t.Schema.Set(record, t.Schema.Version, next); err != nil {
+			return err
+		}
+	}
+
+	resp, err := t.File.Update(record, t.KeyNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpUpdate, resp); err != nil {
+		return err
+	}
+	if t.Schema.Version != "" {
+		values[t.Schema.Version] = next
+	}
+	return t.keepVersion(version)
+}
+
+// Delete deletes the record whose key matches values, checking the
+// version field like Update. If the schema has a soft-delete field, the
+// record is only marked deleted; use Purge to remove it for good. With a
+// History the deleted version is kept there.
+func (t *Table) Delete(values map[string]any) error {
+	return t.withHooks(OpDelete, values, func() error {
+		return t.locked(func() error { return t.delete(values) })
+	})
+}
+
+func (t *Table) delete(values map[string]any) error {
+	if field, ok := t.softDeleteField(); ok {
+		return t.softDelete(field, values)
+	}
+	record, err := t.Schema.Encode(values)
+	if err != nil {
+		return err
+	}
+	current, err := t.lockCurrent(record)
+	if err != nil {
+		return err
+	}
+	if t.Schema.Version != "" {
+		if _, err := t.checkVersion(current, values); err != nil {
+			return err
+		}
+	}
+	version, err := t.pastVersion(current, time.Now())
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.File.Delete(t.KeyNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpDelete, resp); err != nil {
+		return err
+	}
+	return t.keepVersion(version)
+}
+
+// checkDocument fails with ErrFixedLength for a Document schema over a
+// fixed-length file, which would reject or truncate the document
+func (t *Table) checkDocument() error {
+	if t.Schema.Document && !t.File.variableLength {
+		return fmt.Errorf("xtrieve: %s: %w", t.File.path, ErrFixedLength)
+	}
+	return nil
+}
+
+// locked runs write, which locks the stored record with lockCurrent, in a
+// transaction: the server only releases record locks when a transaction
+// ends or the file is closed. Inside the caller's transaction the lock is
+// held until that one ends.
+func (t *Table) locked(write func() error) error {
+	resp, err := t.File.BeginTransaction(LockSingleWait)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == StatusTransactionActive {
+		return write()
+	}
+	if err := checkStatus(OpBeginTransaction, resp); err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		resp, abortErr := t.File.AbortTransaction()
+		if abortErr == nil {
+			abortErr = checkStatus(OpAbortTransaction, resp)
+		}
+		return errors.Join(err, abortErr)
+	}
+	resp, err = t.File.EndTransaction()
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpEndTransaction, resp)
+}
+
+// lockCurrent positions on the stored copy of record with a single-record
+// lock, so that nobody can change it between the version check and the
+// write. The lock is released when the transaction run by locked ends.
+func (t *Table) lockCurrent(record []byte) ([]byte, error) {
+	segments := t.File.KeySegments(t.KeyNumber)
+	if segments == nil {
+		return nil, fmt.Errorf("xtrieve: file has no key %d", t.KeyNumber)
+	}
+	resp, err := t.File.exec(&Request{
+		Operation: OpGetEqual,
+		KeyBuffer: FoldKey(segments, ExtractKey(segments, record)),
+		KeyNumber: t.KeyNumber,
+		LockBias:  LockSingleWait,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkStatus(OpGetEqual, resp); err != nil {
+		return nil, err
+	}
+	return resp.DataBuffer, nil
+}
+
+// checkVersion compares the stored version with the one in values and
+// returns the next version
+func (t *Table) checkVersion(current []byte, values map[string]any) (int64, error) {
+	field, ok := t.Schema.Field(t.Schema.Version)
+	if !ok {
+		return 0, fmt.Errorf("xtrieve: unknown version field %q", t.Schema.Version)
+	}
+	stored, err := field.Decode(current)
+	if err != nil {
+		return 0, err
+	}
+	have, _ := toInt64(stored)
+	want, ok := toInt64(values[t.Schema.Version])
+	if !ok || have != want {
+		return 0, fmt.Errorf("%w: stored version %d, have %v", ErrStaleVersion, have, values[t.Schema.Version])
+	}
+	return have + 1, nil
+}
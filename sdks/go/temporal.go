@@ -0,0 +1,170 @@
+package xtrieve
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// stampValidFrom sets the ValidFrom field to now in values, and in record
+// unless it is nil. Values the caller supplied are replaced, since the
+// history depends on them.
+func (t *Table) stampValidFrom(values map[string]any, record []byte, now time.Time) error {
+	name := t.Schema.ValidFrom
+	if name == "" {
+		return nil
+	}
+	field, ok := t.Schema.Field(name)
+	if !ok {
+		return fmt.Errorf("xtrieve: unknown valid-from field %q", name)
+	}
+	if field.Type == KeyTypeTime {
+		return fmt.Errorf("xtrieve: valid-from field %s must be a date, integer or string", name)
+	}
+	if err := t.stamp(values, name, now); err != nil {
+		return err
+	}
+	if record == nil {
+		return nil
+	}
+	return t.Schema.Set(record, name, values[name])
+}
+
+// pastVersion returns the copy of the stored record current that the
+// history keeps once a write replaces it at now, or nil if the table keeps
+// no history
+func (t *Table) pastVersion(current []byte, now time.Time) ([]byte, error) {
+	if t.History == nil {
+		return nil, nil
+	}
+	if t.Schema.ValidFrom == "" || t.Schema.ValidTo == "" {
+		return nil, errors.New("xtrieve: a table with History needs the schema's ValidFrom and ValidTo fields")
+	}
+	field, ok := t.Schema.Field(t.Schema.ValidTo)
+	if !ok {
+		return nil, fmt.Errorf("xtrieve: unknown valid-to field %q", t.Schema.ValidTo)
+	}
+	v, err := timestampValue(field, now, t.Schema.TimestampLayout)
+	if err != nil {
+		return nil, err
+	}
+	version := bytes.Clone(current)
+	if err := t.Schema.Set(version, field.Name, v); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// keepVersion inserts a version returned by pastVersion into the history
+func (t *Table) keepVersion(version []byte) error {
+	if version == nil {
+		return nil
+	}
+	resp, err := t.History.Insert(version)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	if err := checkStatus(OpInsert, resp); err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	return nil
+}
+
+// AsOf reads the version of the record with the given key that was
+// current at the given time: the stored record if its ValidFrom is not
+// after at, otherwise the version in History whose ValidFrom and ValidTo
+// enclose at. A record that did not exist at that time, or was
+// soft-deleted, is reported as not found. Times are compared at the
+// resolution of the fields, seconds for integers.
+//
+// Update and Delete write the stored record first and the history after
+// it, in the transaction that holds the record's lock; open History on
+// the same connection for both to commit together.
+func (t *Table) AsOf(key []byte, at time.Time) (map[string]any, error) {
+	from, ok := t.Schema.Field(t.Schema.ValidFrom)
+	if !ok {
+		return nil, fmt.Errorf("xtrieve: schema has no valid-from field")
+	}
+	notFound := &StatusError{Operation: OpGetEqual, Status: StatusKeyNotFound}
+
+	resp, err := t.File.GetEqual(key, t.KeyNumber)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != StatusKeyNotFound {
+		if err := checkStatus(OpGetEqual, resp); err != nil {
+			return nil, err
+		}
+		start, err := t.timestampOf(from, resp.DataBuffer)
+		if err != nil {
+			return nil, err
+		}
+		if !start.After(at) {
+			return t.decodeVersion(resp.DataBuffer, notFound)
+		}
+	}
+	if t.History == nil {
+		return nil, notFound
+	}
+
+	to, ok := t.Schema.Field(t.Schema.ValidTo)
+	if !ok {
+		return nil, fmt.Errorf("xtrieve: schema has no valid-to field")
+	}
+	it := t.History.Prefix(t.HistoryKey, key)
+	defer it.Close()
+	for it.Next() {
+		start, err := t.timestampOf(from, it.Record())
+		if err != nil {
+			return nil, err
+		}
+		end, err := t.timestampOf(to, it.Record())
+		if err != nil {
+			return nil, err
+		}
+		if !start.After(at) && at.Before(end) {
+			return t.decodeVersion(it.Record(), notFound)
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return nil, notFound
+}
+
+// decodeVersion decodes a version found by AsOf, or returns notFound if
+// it is soft-deleted
+func (t *Table) decodeVersion(record []byte, notFound error) (map[string]any, error) {
+	if field, ok := t.softDeleteField(); ok && isDeleted(field, record) {
+		return nil, notFound
+	}
+	return t.Schema.Decode(record)
+}
+
+// timestampOf decodes a ValidFrom or ValidTo field as a time
+func (t *Table) timestampOf(field Field, record []byte) (time.Time, error) {
+	v, err := field.Decode(record)
+	if err != nil {
+		return time.Time{}, err
+	}
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0), nil
+	case uint64:
+		return time.Unix(int64(v), 0), nil
+	case string:
+		if v == "" {
+			// Written before the field was stamped
+			return time.Time{}, nil
+		}
+		layout := t.Schema.TimestampLayout
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return time.Parse(layout, v)
+	}
+	return time.Time{}, fmt.Errorf("xtrieve: field %s holds %T, not a timestamp", field.Name, v)
+}
@@ -0,0 +1,186 @@
+package xtrieve
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// CSVExport writes records as CSV driven by a schema: a header row of
+// field names followed by one row per record. Values are formatted as
+// XMLExport formats element text.
+//
+//	export := &xtrieve.CSVExport{Schema: schema, Scale: map[string]int{"amt": 2}}
+//	n, err := export.Write(ctx, w, f.ScanPhysical())
+type CSVExport struct {
+	Schema *Schema
+	// Fields lists the fields to export, in order (default all, in
+	// schema order)
+	Fields []string
+	// Comma is the field delimiter (default ',')
+	Comma rune
+	// NoHeader leaves out the header row
+	NoHeader bool
+	// DateFormat, TimeFormat and Scale are as in XMLExport
+	DateFormat string
+	TimeFormat string
+	Scale      map[string]int
+	// Progress, if set, receives progress reports
+	Progress Progress
+}
+
+// Write streams the records of it to w and returns the number of records
+// written. It stops when ctx is cancelled.
+func (e *CSVExport) Write(ctx context.Context, w io.Writer, it RecordIterator) (int, error) {
+	if e.Schema == nil {
+		return 0, errors.New("xtrieve: CSVExport needs a Schema")
+	}
+	fields, err := exportFields(e.Schema, e.Fields)
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if e.Comma != 0 {
+		cw.Comma = e.Comma
+	}
+	row := make([]string, len(fields))
+	if !e.NoHeader {
+		for i, f := range fields {
+			row[i] = f.Name
+		}
+		if err := cw.Write(row); err != nil {
+			return 0, err
+		}
+	}
+
+	format := exportFormat{dates: e.DateFormat, times: e.TimeFormat, scales: e.Scale}
+	tracker := newProgressTracker(e.Progress, 0)
+	n := 0
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			cw.Flush()
+			return n, err
+		}
+		rec := it.Record()
+		for i, f := range fields {
+			if row[i], err = format.field(e.Schema, f, rec); err != nil {
+				return n, err
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return n, err
+		}
+		n++
+		tracker.add(1, len(rec))
+	}
+	cw.Flush()
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	if err := cw.Error(); err != nil {
+		return n, err
+	}
+	tracker.done()
+	return n, nil
+}
+
+// JSONExport writes records as JSON Lines driven by a schema: one object
+// per line, keyed by field name. Numbers stay numbers, keeping the
+// decimal places of scaled fields; dates, times and untyped bytes are
+// strings formatted as XMLExport formats them, and nulls and empty dates
+// are null. Document values are written as decoded.
+//
+//	export := &xtrieve.JSONExport{Schema: schema}
+//	n, err := export.Write(ctx, w, f.ScanPhysical())
+type JSONExport struct {
+	Schema *Schema
+	// Fields lists the fields to export (default all, with the values of
+	// a Document schema)
+	Fields []string
+	// DateFormat, TimeFormat and Scale are as in XMLExport
+	DateFormat string
+	TimeFormat string
+	Scale      map[string]int
+	// Progress, if set, receives progress reports
+	Progress Progress
+}
+
+// Write streams the records of it to w and returns the number of records
+// written. It stops when ctx is cancelled.
+func (e *JSONExport) Write(ctx context.Context, w io.Writer, it RecordIterator) (int, error) {
+	if e.Schema == nil {
+		return 0, errors.New("xtrieve: JSONExport needs a Schema")
+	}
+	if _, err := exportFields(e.Schema, e.Fields); err != nil {
+		return 0, err
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	enc.SetEscapeHTML(false)
+	format := exportFormat{dates: e.DateFormat, times: e.TimeFormat, scales: e.Scale}
+	tracker := newProgressTracker(e.Progress, 0)
+	n := 0
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			bw.Flush()
+			return n, err
+		}
+		rec := it.Record()
+		values, err := e.Schema.Decode(rec)
+		if err != nil {
+			return n, err
+		}
+		if len(e.Fields) > 0 {
+			selected := make(map[string]any, len(e.Fields))
+			for _, name := range e.Fields {
+				selected[name] = values[name]
+			}
+			values = selected
+		}
+		for name, v := range values {
+			values[name] = format.json(name, v)
+		}
+		if err := enc.Encode(values); err != nil {
+			return n, err
+		}
+		n++
+		tracker.add(1, len(rec))
+	}
+	if err := bw.Flush(); err != nil {
+		return n, err
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	tracker.done()
+	return n, nil
+}
+
+// json converts a decoded value of the named field for encoding/json
+func (x exportFormat) json(name string, v any) any {
+	switch v := v.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return nil
+		}
+		return x.value(name, v)
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil
+		}
+		return json.Number(x.value(name, v))
+	case int64, uint64, FixedPoint:
+		return json.Number(x.value(name, v))
+	case []byte, time.Duration:
+		return x.value(name, v)
+	}
+	// Strings, logicals, nulls and document values
+	return v
+}
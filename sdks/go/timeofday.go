@@ -0,0 +1,141 @@
+package xtrieve
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeOfDay is a wall-clock time with the hundredths of a second precision
+// of a Btrieve TIME, with no date or time zone. Schema TIME fields decode
+// to time.Duration since midnight and accept either type when encoding.
+type TimeOfDay struct {
+	Hour, Minute, Second, Hundredth int
+}
+
+// NewTimeOfDay returns the time of day h:m:s.hs, or an error if a
+// component is out of range
+func NewTimeOfDay(h, m, s, hs int) (TimeOfDay, error) {
+	t := TimeOfDay{Hour: h, Minute: m, Second: s, Hundredth: hs}
+	if !t.IsValid() {
+		return TimeOfDay{}, fmt.Errorf("invalid time of day %02d:%02d:%02d.%02d", h, m, s, hs)
+	}
+	return t, nil
+}
+
+// TimeOfDayOf returns the clock time of t in t's location, truncated to
+// hundredths
+func TimeOfDayOf(t time.Time) TimeOfDay {
+	return TimeOfDay{Hour: t.Hour(), Minute: t.Minute(), Second: t.Second(), Hundredth: t.Nanosecond() / 1e7}
+}
+
+// TimeOfDayFromDuration returns the time d after midnight, truncated to
+// hundredths. d must be in [0, 24h).
+func TimeOfDayFromDuration(d time.Duration) (TimeOfDay, error) {
+	if d < 0 || d >= 24*time.Hour {
+		return TimeOfDay{}, fmt.Errorf("duration %s is not a time of day", d)
+	}
+	return TimeOfDay{
+		Hour:      int(d / time.Hour),
+		Minute:    int(d % time.Hour / time.Minute),
+		Second:    int(d % time.Minute / time.Second),
+		Hundredth: int(d % time.Second / (10 * time.Millisecond)),
+	}, nil
+}
+
+// ParseTimeOfDay parses "15:04", "15:04:05" or "15:04:05.99". Fractions
+// finer than hundredths are truncated.
+func ParseTimeOfDay(s string) (TimeOfDay, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return TimeOfDay{}, fmt.Errorf("invalid time of day %q", s)
+	}
+	var t TimeOfDay
+	var frac string
+	var dot bool
+	if len(parts) == 3 {
+		parts[2], frac, dot = strings.Cut(parts[2], ".")
+	}
+	dst := []*int{&t.Hour, &t.Minute, &t.Second}
+	for i, p := range parts {
+		// Digits only: Atoi would also take signs, as in "+1:00"
+		if len(p) == 0 || len(p) > 2 || !isDigits(p) {
+			return TimeOfDay{}, fmt.Errorf("invalid time of day %q", s)
+		}
+		*dst[i], _ = strconv.Atoi(p)
+	}
+	if dot {
+		if frac == "" || !isDigits(frac) {
+			return TimeOfDay{}, fmt.Errorf("invalid time of day %q", s)
+		}
+		t.Hundredth, _ = strconv.Atoi((frac + "0")[:2])
+	}
+	if !t.IsValid() {
+		return TimeOfDay{}, fmt.Errorf("invalid time of day %q", s)
+	}
+	return t, nil
+}
+
+// DecodeTime decodes a Btrieve TIME: hundredths, seconds, minutes and
+// hours bytes, in that order
+func DecodeTime(b []byte) (TimeOfDay, error) {
+	if len(b) != 4 {
+		return TimeOfDay{}, fmt.Errorf("TIME needs 4 bytes, not %d", len(b))
+	}
+	return NewTimeOfDay(int(b[3]), int(b[2]), int(b[1]), int(b[0]))
+}
+
+// IsValid reports whether every component is in range
+func (t TimeOfDay) IsValid() bool {
+	return t.Hour >= 0 && t.Hour < 24 && t.Minute >= 0 && t.Minute < 60 &&
+		t.Second >= 0 && t.Second < 60 && t.Hundredth >= 0 && t.Hundredth < 100
+}
+
+// Bytes encodes t as a Btrieve TIME, e.g. for a search key
+func (t TimeOfDay) Bytes() []byte {
+	return []byte{byte(t.Hundredth), byte(t.Second), byte(t.Minute), byte(t.Hour)}
+}
+
+// Duration returns the time since midnight
+func (t TimeOfDay) Duration() time.Duration {
+	return time.Duration(t.Hour)*time.Hour + time.Duration(t.Minute)*time.Minute +
+		time.Duration(t.Second)*time.Second + time.Duration(t.Hundredth)*10*time.Millisecond
+}
+
+// On returns t on the calendar date of day, in day's location
+func (t TimeOfDay) On(day time.Time) time.Time {
+	y, m, d := day.Date()
+	return time.Date(y, m, d, t.Hour, t.Minute, t.Second, t.Hundredth*1e7, day.Location())
+}
+
+// Compare returns -1, 0 or 1 as t is before, equal to or after u
+func (t TimeOfDay) Compare(u TimeOfDay) int {
+	switch a, b := t.Duration(), u.Duration(); {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// String formats t as "15:04:05.99"
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d:%02d.%02d", t.Hour, t.Minute, t.Second, t.Hundredth)
+}
+
+// MarshalText encodes t as String does
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText parses a time as ParseTimeOfDay does
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	v, err := ParseTimeOfDay(string(text))
+	if err != nil {
+		return err
+	}
+	*t = v
+	return nil
+}
@@ -0,0 +1,93 @@
+package xtrieve
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeOfDay(t *testing.T) {
+	tests := []struct {
+		in   string
+		want TimeOfDay
+		ok   bool
+	}{
+		{"15:04", TimeOfDay{15, 4, 0, 0}, true},
+		{"9:05:07", TimeOfDay{9, 5, 7, 0}, true},
+		{"00:00:00.00", TimeOfDay{}, true},
+		{"23:59:59.99", TimeOfDay{23, 59, 59, 99}, true},
+		{"12:00:00.5", TimeOfDay{12, 0, 0, 50}, true},
+		{"12:00:00.999", TimeOfDay{12, 0, 0, 99}, true},
+		{"+1:00", TimeOfDay{}, false},
+		{"-0:00", TimeOfDay{}, false},
+		{"1:+2", TimeOfDay{}, false},
+		{"12:00:-1", TimeOfDay{}, false},
+		{" 1:00", TimeOfDay{}, false},
+		{"24:00", TimeOfDay{}, false},
+		{"12:60", TimeOfDay{}, false},
+		{"12:00:60", TimeOfDay{}, false},
+		{"123:00", TimeOfDay{}, false},
+		{"12", TimeOfDay{}, false},
+		{"1:2:3:4", TimeOfDay{}, false},
+		{"12::00", TimeOfDay{}, false},
+		{"12:00:00.", TimeOfDay{}, false},
+		{"12:00:00.-5", TimeOfDay{}, false},
+		{"12:00.5", TimeOfDay{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeOfDay(tt.in)
+		if tt.ok && (err != nil || got != tt.want) {
+			t.Errorf("ParseTimeOfDay(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("ParseTimeOfDay(%q) = %v, want an error", tt.in, got)
+		}
+	}
+}
+
+func TestTimeOfDay(t *testing.T) {
+	tests := []struct {
+		t   TimeOfDay
+		raw []byte
+		d   time.Duration
+	}{
+		{TimeOfDay{}, []byte{0, 0, 0, 0}, 0},
+		{TimeOfDay{15, 4, 5, 99}, []byte{99, 5, 4, 15}, 15*time.Hour + 4*time.Minute + 5990*time.Millisecond},
+		{TimeOfDay{23, 59, 59, 99}, []byte{99, 59, 59, 23}, 24*time.Hour - 10*time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := tt.t.Bytes(); string(got) != string(tt.raw) {
+			t.Errorf("%v.Bytes() = %v, want %v", tt.t, got, tt.raw)
+		}
+		if got, err := DecodeTime(tt.raw); err != nil || got != tt.t {
+			t.Errorf("DecodeTime(%v) = %v, %v, want %v", tt.raw, got, err, tt.t)
+		}
+		if got := tt.t.Duration(); got != tt.d {
+			t.Errorf("%v.Duration() = %v, want %v", tt.t, got, tt.d)
+		}
+		if got, err := TimeOfDayFromDuration(tt.d + 9*time.Millisecond); err != nil || got != tt.t {
+			t.Errorf("TimeOfDayFromDuration(%v) = %v, %v, want %v", tt.d, got, err, tt.t)
+		}
+		if got, err := ParseTimeOfDay(tt.t.String()); err != nil || got != tt.t {
+			t.Errorf("ParseTimeOfDay(%q) = %v, %v, want %v", tt.t.String(), got, err, tt.t)
+		}
+	}
+
+	for _, raw := range [][]byte{{100, 0, 0, 0}, {0, 60, 0, 0}, {0, 0, 0, 24}, {0, 0, 0}} {
+		if got, err := DecodeTime(raw); err == nil {
+			t.Errorf("DecodeTime(%v) = %v, want an error", raw, got)
+		}
+	}
+	for _, d := range []time.Duration{-time.Nanosecond, 24 * time.Hour} {
+		if got, err := TimeOfDayFromDuration(d); err == nil {
+			t.Errorf("TimeOfDayFromDuration(%v) = %v, want an error", d, got)
+		}
+	}
+
+	noon := TimeOfDay{Hour: 12}
+	if noon.Compare(TimeOfDay{11, 59, 59, 99}) != 1 || noon.Compare(noon) != 0 || noon.Compare(TimeOfDay{12, 0, 0, 1}) != -1 {
+		t.Error("Compare does not order times of day")
+	}
+	if got := noon.On(time.Date(2024, 2, 29, 23, 0, 0, 0, time.UTC)); !got.Equal(time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("On = %v, want noon on 2024-02-29", got)
+	}
+}
@@ -0,0 +1,109 @@
+package xtrieve
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// timestampValue is the value of a Created or Modified field at now, in
+// UTC: the date for a date field, the time of day for a time field, Unix
+// seconds for integers and text in layout for strings
+func timestampValue(field Field, now time.Time, layout string) (any, error) {
+	now = now.UTC()
+	switch field.Type {
+	case KeyTypeDate:
+		return now.Truncate(24 * time.Hour), nil
+	case KeyTypeTime:
+		return now.Sub(now.Truncate(24 * time.Hour)).Truncate(10 * time.Millisecond), nil
+	case KeyTypeInteger, KeyTypeUnsignedBinary:
+		return now.Unix(), nil
+	case KeyTypeString, KeyTypeZstring, KeyTypeLstring, KeyTypeWString, KeyTypeWZstring:
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return now.Format(layout), nil
+	}
+	return nil, fmt.Errorf("xtrieve: timestamp field %s must be a date, time, integer or string", field.Name)
+}
+
+// stampInsert fills the Created and Modified fields of a new record in
+// values. Values the caller supplied are kept, unless the schema has
+// StrictTimestamps; nil and zero values, such as those of a new struct in
+// a TypedTable, count as not supplied.
+func (t *Table) stampInsert(values map[string]any, now time.Time) error {
+	for _, name := range []string{t.Schema.Created, t.Schema.Modified} {
+		if name == "" {
+			continue
+		}
+		if v := values[name]; v != nil && !reflect.ValueOf(v).IsZero() {
+			if t.Schema.StrictTimestamps {
+				return fmt.Errorf("%w: %s", ErrTimestampSupplied, name)
+			}
+			continue
+		}
+		if err := t.stamp(values, name, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stampUpdate sets the Modified field of an updated record in values and
+// record. With StrictTimestamps, Created and Modified values in values
+// must be the stored ones, as in a row read by Get.
+func (t *Table) stampUpdate(values map[string]any, current, record []byte, now time.Time) error {
+	if t.Schema.StrictTimestamps {
+		for _, name := range []string{t.Schema.Created, t.Schema.Modified} {
+			if err := t.checkStored(name, values, current); err != nil {
+				return err
+			}
+		}
+	}
+	if t.Schema.Modified == "" {
+		return nil
+	}
+	if err := t.stamp(values, t.Schema.Modified, now); err != nil {
+		return err
+	}
+	return t.Schema.Set(record, t.Schema.Modified, values[t.Schema.Modified])
+}
+
+// stamp sets the timestamp field name to now in values
+func (t *Table) stamp(values map[string]any, name string, now time.Time) error {
+	field, ok := t.Schema.Field(name)
+	if !ok {
+		return fmt.Errorf("xtrieve: unknown timestamp field %q", name)
+	}
+	v, err := timestampValue(field, now, t.Schema.TimestampLayout)
+	if err != nil {
+		return err
+	}
+	values[name] = v
+	return nil
+}
+
+// checkStored reports ErrTimestampSupplied if values holds a value for
+// the field name that differs from the one stored in current
+func (t *Table) checkStored(name string, values map[string]any, current []byte) error {
+	v, ok := values[name]
+	if name == "" || !ok {
+		return nil
+	}
+	supplied := append([]byte(nil), current...)
+	if err := t.Schema.Set(supplied, name, v); err != nil {
+		return err
+	}
+	a, err := t.Schema.Get(supplied, name)
+	if err != nil {
+		return err
+	}
+	b, err := t.Schema.Get(current, name)
+	if err != nil {
+		return err
+	}
+	if !reflect.DeepEqual(a, b) {
+		return fmt.Errorf("%w: %s", ErrTimestampSupplied, name)
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package xtrieve
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Role is the part a server plays in a cluster
+type Role string
+
+// Server roles
+const (
+	RolePrimary Role = "primary"
+	RoleReplica Role = "replica"
+)
+
+// Member describes one server of a cluster
+type Member struct {
+	Addr string `json:"addr"`
+	Role Role   `json:"role"`
+	// Files lists the files the member serves; empty means all files
+	Files []string `json:"files,omitempty"`
+}
+
+// Discoverer reports the current members of a cluster. The server protocol
+// has no discovery operation, so members come from wherever the failover
+// tooling publishes them.
+type Discoverer interface {
+	Discover() ([]Member, error)
+}
+
+// DiscoverFunc adapts a function to the Discoverer interface
+type DiscoverFunc func() ([]Member, error)
+
+// Discover calls fn()
+func (fn DiscoverFunc) Discover() ([]Member, error) {
+	return fn()
+}
+
+// FileDiscovery reads the members from a JSON file holding an array of
+// members, re-reading it on every call:
+//
+//	[{"addr": "db1:7419", "role": "primary"},
+//	 {"addr": "db2:7419", "role": "replica", "files": ["orders.dat"]}]
+func FileDiscovery(path string) Discoverer {
+	return DiscoverFunc(func() ([]Member, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var members []Member
+		if err := json.Unmarshal(data, &members); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return members, nil
+	})
+}
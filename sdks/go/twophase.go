@@ -0,0 +1,350 @@
+package xtrieve
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrInDoubt is returned by Coordinator.Run when the transaction was
+// decided but not every server committed its part; Coordinator.Recover
+// completes it
+var ErrInDoubt = errors.New("xtrieve: distributed transaction in doubt")
+
+// Coordinator runs transactions that span several Xtrieve servers so
+// that each commits on all of them or on none. The protocol has no
+// prepare operation, so the coordinator does the preparing: while every
+// server holds its transaction open, it writes the transaction's writes,
+// server by server, to a recovery log and syncs it, which decides the
+// commit. It then commits on each server. A server whose commit is lost,
+// because it failed or the process died, gets its writes applied again
+// by Recover from the log; writes are identified by unique keys, so those
+// that did commit are not applied twice.
+//
+// Until the last server commits, readers can see the transaction's writes
+// on some servers and not yet on others.
+//
+//	coord, err := xtrieve.OpenCoordinator("transfers.2pc")
+//	err = coord.Run(ctx, map[string]*xtrieve.Client{"east": east, "west": west}, xtrieve.LockSingleWait,
+//	    func(tx *xtrieve.DistributedTx) error {
+//	        from, err := tx.OpenFile("east", "accounts.dat", 0, 0)
+//	        ...
+//	    })
+type Coordinator struct {
+	// NoSync skips the fsync after each log append, giving up recovery
+	// after a machine crash
+	NoSync bool
+
+	mu   sync.Mutex
+	path string
+	file *os.File
+	id   uint64
+}
+
+// DistributedTx is a transaction run by Coordinator.Run
+type DistributedTx struct {
+	clients map[string]*Client
+	files   []*File
+	// writes are the writes made on each server, in order
+	writes map[string][]JournalEntry
+}
+
+// twoPhaseRecord is one line of a coordinator's recovery log: the writes
+// of a decided transaction, the commit of one server's part, or the end
+// of the transaction
+type twoPhaseRecord struct {
+	ID        uint64                    `json:"id"`
+	Writes    map[string][]JournalEntry `json:"writes,omitempty"`
+	Committed string                    `json:"committed,omitempty"`
+	Done      bool                      `json:"done,omitempty"`
+}
+
+// OpenCoordinator opens or creates the recovery log of a coordinator
+func OpenCoordinator(path string) (*Coordinator, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	c := &Coordinator{path: path, file: f}
+	records, err := c.read()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	for _, r := range records {
+		c.id = max(c.id, r.ID)
+	}
+	return c, nil
+}
+
+// Close closes the recovery log
+func (c *Coordinator) Close() error {
+	return c.file.Close()
+}
+
+// OpenFile opens a file on the named server's connection, as part of the
+// transaction. keyNumber names a unique key of the file, by which Recover
+// finds records again. The file is closed when the transaction ends.
+func (tx *DistributedTx) OpenFile(server, path string, mode int16, keyNumber int16) (*File, error) {
+	client := tx.clients[server]
+	if client == nil {
+		return nil, fmt.Errorf("xtrieve: no server %q in the transaction", server)
+	}
+	f, err := client.OpenFile(path, mode)
+	if err != nil {
+		return nil, err
+	}
+	tx.files = append(tx.files, f)
+
+	var key []byte
+	f.Before(func(f *File, op uint16, record []byte) error {
+		if op == OpInsert {
+			key = nil
+			return nil
+		}
+		current, err := currentRecord(f, keyNumber)
+		key = ExtractKey(f.KeySegments(keyNumber), current)
+		return err
+	})
+	f.After(func(f *File, op uint16, record []byte) error {
+		e := JournalEntry{File: path, KeyNumber: keyNumber, Key: key}
+		switch op {
+		case OpInsert:
+			e.Op, e.Data, e.Key = JournalInsert, bytes.Clone(record), ExtractKey(f.KeySegments(keyNumber), record)
+		case OpUpdate:
+			e.Op, e.Data = JournalUpdate, bytes.Clone(record)
+		case OpDelete:
+			e.Op = JournalDelete
+		}
+		tx.writes[server] = append(tx.writes[server], e)
+		return nil
+	})
+	return f, nil
+}
+
+// Run runs fn in a transaction on every server in clients, named for the
+// recovery log, and commits it on all of them if fn returns nil; if fn
+// returns an error, or a server fails before the commit is decided, every
+// server rolls back. fn writes through files opened with tx.OpenFile.
+// After the decision, a failed commit returns an error wrapping
+// ErrInDoubt; the other servers still commit.
+func (c *Coordinator) Run(ctx context.Context, clients map[string]*Client, lockMode uint16, fn func(tx *DistributedTx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	servers := make([]string, 0, len(clients))
+	for name := range clients {
+		servers = append(servers, name)
+	}
+	sort.Strings(servers)
+
+	tx := &DistributedTx{clients: clients, writes: make(map[string][]JournalEntry)}
+	var begun []string
+	decided := false
+	defer func() {
+		if !decided {
+			for _, name := range begun {
+				clients[name].AbortTransaction(nil)
+			}
+		}
+		for _, f := range tx.files {
+			f.Close()
+		}
+	}()
+
+	for _, name := range servers {
+		resp, err := clients[name].BeginTransaction(nil, lockMode)
+		if err == nil {
+			err = checkStatus(OpBeginTransaction, resp)
+		}
+		if err != nil {
+			return fmt.Errorf("server %s: %w", name, err)
+		}
+		begun = append(begun, name)
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Logging the writes decides the commit
+	c.mu.Lock()
+	c.id++
+	id := c.id
+	c.mu.Unlock()
+	if err := c.append(twoPhaseRecord{ID: id, Writes: tx.writes}); err != nil {
+		return err
+	}
+	decided = true
+
+	var failed []error
+	for _, name := range servers {
+		resp, err := clients[name].EndTransaction(nil)
+		if err == nil {
+			err = checkStatus(OpEndTransaction, resp)
+		}
+		if err != nil {
+			failed = append(failed, fmt.Errorf("server %s: %w", name, err))
+			continue
+		}
+		if err := c.append(twoPhaseRecord{ID: id, Committed: name}); err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if failed != nil {
+		return fmt.Errorf("%w: transaction %d: %w", ErrInDoubt, id, errors.Join(failed...))
+	}
+	return c.append(twoPhaseRecord{ID: id, Done: true})
+}
+
+// Recover completes the transactions in the log that were decided but not
+// committed on every server: the writes of each server whose commit is not
+// logged are applied in a transaction of their own, skipping those already
+// in the file. open returns the File for a path on a named server, on a
+// connection not in a transaction. It returns the number of transactions
+// completed.
+func (c *Coordinator) Recover(ctx context.Context, open func(server, path string) (*File, error)) (int, error) {
+	records, err := c.read()
+	if err != nil {
+		return 0, err
+	}
+	pending := make(map[uint64]*twoPhaseRecord)
+	var order []uint64
+	for _, r := range records {
+		switch {
+		case r.Writes != nil:
+			r := r
+			pending[r.ID] = &r
+			order = append(order, r.ID)
+		case r.Committed != "":
+			if p := pending[r.ID]; p != nil {
+				delete(p.Writes, r.Committed)
+			}
+		case r.Done:
+			delete(pending, r.ID)
+		}
+	}
+
+	n := 0
+	for _, id := range order {
+		p := pending[id]
+		if p == nil {
+			continue
+		}
+		servers := make([]string, 0, len(p.Writes))
+		for name := range p.Writes {
+			servers = append(servers, name)
+		}
+		sort.Strings(servers)
+		for _, name := range servers {
+			if err := ctx.Err(); err != nil {
+				return n, err
+			}
+			if err := recoverServer(p.Writes[name], name, open); err != nil {
+				return n, fmt.Errorf("transaction %d, server %s: %w", id, name, err)
+			}
+			if err := c.append(twoPhaseRecord{ID: id, Committed: name}); err != nil {
+				return n, err
+			}
+		}
+		if err := c.append(twoPhaseRecord{ID: id, Done: true}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// recoverServer applies one server's writes of a transaction in a
+// transaction on that server
+func recoverServer(writes []JournalEntry, server string, open func(server, path string) (*File, error)) error {
+	files := make(map[string]*File)
+	var client *Client
+	for _, e := range writes {
+		if files[e.File] != nil {
+			continue
+		}
+		f, err := open(server, e.File)
+		if err != nil {
+			return err
+		}
+		if client != nil && f.client != client {
+			return fmt.Errorf("xtrieve: files of server %s opened on different connections", server)
+		}
+		client, files[e.File] = f.client, f
+	}
+	if client == nil {
+		return nil
+	}
+
+	resp, err := client.BeginTransaction(nil, 0)
+	if err == nil {
+		err = checkStatus(OpBeginTransaction, resp)
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range writes {
+		f := files[e.File]
+		done, err := isApplied(f, e)
+		if err == nil && !done {
+			err = apply(f, e)
+		}
+		if err != nil {
+			client.AbortTransaction(nil)
+			return err
+		}
+	}
+	resp, err = client.EndTransaction(nil)
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpEndTransaction, resp)
+}
+
+// append writes one record as a JSON line
+func (c *Coordinator) append(r twoPhaseRecord) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("coordinator log: %w", err)
+	}
+	if c.NoSync {
+		return nil
+	}
+	return c.file.Sync()
+}
+
+// read parses every record in the log. A torn last line, left by a crash
+// during an append, is ignored.
+func (c *Coordinator) read() ([]twoPhaseRecord, error) {
+	f, err := os.Open(c.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []twoPhaseRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var r twoPhaseRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			break
+		}
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
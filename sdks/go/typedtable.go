@@ -0,0 +1,136 @@
+package xtrieve
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// TypedTable is a Table whose records are Go structs. Struct fields are
+// matched to schema fields by name, or by the name in a msgpack tag; with
+// a Document schema the remaining struct fields are stored in the
+// record's MessagePack document.
+//
+//	type Customer struct {
+//	    ID      int64             `msgpack:"id"`   // key field at a fixed offset
+//	    Name    string            `msgpack:"name"`
+//	    Tags    []string          `msgpack:"tags"` // in the document
+//	    Address map[string]string `msgpack:"address"`
+//	}
+//	customers := xtrieve.NewTypedTable[Customer](f, schema, 0)
+//	c, err := customers.Get(key)
+type TypedTable[T any] struct {
+	Table *Table
+}
+
+// NewTypedTable returns a typed table over f identified by the unique key
+// keyNumber
+func NewTypedTable[T any](f *File, schema *Schema, keyNumber int16) *TypedTable[T] {
+	return &TypedTable[T]{Table: NewTable(f, schema, keyNumber)}
+}
+
+// Get reads the record with the given key
+func (t *TypedTable[T]) Get(key []byte) (*T, error) {
+	values, err := t.Table.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	v := new(T)
+	if err := assignRecord(v, values); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// AsOf reads the version of the record with the given key that was
+// current at the given time, like Table.AsOf
+func (t *TypedTable[T]) AsOf(key []byte, at time.Time) (*T, error) {
+	values, err := t.Table.AsOf(key, at)
+	if err != nil {
+		return nil, err
+	}
+	v := new(T)
+	if err := assignRecord(v, values); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Insert inserts v; its version field, if any, is set to 1
+func (t *TypedTable[T]) Insert(v *T) error {
+	return t.write(v, t.Table.Insert)
+}
+
+// Update writes v over the record with the same key, checking and
+// incrementing its version field like Table.Update
+func (t *TypedTable[T]) Update(v *T) error {
+	return t.write(v, t.Table.Update)
+}
+
+// Delete deletes the record with v's key like Table.Delete
+func (t *TypedTable[T]) Delete(v *T) error {
+	return t.write(v, t.Table.Delete)
+}
+
+// write runs op on v's values and copies changes such as the new version
+// back into v
+func (t *TypedTable[T]) write(v *T, op func(map[string]any) error) error {
+	values, err := t.values(v)
+	if err != nil {
+		return err
+	}
+	if err := op(values); err != nil {
+		return err
+	}
+	return assignRecord(v, values)
+}
+
+// values converts v to a field map. Values of schema fields are converted
+// to the basic types Field.Encode expects, so named types such as
+// `type Status int8` can be used.
+func (t *TypedTable[T]) values(v *T) (map[string]any, error) {
+	rv := reflect.ValueOf(v).Elem()
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("xtrieve: TypedTable needs a struct type, not %s", rv.Type())
+	}
+	values := make(map[string]any)
+	for _, f := range structFields(rv) {
+		if _, isField := t.Table.Schema.Field(f.name); isField {
+			values[f.name] = basicValue(f.value)
+		} else if t.Table.Schema.Document {
+			values[f.name] = f.value.Interface()
+		}
+	}
+	return values, nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// basicValue returns v as a value of its underlying basic type
+func basicValue(v reflect.Value) any {
+	if v.Type() == durationType {
+		return v.Interface()
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return v.Bool()
+	}
+	return v.Interface()
+}
+
+// assignRecord stores a field map into the struct v points to
+func assignRecord(v any, values map[string]any) error {
+	rv := reflect.ValueOf(v).Elem()
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("xtrieve: TypedTable needs a struct type, not %s", rv.Type())
+	}
+	return assignStruct(rv, values)
+}
@@ -0,0 +1,280 @@
+package xtrieve
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// WatchdogConfig sets the limits of a Watchdog. A zero limit is not
+// enforced.
+type WatchdogConfig struct {
+	// MaxTransaction is how long a transaction may stay open
+	MaxTransaction time.Duration
+	// MaxLock is how long a file's record locks may be held
+	MaxLock time.Duration
+	// Abort aborts transactions and releases locks past their limit
+	// instead of only reporting them
+	Abort bool
+	// Interval is how often the limits are checked; by default a quarter
+	// of the smaller limit
+	Interval time.Duration
+	// OnViolation is called once for each transaction or lock past its
+	// limit, from the watchdog's goroutine. Violations are also logged at
+	// Warn to the client's logger, or slog's default logger without one.
+	OnViolation func(Violation)
+}
+
+// Violation is a transaction or record lock held past its limit
+type Violation struct {
+	// Transaction is set for a transaction; otherwise File holds record
+	// locks
+	Transaction bool
+	File        string
+	Since       time.Time
+	Held        time.Duration
+	// Aborted is set when the watchdog aborted the transaction or
+	// released the locks; Err is why that failed
+	Aborted bool
+	Err     error
+}
+
+// Watchdog tracks how long a client's transactions and record locks are
+// held, as seen in the requests it sends, and reports or ends the ones
+// held too long, e.g. a transaction a handler forgot to end. Locks are
+// taken by reads with a LockBias and released by Unlock, Update, Delete,
+// Close and the end of the transaction they were taken in.
+//
+// Aborting a transaction under a running handler makes its next
+// operations fail rather than commit half of its work. Locks taken inside
+// a transaction are released by aborting it, others with Unlock. xtrieved
+// does not support Unlock, so against it the watchdog closes and reopens
+// the file, which releases the locks the session holds on it. A
+// Violation whose locks could not be released has Aborted unset and an
+// Err saying so.
+type Watchdog struct {
+	client *Client
+	cfg    WatchdogConfig
+	stop   chan struct{}
+	once   sync.Once
+
+	mu sync.Mutex
+	tx *heldTx
+	// locks by file path
+	locks map[string]*heldLock
+}
+
+type heldTx struct {
+	since    time.Time
+	reported bool
+}
+
+type heldLock struct {
+	since    time.Time
+	multi    bool
+	inTx     bool
+	reported bool
+	// posBlock is a copy of the file's position block to unlock with
+	posBlock []byte
+}
+
+// NewWatchdog starts watching the transactions and locks of c. Only one
+// watchdog watches a client; a new one replaces the previous one.
+func NewWatchdog(c *Client, cfg WatchdogConfig) *Watchdog {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Minute
+		for _, limit := range []time.Duration{cfg.MaxTransaction, cfg.MaxLock} {
+			if limit > 0 {
+				cfg.Interval = min(cfg.Interval, limit/4)
+			}
+		}
+		cfg.Interval = max(cfg.Interval, time.Millisecond)
+	}
+	w := &Watchdog{
+		client: c,
+		cfg:    cfg,
+		stop:   make(chan struct{}),
+		locks:  make(map[string]*heldLock),
+	}
+	if old := c.watchdog.Swap(w); old != nil {
+		old.Stop()
+	}
+	go w.run()
+	return w
+}
+
+// Stop stops watching
+func (w *Watchdog) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+		w.client.watchdog.CompareAndSwap(w, nil)
+	})
+}
+
+// observe updates the state after a request was answered
+func (w *Watchdog) observe(req *Request, resp *Response, err error) {
+	if err != nil || resp.StatusCode != StatusSuccess {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch op := req.Operation; {
+	case op == OpBeginTransaction:
+		w.tx = &heldTx{since: time.Now()}
+	case op == OpEndTransaction, op == OpAbortTransaction:
+		w.tx = nil
+		for file, l := range w.locks {
+			if l.inTx {
+				delete(w.locks, file)
+			}
+		}
+	case op == OpUnlock, op == OpClose:
+		delete(w.locks, requestFile(req))
+	case op == OpUpdate, op == OpDelete:
+		// Writing the locked record releases a single-record lock
+		if l := w.locks[requestFile(req)]; l != nil && !l.multi {
+			delete(w.locks, requestFile(req))
+		}
+	case IsReadOnly(op) && req.LockBias != LockNone:
+		file := requestFile(&Request{PositionBlock: resp.PositionBlock})
+		multi := req.LockBias == LockMultiWait || req.LockBias == LockMultiNoWait
+		l := w.locks[file]
+		if l == nil || !multi {
+			// A new single-record lock releases the previous one
+			l = &heldLock{since: time.Now(), multi: multi, inTx: w.tx != nil}
+			w.locks[file] = l
+		}
+		l.posBlock = append(l.posBlock[:0], resp.PositionBlock...)
+	}
+}
+
+func (w *Watchdog) run() {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reports and, with Abort set, ends what is held past its limit
+func (w *Watchdog) check() {
+	now := time.Now()
+	var held []heldPastLimit
+	w.mu.Lock()
+	if tx := w.tx; tx != nil && !tx.reported && w.cfg.MaxTransaction > 0 && now.Sub(tx.since) >= w.cfg.MaxTransaction {
+		tx.reported = true
+		held = append(held, heldPastLimit{Violation: Violation{Transaction: true, Since: tx.since, Held: now.Sub(tx.since)}})
+	}
+	for file, l := range w.locks {
+		if l.reported || w.cfg.MaxLock <= 0 || now.Sub(l.since) < w.cfg.MaxLock {
+			continue
+		}
+		l.reported = true
+		h := heldPastLimit{Violation: Violation{File: file, Since: l.since, Held: now.Sub(l.since)}, multi: l.multi}
+		// Locks taken in a transaction are released by aborting it
+		if !l.inTx {
+			h.posBlock = append([]byte(nil), l.posBlock...)
+		}
+		held = append(held, h)
+	}
+	w.mu.Unlock()
+
+	txAborted := false
+	for _, h := range held {
+		v := h.Violation
+		switch {
+		case !w.cfg.Abort:
+		case txAborted && h.posBlock == nil:
+			// Released with the transaction the watchdog just aborted
+			v.Aborted = true
+		default:
+			v.Err = w.release(h)
+			v.Aborted = v.Err == nil
+			txAborted = txAborted || v.Aborted && h.posBlock == nil
+		}
+		w.report(v)
+	}
+}
+
+// heldPastLimit is a violation and the position block releasing its locks
+type heldPastLimit struct {
+	Violation
+	posBlock []byte
+	multi    bool
+}
+
+// release aborts the transaction of a violation or releases its locks
+func (w *Watchdog) release(h heldPastLimit) error {
+	if h.posBlock == nil {
+		resp, err := w.client.Execute(&Request{Operation: OpAbortTransaction})
+		if err != nil {
+			return err
+		}
+		return checkStatus(OpAbortTransaction, resp)
+	}
+
+	// Key number -2 releases every multiple-record lock of the file, 0 its
+	// single-record lock
+	req := &Request{Operation: OpUnlock, PositionBlock: h.posBlock}
+	if h.multi {
+		req.KeyNumber = -2
+	}
+	resp, err := w.client.Execute(req)
+	if err == nil && resp.StatusCode == StatusInvalidOperation {
+		err = w.reopen(h)
+	} else if err == nil {
+		err = checkStatus(OpUnlock, resp)
+	}
+	if err != nil {
+		return fmt.Errorf("xtrieve: could not release the locks on %s: %w", h.File, err)
+	}
+	return nil
+}
+
+// reopen releases the locks of a violation on a server without Unlock by
+// closing the file, which releases its locks, and opening it again so the
+// file stays open for its handle. xtrieved keeps a handle's state in its
+// position block, so the handle keeps working.
+func (w *Watchdog) reopen(h heldPastLimit) error {
+	resp, err := w.client.Execute(&Request{Operation: OpClose, PositionBlock: h.posBlock})
+	if err != nil {
+		return err
+	}
+	if err := checkStatus(OpClose, resp); err != nil {
+		return err
+	}
+	resp, err = w.client.Execute(&Request{Operation: OpOpen, FilePath: h.File})
+	if err != nil {
+		return err
+	}
+	return checkStatus(OpOpen, resp)
+}
+
+// report logs a violation and passes it to OnViolation
+func (w *Watchdog) report(v Violation) {
+	logger := w.client.logger.Load()
+	if logger == nil {
+		logger = slog.Default()
+	}
+	attrs := []slog.Attr{slog.Duration("held", v.Held), slog.Bool("aborted", v.Aborted)}
+	msg := "xtrieve transaction held too long"
+	if !v.Transaction {
+		msg = "xtrieve record locks held too long"
+		attrs = append(attrs, slog.String("file", v.File))
+	}
+	if v.Err != nil {
+		attrs = append(attrs, slog.Any("error", v.Err))
+	}
+	logger.LogAttrs(context.Background(), slog.LevelWarn, msg, attrs...)
+	if w.cfg.OnViolation != nil {
+		w.cfg.OnViolation(v)
+	}
+}
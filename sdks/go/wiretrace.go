@@ -0,0 +1,142 @@
+package xtrieve
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// WithWireTrace makes the client write an annotated hex dump of every
+// request and response to w, each field labeled with its offset in the
+// frame, for diagnosing interoperability with other servers. It is
+// independent of SetLogger and dumps records as they are, unredacted.
+// Passing nil turns tracing off. It returns c.
+//
+//	> 12:00:01.503211 get_equal request, 156 bytes
+//	0000 operation      05 00                                            5 get_equal
+//	0002 position_block 01 00 00 00 00 00 00 00 00 00 00 00 00 00 00 00  |................|
+//	     *
+//	...
+func (c *Client) WithWireTrace(w io.Writer) *Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.trace = w
+	return c
+}
+
+// traceRequest writes the trace of a request. The caller holds c.mu.
+func (c *Client) traceRequest(req *Request) {
+	t := &frameTrace{}
+	size := requestHeaderSize + len(req.DataBuffer) + 2 + len(req.KeyBuffer) + 4 + len(req.FilePath) + 2
+	t.header('>', fmt.Sprintf("%s request, %d bytes", OpName(req.Operation), size))
+	t.u16("operation", req.Operation, fmt.Sprintf("%d %s", req.Operation, OpName(req.Operation)))
+	pb := make([]byte, PositionBlockSize)
+	copy(pb, req.PositionBlock)
+	t.bytes("position_block", pb)
+	t.u32("data_length", uint32(len(req.DataBuffer)))
+	t.bytes("data_buffer", req.DataBuffer)
+	t.u16("key_length", uint16(len(req.KeyBuffer)), "")
+	t.bytes("key_buffer", req.KeyBuffer)
+	t.u16("key_number", uint16(req.KeyNumber), strconv.Itoa(int(req.KeyNumber)))
+	t.u16("path_length", uint16(len(req.FilePath)), "")
+	t.bytes("file_path", []byte(req.FilePath))
+	t.u16("lock_bias", req.LockBias, "")
+	c.trace.Write(t.b)
+}
+
+// traceResponse writes the trace of the response to op, or of the error
+// reading it. The caller holds c.mu.
+func (c *Client) traceResponse(op uint16, resp *Response, err error) {
+	t := &frameTrace{}
+	if err != nil {
+		t.header('<', fmt.Sprintf("%s response: %v", OpName(op), err))
+		c.trace.Write(t.b)
+		return
+	}
+	size := responseHeaderSize + len(resp.DataBuffer) + 2 + len(resp.KeyBuffer)
+	t.header('<', fmt.Sprintf("%s response, status %d, %d bytes", OpName(op), resp.StatusCode, size))
+	t.u16("status", resp.StatusCode, "")
+	t.bytes("position_block", resp.PositionBlock)
+	t.u32("data_length", uint32(len(resp.DataBuffer)))
+	t.bytes("data_buffer", resp.DataBuffer)
+	t.u16("key_length", uint16(len(resp.KeyBuffer)), "")
+	t.bytes("key_buffer", resp.KeyBuffer)
+	c.trace.Write(t.b)
+}
+
+// frameTrace formats one frame, field by field
+type frameTrace struct {
+	b      []byte
+	offset int
+}
+
+// Column where the decoded value or the characters of a row start
+const traceTextColumn = 3*16 + 1
+
+func (t *frameTrace) header(dir byte, title string) {
+	t.b = fmt.Appendf(t.b, "%c %s %s\n", dir, time.Now().Format("15:04:05.000000"), title)
+}
+
+func (t *frameTrace) u16(name string, v uint16, note string) {
+	if note == "" {
+		note = strconv.Itoa(int(v))
+	}
+	t.row(t.offset, name, binary.LittleEndian.AppendUint16(nil, v), note)
+	t.offset += 2
+}
+
+func (t *frameTrace) u32(name string, v uint32) {
+	t.row(t.offset, name, binary.LittleEndian.AppendUint32(nil, v), strconv.FormatUint(uint64(v), 10))
+	t.offset += 4
+}
+
+// bytes dumps a variable field 16 bytes to a row, collapsing repeated
+// all-zero rows into a *
+func (t *frameTrace) bytes(name string, b []byte) {
+	start := t.offset
+	t.offset += len(b)
+	zeroRun := false
+	for i := 0; i < len(b); i += 16 {
+		row := b[i:min(i+16, len(b))]
+		if i > 0 && len(row) == 16 && allZero(row) && allZero(b[i-16:i]) {
+			if !zeroRun {
+				t.b = append(t.b, "     *\n"...)
+				zeroRun = true
+			}
+			continue
+		}
+		zeroRun = false
+		label := ""
+		if i == 0 {
+			label = name
+		}
+		t.row(start+i, label, row, "|"+printable(row)+"|")
+	}
+}
+
+func (t *frameTrace) row(offset int, name string, b []byte, text string) {
+	t.b = fmt.Appendf(t.b, "%04x %-14s ", offset, name)
+	n := 0
+	for _, c := range b {
+		t.b = fmt.Appendf(t.b, "%02x ", c)
+		n += 3
+	}
+	for ; n < traceTextColumn; n++ {
+		t.b = append(t.b, ' ')
+	}
+	t.b = append(t.b, text...)
+	t.b = append(t.b, '\n')
+}
+
+func printable(b []byte) string {
+	s := make([]byte, len(b))
+	for i, c := range b {
+		if c < 0x20 || c > 0x7e {
+			c = '.'
+		}
+		s[i] = c
+	}
+	return string(s)
+}
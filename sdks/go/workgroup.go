@@ -0,0 +1,166 @@
+package xtrieve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// WorkGroup spreads jobs over a fixed set of workers, each with its own
+// File, with errgroup semantics: the first failing job cancels the group,
+// the jobs not yet started are skipped, and Wait returns the errors of
+// every job that failed.
+//
+//	g := pool.WorkGroup(ctx, "orders.dat", 0, 8)
+//	for _, rec := range records {
+//	    key := rec[:8]
+//	    if g.GoOrdered(key, func(f *xtrieve.File) error { return apply(f, rec) }) != nil {
+//	        break // the group failed
+//	    }
+//	}
+//	err := g.Wait()
+type WorkGroup struct {
+	parent context.Context
+	ctx    context.Context
+	cancel context.CancelFunc
+	open   func() (*File, error)
+	// finish, if set, runs on each worker's file after its last job;
+	// failed reports whether the group was canceled
+	finish func(f *File, failed bool) error
+
+	shared chan func(*File) error
+	queues []chan func(*File) error
+	wg     sync.WaitGroup
+
+	mu   sync.Mutex
+	errs []error
+}
+
+// NewWorkGroup starts workers (at least one) that each open a File with
+// open and run the jobs submitted to the group
+func NewWorkGroup(ctx context.Context, workers int, open func() (*File, error)) *WorkGroup {
+	return newWorkGroup(ctx, workers, open, nil)
+}
+
+func newWorkGroup(ctx context.Context, workers int, open func() (*File, error), finish func(*File, bool) error) *WorkGroup {
+	workers = max(workers, 1)
+	g := &WorkGroup{parent: ctx, open: open, finish: finish, shared: make(chan func(*File) error)}
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	for i := 0; i < workers; i++ {
+		q := make(chan func(*File) error, 16)
+		g.queues = append(g.queues, q)
+		g.wg.Add(1)
+		go g.work(q)
+	}
+	return g
+}
+
+// WorkGroup starts workers that each open path through the pool, so the
+// work is spread over the pool's connections
+func (p *Pool) WorkGroup(ctx context.Context, path string, mode int16, workers int) *WorkGroup {
+	return NewWorkGroup(ctx, workers, func() (*File, error) {
+		return p.OpenFile(path, mode)
+	})
+}
+
+// Context returns the group's context, which is canceled when a job fails
+// or Wait returns
+func (g *WorkGroup) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs job on the next idle worker. It blocks until a worker takes the
+// job and returns the context's error once the group has been canceled.
+func (g *WorkGroup) Go(job func(f *File) error) error {
+	select {
+	case g.shared <- job:
+		return nil
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+}
+
+// GoOrdered runs job on the worker that owns key: jobs with equal keys run
+// one after another in the order they were submitted
+func (g *WorkGroup) GoOrdered(key []byte, job func(f *File) error) error {
+	h := fnv.New32a()
+	h.Write(key)
+	q := g.queues[h.Sum32()%uint32(len(g.queues))]
+	select {
+	case q <- job:
+		return nil
+	case <-g.ctx.Done():
+		return g.ctx.Err()
+	}
+}
+
+// Wait waits for the submitted jobs, closes the workers' files and returns
+// the errors of the failed jobs joined, or the parent context's error if
+// it canceled the group. Go must not be called after Wait.
+func (g *WorkGroup) Wait() error {
+	close(g.shared)
+	for _, q := range g.queues {
+		close(q)
+	}
+	g.wg.Wait()
+	g.cancel()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.errs) == 0 {
+		return g.parent.Err()
+	}
+	return errors.Join(g.errs...)
+}
+
+// work runs the jobs of the shared queue and of the worker's own queue
+// until both are closed. Once the group is canceled, the remaining jobs
+// are drained without running them.
+func (g *WorkGroup) work(own chan func(*File) error) {
+	defer g.wg.Done()
+	f, err := g.open()
+	if err != nil {
+		g.fail(fmt.Errorf("open: %w", err))
+	} else {
+		defer f.Close()
+	}
+
+	shared := g.shared
+	for shared != nil || own != nil {
+		var job func(*File) error
+		var ok bool
+		select {
+		case job, ok = <-shared:
+			if !ok {
+				shared = nil
+				continue
+			}
+		case job, ok = <-own:
+			if !ok {
+				own = nil
+				continue
+			}
+		}
+		if f == nil || g.ctx.Err() != nil {
+			continue
+		}
+		if err := job(f); err != nil {
+			g.fail(err)
+		}
+	}
+	if f != nil && g.finish != nil {
+		if err := g.finish(f, g.ctx.Err() != nil); err != nil {
+			g.fail(err)
+		}
+	}
+}
+
+// fail records a job's error and cancels the group
+func (g *WorkGroup) fail(err error) {
+	g.mu.Lock()
+	g.errs = append(g.errs, err)
+	g.mu.Unlock()
+	g.cancel()
+}
@@ -0,0 +1,108 @@
+package xtrieve
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+)
+
+// EncodeUTF16LE encodes s as UTF-16LE, the encoding of WSTRING and
+// WZSTRING fields
+func EncodeUTF16LE(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(units))
+	for i, u := range units {
+		binary.LittleEndian.PutUint16(b[2*i:], u)
+	}
+	return b
+}
+
+// DecodeUTF16LE decodes UTF-16LE bytes. A trailing odd byte is ignored.
+func DecodeUTF16LE(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+// WStringKey returns s as a WSTRING key segment of length bytes, padded
+// with spaces the way the field is stored. Use it to build search keys.
+func WStringKey(s string, length int) ([]byte, error) {
+	b := make([]byte, length)
+	return b, putUTF16(b, s, ' ')
+}
+
+// WZStringKey returns s as a null-terminated WZSTRING key segment of
+// length bytes
+func WZStringKey(s string, length int) ([]byte, error) {
+	b := make([]byte, length)
+	return b, putUTF16(b, s, 0)
+}
+
+// putUTF16 fills b with s in UTF-16LE followed by pad units. A zero pad
+// requires room for the terminator.
+func putUTF16(b []byte, s string, pad rune) error {
+	if len(b)%2 != 0 {
+		return fmt.Errorf("wide string length %d is odd", len(b))
+	}
+	encoded := EncodeUTF16LE(s)
+	limit := len(b)
+	if pad == 0 {
+		limit -= 2
+	}
+	if len(encoded) > limit {
+		return fmt.Errorf("value longer than %d bytes", limit)
+	}
+	n := copy(b, encoded)
+	for i := n; i+1 < len(b); i += 2 {
+		binary.LittleEndian.PutUint16(b[i:], uint16(pad))
+	}
+	return nil
+}
+
+// trimUTF16 cuts b at the first zero unit and, for a space pad, drops
+// trailing spaces
+func trimUTF16(b []byte, pad rune) []byte {
+	b = b[:len(b)&^1]
+	for i := 0; i < len(b); i += 2 {
+		if b[i] == 0 && b[i+1] == 0 {
+			b = b[:i]
+			break
+		}
+	}
+	for pad != 0 && len(b) >= 2 && binary.LittleEndian.Uint16(b[len(b)-2:]) == uint16(pad) {
+		b = b[:len(b)-2]
+	}
+	return b
+}
+
+// compareUTF16 compares wide strings by UTF-16 code unit, folding ASCII
+// letters to upper case if noCase is set
+func compareUTF16(a, b []byte, noCase bool) int {
+	for i := 0; i+1 < len(a) && i+1 < len(b); i += 2 {
+		ua, ub := binary.LittleEndian.Uint16(a[i:]), binary.LittleEndian.Uint16(b[i:])
+		if noCase {
+			ua, ub = upperUTF16(ua), upperUTF16(ub)
+		}
+		if c := cmp.Compare(ua, ub); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// foldUpperUTF16 upper-cases ASCII letters of UTF-16LE text in place
+func foldUpperUTF16(b []byte) {
+	for i := 0; i+1 < len(b); i += 2 {
+		binary.LittleEndian.PutUint16(b[i:], upperUTF16(binary.LittleEndian.Uint16(b[i:])))
+	}
+}
+
+func upperUTF16(u uint16) uint16 {
+	if 'a' <= u && u <= 'z' {
+		return u - 'a' + 'A'
+	}
+	return u
+}
@@ -0,0 +1,108 @@
+package xtrieve
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUTF16LE(t *testing.T) {
+	tests := []struct {
+		s   string
+		raw []byte
+	}{
+		{"", []byte{}},
+		{"Ab", []byte{'A', 0, 'b', 0}},
+		{"é", []byte{0xE9, 0}},
+		{"€", []byte{0xAC, 0x20}},
+		{"😀", []byte{0x3D, 0xD8, 0x00, 0xDE}}, // surrogate pair
+	}
+	for _, tt := range tests {
+		if got := EncodeUTF16LE(tt.s); !bytes.Equal(got, tt.raw) {
+			t.Errorf("EncodeUTF16LE(%q) = %x, want %x", tt.s, got, tt.raw)
+		}
+		if got := DecodeUTF16LE(tt.raw); got != tt.s {
+			t.Errorf("DecodeUTF16LE(%x) = %q, want %q", tt.raw, got, tt.s)
+		}
+	}
+	if got := DecodeUTF16LE([]byte{'A', 0, 'B'}); got != "A" {
+		t.Errorf("DecodeUTF16LE with an odd byte = %q, want A", got)
+	}
+}
+
+func TestWStringKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		fn     func(string, int) ([]byte, error)
+		s      string
+		length int
+		want   []byte // nil for an error
+	}{
+		{"WStringKey", WStringKey, "ab", 8, []byte{'a', 0, 'b', 0, ' ', 0, ' ', 0}},
+		{"WStringKey", WStringKey, "abcd", 8, []byte{'a', 0, 'b', 0, 'c', 0, 'd', 0}},
+		{"WStringKey", WStringKey, "abcde", 8, nil},
+		{"WStringKey", WStringKey, "a", 3, nil},
+		{"WZStringKey", WZStringKey, "ab", 8, []byte{'a', 0, 'b', 0, 0, 0, 0, 0}},
+		{"WZStringKey", WZStringKey, "abc", 8, []byte{'a', 0, 'b', 0, 'c', 0, 0, 0}},
+		{"WZStringKey", WZStringKey, "abcd", 8, nil}, // no room for the terminator
+		{"WZStringKey", WZStringKey, "", 2, []byte{0, 0}},
+	}
+	for _, tt := range tests {
+		got, err := tt.fn(tt.s, tt.length)
+		switch {
+		case tt.want == nil && err == nil:
+			t.Errorf("%s(%q, %d) = %x, want an error", tt.name, tt.s, tt.length, got)
+		case tt.want != nil && (err != nil || !bytes.Equal(got, tt.want)):
+			t.Errorf("%s(%q, %d) = %x, %v, want %x", tt.name, tt.s, tt.length, got, err, tt.want)
+		}
+	}
+}
+
+func TestTrimUTF16(t *testing.T) {
+	tests := []struct {
+		raw  []byte
+		pad  rune
+		want []byte
+	}{
+		{[]byte{'a', 0, ' ', 0, ' ', 0}, ' ', []byte{'a', 0}},
+		{[]byte{'a', 0, ' ', 0, ' ', 0}, 0, []byte{'a', 0, ' ', 0, ' ', 0}},
+		{[]byte{'a', 0, 0, 0, 'b', 0}, 0, []byte{'a', 0}},
+		{[]byte{'a', 0, 0, 0, 'b', 0}, ' ', []byte{'a', 0}},
+		{[]byte{0, 'a', ' ', 0}, ' ', []byte{0, 'a'}}, // U+6100 is not a terminator
+		{[]byte{'a', 0, 'b'}, 0, []byte{'a', 0}},
+		{[]byte{' ', 0}, ' ', []byte{}},
+	}
+	for _, tt := range tests {
+		if got := trimUTF16(append([]byte(nil), tt.raw...), tt.pad); !bytes.Equal(got, tt.want) {
+			t.Errorf("trimUTF16(%x, %q) = %x, want %x", tt.raw, tt.pad, got, tt.want)
+		}
+	}
+}
+
+func TestCompareUTF16(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		noCase bool
+		want   int
+	}{
+		{"abc", "abc", false, 0},
+		{"abc", "abd", false, -1},
+		{"abc", "ABC", false, 1},
+		{"abc", "ABC", true, 0},
+		{"abc", "ABD", true, -1},
+		{"ab", "abc", false, -1},
+		{"é", "É", true, 1}, // only ASCII letters fold
+		{"z", "é", false, -1},
+		// By code unit, a surrogate (0xD83D) sorts before U+FF21 although
+		// the code point is higher
+		{"😀", "Ａ", false, -1},
+	}
+	for _, tt := range tests {
+		a, b := EncodeUTF16LE(tt.a), EncodeUTF16LE(tt.b)
+		if got := compareUTF16(a, b, tt.noCase); got != tt.want {
+			t.Errorf("compareUTF16(%q, %q, %v) = %d, want %d", tt.a, tt.b, tt.noCase, got, tt.want)
+		}
+		if got := compareUTF16(b, a, tt.noCase); got != -tt.want {
+			t.Errorf("compareUTF16(%q, %q, %v) = %d, want %d", tt.b, tt.a, tt.noCase, got, -tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package xtrieve
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// XMLExport renders records as an XML document driven by a schema: one
+// element per record with one child element per field.
+//
+//	export := &xtrieve.XMLExport{
+//	    Schema:   schema,
+//	    Root:     "Invoices",
+//	    Record:   "Invoice",
+//	    Elements: map[string]string{"inv_no": "InvoiceNumber", "amt": "Amount"},
+//	    Scale:    map[string]int{"amt": 2},
+//	}
+//	n, err := export.Write(ctx, w, f.Scan(0))
+type XMLExport struct {
+	Schema *Schema
+	// Root and Record are the names of the document element and of each
+	// record's element (default "records" and "record")
+	Root   string
+	Record string
+	// Fields lists the fields to export, in order (default all, in
+	// schema order)
+	Fields []string
+	// Elements maps field names to element names; other fields use their
+	// own name
+	Elements map[string]string
+	// DateFormat and TimeFormat are time layouts for date and time fields
+	// (default 2006-01-02 and 15:04:05). Empty dates are empty elements.
+	DateFormat string
+	TimeFormat string
+	// Scale sets the number of decimal places of a numeric field. Zoned
+	// and packed decimal fields hold unscaled digits and default to the
+	// field's Scale (2 for MONEY). Float fields without a scale use the
+	// fewest digits needed.
+	Scale map[string]int
+	// Indent, if set, pretty-prints the document
+	Indent string
+	// Progress, if set, receives progress reports
+	Progress Progress
+}
+
+// Write streams the records of it to w as one document and returns the
+// number of records written. It stops when ctx is cancelled, leaving the
+// document unfinished.
+func (e *XMLExport) Write(ctx context.Context, w io.Writer, it RecordIterator) (int, error) {
+	if e.Schema == nil {
+		return 0, errors.New("xtrieve: XMLExport needs a Schema")
+	}
+	fields, err := e.fields()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return 0, err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", e.Indent)
+	root := xml.StartElement{Name: xml.Name{Local: defaultString(e.Root, "records")}}
+	record := xml.StartElement{Name: xml.Name{Local: defaultString(e.Record, "record")}}
+	if err := enc.EncodeToken(root); err != nil {
+		return 0, err
+	}
+
+	format := exportFormat{dates: e.DateFormat, times: e.TimeFormat, scales: e.Scale}
+	tracker := newProgressTracker(e.Progress, 0)
+	n := 0
+	for it.Next() {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		rec := it.Record()
+		if err := enc.EncodeToken(record); err != nil {
+			return n, err
+		}
+		for _, f := range fields {
+			text, err := format.field(e.Schema, f, rec)
+			if err != nil {
+				return n, err
+			}
+			name := f.Name
+			if element, ok := e.Elements[f.Name]; ok {
+				name = element
+			}
+			if err := enc.EncodeElement(text, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+				return n, err
+			}
+		}
+		if err := enc.EncodeToken(record.End()); err != nil {
+			return n, err
+		}
+		n++
+		tracker.add(1, len(rec))
+	}
+	if err := it.Err(); err != nil {
+		return n, err
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return n, err
+	}
+	if err := enc.Flush(); err != nil {
+		return n, err
+	}
+	tracker.done()
+	return n, nil
+}
+
+// fields resolves the exported fields
+func (e *XMLExport) fields() ([]Field, error) {
+	return exportFields(e.Schema, e.Fields)
+}
+
+// exportFields resolves the named fields of an export, or all of them
+func exportFields(schema *Schema, names []string) ([]Field, error) {
+	if len(names) == 0 {
+		return schema.Fields, nil
+	}
+	fields := make([]Field, 0, len(names))
+	for _, name := range names {
+		f, ok := schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("xtrieve: unknown field %q", name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// exportFormat holds the date and time layouts and the decimal places of
+// numeric fields of a text export
+type exportFormat struct {
+	dates, times string
+	scales       map[string]int
+}
+
+// field renders a field of a record as text
+func (x exportFormat) field(schema *Schema, f Field, record []byte) (string, error) {
+	v, err := schema.decode(f, record)
+	if err != nil {
+		return "", err
+	}
+	return x.value(f.Name, v), nil
+}
+
+// value renders a decoded value of the named field as text. Nulls and
+// empty dates are empty.
+func (x exportFormat) value(name string, v any) string {
+	scale, scaled := x.scales[name]
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(defaultString(x.dates, time.DateOnly))
+	case time.Duration:
+		midnight := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		return midnight.Add(v).Format(defaultString(x.times, time.TimeOnly))
+	case float64:
+		if !scaled {
+			scale = -1
+		}
+		return strconv.FormatFloat(v, 'f', scale, 64)
+	case int64, uint64:
+		if !scaled {
+			return fmt.Sprint(v)
+		}
+		n, _ := new(big.Int).SetString(fmt.Sprint(v), 10)
+		return formatScaled(n, scale)
+	case bool:
+		return strconv.FormatBool(v)
+	case FixedPoint:
+		if !scaled {
+			return v.String()
+		}
+		return formatScaled(big.NewInt(v.Units()), scale)
+	case []byte:
+		return hex.EncodeToString(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// formatScaled renders an unscaled integer with scale decimal places
+func formatScaled(n *big.Int, scale int) string {
+	if scale <= 0 {
+		return n.String()
+	}
+	return new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)).FloatString(scale)
+}
+
+func defaultString(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
@@ -2,12 +2,17 @@
 package xtrieve
 
 import (
+	"bufio"
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Constants
@@ -34,14 +39,26 @@ const (
 	OpGetLast          = 13
 	OpCreate           = 14
 	OpStat             = 15
+	OpExtend           = 16
 	OpBeginTransaction = 19
 	OpEndTransaction   = 20
 	OpAbortTransaction = 21
+	OpGetPosition      = 22
+	OpGetDirect        = 23
 	OpStepNext         = 24
+	OpVersion          = 26
 	OpUnlock           = 27
+	OpSetOwner         = 29
+	OpClearOwner       = 30
 	OpStepFirst        = 33
 	OpStepLast         = 34
 	OpStepPrevious     = 35
+	OpGetNextExtended  = 36
+	OpGetPrevExtended  = 37
+	OpStepNextExtended = 38
+	OpStepPrevExtended = 39
+	OpGetByPercentage  = 44
+	OpFindPercentage   = 45
 )
 
 // Status codes
@@ -58,7 +75,13 @@ const (
 	StatusEndOfFile         = 9
 	StatusFileNotFound      = 12
 	StatusDiskFull          = 18
+	StatusTransactionActive = 36
 	StatusDataBufferTooShort = 22
+	StatusOwnerAlreadySet   = 49
+	StatusInvalidOwner      = 50
+	StatusRejectCountReached = 60
+	StatusDescriptorError   = 62
+	StatusFilterLimitReached = 64
 	StatusRecordLocked      = 84
 	StatusFileLocked        = 85
 )
@@ -88,6 +111,11 @@ const (
 	KeyTypeZstring       = 11
 	KeyTypeUnsignedBinary = 14
 	KeyTypeAutoincrement = 15
+	KeyTypeNumericSA     = 18
+	KeyTypeNumericSTS    = 19
+	KeyTypeWString       = 25
+	KeyTypeWZstring      = 26
+	KeyTypeNullIndicator = 255
 )
 
 // Key flags
@@ -97,9 +125,12 @@ const (
 	KeyFlagBinary       = 0x0004
 	KeyFlagNullKey      = 0x0008
 	KeyFlagSegmented    = 0x0010
-	KeyFlagDescending   = 0x0020
-	KeyFlagSupplemental = 0x0040
-	KeyFlagExtendedType = 0x0080
+	KeyFlagAltSequence  = 0x0020
+	KeyFlagDescending   = 0x0040
+	KeyFlagSupplemental = 0x0080
+	KeyFlagExtendedType = 0x0100
+	KeyFlagManual       = 0x0200
+	KeyFlagNoCase       = 0x0400
 )
 
 // Request represents a Btrieve request
@@ -135,23 +166,131 @@ type FileSpec struct {
 	RecordLength uint16
 	PageSize     uint16
 	Keys         []KeySpec
+	// Flags is a combination of FileFlag constants
+	Flags uint16
+	// Preallocation is the number of pages to allocate when
+	// FileFlagPreallocate is set. xtrieved ignores it, and Flags.
+	Preallocation uint16
 }
 
 // Client represents a connection to an Xtrieve server
 type Client struct {
 	conn  net.Conn
+	addr  string
+	dial  dialFunc
+	// backoff retries Reconnect; the zero value makes one attempt
+	backoff Backoff
+	// timeout limits each operation; zero means none
+	timeout time.Duration
+	// classTimeouts replace timeout for their OpClass when set
+	classTimeouts [classCount]time.Duration
+	// deadline is set while the connection has a deadline armed
+	deadline bool
+	// budget caps scans and operation sizes; see SetBudget
+	budget Budget
+	// scans counts the iterators in progress
+	scans atomic.Int32
+	// noPercentage is set once the server rejected percentage positioning
+	noPercentage atomic.Bool
+	// debug tracks the operation in flight, open files and recent
+	// errors; see Debug
+	debug debugState
 	mu    sync.Mutex
+
+	profileLabels bool
+	stats         clientStats
+	logger        atomic.Pointer[slog.Logger]
+	logSchemas    map[string]*Schema
+	// interceptors wrap every operation; see Use
+	interceptors []Interceptor
+	// strict rejects malformed responses; see SetStrict
+	strict bool
+	// trace receives a dump of every frame; see WithWireTrace
+	trace io.Writer
+	// watchdog tracks transactions and record locks; see NewWatchdog
+	watchdog atomic.Pointer[Watchdog]
+	// latency, set for pooled connections, measures their server
+	latency *latencyTracker
+	// broken is set when a cancelled operation left a response unread or
+	// a pool retired the connection; the next operation dials a fresh one
+	broken bool
+	// redials counts the failed dials since the connection broke; no dial
+	// is tried before redialAt, and redialErr is the last failure
+	redials   int
+	redialAt  time.Time
+	redialErr error
+	// connected and lastUsed (unix nanoseconds) drive pool maintenance
+	connected time.Time
+	lastUsed  atomic.Int64
+
+	// Wire buffers reused by every operation, guarded by mu
+	r     *bufio.Reader
+	whead [requestHeaderSize]byte
+	wtail []byte
+	wbuf  []byte
+	vec   [3][]byte
+	bufs  net.Buffers
+	rhead [responseHeaderSize]byte
 }
 
+const (
+	// requestHeaderSize covers operation, position block and data length
+	requestHeaderSize = 2 + PositionBlockSize + 4
+	// responseHeaderSize covers status, position block and data length
+	responseHeaderSize = 2 + PositionBlockSize + 4
+	// readBufferSize is the size of the buffered connection reader
+	readBufferSize = 16 << 10
+)
+
 // Connect creates a new client and connects to the server
 func Connect(host string, port int) (*Client, error) {
-	addr := fmt.Sprintf("%s:%d", host, port)
-	conn, err := net.Dial("tcp", addr)
+	return Dial(net.JoinHostPort(host, strconv.Itoa(port)))
+}
+
+// Dial creates a new client for an address:
+//
+//	host:port or tcp://host:port   TCP
+//	npipe://./pipe/xtrieve         Windows named pipe \\.\pipe\xtrieve
+//
+// Named pipes are opened for synchronous I/O, which takes no deadlines:
+// operation timeouts and ExecuteContext cancellation do not apply to them.
+// xtrieved listens on TCP only; pipes need a server that serves them.
+func Dial(address string) (*Client, error) {
+	dial, err := dialer(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dial(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect: %w", err)
 	}
 
-	return &Client{conn: conn}, nil
+	return newClient(conn, address, dial), nil
+}
+
+// newClient wraps a fresh connection
+func newClient(conn net.Conn, address string, dial dialFunc) *Client {
+	c := &Client{conn: conn, addr: address, dial: dial, r: bufio.NewReaderSize(conn, readBufferSize)}
+	c.connected = time.Now()
+	c.stats.since = c.connected
+	c.lastUsed.Store(c.connected.UnixNano())
+	return c
+}
+
+// dialer returns a function connecting to address
+func dialer(address string) (dialFunc, error) {
+	return dialerWith(address, DialOptions{})
+}
+
+// Reconnect drops the current connection and dials the server again,
+// retrying with the backoff given to DialContext for up to a minute; use
+// ReconnectContext for another limit. Server-side state tied to the
+// connection is lost; xtrieved keeps open files, locks and transactions
+// with the position blocks, so they survive.
+func (c *Client) Reconnect() error {
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	return c.ReconnectContext(ctx)
 }
 
 // Close closes the connection
@@ -164,28 +303,202 @@ func (c *Client) Close() error {
 
 // Execute executes a Btrieve operation
 func (c *Client) Execute(req *Request) (*Response, error) {
+	return c.execute(req, nil)
+}
+
+// ExecuteInto executes a Btrieve operation and decodes the response into
+// resp, reusing the capacity of its PositionBlock, DataBuffer and KeyBuffer.
+// With buffers that are large enough a call makes no allocations, which
+// suits tight loops that process each record before reading the next.
+func (c *Client) ExecuteInto(req *Request, resp *Response) error {
+	return c.executeInto(context.Background(), req, resp)
+}
+
+// executeInto runs a request under ctx through the client's interceptors,
+// then logs and instruments it
+func (c *Client) executeInto(ctx context.Context, req *Request, resp *Response) error {
+	if len(c.interceptors) > 0 {
+		return c.intercept(ctx, req, resp, 0)
+	}
+	return c.observe(ctx, req, resp)
+}
+
+// observe runs a request, logged when the client has a logger
+func (c *Client) observe(ctx context.Context, req *Request, resp *Response) error {
+	if logger := c.logger.Load(); logger != nil {
+		return c.logged(ctx, logger, req, resp)
+	}
+	return c.instrumented(ctx, req, resp)
+}
+
+// instrumented runs a request, profiled when profiling is enabled, and
+// counts it in the client's statistics
+func (c *Client) instrumented(ctx context.Context, req *Request, resp *Response) error {
+	var err error
+	start := time.Now()
+	if c.profileLabels || opStats.Load() != nil {
+		err = c.profiled(ctx, req, resp)
+	} else {
+		err = c.roundTrip(ctx, req, resp)
+	}
+	elapsed := time.Since(start)
+	c.stats.record(req, resp, err, elapsed)
+	c.debug.record(req, resp, err)
+	if c.latency != nil {
+		c.latency.observe(elapsed, err != nil)
+	}
+	if w := c.watchdog.Load(); w != nil {
+		w.observe(req, resp, err)
+	}
+	return err
+}
+
+// execute executes a Btrieve operation. When posBlock is non-nil the
+// response position block is decoded into it instead of a fresh allocation.
+func (c *Client) execute(req *Request, posBlock []byte) (*Response, error) {
+	return c.executeWith(context.Background(), req, posBlock)
+}
+
+// executeWith is execute under ctx, see ExecuteContext
+func (c *Client) executeWith(ctx context.Context, req *Request, posBlock []byte) (*Response, error) {
+	resp := &Response{PositionBlock: posBlock}
+	if err := c.executeInto(ctx, req, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// roundTrip sends one request and reads its response, giving up when ctx
+// is done
+func (c *Client) roundTrip(ctx context.Context, req *Request, resp *Response) error {
+	if slot, ok := ctx.Value(pipelineKey{}).(*pipelineSlot); ok && !slot.used {
+		return slot.wait(ctx, req, resp)
+	}
+	c.debug.inFlight.Add(1)
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.debug.begin(req)
+	defer c.debug.end()
 
-	if c.conn == nil {
-		return nil, errors.New("not connected")
+	if c.budget.MaxOperationBytes > 0 && len(req.DataBuffer) > c.budget.MaxOperationBytes {
+		return c.overBudget(req.Operation, len(req.DataBuffer))
+	}
+	if ctx.Done() != nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if err := c.ready(ctx); err != nil {
+		return err
+	}
+	c.lastUsed.Store(time.Now().UnixNano())
+	timeout := c.timeoutFor(OpClassOf(req.Operation))
+	c.startDeadline(timeout)
+	if ctx.Done() != nil {
+		return c.exchangeContext(ctx, req, resp, timeout)
+	}
+	return c.checkTimeout(c.exchange(req, resp), timeout)
+}
+
+// exchange writes a request and reads its response. The caller holds c.mu.
+func (c *Client) exchange(req *Request, resp *Response) error {
+	if c.trace != nil {
+		c.traceRequest(req)
+	}
+	if err := c.send(req); err != nil {
+		return err
 	}
+	err := c.readResponse(resp)
+	if c.trace != nil {
+		c.traceResponse(req.Operation, resp, err)
+	}
+	if c.strict {
+		err = c.checkResponse(req, resp, err, true)
+	}
+	if err == nil && c.budget.MaxOperationBytes > 0 && len(resp.DataBuffer) > c.budget.MaxOperationBytes {
+		return c.overBudget(req.Operation, len(resp.DataBuffer))
+	}
+	return err
+}
 
-	// Build request
-	packet := c.buildRequest(req)
+// send writes the fixed header, the data buffer and the trailer as one
+// vectored write, without copying the data buffer. The caller holds c.mu.
+func (c *Client) send(req *Request) error {
+	c.encodeHeader(req)
+	c.wtail = appendTrailer(c.wtail[:0], req)
+	c.vec = [3][]byte{c.whead[:], req.DataBuffer, c.wtail}
+	c.bufs = c.vec[:]
+	_, err := c.bufs.WriteTo(c.conn)
+	c.vec = [3][]byte{} // do not keep the caller's data buffer alive
+	if err != nil {
+		return fmt.Errorf("send failed: %w", err)
+	}
+	return nil
+}
 
-	// Send request
-	if _, err := c.conn.Write(packet); err != nil {
-		return nil, fmt.Errorf("send failed: %w", err)
+// pipeline sends several requests back to back and then reads their
+// responses, so the whole sequence costs a single round trip. The server
+// answers requests on a connection strictly in order.
+func (c *Client) pipeline(reqs []*Request) ([]*Response, error) {
+	c.debug.inFlight.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.debug.begin(reqs[0])
+	defer c.debug.end()
+
+	if c.budget.MaxOperationBytes > 0 {
+		for _, req := range reqs {
+			if len(req.DataBuffer) > c.budget.MaxOperationBytes {
+				return nil, c.overBudget(req.Operation, len(req.DataBuffer))
+			}
+		}
+	}
+	if err := c.ready(context.Background()); err != nil {
+		return nil, err
+	}
+	c.lastUsed.Store(time.Now().UnixNano())
+	timeout := c.timeoutFor(ClassBulk)
+	c.startDeadline(timeout)
+
+	c.wbuf = c.wbuf[:0]
+	for _, req := range reqs {
+		if c.trace != nil {
+			c.traceRequest(req)
+		}
+		c.encodeHeader(req)
+		c.wbuf = append(c.wbuf, c.whead[:]...)
+		c.wbuf = append(c.wbuf, req.DataBuffer...)
+		c.wbuf = appendTrailer(c.wbuf, req)
+	}
+	if _, err := c.conn.Write(c.wbuf); err != nil {
+		return nil, c.checkTimeout(fmt.Errorf("send failed: %w", err), timeout)
 	}
 
-	// Read response
-	return c.readResponse()
+	resps := make([]*Response, len(reqs))
+	for i := range reqs {
+		resps[i] = &Response{}
+		err := c.readResponse(resps[i])
+		if c.trace != nil {
+			c.traceResponse(reqs[i].Operation, resps[i], err)
+		}
+		if c.strict {
+			err = c.checkResponse(reqs[i], resps[i], err, i == len(reqs)-1)
+		}
+		if err != nil {
+			return nil, c.checkTimeout(err, timeout)
+		}
+		if c.budget.MaxOperationBytes > 0 && len(resps[i].DataBuffer) > c.budget.MaxOperationBytes {
+			// The responses after it are still on the wire
+			c.broken = true
+			return nil, c.overBudget(reqs[i].Operation, len(resps[i].DataBuffer))
+		}
+	}
+	return resps, nil
 }
 
 // BuildFileSpec creates a file specification buffer for Create operation
 func BuildFileSpec(spec *FileSpec) []byte {
-	headerSize := 10
+	headerSize := 16
 	keySpecSize := 16
 	buf := make([]byte, headerSize+len(spec.Keys)*keySpecSize)
 
@@ -193,17 +506,21 @@ func BuildFileSpec(spec *FileSpec) []byte {
 	binary.LittleEndian.PutUint16(buf[0:], spec.RecordLength)
 	binary.LittleEndian.PutUint16(buf[2:], spec.PageSize)
 	binary.LittleEndian.PutUint16(buf[4:], uint16(len(spec.Keys)))
-	// bytes 6-9 reserved (zero)
+	// bytes 6-7 unused
+	binary.LittleEndian.PutUint16(buf[8:], spec.Flags)
+	// bytes 10-13 reserved
+	binary.LittleEndian.PutUint16(buf[14:], spec.Preallocation)
 
-	// Key specs
+	// Key specs, laid out as Stat returns them
 	for i, key := range spec.Keys {
 		offset := headerSize + i*keySpecSize
 		binary.LittleEndian.PutUint16(buf[offset:], key.Position)
 		binary.LittleEndian.PutUint16(buf[offset+2:], key.Length)
 		binary.LittleEndian.PutUint16(buf[offset+4:], key.Flags)
-		buf[offset+6] = key.Type
-		buf[offset+7] = key.NullValue
-		// bytes 8-15 reserved (zero)
+		// bytes 6-9 unique count (returned by Stat only)
+		buf[offset+10] = key.Type
+		buf[offset+11] = key.NullValue
+		// bytes 12-15 reserved
 	}
 
 	return buf
@@ -228,7 +545,8 @@ func (c *Client) CloseFile(positionBlock []byte) (*Response, error) {
 	})
 }
 
-// Create creates a new file
+// Create creates a new file. The server may not keep all of spec; compare
+// the new file's Stat with it using FileStat.Diff.
 func (c *Client) Create(filePath string, spec *FileSpec) (*Response, error) {
 	return c.Execute(&Request{
 		Operation:  OpCreate,
@@ -237,6 +555,14 @@ func (c *Client) Create(filePath string, spec *FileSpec) (*Response, error) {
 	})
 }
 
+// Stat retrieves file and key attributes of an open file
+func (c *Client) Stat(positionBlock []byte) (*Response, error) {
+	return c.Execute(&Request{
+		Operation:     OpStat,
+		PositionBlock: positionBlock,
+	})
+}
+
 // Insert inserts a record
 func (c *Client) Insert(positionBlock []byte, data []byte) (*Response, error) {
 	return c.Execute(&Request{
@@ -361,94 +687,79 @@ func (c *Client) ForEach(positionBlock []byte, keyNumber int16, fn func(record,
 
 // ========== Private Methods ==========
 
-func (c *Client) buildRequest(req *Request) []byte {
-	posBlock := make([]byte, PositionBlockSize)
-	if len(req.PositionBlock) > 0 {
-		copy(posBlock, req.PositionBlock)
-	}
-
-	filePathBytes := []byte(req.FilePath)
-
-	// Calculate total size
-	totalSize := 2 + PositionBlockSize + 4 + len(req.DataBuffer) +
-		2 + len(req.KeyBuffer) + 2 + 2 + len(filePathBytes) + 2
-
-	buf := make([]byte, totalSize)
-	offset := 0
-
+// encodeHeader writes operation, position block and data length
+func (c *Client) encodeHeader(req *Request) {
 	// Operation (2 bytes)
-	binary.LittleEndian.PutUint16(buf[offset:], req.Operation)
-	offset += 2
+	binary.LittleEndian.PutUint16(c.whead[0:], req.Operation)
 
-	// Position block (128 bytes)
-	copy(buf[offset:], posBlock)
-	offset += PositionBlockSize
+	// Position block (128 bytes, zero-filled if shorter)
+	n := copy(c.whead[2:2+PositionBlockSize], req.PositionBlock)
+	clear(c.whead[2+n : 2+PositionBlockSize])
 
-	// Data buffer length + data
-	binary.LittleEndian.PutUint32(buf[offset:], uint32(len(req.DataBuffer)))
-	offset += 4
-	copy(buf[offset:], req.DataBuffer)
-	offset += len(req.DataBuffer)
+	// Data buffer length; the data itself follows the header
+	binary.LittleEndian.PutUint32(c.whead[2+PositionBlockSize:], uint32(len(req.DataBuffer)))
+}
 
+// appendTrailer appends everything after the data buffer: key, key
+// number, file path and lock bias
+func appendTrailer(buf []byte, req *Request) []byte {
 	// Key buffer length + key
-	binary.LittleEndian.PutUint16(buf[offset:], uint16(len(req.KeyBuffer)))
-	offset += 2
-	copy(buf[offset:], req.KeyBuffer)
-	offset += len(req.KeyBuffer)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(req.KeyBuffer)))
+	buf = append(buf, req.KeyBuffer...)
 
 	// Key number (2 bytes, signed)
-	binary.LittleEndian.PutUint16(buf[offset:], uint16(req.KeyNumber))
-	offset += 2
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(req.KeyNumber))
 
 	// File path length + path
-	binary.LittleEndian.PutUint16(buf[offset:], uint16(len(filePathBytes)))
-	offset += 2
-	copy(buf[offset:], filePathBytes)
-	offset += len(filePathBytes)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(req.FilePath)))
+	buf = append(buf, req.FilePath...)
 
 	// Lock bias
-	binary.LittleEndian.PutUint16(buf[offset:], req.LockBias)
-
-	return buf
+	return binary.LittleEndian.AppendUint16(buf, req.LockBias)
 }
 
-func (c *Client) readResponse() (*Response, error) {
-	resp := &Response{
-		PositionBlock: make([]byte, PositionBlockSize),
-	}
-
+// readResponse decodes a response into resp, reusing its buffers
+func (c *Client) readResponse(resp *Response) error {
 	// Read header: status(2) + position_block(128) + data_len(4)
-	header := make([]byte, 2+PositionBlockSize+4)
-	if _, err := io.ReadFull(c.conn, header); err != nil {
-		return nil, fmt.Errorf("read header failed: %w", err)
+	if _, err := io.ReadFull(c.r, c.rhead[:]); err != nil {
+		return fmt.Errorf("read header failed: %w", err)
 	}
 
-	resp.StatusCode = binary.LittleEndian.Uint16(header[0:])
-	copy(resp.PositionBlock, header[2:2+PositionBlockSize])
-	dataLen := binary.LittleEndian.Uint32(header[2+PositionBlockSize:])
+	resp.StatusCode = binary.LittleEndian.Uint16(c.rhead[0:])
+	resp.PositionBlock = grow(resp.PositionBlock, PositionBlockSize)
+	copy(resp.PositionBlock, c.rhead[2:2+PositionBlockSize])
+	dataLen := binary.LittleEndian.Uint32(c.rhead[2+PositionBlockSize:])
+	if c.strict && dataLen > maxDataLength {
+		// Nothing after the header can be trusted; start over
+		c.broken = true
+		return &ProtocolError{Status: resp.StatusCode, Err: ErrInconsistentLength, Detail: fmt.Sprintf("%d byte data buffer", dataLen)}
+	}
 
 	// Read data buffer
-	if dataLen > 0 {
-		resp.DataBuffer = make([]byte, dataLen)
-		if _, err := io.ReadFull(c.conn, resp.DataBuffer); err != nil {
-			return nil, fmt.Errorf("read data failed: %w", err)
-		}
+	resp.DataBuffer = grow(resp.DataBuffer, int(dataLen))
+	if _, err := io.ReadFull(c.r, resp.DataBuffer); err != nil {
+		return fmt.Errorf("read data failed: %w", err)
 	}
 
 	// Read key length
-	keyLenBuf := make([]byte, 2)
-	if _, err := io.ReadFull(c.conn, keyLenBuf); err != nil {
-		return nil, fmt.Errorf("read key length failed: %w", err)
+	if _, err := io.ReadFull(c.r, c.rhead[:2]); err != nil {
+		return fmt.Errorf("read key length failed: %w", err)
 	}
-	keyLen := binary.LittleEndian.Uint16(keyLenBuf)
+	keyLen := binary.LittleEndian.Uint16(c.rhead[:2])
 
 	// Read key buffer
-	if keyLen > 0 {
-		resp.KeyBuffer = make([]byte, keyLen)
-		if _, err := io.ReadFull(c.conn, resp.KeyBuffer); err != nil {
-			return nil, fmt.Errorf("read key failed: %w", err)
-		}
+	resp.KeyBuffer = grow(resp.KeyBuffer, int(keyLen))
+	if _, err := io.ReadFull(c.r, resp.KeyBuffer); err != nil {
+		return fmt.Errorf("read key failed: %w", err)
 	}
 
-	return resp, nil
+	return nil
+}
+
+// grow returns b resized to n bytes, reusing its capacity when possible
+func grow(b []byte, n int) []byte {
+	if cap(b) >= n {
+		return b[:n]
+	}
+	return make([]byte, n)
 }
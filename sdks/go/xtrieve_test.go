@@ -0,0 +1,259 @@
+package xtrieve
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+// fakeServer answers every request with the same fixed response. It does
+// not allocate per request, so allocation counts measure the client only.
+func fakeServer(tb testing.TB, recordLength, keyLength int) *Client {
+	tb.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { ln.Close() })
+
+	resp := make([]byte, responseHeaderSize+recordLength+2+keyLength)
+	copy(resp[2+positionBlockPathOffset:], "test.dat")
+	binary.LittleEndian.PutUint32(resp[2+PositionBlockSize:], uint32(recordLength))
+	binary.LittleEndian.PutUint16(resp[responseHeaderSize+recordLength:], uint16(keyLength))
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		buf := make([]byte, 64<<10)
+		field := func(n int) []byte {
+			if _, err := io.ReadFull(r, buf[:n]); err != nil {
+				panic(err)
+			}
+			return buf[:n]
+		}
+		for {
+			if _, err := r.Peek(1); err != nil {
+				return
+			}
+			dataLen := binary.LittleEndian.Uint32(field(requestHeaderSize)[2+PositionBlockSize:])
+			field(int(dataLen))
+			field(int(binary.LittleEndian.Uint16(field(2)))) // key
+			field(2)                                         // key number
+			field(int(binary.LittleEndian.Uint16(field(2)))) // path
+			field(2)                                         // lock bias
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	c, err := Connect("127.0.0.1", p)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestExecuteIntoDoesNotAllocate(t *testing.T) {
+	c := fakeServer(t, 100, 8)
+	req := &Request{Operation: OpGetNext, PositionBlock: make([]byte, PositionBlockSize)}
+	resp := &Response{}
+	if err := c.ExecuteInto(req, resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.DataBuffer) != 100 || len(resp.KeyBuffer) != 8 || !hasFileRef(resp.PositionBlock) {
+		t.Fatalf("unexpected response: %d data, %d key bytes", len(resp.DataBuffer), len(resp.KeyBuffer))
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := c.ExecuteInto(req, resp); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ExecuteInto allocated %v times per call, want 0", allocs)
+	}
+}
+
+func TestParseStatRecordCount(t *testing.T) {
+	buf := make([]byte, statHeaderSize+2*statKeySpecSize)
+	binary.LittleEndian.PutUint16(buf[0:], 100)
+	binary.LittleEndian.PutUint16(buf[4:], 2)
+	binary.LittleEndian.PutUint32(buf[6:], 0xFFFFFFFF)
+	stat, err := ParseStat(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.NumRecords != 0xFFFFFFFF || len(stat.Keys) != 2 {
+		t.Fatalf("stat: %d records, %d keys", stat.NumRecords, len(stat.Keys))
+	}
+
+	// Trailing bytes short of a key spec are not a record count
+	buf = binary.LittleEndian.AppendUint64(buf, 5_000_000_000)
+	stat, err = ParseStat(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.NumRecords != 0xFFFFFFFF || len(stat.Keys) != 2 {
+		t.Fatalf("stat with trailing bytes: %d records, %d keys", stat.NumRecords, len(stat.Keys))
+	}
+}
+
+func TestPercentageLargeCounts(t *testing.T) {
+	for _, total := range []uint64{100, 1 << 33, 1 << 63} {
+		if got := PercentageOf(total/2, total); got != MaxPercentage/2 {
+			t.Errorf("PercentageOf(half of %d) = %d", total, got)
+		}
+		if got := PercentageOf(total, total); got != MaxPercentage {
+			t.Errorf("PercentageOf(%d, %d) = %d", total, total, got)
+		}
+		if got := RecordAtPercentage(MaxPercentage/4, total); got != total/4 {
+			t.Errorf("RecordAtPercentage(25%%, %d) = %d, want %d", total, got, total/4)
+		}
+	}
+}
+
+func TestRecordChecksumIgnoresOrder(t *testing.T) {
+	var a, b, c RecordChecksum
+	for _, r := range []string{"one", "two", "two"} {
+		a.Add([]byte(r))
+	}
+	for _, r := range []string{"two", "one", "two"} {
+		b.Add([]byte(r))
+	}
+	for _, r := range []string{"one", "two"} {
+		c.Add([]byte(r))
+	}
+	if a != b {
+		t.Errorf("checksum depends on order: %s != %s", a, b)
+	}
+	if a == c {
+		t.Errorf("checksum ignores a duplicate record")
+	}
+}
+
+func TestAnchoredPrefix(t *testing.T) {
+	for pattern, want := range map[string]string{
+		`^INV-20`:  "INV-20",
+		`INV`:      "",
+		`^ab*c`:    "a",
+		`^a|b`:     "",
+		`^ab|abc`:  "",
+		`(?i)^inv`: "",
+	} {
+		if got := anchoredPrefix(regexp.MustCompile(pattern)); got != want {
+			t.Errorf("anchoredPrefix(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestStructSpec(t *testing.T) {
+	type record struct {
+		ID    int64  `msgpack:"id" xtrieve:"key=0"`
+		Name  string `msgpack:"name" xtrieve:"len=20,key=1,dup"`
+		Since int32  `xtrieve:"key=1"`
+		Notes []string
+	}
+	spec, schema, err := StructSpec(record{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec.RecordLength != 32 || len(schema.Fields) != 3 {
+		t.Fatalf("record length %d with %d fields, want 32 with 3", spec.RecordLength, len(schema.Fields))
+	}
+	want := []KeySpec{
+		{Position: 0, Length: 8, Type: KeyTypeInteger},
+		{Position: 8, Length: 20, Flags: KeyFlagDuplicates | KeyFlagSegmented, Type: KeyTypeString},
+		{Position: 28, Length: 4, Flags: KeyFlagDuplicates, Type: KeyTypeInteger},
+	}
+	for i, k := range spec.Keys {
+		if i >= len(want) || k != want[i] {
+			t.Errorf("key spec %d = %+v, want %+v", i, k, want)
+		}
+	}
+	if f, ok := schema.Field("Since"); !ok || f.Offset != 28 {
+		t.Errorf("field Since = %+v, want offset 28", f)
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	c := fakeServer(b, 100, 8)
+	req := &Request{Operation: OpGetNext, PositionBlock: make([]byte, PositionBlockSize)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := c.Execute(req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecuteInto(b *testing.B) {
+	c := fakeServer(b, 100, 8)
+	req := &Request{Operation: OpGetNext, PositionBlock: make([]byte, PositionBlockSize)}
+	resp := &Response{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := c.ExecuteInto(req, resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	c := fakeServer(b, 0, 0)
+	req := &Request{
+		Operation:     OpInsert,
+		PositionBlock: make([]byte, PositionBlockSize),
+		DataBuffer:    make([]byte, 4096),
+	}
+	resp := &Response{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(req.DataBuffer)))
+	for i := 0; i < b.N; i++ {
+		if err := c.ExecuteInto(req, resp); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestBfloatIsMBF(t *testing.T) {
+	field := Field{Name: "x", Type: KeyTypeBfloat, Length: 4}
+	for x, want := range map[float64]string{
+		0:    "00000000",
+		1:    "00000081",
+		-0.5: "00008080",
+		10:   "00002084",
+	} {
+		record := make([]byte, 4)
+		if err := field.Encode(record, x); err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(record); got != want {
+			t.Errorf("encode %v = %s, want %s", x, got, want)
+		}
+		if got, err := field.Decode(record); err != nil || got != x {
+			t.Errorf("decode %s = %v, %v, want %v", want, got, err, x)
+		}
+	}
+	field.Length = 8
+	record := make([]byte, 8)
+	if err := field.Encode(record, 123.456); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := field.Decode(record); got != 123.456 {
+		t.Errorf("8-byte BFLOAT round trip = %v", got)
+	}
+}